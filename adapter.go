@@ -0,0 +1,114 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+var _ io.WriteCloser = (*levelSplitter)(nil)
+
+type levelSplitter struct {
+	def     io.Writer
+	levelOf func(p []byte) string
+	ws      map[string]io.Writer
+}
+
+// LevelSplitter routes every write to the writer of its level, the writes of the unknown levels go to def.
+// It is for the loggers without the separate writers per level, eg. go-kit log, see LogfmtLevel.
+//
+// hclog and klog support the separate writers themselves, see hclog.NewLeveledWriter and klog.SetOutputBySeverity.
+func LevelSplitter(def io.Writer, levelOf func(p []byte) string) *levelSplitter {
+	return &levelSplitter{
+		def:     def,
+		levelOf: levelOf,
+		ws:      map[string]io.Writer{},
+	}
+}
+
+// Level routes the writes of level to w, the level is case-insensitive.
+func (s *levelSplitter) Level(level string, w io.Writer) *levelSplitter {
+	s.ws[strings.ToLower(level)] = w
+	return s
+}
+
+func (s *levelSplitter) Write(p []byte) (int, error) {
+	if w, ok := s.ws[strings.ToLower(s.levelOf(p))]; ok {
+		return w.Write(p)
+	}
+	return s.def.Write(p)
+}
+
+// Close closes all the writers which are io.Closer, eg. the Rolls.
+func (s *levelSplitter) Close() error {
+	closed := map[io.Writer]bool{}
+	var err error
+	for _, w := range append([]io.Writer{s.def}, s.values()...) {
+		c, ok := w.(io.Closer)
+		if !ok || closed[w] {
+			continue
+		}
+		closed[w] = true
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *levelSplitter) values() []io.Writer {
+	ws := make([]io.Writer, 0, len(s.ws))
+	for _, w := range s.ws {
+		ws = append(ws, w)
+	}
+	return ws
+}
+
+// LogfmtLevel returns the level of a logfmt or JSON record, eg. `level=error msg=...` of go-kit log
+// and `{"level":"error",...}`.
+func LogfmtLevel(p []byte) string {
+	for _, key := range [][]byte{[]byte("level="), []byte(`"level":`)} {
+		i := bytes.Index(p, key)
+		if i < 0 {
+			continue
+		}
+		v := bytes.TrimLeft(p[i+len(key):], ` "`)
+		if end := bytes.IndexAny(v, "\" ,}\n"); end >= 0 {
+			v = v[:end]
+		}
+		return string(v)
+	}
+	return ""
+}
+
+// KlogLevel returns the level of a klog record by its header, eg. "E0601 12:00:00.000000 ..." is "error".
+func KlogLevel(p []byte) string {
+	if len(p) < 5 || p[1] < '0' || p[1] > '9' {
+		return ""
+	}
+	switch p[0] {
+	case 'I':
+		return "info"
+	case 'W':
+		return "warning"
+	case 'E':
+		return "error"
+	case 'F':
+		return "fatal"
+	}
+	return ""
+}
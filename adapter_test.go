@@ -0,0 +1,39 @@
+package rollingf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLevelSplitter(t *testing.T) {
+	var def, errs bytes.Buffer
+	s := LevelSplitter(&def, LogfmtLevel).Level("ERROR", &errs)
+
+	for _, line := range []string{
+		"level=info msg=hello\n",
+		"ts=now level=error msg=boom\n",
+		`{"level":"error","msg":"boom"}` + "\n",
+		"msg=unknown\n",
+	} {
+		s.Write([]byte(line))
+	}
+	if def.String() != "level=info msg=hello\nmsg=unknown\n" {
+		t.Errorf("default: %q", def.String())
+	}
+	if errs.String() != "ts=now level=error msg=boom\n{\"level\":\"error\",\"msg\":\"boom\"}\n" {
+		t.Errorf("error: %q", errs.String())
+	}
+}
+
+func TestKlogLevel(t *testing.T) {
+	for line, level := range map[string]string{
+		"I0601 12:00:00.000000       1 main.go:10] hi": "info",
+		"W0601 12:00:00.000000       1 main.go:10] hi": "warning",
+		"E0601 12:00:00.000000       1 main.go:10] hi": "error",
+		"Error: not a klog header":                     "",
+	} {
+		if got := KlogLevel([]byte(line)); got != level {
+			t.Errorf("%q: %q, want %q", line, got, level)
+		}
+	}
+}
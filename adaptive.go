@@ -0,0 +1,134 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// adaptiveCheck decides whether the checkers shall run after a write.
+//
+// Every fruitless check doubles the number of writes skipped until the next check, up to maxEvery,
+// a rolling resets it to 1. The checkers always run when maxDelay elapsed since the last check,
+// or when the file is near the max size.
+type adaptiveCheck struct {
+	maxEvery int64
+	maxDelay time.Duration
+	now      func() time.Time // the clock of the Roll
+
+	every  int64 // the number of writes between two checks
+	writes int64 // the number of writes since the last check
+	last   int64 // the unix nano of the last check
+}
+
+func newAdaptiveCheck(maxEvery int, maxDelay time.Duration, now func() time.Time) *adaptiveCheck {
+	if maxEvery < 1 {
+		maxEvery = 1
+	}
+	return &adaptiveCheck{
+		maxEvery: int64(maxEvery),
+		maxDelay: maxDelay,
+		now:      now,
+		every:    1,
+		last:     now().UnixNano(),
+	}
+}
+
+// due reports whether the checkers shall run, size is the current size of the file and limit is the max size.
+func (a *adaptiveCheck) due(size, limit int64) bool {
+	w := atomic.AddInt64(&a.writes, 1)
+
+	due := w >= atomic.LoadInt64(&a.every) ||
+		(limit > 0 && size >= limit-limit/10) ||
+		(a.maxDelay > 0 && time.Duration(a.now().UnixNano()-atomic.LoadInt64(&a.last)) >= a.maxDelay)
+	if !due {
+		return false
+	}
+
+	atomic.StoreInt64(&a.writes, 0)
+	atomic.StoreInt64(&a.last, a.now().UnixNano())
+	return true
+}
+
+// checked adapts the frequency by the result of a check.
+func (a *adaptiveCheck) checked(rolling bool) {
+	if rolling {
+		atomic.StoreInt64(&a.every, 1)
+		return
+	}
+
+	every := atomic.LoadInt64(&a.every) * 2
+	if every > a.maxEvery {
+		every = a.maxEvery
+	}
+	atomic.StoreInt64(&a.every, every)
+}
+
+// AdaptiveCheck runs the checkers every up to maxEvery writes instead of after every write,
+// the frequency adapts to the results of the checks. The checkers still run when maxDelay elapsed
+// since the last check, or when the file is near the size limit of a MaxSizeChecker.
+func AdaptiveCheck(maxEvery int, maxDelay time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		r.adaptive = newAdaptiveCheck(maxEvery, maxDelay, r.now)
+	})
+}
+
+// shouldCheck reports whether the checkers shall run after a write.
+func (r *Roll) shouldCheck() bool {
+	if !r.mayRoll() {
+		return false
+	}
+	if r.adaptive == nil {
+		return true
+	}
+
+	var limit int64
+	for _, c := range r.checkers {
+		if m, ok := c.(*maxSizeChecker); ok && m.Threshold() > 0 && (limit == 0 || m.Threshold() < limit) {
+			limit = m.Threshold()
+		}
+	}
+	return r.adaptive.due(r.st.Size(), limit)
+}
+
+// mayRoll compares the MaxSizeChecker and the IntervalChecker inline, so the fruitless writes do not wake up
+// the checking goroutine. It is true if any of the other checkers is enabled, which only the checks can tell,
+// or the size is refreshed or followed by the checks, see RefreshStat and SharedFile. The caller holds the write lock.
+func (r *Roll) mayRoll() bool {
+	if r.restat != nil || r.shared != nil {
+		return true
+	}
+	for i, c := range r.checkers {
+		if !r.checkerHandles[i].Enabled() {
+			continue
+		}
+		switch c := c.(type) {
+		case *maxSizeChecker:
+			if limit := c.Threshold(); limit > 0 && r.st.Size() >= limit {
+				return true
+			}
+		case *intervalChecker:
+			if interval := time.Duration(c.Threshold()); interval > 0 {
+				if ok, birth := r.st.Birthtimespec(); ok && c.due(interval, time.Unix(birth.Unix())) {
+					return true
+				}
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package rollingf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveCheck(t *testing.T) {
+	a := newAdaptiveCheck(8, time.Hour, time.Now)
+
+	var checks int
+	for i := 0; i < 100; i++ {
+		if a.due(0, 1000) {
+			checks++
+			a.checked(false)
+		}
+	}
+	// 1 + 2 + 4 + 8 + 8 + ...
+	if checks != 14 {
+		t.Fatal(checks)
+	}
+
+	if !a.due(950, 1000) {
+		t.Fatal("not checked near the limit")
+	}
+	a.checked(true)
+	if !a.due(0, 1000) {
+		t.Fatal("not checked after rolling")
+	}
+}
+
+func TestAdaptiveCheckMaxDelay(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := NewC("/mem/app.log", WithFS(NewMemFS()), AdaptiveCheck(8, time.Minute))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	// the clock set later is followed too
+	r.WithClock(clock)
+	a := r.adaptive
+
+	a.due(0, 0)
+	a.checked(false)
+	if a.due(0, 0) {
+		t.Fatal("checked before the 2nd write")
+	}
+	clock.Add(time.Minute)
+	if !a.due(0, 0) {
+		t.Fatal("not checked after maxDelay")
+	}
+	if a.due(0, 0) {
+		t.Fatal("checked again at once")
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveFormat is the format of the archives bundled by DailyArchiver.
+type ArchiveFormat string
+
+const (
+	ZipArchive   ArchiveFormat = "zip"
+	TarGzArchive ArchiveFormat = "tar.gz"
+)
+
+var archiveSuffix = map[ArchiveFormat]string{
+	ZipArchive:   ".zip",
+	TarGzArchive: ".tar.gz",
+}
+
+const archiveDayLayout = "20060102"
+
+// isArchive reports whether name is an archive of the backups of base, eg. app.log.20240601.zip.
+func isArchive(base, name string) bool {
+	name = path.Base(name)
+	if !strings.HasPrefix(name, base+".") {
+		return false
+	}
+	for _, suffix := range archiveSuffix {
+		if strings.HasSuffix(name, suffix) {
+			day := strings.TrimSuffix(name[len(base)+1:], suffix)
+			return len(day) == len(archiveDayLayout) && isDigits(day)
+		}
+	}
+	return false
+}
+
+// withoutArchives returns the files except the archives of base.
+func withoutArchives(base string, files []os.DirEntry) []os.DirEntry {
+	for i, e := range files {
+		if !isArchive(base, e.Name()) {
+			continue
+		}
+		rest := append([]os.DirEntry(nil), files[:i]...)
+		for _, e := range files[i+1:] {
+			if !isArchive(base, e.Name()) {
+				rest = append(rest, e)
+			}
+		}
+		return rest
+	}
+	return files
+}
+
+type archiveMatcher struct {
+	Matcher
+	base string
+}
+
+// MatchArchives matches the archives of DailyArchiver besides the files matched by m, so the filters see the archives.
+//
+// The archives carry no tail number, sort them by MtimeSorter, the ModTime of an archive is the latest of its backups.
+func MatchArchives(m Matcher) *archiveMatcher {
+	return &archiveMatcher{Matcher: m}
+}
+
+func (m *archiveMatcher) Init(base string) {
+	m.base = base
+	m.Matcher.Init(base)
+}
+
+func (m *archiveMatcher) Match(other string) bool {
+	return m.Matcher.Match(other) || isArchive(m.base, other)
+}
+
+type archiver struct {
+	format ArchiveFormat
+	base   string
+	fs     FS
+	logs
+
+	mu    sync.Mutex
+	loc   *time.Location
+	clock Clock
+}
+
+// DailyArchiver bundles the backups rolled on the same day into one archive, eg. app.log.20240601.zip,
+// the backups of today are left until the day is over. The backups rolled late are added to the existing archive.
+//
+// Chain it after the processor renaming the backups, and match the archives by MatchArchives:
+//
+//	r.WithMatcher(MatchArchives(DefaultMatcher())).
+//		WithSorter(MtimeSorter()).
+//		WithProcessor(DefaultProcessor(), DailyArchiver(ZipArchive))
+//
+// The days are computed in the local time by default, see In and Roll.WithLocation.
+func DailyArchiver(format ArchiveFormat) *archiver {
+	if archiveSuffix[format] == "" {
+		format = ZipArchive
+	}
+	return &archiver{
+		format: format,
+		loc:    time.Local,
+		clock:  systemClock{},
+	}
+}
+
+// In computes the days in loc, eg. time.UTC.
+func (a *archiver) In(loc *time.Location) *archiver {
+	a.setLocation(loc)
+	return a
+}
+
+func (a *archiver) Init(base string) {
+	a.base = base
+}
+
+func (a *archiver) setFS(fsys FS) {
+	a.fs = fsys
+}
+
+func (a *archiver) setLocation(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.loc = loc
+}
+
+func (a *archiver) setClock(clock Clock) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clock = clock
+}
+
+func (a *archiver) Process(dir string, remains []os.DirEntry) error {
+	return a.ProcessContext(context.Background(), dir, remains)
+}
+
+// ProcessContext is Process, the bundling is stopped once ctx is done, the partial archive is removed.
+func (a *archiver) ProcessContext(ctx context.Context, dir string, remains []os.DirEntry) error {
+	a.mu.Lock()
+	loc, today := a.loc, a.clock.Now().In(a.loc).Format(archiveDayLayout)
+	a.mu.Unlock()
+
+	// the backups of a day in the same directory, see ShardByDate
+	groups := map[string][]os.DirEntry{}
+	for _, e := range remains {
+		name := e.Name()
+		if path.Base(name) == a.base || isArchive(a.base, name) || strings.HasSuffix(name, compressTmpSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		day := info.ModTime().In(loc).Format(archiveDayLayout)
+		if day == today {
+			continue
+		}
+		key := path.Join(path.Dir(name), a.base+"."+day+archiveSuffix[a.format])
+		groups[key] = append(groups[key], e)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := a.bundle(ctx, dir, name, groups[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundle adds the files to the archive name through a temporary file, then removes them.
+func (a *archiver) bundle(ctx context.Context, dir, name string, files []os.DirEntry) error {
+	a.debug("[Archive] %d files --> %v", len(files), name)
+	fsys := fsOrDefault(a.fs)
+	tmpName := name + compressTmpSuffix
+	f, err := fsys.OpenFile(path.Join(dir, tmpName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	aw := a.newWriter(f)
+	latest, err := a.copyArchive(fsys, path.Join(dir, name), aw)
+	for _, e := range files {
+		if err != nil {
+			break
+		}
+		var info os.FileInfo
+		if info, err = e.Info(); err != nil {
+			break
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		err = a.add(ctx, fsys, aw, path.Join(dir, e.Name()), info)
+	}
+	if cerr := aw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if c, ok := fsys.(chtimeser); ok {
+			err = c.Chtimes(path.Join(dir, tmpName), latest, latest)
+		}
+	}
+	if err == nil {
+		err = renameFile(fsys, dir, tmpName, name)
+	}
+	if err != nil {
+		if err := removeFile(fsys, dir, tmpName); err != nil {
+			return err
+		}
+		return err
+	}
+
+	for _, e := range files {
+		if err := removeFile(fsys, dir, e.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add copies the file to the archive.
+func (a *archiver) add(ctx context.Context, fsys FS, aw archiveWriter, name string, info os.FileInfo) error {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return aw.add(path.Base(name), info.ModTime(), info.Size(), &ctxReader{ctx: ctx, r: f})
+}
+
+// copyArchive copies the entries of the existing archive to aw, it returns the latest modification time of them.
+func (a *archiver) copyArchive(fsys FS, name string, aw archiveWriter) (time.Time, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0644)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	var latest time.Time
+	each := func(name string, mtime time.Time, size int64, r io.Reader) error {
+		if mtime.After(latest) {
+			latest = mtime
+		}
+		return aw.add(name, mtime, size, r)
+	}
+	if a.format == TarGzArchive {
+		return latest, eachTarGz(f, each)
+	}
+	// the zip directory is at the end
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return latest, err
+	}
+	return latest, eachZip(b, each)
+}
+
+func eachTarGz(r io.Reader, fn func(name string, mtime time.Time, size int64, r io.Reader) error) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(h.Name, h.ModTime, h.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func eachZip(b []byte, fn func(name string, mtime time.Time, size int64, r io.Reader) error) error {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(zf.Name, zf.Modified, int64(zf.UncompressedSize64), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveWriter writes the entries of an archive.
+type archiveWriter interface {
+	add(name string, mtime time.Time, size int64, r io.Reader) error
+	Close() error
+}
+
+func (a *archiver) newWriter(w io.Writer) archiveWriter {
+	if a.format == TarGzArchive {
+		zw := gzip.NewWriter(w)
+		return &tarGzWriter{zw: zw, tw: tar.NewWriter(zw)}
+	}
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipWriter) add(name string, mtime time.Time, _ int64, r io.Reader) error {
+	fw, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarGzWriter struct {
+	zw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarGzWriter) add(name string, mtime time.Time, size int64, r io.Reader) error {
+	h := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: mtime, Typeflag: tar.TypeReg}
+	if err := w.tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w.tw, r, size)
+	return err
+}
+
+func (w *tarGzWriter) Close() error {
+	err := w.tw.Close()
+	if cerr := w.zw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package rollingf
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDailyArchiver(t *testing.T) {
+	for _, format := range []ArchiveFormat{ZipArchive, TarGzArchive} {
+		t.Run(string(format), func(t *testing.T) {
+			mfs := NewMemFS()
+			c := &fakeClock{now: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)}
+			r := NewC("/mem/app.log", WithFS(mfs)).
+				WithClock(c).
+				WithLocation(time.UTC).
+				WithMatcher(MatchArchives(DefaultMatcher())).
+				WithSorter(MtimeSorter()).
+				WithProcessor(DefaultProcessor(), DailyArchiver(format))
+			if r == nil {
+				t.Fatal("nil roll")
+			}
+			defer r.Close()
+
+			events := make(chan RotateEvent, 16)
+			r.OnRotate(func(ev RotateEvent) {
+				events <- ev
+			})
+			for _, step := range []struct {
+				content string
+				after   time.Duration
+			}{{"a", 24 * time.Hour}, {"b", time.Hour}, {"c", 24 * time.Hour}, {"d", 0}} {
+				r.Write([]byte(step.content))
+				if err := rollSync(t, r, events); err != nil {
+					t.Fatal(err)
+				}
+				c.Add(step.after)
+			}
+
+			suffix := archiveSuffix[format]
+			wantFiles := []string{"app.log", "app.log.1", "app.log.20240601" + suffix, "app.log.20240602" + suffix}
+			if got := memNames(mfs); !reflect.DeepEqual(got, wantFiles) {
+				t.Fatalf("files %v, want %v", got, wantFiles)
+			}
+			want := map[string]string{"app.log.3": "b", "app.log.2": "c"}
+			if got := readArchive(t, mfs, "/mem/app.log.20240602"+suffix, format); !reflect.DeepEqual(got, want) {
+				t.Errorf("archive %v, want %v", got, want)
+			}
+			if info, _ := mfs.Stat("/mem/app.log.20240602" + suffix); !info.ModTime().Equal(time.Date(2024, 6, 2, 11, 0, 0, 0, time.UTC)) {
+				t.Errorf("modtime %v", info.ModTime())
+			}
+
+			// a backup rolled late joins the archive of its day
+			f, _ := mfs.OpenFile("/mem/app.log.7", os.O_CREATE|os.O_WRONLY, 0644)
+			f.Write([]byte("late"))
+			f.Close()
+			late := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+			mfs.Chtimes("/mem/app.log.7", late, late)
+			if err := rollSync(t, r, events); err != nil {
+				t.Fatal(err)
+			}
+			want = map[string]string{"app.log.2": "a", "app.log.8": "late"}
+			if got := readArchive(t, mfs, "/mem/app.log.20240601"+suffix, format); !reflect.DeepEqual(got, want) {
+				t.Errorf("archive %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func memNames(mfs *MemFS) []string {
+	entries, _ := mfs.ReadDir("/mem")
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func readArchive(t *testing.T, mfs *MemFS, name string, format ArchiveFormat) map[string]string {
+	b, err := mfs.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	each := func(name string, _ time.Time, _ int64, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		got[name] = string(content)
+		return err
+	}
+	if format == TarGzArchive {
+		err = eachTarGz(bytes.NewReader(b), each)
+	} else {
+		err = eachZip(b, each)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy decides which record is dropped when the queue of the NonBlocking mode is full.
+type DropPolicy int
+
+const (
+	DropNewest DropPolicy = iota // drop the record being written
+	DropOldest                   // drop the oldest queued record to make room
+)
+
+type asyncWriter struct {
+	policy  DropPolicy
+	ch      chan [][]byte
+	done    chan struct{}
+	pending int64 // atomic, the bytes queued
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NonBlocking makes Write and WriteBatch never block, the records are queued and written by a background goroutine.
+//
+// When the queue of queueSize records is full, eg. the disk is slow or erroring, a record is dropped by policy.
+// The records failed to be written are dropped too, all the dropped ones are counted by Stats.Dropped.
+// Close drains the queue before closing the file, Shutdown drains it until its deadline.
+func NonBlocking(queueSize int, policy DropPolicy) Option {
+	return OptionFunc(func(r *Roll) {
+		r.async = newAsyncWriter(queueSize, policy)
+	})
+}
+
+func newAsyncWriter(queueSize int, policy DropPolicy) *asyncWriter {
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	return &asyncWriter{
+		policy: policy,
+		ch:     make(chan [][]byte, queueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue queues the records without blocking, it returns the number of the records dropped.
+func (w *asyncWriter) enqueue(records [][]byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	size := recordsLen(records)
+	select {
+	case w.ch <- records:
+		atomic.AddInt64(&w.pending, size)
+		return 0, nil
+	default:
+	}
+	if w.policy == DropNewest {
+		return len(records), nil
+	}
+
+	var dropped int
+	select {
+	case oldest := <-w.ch:
+		dropped = len(oldest)
+		atomic.AddInt64(&w.pending, -recordsLen(oldest))
+	default:
+	}
+	select {
+	case w.ch <- records:
+		atomic.AddInt64(&w.pending, size)
+	default:
+		// the room is taken by the other writers
+		dropped += len(records)
+	}
+	return dropped, nil
+}
+
+// run writes the queued records until the queue is closed.
+func (w *asyncWriter) run(r *Roll) {
+	defer close(w.done)
+	for records := range w.ch {
+		if _, err := r.deliver(records); err != nil {
+			r.warn("[async] err: %v", err)
+			r.stats.drop(int64(len(records)))
+		}
+		atomic.AddInt64(&w.pending, -recordsLen(records))
+	}
+}
+
+// pendingBytes returns the bytes queued but not written yet.
+func (w *asyncWriter) pendingBytes() int64 {
+	if w == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.pending)
+}
+
+func recordsLen(records [][]byte) int64 {
+	var n int64
+	for _, p := range records {
+		n += int64(len(p))
+	}
+	return n
+}
+
+// closeContext stops accepting the records and waits for the queued ones to be written until ctx is done,
+// it returns the bytes left, which are dropped.
+func (w *asyncWriter) closeContext(ctx context.Context) int64 {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.ch)
+	}
+	w.mu.Unlock()
+	select {
+	case <-w.done:
+		return 0
+	case <-ctx.Done():
+		return w.pendingBytes()
+	}
+}
+
+func (r *Roll) writeAsync(records [][]byte) (int, error) {
+	var n int
+	cp := make([][]byte, len(records))
+	for i, p := range records {
+		// the caller may reuse the buffers
+		cp[i] = append([]byte(nil), p...)
+		n += len(p)
+	}
+
+	dropped, err := r.async.enqueue(cp)
+	if err != nil {
+		return 0, err
+	}
+	if dropped > 0 {
+		r.stats.drop(int64(dropped))
+	}
+	return n, nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// BackupInfo describes a backup of the file, as understood by the matcher and the namer.
+type BackupInfo struct {
+	Name       string         // the base name of the backup
+	Path       string         // the path of the backup
+	Size       int64          // the size on disk, compressed if Compressed
+	ModTime    time.Time      // the modification time
+	Compressed bool           // whether the backup is compressed
+	Format     CompressFormat // the compression format, NoCompress if not Compressed
+	Index      int            // the tail number of the name, eg. 2 of "app.log.2.gz", 0 if none
+	Time       time.Time      // the rolling time embedded in the name by the namer, zero if none
+}
+
+// Backups returns the backups of the file matched by the matcher, sorted from the newest to the oldest.
+//
+// The file itself and the temporary file are not included.
+func (r *Roll) Backups() ([]BackupInfo, error) {
+	dir := path.Dir(r.filePath)
+	files, err := r.backupEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(r.filePath)
+	tp, _ := r.namer.(timeParser)
+	backups := make([]BackupInfo, 0, len(files))
+	for _, e := range files {
+		info, err := e.Info()
+		if os.IsNotExist(err) {
+			// removed meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		b := BackupInfo{
+			Name:    e.Name(),
+			Path:    path.Join(dir, e.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Format:  compressFormat(e.Name()),
+			Index:   parseBackupName(base, e.Name()).index,
+		}
+		b.Compressed = b.Format != NoCompress
+		if tp != nil {
+			if t, ok := tp.parseTime(base, path.Base(e.Name())); ok {
+				b.Time = t
+			}
+		}
+		backups = append(backups, b)
+	}
+	return backups, nil
+}
+
+// compressFormat returns the compression format by the suffix of the name.
+func compressFormat(name string) CompressFormat {
+	for format, suffix := range cfSuffix {
+		if strings.HasSuffix(name, suffix) {
+			return format
+		}
+	}
+	return NoCompress
+}
+
+// Purge runs the filters over the backups now, without rolling, eg. for an admin endpoint reclaiming the space on demand.
+//
+// It waits for the rolling in progress, until ctx is done. The file itself is never filtered.
+// Under SkipOnError, it returns the *RetentionError of the backups failed to be dealt, see RetentionErrors.
+func (r *Roll) Purge(ctx context.Context) error {
+	unlock, err := r.lockBackups(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	files, err := r.backupEntries(path.Dir(r.filePath))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := r.withRollContext(ctx)
+	defer cancel()
+	_, results, err := r.filterChain(ctx, files, false)
+	if err != nil {
+		return err
+	}
+	if err = r.tidyShards(path.Dir(r.filePath)); err != nil {
+		return err
+	}
+	if r.errorsPolicy == SkipOnError {
+		return retentionError(results)
+	}
+	return nil
+}
+
+// PurgeDryRun runs the filters over the backups like Purge, but returns the files the filters would remove
+// and why instead of removing them, for auditing the retention.
+func (r *Roll) PurgeDryRun(ctx context.Context) ([]FilterResult, error) {
+	unlock, err := r.lockBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	files, err := r.backupEntries(path.Dir(r.filePath))
+	if err != nil {
+		return nil, err
+	}
+	_, results, err := r.filterChain(ctx, files, true)
+	return results, err
+}
+
+// CompactIndexes renumbers the numeric backups to 1..N in order, eg. after the manual deletions or the crashes
+// left the gaps or two backups of the same index, so the filters count and sort them predictably again.
+//
+// The compression suffixes are kept, the backups named by the time are untouched. It waits for the rolling in progress.
+func (r *Roll) CompactIndexes() error {
+	unlock, err := r.lockBackups(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := path.Dir(r.filePath)
+	files, err := r.backupEntries(dir)
+	if err != nil {
+		return err
+	}
+
+	base := path.Base(r.filePath)
+	var steps []renameStep
+	idx := 0
+	for _, e := range files {
+		n := parseBackupName(base, e.Name())
+		if n.index == 0 {
+			continue
+		}
+		idx++
+		newName := backupName{stem: base, index: idx, format: n.format}.String()
+		if newName != e.Name() {
+			steps = append(steps, renameStep{From: e.Name(), To: newName})
+		}
+	}
+	if steps, err = orderSteps(steps); err != nil {
+		return err
+	}
+	r.debug("[CompactIndexes] %d renames", len(steps))
+	return renumber(r.fs, &logs{logger: r.logger}, dir, base, steps)
+}
+
+// lockBackups takes the rolling token and the locks of the backups shared with the other processes,
+// it waits for the rolling in progress until ctx is done.
+func (r *Roll) lockBackups(ctx context.Context) (func(), error) {
+	select {
+	case r.rotateCh <- struct{}{}:
+	case <-r.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if r.shared != nil {
+		if _, err := r.shared.lock(true); err != nil {
+			<-r.rotateCh
+			return nil, err
+		}
+	}
+	if r.coordinator != nil {
+		if err := r.coordinator.Lock(); err != nil {
+			if r.shared != nil {
+				r.shared.unlock()
+			}
+			<-r.rotateCh
+			return nil, err
+		}
+	}
+	return func() {
+		if r.coordinator != nil {
+			r.coordinator.Unlock()
+		}
+		if r.shared != nil {
+			r.shared.unlock()
+		}
+		r.releaseRotate()
+	}, nil
+}
+
+// backupEntries returns the files matched in dir except the file itself, sorted from the newest to the oldest.
+func (r *Roll) backupEntries(dir string) ([]os.DirEntry, error) {
+	if r.matcher == nil {
+		return nil, nil
+	}
+	files, err := r.matchFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(r.filePath)
+	backups := files[:0]
+	for _, e := range files {
+		if e.Name() != base {
+			backups = append(backups, e)
+		}
+	}
+	return backups, nil
+}
@@ -0,0 +1,323 @@
+package rollingf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackups(t *testing.T) {
+	mfs := NewMemFS()
+	rolled := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	n := TimestampNamer("")
+	names := []string{
+		n.Name("app.log", 1, rolled),
+		n.Name("app.log", 2, rolled.Add(-time.Hour)) + ".gz",
+	}
+	for _, name := range append(names, "other.log") {
+		f, err := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(name))
+		f.Close()
+	}
+
+	r := NewC("/mem/app.log", WithFS(mfs), Naming(n))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	backups, err := r.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("%+v", backups)
+	}
+	for i, b := range backups {
+		if b.Name != names[i] || b.Path != "/mem/"+names[i] || b.Size != int64(len(names[i])) {
+			t.Errorf("%d: %+v", i, b)
+		}
+		if !b.Time.Equal(rolled.Add(-time.Duration(i) * time.Hour)) {
+			t.Errorf("%d: time %v", i, b.Time)
+		}
+	}
+	if backups[0].Compressed || !backups[1].Compressed || backups[1].Format != Gzip {
+		t.Fatalf("%+v", backups)
+	}
+}
+
+func TestBackupsIndex(t *testing.T) {
+	mfs := NewMemFS()
+	for _, name := range []string{"app.log.2.gz", "app.log.1"} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	r := NewC("/mem/app.log", WithFS(mfs), Compress(Gzip), CompressAfter(1))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	backups, err := r.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Index != 1 || backups[1].Index != 2 || !backups[1].Compressed || !backups[0].Time.IsZero() {
+		t.Fatalf("%+v", backups)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	mfs := NewMemFS()
+	for _, name := range []string{"app.log.1", "app.log.2", "app.log.3"} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	r := NewC("/mem/app.log", WithFS(mfs)).
+		WithDefaultMatcher().
+		WithDefaultProcessor().
+		WithFilter(MaxBackupsFilter(1))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+
+	// a rolling in progress
+	r.rotateCh <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Purge(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("busy: %v", err)
+	}
+	<-r.rotateCh
+
+	if err := r.Purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := r.Backups()
+	if len(backups) != 1 || backups[0].Name != "app.log.1" {
+		t.Fatalf("%+v", backups)
+	}
+	if _, err := mfs.Stat("/mem/app.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Close()
+	if err := r.Purge(context.Background()); err != os.ErrClosed {
+		t.Fatalf("closed: %v", err)
+	}
+}
+
+// gzFilter filters out the compressed files.
+type gzFilter struct{}
+
+func (gzFilter) Name() string { return "gzFilter" }
+
+func (gzFilter) Filter(files []os.DirEntry) (remains []os.DirEntry, filtered []os.DirEntry, err error) {
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".gz") {
+			filtered = append(filtered, f)
+		} else {
+			remains = append(remains, f)
+		}
+	}
+	return remains, filtered, nil
+}
+
+func (gzFilter) Reason(os.DirEntry) string { return "compressed" }
+
+func (gzFilter) DealFile(dir string, file os.DirEntry) error {
+	return os.ErrPermission
+}
+
+func TestPurgeDryRun(t *testing.T) {
+	mfs := NewMemFS()
+	for _, name := range []string{"app.log.1", "app.log.2.gz", "app.log.3", "app.log.4"} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	var removed []FilterResult
+	r := NewC("/mem/app.log", WithFS(mfs)).
+		WithMatcher(NewRegexMatcher(`\.\d+(\.gz)?$`)).
+		WithDefaultProcessor().
+		WithFilterV2(gzFilter{}).
+		WithFilter(MaxBackupsFilter(1)).
+		OnRemove(func(res FilterResult) {
+			removed = append(removed, res)
+		})
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := r.Events()
+
+	results, err := r.PurgeDryRun(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FilterResult{
+		{Name: "/mem/app.log.2.gz", Filter: "gzFilter", Reason: "compressed"},
+		{Name: "/mem/app.log.3", Filter: "MaxBackupsFilter", Reason: "count>1"},
+		{Name: "/mem/app.log.4", Filter: "MaxBackupsFilter", Reason: "count>1"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("%+v", results)
+	}
+	if backups, _ := r.Backups(); len(backups) != 4 || len(removed) != 0 {
+		t.Fatal("removed in the dry run", backups, removed)
+	}
+
+	if err := r.Purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want[0].Err = os.ErrPermission
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatalf("%+v", removed)
+	}
+	if backups, _ := r.Backups(); len(backups) != 2 {
+		t.Fatal(backups)
+	}
+	if ev, ok := (<-events).(ErrorEvent); !ok || ev.Err != os.ErrPermission {
+		t.Fatal(ev)
+	}
+	if ev, ok := (<-events).(BackupRemoved); !ok || ev.Name != "/mem/app.log.3" || ev.Detail != "count>1" {
+		t.Fatal(ev)
+	}
+}
+
+func TestCompactIndexes(t *testing.T) {
+	mfs := NewMemFS()
+	// the gaps, and two backups of the index 3
+	for _, name := range []string{"app.log.2", "app.log.3", "app.log.3.gz", "app.log.4.gz", "app.log.7.gz", "app.log.20240601T120000"} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Write([]byte(name))
+		f.Close()
+	}
+	r := NewC("/mem/app.log", WithFS(mfs)).WithMatcher(NewRegexMatcher(`.*`)).WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	if err := r.CompactIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	for name, was := range map[string]string{
+		"app.log.1":               "app.log.2",
+		"app.log.2":               "app.log.3",
+		"app.log.3.gz":            "app.log.3.gz",
+		"app.log.4.gz":            "app.log.4.gz",
+		"app.log.5.gz":            "app.log.7.gz",
+		"app.log.20240601T120000": "app.log.20240601T120000",
+	} {
+		if b, err := mfs.ReadFile("/mem/" + name); err != nil || string(b) != was {
+			t.Errorf("%s: %q, want %q, %v", name, b, was, err)
+		}
+	}
+	if entries, _ := mfs.ReadDir("/mem"); len(entries) != 7 {
+		t.Fatal(len(entries), "files")
+	}
+}
+
+func TestRetentionInterval(t *testing.T) {
+	mfs := NewMemFS()
+	r, err := NewE(NewRollConf("/mem/app.log", DurOneDay, 0, 0, 1), WithFS(mfs), WithRetentionInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, name := range []string{"app.log.1", "app.log.2", "app.log.3"} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		backups, err := r.Backups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(backups) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not swept: %+v", backups)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRecompress(t *testing.T) {
+	mfs := NewMemFS()
+	c := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	mfs.setClock(c)
+	write := func(name string, format CompressFormat, content string) {
+		f, err := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := codec{format: format, level: DefaultCompressLevel}.writer(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+		w.Close()
+		f.Close()
+	}
+	write("app.log.2.gz", Gzip, "two")
+	write("app.log.3.z", Zlib, "three")
+	c.Add(2 * time.Hour)
+	write("app.log", NoCompress, "active")
+	write("app.log.1", NoCompress, "one")
+
+	r := NewC("/mem/app.log", WithFS(mfs)).WithClock(c).WithMatcher(CompressMatcher(Zlib))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	// app.log.1 is rolled recently
+	done, err := r.Recompress(context.Background(), Zlib, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(done, []string{"/mem/app.log.2.z"}) {
+		t.Fatalf("recompressed %v", done)
+	}
+	if info, err := mfs.Stat("/mem/app.log.2.z"); err != nil || !info.ModTime().Equal(c.Now().Add(-2*time.Hour)) {
+		t.Fatalf("modtime %v", err)
+	}
+
+	if done, err = r.Recompress(context.Background(), Zlib, 0); err != nil || len(done) != 1 {
+		t.Fatal(done, err)
+	}
+	entries, _ := mfs.ReadDir("/mem")
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"app.log", "app.log.1.z", "app.log.2.z", "app.log.3.z"}) {
+		t.Fatalf("files %v", names)
+	}
+	for name, want := range map[string]string{"app.log.1.z": "one", "app.log.2.z": "two", "app.log.3.z": "three"} {
+		b, _ := mfs.ReadFile("/mem/" + name)
+		rc, err := codec{format: Zlib}.reader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if got, err := io.ReadAll(rc); err != nil || string(got) != want {
+			t.Errorf("%s: %q, want %q, %v", name, got, want, err)
+		}
+	}
+
+	if _, err := r.Recompress(context.Background(), "zstd", 0); err == nil {
+		t.Error("unknown format")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxIndexDigits bounds the digits of an index, so it never overflows an int.
+const maxIndexDigits = 9
+
+// backupName is a backup name split into its parts:
+//
+//	stem  . index . suffix of format  .tmp
+//	app.log   10       .gz            .tmp
+type backupName struct {
+	stem   string
+	index  int // 0 if the name has none
+	format CompressFormat
+	temp   bool // the compression in progress
+}
+
+// parseBackupName splits name, a backup of the file named base.
+//
+// The index is the last decimal extension after the compression suffix and ".tmp" are taken off, but base is
+// never split, so a base ending in digits, eg. "app.2", has no index. base may be empty if it is unknown.
+//
+// eg.
+//
+//	base: "app.v2.log", name: "app.v2.log.10.gz.tmp"
+//	return: {stem: "app.v2.log", index: 10, format: Gzip, temp: true}
+func parseBackupName(base, name string) backupName {
+	n := backupName{stem: name}
+	if name == base {
+		return n
+	}
+
+	rest := name
+	if s := strings.TrimSuffix(rest, compressTmpSuffix); s != rest && s != "" && s != base {
+		rest, n.temp = s, true
+	}
+	if f := compressFormat(rest); f != NoCompress {
+		if s := strings.TrimSuffix(rest, cfSuffix[f]); s != "" && s != base {
+			rest, n.format = s, f
+		} else if s != "" {
+			// a compressed file of its own, eg. "app.log.gz"
+			n.stem, n.format = s, f
+			return n
+		}
+	}
+	n.stem = rest
+
+	dot := strings.LastIndexByte(rest, '.')
+	if dot <= 0 {
+		return n
+	}
+	if idx, ok := parseIndex(rest[dot+1:]); ok {
+		n.stem, n.index = rest[:dot], idx
+	}
+	return n
+}
+
+// parseIndex parses a positive index of the ASCII digits only. The signs, the leading zeros and the other digits
+// of unicode are refused, so the index is printed back the same.
+func parseIndex(s string) (int, bool) {
+	if s == "" || len(s) > maxIndexDigits || s[0] == '0' {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+	}
+	idx, err := strconv.Atoi(s)
+	return idx, err == nil && idx > 0
+}
+
+// String joins the parts back into a name.
+func (n backupName) String() string {
+	s := n.stem
+	if n.index > 0 {
+		s += "." + strconv.Itoa(n.index)
+	}
+	s += cfSuffix[n.format]
+	if n.temp {
+		s += compressTmpSuffix
+	}
+	return s
+}
+
+// nextBackupName returns name with the index increased by 1, in format. The format of name is kept if format is NoCompress.
+//
+// eg.
+//
+//	base: "abc.log", name: "abc.log", format: Gzip
+//	return: "abc.log.1.gz"
+func nextBackupName(base, name string, format CompressFormat) string {
+	if name == "" {
+		return name
+	}
+	n := parseBackupName(base, name)
+	n.index++
+	n.temp = false
+	if format != NoCompress {
+		n.format = format
+	}
+	return n.String()
+}
@@ -0,0 +1,40 @@
+//go:build go1.18
+// +build go1.18
+
+package rollingf
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseBackupName(f *testing.F) {
+	for _, name := range []string{"app.log", "app.log.1", "app.log.10.gz.tmp", "app.2.3.z", "app.log.01", ".gz", "app.log.١"} {
+		f.Add("app.log", name)
+		f.Add("", name)
+	}
+	f.Fuzz(func(t *testing.T, base, name string) {
+		n := parseBackupName(base, name)
+		if s := n.String(); s != name {
+			t.Fatalf("parseBackupName(%q, %q) = %#v, String() = %q", base, name, n, s)
+		}
+		if n.index < 0 {
+			t.Fatalf("parseBackupName(%q, %q) = %#v, negative index", base, name, n)
+		}
+		if name == base && n != (backupName{stem: base}) {
+			t.Fatalf("parseBackupName(%q, %q) = %#v, base split", base, name, n)
+		}
+
+		next := nextBackupName(base, name, NoCompress)
+		if name == "" {
+			return
+		}
+		m := parseBackupName(base, next)
+		if m.index != n.index+1 || m.stem != n.stem || m.format != n.format || m.temp {
+			t.Fatalf("nextBackupName(%q, %q) = %q, parsed %#v from %#v", base, name, next, m, n)
+		}
+		if !strings.HasPrefix(next, n.stem) {
+			t.Fatalf("nextBackupName(%q, %q) = %q, stem %q lost", base, name, next, n.stem)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package rollingf
+
+import "testing"
+
+func TestParseBackupName(t *testing.T) {
+	for _, c := range []struct {
+		base, name string
+		want       backupName
+	}{
+		{"app.log", "app.log", backupName{stem: "app.log"}},
+		{"app.log", "app.log.1", backupName{stem: "app.log", index: 1}},
+		{"app.log", "app.log.10.gz", backupName{stem: "app.log", index: 10, format: Gzip}},
+		{"app.log", "app.log.10.gz.tmp", backupName{stem: "app.log", index: 10, format: Gzip, temp: true}},
+		{"app.log", "app.log.3.z", backupName{stem: "app.log", index: 3, format: Zlib}},
+		{"app.log", "app.log.gz", backupName{stem: "app.log", format: Gzip}},
+		{"app.v2.log", "app.v2.log.12", backupName{stem: "app.v2.log", index: 12}},
+		{"app.2", "app.2", backupName{stem: "app.2"}},
+		{"app.2", "app.2.gz", backupName{stem: "app.2", format: Gzip}},
+		{"app.2", "app.2.5.gz", backupName{stem: "app.2", index: 5, format: Gzip}},
+		{"", "app.log.7", backupName{stem: "app.log", index: 7}},
+		// the unexpected names
+		{"app.log", "app.log.old", backupName{stem: "app.log.old"}},
+		{"app.log", "app.log.01", backupName{stem: "app.log.01"}},
+		{"app.log", "app.log.0", backupName{stem: "app.log.0"}},
+		{"app.log", "app.log.-1", backupName{stem: "app.log.-1"}},
+		{"app.log", "app.log.١", backupName{stem: "app.log.١"}},
+		{"app.log", "app.log.99999999999999999999", backupName{stem: "app.log.99999999999999999999"}},
+		{"app.log", ".gz", backupName{stem: ".gz"}},
+		{"app.log", ".tmp", backupName{stem: ".tmp"}},
+		{"app.log", ".3", backupName{stem: ".3"}},
+	} {
+		got := parseBackupName(c.base, c.name)
+		if got != c.want {
+			t.Errorf("parseBackupName(%q, %q) = %+v, want %+v", c.base, c.name, got, c.want)
+		}
+		if got.String() != c.name {
+			t.Errorf("parseBackupName(%q, %q).String() = %q", c.base, c.name, got.String())
+		}
+	}
+}
+
+func TestNextBackupName(t *testing.T) {
+	for _, c := range []struct {
+		base, name string
+		format     CompressFormat
+		want       string
+	}{
+		{"app.log", "app.log", NoCompress, "app.log.1"},
+		{"app.log", "app.log", Gzip, "app.log.1.gz"},
+		{"app.log", "app.log.1", Gzip, "app.log.2.gz"},
+		{"app.log", "app.log.9.gz", NoCompress, "app.log.10.gz"},
+		{"app.log", "app.log.10.z", Zlib, "app.log.11.z"},
+		{"app.2", "app.2", NoCompress, "app.2.1"},
+		{"app.v2.log", "app.v2.log.1", NoCompress, "app.v2.log.2"},
+		{"app.log", "app.log.old", NoCompress, "app.log.old.1"},
+		{"app.log", "", Gzip, ""},
+	} {
+		if got := nextBackupName(c.base, c.name, c.format); got != c.want {
+			t.Errorf("nextBackupName(%q, %q, %q) = %q, want %q", c.base, c.name, c.format, got, c.want)
+		}
+	}
+}
@@ -15,39 +15,149 @@
 package rollingf
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Checker is a file checker, it checks if a file is shall be rolled.
+//
+// Deprecated: the third-party checkers should implement CheckerV2 instead, registered by Roll.WithCheckerV2.
+// Checker is kept for the built-in checkers, some of which update the Rstat, eg. WriteRateChecker.
 type Checker interface {
 	Name() string
 	Check(filePath string, st *Rstat) (bool, error)
 }
 
+// CheckerV2 checks if a file shall be rolled, on a read-only snapshot of the stat.
+//
+// The ctx is done when the Roll is closed. The checks of a Roll run one at a time, the writes wait for them.
+type CheckerV2 interface {
+	Name() string
+	CheckContext(ctx context.Context, filePath string, st StatSnapshot) (bool, error)
+}
+
+// contextChecker is implemented by the Checkers taking the context of the Roll.
+type contextChecker interface {
+	checkContext(ctx context.Context, filePath string, st *Rstat) (bool, error)
+}
+
+var (
+	_ Checker        = (*v2Checker)(nil)
+	_ contextChecker = (*v2Checker)(nil)
+	_ CheckerV2      = (*v1Checker)(nil)
+)
+
+// v2Checker adapts a CheckerV2 to the Checker chain of the Roll.
+type v2Checker struct {
+	c CheckerV2
+}
+
+func (c *v2Checker) Name() string {
+	return c.c.Name()
+}
+
+func (c *v2Checker) Check(filePath string, st *Rstat) (bool, error) {
+	return c.checkContext(context.Background(), filePath, st)
+}
+
+func (c *v2Checker) checkContext(ctx context.Context, filePath string, st *Rstat) (bool, error) {
+	return c.c.CheckContext(ctx, filePath, st.Snapshot())
+}
+
+// v1Checker adapts a Checker to CheckerV2.
+type v1Checker struct {
+	c Checker
+}
+
+// AdaptChecker adapts the deprecated Checker to CheckerV2. The Checker gets a copy of the stat for every check,
+// so the changes it makes to the stat are lost, eg. the rates tracked by WriteRateChecker.
+func AdaptChecker(c Checker) CheckerV2 {
+	if a, ok := c.(*v2Checker); ok {
+		return a.c
+	}
+	return &v1Checker{c: c}
+}
+
+func (c *v1Checker) Name() string {
+	return c.c.Name()
+}
+
+func (c *v1Checker) CheckContext(ctx context.Context, filePath string, st StatSnapshot) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.c.Check(filePath, statOf(st))
+}
+
+// CheckExplainer is implemented by the checkers which explain why they triggered the rolling.
+type CheckExplainer interface {
+	// Explain is called right after Check returned true.
+	Explain(filePath string, st *Rstat) string
+}
+
 var (
+	_ CheckExplainer = (*intervalChecker)(nil)
+	_ CheckExplainer = (*maxSizeChecker)(nil)
+	_ CheckExplainer = (*calendarChecker)(nil)
+	_ CheckExplainer = (*writeRateChecker)(nil)
+	_ CheckExplainer = (*firstWriteChecker)(nil)
+
 	_ Checker = (*intervalChecker)(nil)
 	_ Checker = (*maxSizeChecker)(nil)
+	_ Checker = (*calendarChecker)(nil)
+	_ Checker = (*writeRateChecker)(nil)
+	_ Checker = (*firstWriteChecker)(nil)
 )
 
 type intervalChecker struct {
 	interval time.Duration
+	jitter   int64
+	clock    Clock
 }
 
 // IntervalChecker checks whether a file should be rolled at regular intervals
 //
-// If interval <= 0, it will never roll.
+// If interval <= 0, it will never roll. The age is counted from the birth time of the file, see Rstat.BirthSource.
 func IntervalChecker(interval time.Duration) *intervalChecker {
 	return &intervalChecker{
 		interval: interval,
+		clock:    systemClock{},
 	}
 }
 
+func (c *intervalChecker) setClock(clock Clock) {
+	c.clock = clock
+}
+
+func (c *intervalChecker) setJitter(d time.Duration) {
+	atomic.StoreInt64(&c.jitter, int64(d))
+}
+
+// due reports whether the file born at birth is older than the interval and the jitter.
+func (c *intervalChecker) due(interval time.Duration, birth time.Time) bool {
+	return c.clock.Since(birth) > interval+time.Duration(atomic.LoadInt64(&c.jitter))
+}
+
 func (c *intervalChecker) Name() string {
 	return "IntervalChecker"
 }
 
+// Threshold returns the interval in nanoseconds.
+func (c *intervalChecker) Threshold() int64 {
+	return atomic.LoadInt64((*int64)(&c.interval))
+}
+
+// SetThreshold sets the interval in nanoseconds, eg. int64(time.Hour).
+func (c *intervalChecker) SetThreshold(v int64) {
+	atomic.StoreInt64((*int64)(&c.interval), v)
+}
+
 func (c *intervalChecker) Check(_ string, st *Rstat) (bool, error) {
-	if c.interval <= 0 {
+	interval := time.Duration(c.Threshold())
+	if interval <= 0 {
 		return false, nil
 	}
 
@@ -55,7 +165,16 @@ func (c *intervalChecker) Check(_ string, st *Rstat) (bool, error) {
 	if !ok {
 		return false, nil
 	}
-	return time.Now().After(time.Unix(brithTime.Unix()).Add(c.interval)), nil
+	return c.due(interval, time.Unix(brithTime.Unix())), nil
+}
+
+func (c *intervalChecker) Explain(_ string, st *Rstat) string {
+	_, brithTime := st.Birthtimespec()
+	age := c.clock.Since(time.Unix(brithTime.Unix())).Truncate(time.Second)
+	if jitter := time.Duration(atomic.LoadInt64(&c.jitter)); jitter > 0 {
+		return fmt.Sprintf("age=%v>interval=%v+jitter=%v", age, time.Duration(c.Threshold()), jitter.Truncate(time.Second))
+	}
+	return fmt.Sprintf("age=%v>interval=%v", age, time.Duration(c.Threshold()))
 }
 
 type maxSizeChecker struct {
@@ -73,10 +192,241 @@ func (c *maxSizeChecker) Name() string {
 	return "MaxSizeChecker"
 }
 
+// Threshold returns the max size in bytes.
+func (c *maxSizeChecker) Threshold() int64 {
+	return atomic.LoadInt64(&c.maxSize)
+}
+
+// SetThreshold sets the max size in bytes.
+func (c *maxSizeChecker) SetThreshold(v int64) {
+	atomic.StoreInt64(&c.maxSize, v)
+}
+
 func (c *maxSizeChecker) Check(_ string, st *Rstat) (bool, error) {
-	if c.maxSize <= 0 {
+	maxSize := c.Threshold()
+	if maxSize <= 0 {
 		return false, nil
 	}
 
-	return st.Size() >= c.maxSize, nil
+	return st.Size() >= maxSize, nil
+}
+
+func (c *maxSizeChecker) Explain(_ string, st *Rstat) string {
+	return fmt.Sprintf("size=%d>=limit=%d", st.Size(), c.Threshold())
+}
+
+type firstWriteChecker struct {
+	mu   sync.Mutex
+	loc  *time.Location
+	last time.Time
+}
+
+// FirstWriteOfDay checks whether a file should be rolled when the day of the latest write differs from
+// the day of the previous one, so the rolling follows the writes even if the process was asleep across midnight.
+//
+// The previous write is resumed from the file's mtime, or the RollState persisted by the StateFile option.
+// The days are computed in the local time by default, see In and Roll.WithLocation.
+func FirstWriteOfDay() *firstWriteChecker {
+	return &firstWriteChecker{loc: time.Local}
+}
+
+// In computes the days in loc, eg. time.UTC.
+func (c *firstWriteChecker) In(loc *time.Location) *firstWriteChecker {
+	c.setLocation(loc)
+	return c
+}
+
+func (c *firstWriteChecker) setLocation(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loc = loc
+}
+
+func (c *firstWriteChecker) Name() string {
+	return "FirstWriteOfDay"
+}
+
+func (c *firstWriteChecker) Check(_ string, st *Rstat) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cur := st.ModTime()
+	if c.last.IsZero() {
+		c.last = st.PriorWrite()
+	}
+	last := c.last
+	if cur.After(c.last) {
+		c.last = cur
+	}
+	if last.IsZero() {
+		return false, nil
+	}
+
+	y1, m1, d1 := last.In(c.loc).Date()
+	y2, m2, d2 := cur.In(c.loc).Date()
+	return y1 != y2 || m1 != m2 || d1 != d2, nil
+}
+
+func (c *firstWriteChecker) Explain(_ string, st *Rstat) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("write=%s", st.ModTime().In(c.loc).Format(tsFormat))
+}
+
+type writeRateChecker struct {
+	limit     int64
+	per       time.Duration
+	sustained int
+}
+
+// WriteRateChecker checks whether a file should be rolled when more than limit bytes are written per period
+// in each of the last sustained periods, eg. WriteRateChecker(50*SizeMB, time.Minute, 5) isolates the bursts
+// of more than 50MB/min for 5 minutes into their own files.
+//
+// The rate is tracked by Rstat.TrackRate since the first check, and restarts with the new file, so a lasting
+// burst is rolled every sustained periods.
+func WriteRateChecker(limit int64, per time.Duration, sustained int) *writeRateChecker {
+	if sustained <= 0 {
+		sustained = 1
+	}
+	return &writeRateChecker{
+		limit:     limit,
+		per:       per,
+		sustained: sustained,
+	}
+}
+
+func (c *writeRateChecker) Name() string {
+	return "WriteRateChecker"
+}
+
+func (c *writeRateChecker) Check(_ string, st *Rstat) (bool, error) {
+	if c.limit <= 0 || c.per <= 0 {
+		return false, nil
+	}
+
+	st.TrackRate(c.per, c.sustained)
+	counts, ok := st.Rates(c.sustained)
+	if !ok {
+		return false, nil
+	}
+	for _, n := range counts {
+		if n <= c.limit {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *writeRateChecker) Explain(_ string, st *Rstat) string {
+	counts, _ := st.Rates(c.sustained)
+	return fmt.Sprintf("rates=%v>limit=%d/%v", counts, c.limit, c.per)
+}
+
+// locationSetter is implemented by the components computing the calendar boundaries.
+type locationSetter interface {
+	setLocation(loc *time.Location)
+}
+
+type calendarChecker struct {
+	name     string
+	truncate func(t time.Time) time.Time
+
+	mu     sync.Mutex
+	loc    *time.Location
+	jitter time.Duration
+	clock  Clock
+	period time.Time
+}
+
+// RotateDaily checks whether a file should be rolled when a calendar day boundary has passed.
+//
+// The boundaries are computed in the local time by default, see In and Roll.WithLocation.
+func RotateDaily() *calendarChecker {
+	return &calendarChecker{
+		name: "RotateDaily",
+		truncate: func(t time.Time) time.Time {
+			y, m, d := t.Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+		},
+		loc:   time.Local,
+		clock: systemClock{},
+	}
+}
+
+// RotateHourly checks whether a file should be rolled when a calendar hour boundary has passed.
+//
+// The boundaries are computed in the local time by default, see In and Roll.WithLocation.
+func RotateHourly() *calendarChecker {
+	return &calendarChecker{
+		name: "RotateHourly",
+		truncate: func(t time.Time) time.Time {
+			y, m, d := t.Date()
+			return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+		},
+		loc:   time.Local,
+		clock: systemClock{},
+	}
+}
+
+// In computes the boundaries in loc, eg. time.UTC.
+func (c *calendarChecker) In(loc *time.Location) *calendarChecker {
+	c.setLocation(loc)
+	return c
+}
+
+func (c *calendarChecker) setLocation(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loc = loc
+}
+
+func (c *calendarChecker) setClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+}
+
+func (c *calendarChecker) setJitter(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jitter = d
+}
+
+func (c *calendarChecker) Name() string {
+	return c.name
+}
+
+func (c *calendarChecker) Check(_ string, st *Rstat) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.period.IsZero() {
+		// the period of the existing content
+		start := st.FileInfo().ModTime()
+		if ok, birthTime := st.Birthtimespec(); ok {
+			start = time.Unix(birthTime.Unix())
+		}
+		c.period = c.truncate(start.Add(-c.jitter).In(c.loc))
+	}
+
+	// the periods start at the boundaries delayed by the jitter
+	cur := c.truncate(c.clock.Now().Add(-c.jitter).In(c.loc))
+	if cur.Equal(c.period) {
+		return false, nil
+	}
+	c.period = cur
+	return true, nil
+}
+
+func (c *calendarChecker) Explain(_ string, _ *Rstat) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("boundary=%s", c.period.Format(tsFormat))
 }
@@ -0,0 +1,60 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "time"
+
+// Clock tells the time to the time-based components, replace it to test them deterministically.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+}
+
+// clockSetter is implemented by the time-based components.
+type clockSetter interface {
+	setClock(c Clock)
+}
+
+var _ Clock = systemClock{}
+
+type systemClock struct{}
+
+// SystemClock returns the Clock of the system time, it is the default one.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// WithClock sets the clock for the Roll and all the checkers and filters.
+func (r *Roll) WithClock(c Clock) *Roll {
+	r.clock = c
+	r.st.setClock(c)
+	r.setupAll()
+	return r
+}
+
+func (r *Roll) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
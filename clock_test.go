@@ -0,0 +1,254 @@
+package rollingf
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCalendarCheckerClock(t *testing.T) {
+	fp := t.TempDir() + "/app.log"
+	if err := os.WriteFile(fp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &Rstat{}
+	st.reset(info)
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 23, 30, 0, 0, loc)}
+	c := RotateDaily().In(loc)
+	c.setClock(clock)
+
+	// the file was written before 2030, the first check rolls it
+	if ok, _ := c.Check(fp, st); !ok {
+		t.Fatal("expect rolling")
+	}
+	if ok, _ := c.Check(fp, st); ok {
+		t.Fatal("unexpected rolling")
+	}
+
+	clock.Add(20 * time.Minute)
+	if ok, _ := c.Check(fp, st); ok {
+		t.Fatal("unexpected rolling before midnight")
+	}
+	clock.Add(20 * time.Minute)
+	if ok, _ := c.Check(fp, st); !ok {
+		t.Fatal("expect rolling after midnight")
+	}
+}
+
+func TestRotateCalendarClock(t *testing.T) {
+	utc8 := time.FixedZone("UTC+8", 8*3600)
+	type step struct {
+		add  time.Duration
+		roll bool
+	}
+	for name, c := range map[string]struct {
+		checker *calendarChecker
+		loc     *time.Location
+		start   time.Time
+		steps   []step
+	}{
+		"Hourly": {RotateHourly(), time.UTC, time.Date(2030, 1, 1, 10, 30, 0, 0, time.UTC), []step{
+			{20 * time.Minute, false}, {20 * time.Minute, true}, {40 * time.Minute, false}, {2 * time.Hour, true}, {0, false},
+		}},
+		// the local midnight is 16:00 in UTC
+		"DailyLocal": {RotateDaily(), utc8, time.Date(2030, 1, 1, 15, 30, 0, 0, time.UTC), []step{
+			{20 * time.Minute, false}, {20 * time.Minute, true}, {8 * time.Hour, false}, {16 * time.Hour, true},
+		}},
+		"DailyUTC": {RotateDaily(), time.UTC, time.Date(2030, 1, 1, 15, 30, 0, 0, time.UTC), []step{
+			{40 * time.Minute, false}, {8 * time.Hour, true}, {23 * time.Hour, false}, {2 * time.Hour, true},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{now: c.start}
+			mfs := NewMemFS()
+			mfs.setClock(clock)
+			r := NewC("/mem/app.log", WithFS(mfs), OptionFunc(func(r *Roll) {
+				r.WithClock(clock).WithLocation(c.loc).WithChecker(c.checker).WithDefaultMatcher().WithDefaultProcessor()
+			}))
+			if r == nil {
+				t.Fatal("nil roll")
+			}
+			defer r.Close()
+
+			rolls := 0
+			for i, s := range c.steps {
+				clock.Add(s.add)
+				rolled, err := r.CheckNow()
+				if err != nil || rolled != s.roll {
+					t.Fatal(i, clock.Now(), rolled, err)
+				}
+				if rolled {
+					rolls++
+				}
+			}
+			if _, err := mfs.Stat(fmt.Sprintf("/mem/app.log.%d", rolls)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := mfs.Stat(fmt.Sprintf("/mem/app.log.%d", rolls+1)); !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMaxAgeFilterClock(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/app.log.1", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &fakeClock{now: time.Now()}
+	f := MaxAgeFilter(time.Hour)
+	f.setClock(clock)
+
+	remains, filtered, _ := f.Filter(entries)
+	if len(remains) != 1 || len(filtered) != 0 {
+		t.Fatal(remains, filtered)
+	}
+
+	clock.Add(2 * time.Hour)
+	remains, filtered, _ = f.Filter(entries)
+	if len(remains) != 0 || len(filtered) != 1 {
+		t.Fatal(remains, filtered)
+	}
+
+	remains, _, _ = MaxAgeFilter(0).Filter(entries)
+	if len(remains) != 1 {
+		t.Fatal("MaxAgeFilter(0) drops the files")
+	}
+}
+
+func TestMaxAgeByNameFilter(t *testing.T) {
+	mfs := NewMemFS()
+	rolled := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	n := TimestampNamer("")
+	for _, name := range []string{
+		"app.log",
+		n.Name("app.log", 1, rolled),
+		n.Name("app.log", 2, rolled.Add(-2*time.Hour)) + ".gz",
+	} {
+		f, err := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	entries, _ := mfs.ReadDir("/mem")
+
+	// the ModTime is now, but the names are hours old
+	clock := &fakeClock{now: rolled.Add(30 * time.Minute)}
+	f := MaxAgeByNameFilter(time.Hour, n)
+	f.Init("app.log")
+	f.setClock(clock)
+
+	remains, filtered, err := f.Filter(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remains) != 2 || len(filtered) != 1 || filtered[0].Name() != "app.log.20240601T100000.gz" {
+		t.Fatal(remains, filtered)
+	}
+
+	// the active file without a timestamp falls back to the ModTime
+	clock.now = time.Now().Add(2 * time.Hour)
+	remains, filtered, _ = f.Filter(entries)
+	if len(remains) != 0 || len(filtered) != 3 {
+		t.Fatal(remains, filtered)
+	}
+}
+
+func TestTieredFilter(t *testing.T) {
+	mfs := NewMemFS()
+	n := TimestampNamer("")
+	at := func(month time.Month, day, hour, min int) string {
+		return n.Name("app.log", 1, time.Date(2024, month, day, hour, min, 0, 0, time.UTC))
+	}
+	names := []string{
+		"app.log",
+		at(6, 10, 12, 0),
+		at(6, 10, 11, 40),
+		at(6, 10, 11, 10),
+		at(6, 8, 9, 0),
+		at(6, 8, 3, 0),
+		at(5, 1, 0, 0),
+		at(4, 30, 0, 0),
+	}
+	for _, name := range names {
+		f, err := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	entries, _ := mfs.ReadDir("/mem")
+	s := TimestampSorter(n)
+	s.Init("app.log")
+	s.Sort(entries)
+
+	clock := &fakeClock{now: time.Date(2024, 6, 10, 12, 30, 0, 0, time.UTC)}
+	f := TieredFilter(
+		Tier{Bucket: WeekBucket, Keep: 1},
+		Tier{Within: 7 * 24 * time.Hour, Bucket: DayBucket, Keep: 1},
+		Tier{Within: 24 * time.Hour, Bucket: HourBucket, Keep: 1},
+	).WithNamer(n).In(time.UTC)
+	f.Init("app.log")
+	f.setClock(clock)
+
+	remains, filtered, err := f.Filter(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range filtered {
+		got = append(got, e.Name())
+	}
+	want := []string{names[3], names[5], names[7]}
+	if len(remains) != 5 || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("filtered %v, want %v", got, want)
+	}
+	if reason := f.Reason(filtered[0]); reason != "hour=2024-06-10T11 keep=1" {
+		t.Errorf("reason %q", reason)
+	}
+
+	// without an unlimited tier the older backups are filtered
+	f = TieredFilter(Tier{Within: 24 * time.Hour, Bucket: DayBucket, Keep: 2}).WithNamer(n).In(time.UTC)
+	f.Init("app.log")
+	f.setClock(clock)
+	remains, filtered, _ = f.Filter(entries)
+	if len(remains) != 3 || len(filtered) != 5 || remains[0].Name() != "app.log" {
+		t.Fatal(remains, filtered)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// cmdPumpBufSize is the longest line kept in one record, the longer lines are split.
+const cmdPumpBufSize = 64 * 1024
+
+// CmdPump pumps the output of the child processes into a Roll through a pipe.
+//
+// A child holding the file itself keeps writing to the rolled file after the rotation,
+// the pipe lets the Roll follow the rotations. The output is written line by line,
+// so a line never straddles the rotation.
+type CmdPump struct {
+	r  *Roll
+	pr *os.File
+	pw *os.File
+
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+// NewCmdPump creates a pipe pumped into r, File returns the write end for the child processes.
+func NewCmdPump(r *Roll) (*CmdPump, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	p := &CmdPump{
+		r:    r,
+		pr:   pr,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	go p.pump()
+	return p, nil
+}
+
+// AttachCmd sets both the stdout and the stderr of cmd to a CmdPump of r, it must be called before cmd.Start.
+//
+// eg.
+//
+//	p, err := rf.AttachCmd(cmd)
+//	...
+//	err = cmd.Run()
+//	p.Close()
+func (r *Roll) AttachCmd(cmd *exec.Cmd) (*CmdPump, error) {
+	p, err := NewCmdPump(r)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = p.File()
+	cmd.Stderr = p.File()
+	return p, nil
+}
+
+// File returns the write end of the pipe, eg. for exec.Cmd.Stdout.
+//
+// Being an *os.File, exec.Cmd hands it to the child directly, so cmd.Wait does not wait for the
+// grandchildren inheriting it.
+func (p *CmdPump) File() *os.File {
+	return p.pw
+}
+
+// Close closes the write end in this process, it can be called once the children are started.
+// It returns after the pump drains the pipe, that is all the children holding it exit,
+// and returns the first error of writing to the Roll. The Roll is not closed.
+func (p *CmdPump) Close() error {
+	p.closeOnce.Do(func() {
+		p.pw.Close()
+	})
+	<-p.done
+	return p.err
+}
+
+func (p *CmdPump) pump() {
+	defer close(p.done)
+	defer p.pr.Close()
+
+	br := bufio.NewReaderSize(p.pr, cmdPumpBufSize)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			if _, werr := p.r.Write(line); werr != nil && p.err == nil {
+				p.err = werr
+			}
+		}
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return
+		default:
+			if p.err == nil {
+				p.err = err
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command rollingf rolls, purges, compresses, verifies and lists the backups of a log file by the rollingf library,
+// with its exact semantics, eg. from a cron job or by an operator.
+//
+// Usage:
+//
+//	rollingf <command> [flags]
+//
+// The commands are:
+//
+//	list      list the backups, their total size and the policy they suggest, the file is not opened
+//	rotate    roll the file now, the backups are processed before it exits
+//	purge     remove the backups beyond the retention, -dry-run only lists them
+//	compress  compress the backups in -format, or transcode the ones in the other formats
+//	verify    decompress the compressed backups and report the corrupt ones, the file is not opened
+//
+// The file is described by the flags, eg.
+//
+//	rollingf purge -file /var/log/app.log -max-backups 7 -max-age 30d -compress gzip
+//
+// or by -config, a JSON rollingf.Spec whose file_path is overridden by -file. The checkers of the Spec are
+// ignored, the file is only rolled by the rotate command.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ignorantshr/rollingf"
+)
+
+const usage = `usage: rollingf <command> [flags]
+
+commands:
+  list      list the backups, their total size and the policy they suggest
+  rotate    roll the file now
+  purge     remove the backups beyond the retention
+  compress  compress the backups in -format
+  verify    report the corrupt compressed backups
+
+Run "rollingf <command> -h" for the flags.
+`
+
+// manualChecker never rolls, the CLI rolls by the rotate command only.
+type manualChecker struct{}
+
+func (manualChecker) Name() string                                { return "manual" }
+func (manualChecker) Check(string, *rollingf.Rstat) (bool, error) { return false, nil }
+
+func init() {
+	rollingf.RegisterChecker("manual", func(rollingf.Params) (rollingf.Checker, error) {
+		return manualChecker{}, nil
+	})
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// options are the flags shared by the commands.
+type options struct {
+	config     string
+	file       string
+	maxBackups int
+	maxAge     string
+	compress   string
+	format     string
+	minAge     time.Duration
+	dryRun     bool
+	timeout    time.Duration
+}
+
+// run runs the command of args and returns the exit code, 2 for the bad usage.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+	commands := map[string]func(context.Context, rollingf.Spec, *options, io.Writer) error{
+		"list":     list,
+		"rotate":   rotate,
+		"purge":    purge,
+		"compress": compress,
+		"verify":   verify,
+	}
+	fn, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(stderr, "rollingf: unknown command %q\n%s", cmd, usage)
+		return 2
+	}
+
+	var o options
+	fs := flag.NewFlagSet("rollingf "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&o.config, "config", "", "the JSON `file` of a rollingf.Spec")
+	fs.StringVar(&o.file, "file", "", "the `path` of the log file, overrides the file_path of -config")
+	fs.IntVar(&o.maxBackups, "max-backups", -1, "keep at most `n` backups, -1 for no limit")
+	fs.StringVar(&o.maxAge, "max-age", "", "remove the backups older than `age`, eg. 30d")
+	fs.StringVar(&o.compress, "compress", "", "compress the backups rolled by `format`, gzip or zlib")
+	switch cmd {
+	case "purge":
+		fs.BoolVar(&o.dryRun, "dry-run", false, "list the backups to remove without removing them")
+	case "compress":
+		fs.StringVar(&o.format, "format", string(rollingf.Gzip), "the compression `format`, gzip, zlib or empty to decompress")
+		fs.DurationVar(&o.minAge, "min-age", 0, "leave the backups rolled within `duration`")
+	}
+	fs.DurationVar(&o.timeout, "timeout", 0, "give up after `duration`, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "rollingf %s: unexpected arguments %v\n", cmd, fs.Args())
+		return 2
+	}
+
+	spec, err := o.spec()
+	if err != nil {
+		fmt.Fprintf(stderr, "rollingf %s: %v\n", cmd, err)
+		return 2
+	}
+
+	ctx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	if err := fn(ctx, spec, &o, stdout); err != nil {
+		fmt.Fprintf(stderr, "rollingf %s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// spec describes the file by -config and the other flags.
+func (o *options) spec() (rollingf.Spec, error) {
+	var spec rollingf.Spec
+	if o.config != "" {
+		b, err := os.ReadFile(o.config)
+		if err != nil {
+			return spec, err
+		}
+		if err = json.Unmarshal(b, &spec); err != nil {
+			return spec, fmt.Errorf("%s: %w", o.config, err)
+		}
+	}
+	if o.file != "" {
+		spec.FilePath = o.file
+	}
+	if spec.FilePath == "" {
+		return spec, errors.New("no file, see -file and -config")
+	}
+
+	if o.maxBackups >= 0 {
+		spec.Filters = append(spec.Filters, rollingf.ComponentSpec{Type: "max_backups", Params: rollingf.Params{"count": o.maxBackups}})
+	}
+	if o.maxAge != "" {
+		spec.Filters = append(spec.Filters, rollingf.ComponentSpec{Type: "max_age", Params: rollingf.Params{"age": o.maxAge}})
+	}
+	if o.compress != "" {
+		spec.Processors = []rollingf.ComponentSpec{{Type: o.compress}}
+	}
+	spec.Checkers = []rollingf.ComponentSpec{{Type: "manual"}}
+	return spec, nil
+}
+
+func inspect(spec rollingf.Spec) (*rollingf.Inventory, error) {
+	m, err := spec.BuildMatcher()
+	if err != nil {
+		return nil, err
+	}
+	return rollingf.Inspect(spec.FilePath, m)
+}
+
+func list(_ context.Context, spec rollingf.Spec, _ *options, w io.Writer) error {
+	inv, err := inspect(spec)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tMODIFIED\tFORMAT")
+	if inv.Exists {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t-\n", inv.Path, inv.Size, inv.ModTime.Format(time.RFC3339))
+	}
+	for _, b := range inv.Backups {
+		format := string(b.Format)
+		if b.Format == rollingf.NoCompress {
+			format = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", b.Path, b.Size, b.ModTime.Format(time.RFC3339), format)
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+
+	p := inv.Policy
+	fmt.Fprintf(w, "\n%d backups, %d bytes in total\n", len(inv.Backups), inv.TotalSize)
+	if len(inv.Backups) > 0 {
+		fmt.Fprintf(w, "oldest %v ago, every %v", p.MaxAge.Truncate(time.Second), p.Interval.Truncate(time.Second))
+		if p.Format != rollingf.NoCompress {
+			fmt.Fprintf(w, ", %s after %d", p.Format, p.Uncompressed)
+		}
+		fmt.Fprintln(w)
+	}
+	if inv.State != nil {
+		fmt.Fprintf(w, "last rotation %s, %d rotations\n", inv.State.LastRotation.Format(time.RFC3339), inv.State.Sequence)
+	}
+	for _, name := range p.Interrupted {
+		fmt.Fprintf(w, "interrupted: %s\n", name)
+	}
+	return nil
+}
+
+func verify(ctx context.Context, spec rollingf.Spec, _ *options, w io.Writer) error {
+	inv, err := inspect(spec)
+	if err != nil {
+		return err
+	}
+	errs := inv.Verify(ctx)
+	for _, err := range errs {
+		fmt.Fprintln(w, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d backups failed", len(errs), len(inv.Backups))
+	}
+	return nil
+}
+
+// withRoll builds the Roll of spec and runs fn with it, the rolling in progress is finished until ctx is done.
+func withRoll(ctx context.Context, spec rollingf.Spec, fn func(*rollingf.Roll) error) error {
+	r, err := spec.Build()
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	var rotateErr error
+	r.OnRotate(func(ev rollingf.RotateEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		rotateErr = ev.Err
+	})
+
+	err = fn(r)
+	if serr := r.Shutdown(ctx); err == nil {
+		err = serr
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err == nil {
+		err = rotateErr
+	}
+	return err
+}
+
+func rotate(ctx context.Context, spec rollingf.Spec, _ *options, _ io.Writer) error {
+	return withRoll(ctx, spec, func(r *rollingf.Roll) error {
+		return r.MarkRotate()
+	})
+}
+
+func purge(ctx context.Context, spec rollingf.Spec, o *options, w io.Writer) error {
+	return withRoll(ctx, spec, func(r *rollingf.Roll) error {
+		if !o.dryRun {
+			return r.Purge(ctx)
+		}
+		results, err := r.PurgeDryRun(ctx)
+		for _, res := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", res.Name, res.Filter, res.Reason)
+		}
+		return err
+	})
+}
+
+func compress(ctx context.Context, spec rollingf.Spec, o *options, w io.Writer) error {
+	return withRoll(ctx, spec, func(r *rollingf.Roll) error {
+		done, err := r.Recompress(ctx, rollingf.CompressFormat(o.format), o.minAge)
+		for _, name := range done {
+			fmt.Fprintln(w, name)
+		}
+		return err
+	})
+}
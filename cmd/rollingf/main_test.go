@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func names(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2", "app.log.3"} {
+		if err := os.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec := func(args ...string) (int, string) {
+		var out, errOut bytes.Buffer
+		code := run(args, &out, &errOut)
+		if errOut.Len() > 0 {
+			t.Log(errOut.String())
+		}
+		return code, out.String()
+	}
+
+	if code, out := exec("list", "-file", fp); code != 0 || !strings.Contains(out, "3 backups, 34 bytes in total") {
+		t.Fatal(code, out)
+	}
+
+	if code, out := exec("purge", "-file", fp, "-max-backups", "2", "-dry-run"); code != 0 || !strings.Contains(out, "app.log.3\tMaxBackupsFilter") {
+		t.Fatal(code, out)
+	}
+	if code, _ := exec("purge", "-file", fp, "-max-backups", "2"); code != 0 {
+		t.Fatal(code)
+	}
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"app.log", "app.log.1", "app.log.2"}) {
+		t.Fatal(got)
+	}
+
+	if code, out := exec("compress", "-file", fp, "-compress", "gzip"); code != 0 || strings.Count(out, "\n") != 2 {
+		t.Fatal(code, out)
+	}
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"app.log", "app.log.1.gz", "app.log.2.gz"}) {
+		t.Fatal(got)
+	}
+
+	if code, _ := exec("rotate", "-file", fp, "-compress", "gzip"); code != 0 {
+		t.Fatal(code)
+	}
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"app.log", "app.log.1.gz", "app.log.2.gz", "app.log.3.gz"}) {
+		t.Fatal(got)
+	}
+	f, _ := os.Open(path.Join(dir, "app.log.1.gz"))
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	b.ReadFrom(gr)
+	f.Close()
+	if b.String() != "app.log" {
+		t.Fatalf("%q", b)
+	}
+
+	if code, _ := exec("verify", "-file", fp, "-compress", "gzip"); code != 0 {
+		t.Fatal(code)
+	}
+	if err := os.WriteFile(path.Join(dir, "app.log.2.gz"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := exec("verify", "-file", fp, "-compress", "gzip"); code != 1 || !strings.Contains(out, "app.log.2.gz") {
+		t.Fatal(code, out)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	for _, name := range []string{"app.log.1", "app.log.2"} {
+		if err := os.WriteFile(path.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := path.Join(dir, "spec.json")
+	spec := `{"file_path": "` + fp + `", "checkers": [{"type": "max_size", "params": {"size": 1}}],
+		"filters": [{"type": "max_backups", "params": {"count": 1}}]}`
+	if err := os.WriteFile(config, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if code := run([]string{"purge", "-config", config}, &out, &errOut); code != 0 {
+		t.Fatal(code, errOut.String())
+	}
+	if got := names(t, dir); !reflect.DeepEqual(got, []string{"app.log", "app.log.1", "spec.json"}) {
+		t.Fatal(got)
+	}
+
+	for _, args := range [][]string{nil, {"bogus"}, {"list"}, {"list", "-file", fp, "extra"}, {"list", "-bogus"}} {
+		if code := run(args, &out, &errOut); code != 2 {
+			t.Error(args, code)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package rollingf
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttachCmd(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	rotated := make(chan struct{}, 1)
+	r.OnRotate(func(RotateEvent) { rotated <- struct{}{} })
+
+	// the child outlives the rotation
+	cmd := exec.Command(sh, "-c", "echo before; read x; echo after >&2")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := r.AttachCmd(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if b, _ := os.ReadFile(fp); strings.Contains(string(b), "before") {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err = r.roll("test"); err != nil {
+		t.Fatal(err)
+	}
+	<-rotated
+	stdin.Write([]byte("\n"))
+	if err = cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(fp); string(b) != "after\n" {
+		t.Fatalf("file: %q", b)
+	}
+	if b, _ := os.ReadFile(fp + ".1"); string(b) != "before\n" {
+		t.Fatalf("backup: %q", b)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultCompressLevel is the default level of gzip and zlib, see Compressor.WithLevel.
+const DefaultCompressLevel = flate.DefaultCompression
+
+// resetWriter is a compressing writer which can be reused for another output, eg. *gzip.Writer.
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// codec is a compression format with its settings, the zero value is NoCompress.
+type codec struct {
+	format CompressFormat
+	level  int
+	// dict is the preset dictionary of Zlib, a string to key the pools.
+	dict string
+}
+
+// writerPools pools the compressing writers by the codec, each writer allocates
+// hundreds of KB for its window and tables.
+var writerPools sync.Map // codec -> *sync.Pool
+
+// copyBufPool pools the buffers copying the content of the backups.
+var copyBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 32*1024)
+		return &b
+	},
+}
+
+// writer returns a writer compressing to w, Close flushes it and returns it to the pool.
+// It returns an error if the level is invalid, or a dictionary is given to Gzip which has none.
+func (c codec) writer(w io.Writer) (io.WriteCloser, error) {
+	if c.format == NoCompress {
+		return nopWriteCloser{w}, nil
+	}
+	v, ok := writerPools.Load(c)
+	if !ok {
+		v, _ = writerPools.LoadOrStore(c, &sync.Pool{})
+	}
+	pool := v.(*sync.Pool)
+	if zw, ok := pool.Get().(resetWriter); ok {
+		zw.Reset(w)
+		return &pooledWriter{resetWriter: zw, pool: pool}, nil
+	}
+
+	var zw resetWriter
+	var err error
+	switch c.format {
+	case Gzip:
+		if c.dict != "" {
+			return nil, errors.New("rollingf: gzip has no preset dictionary")
+		}
+		zw, err = gzip.NewWriterLevel(w, c.level)
+	case Zlib:
+		zw, err = zlib.NewWriterLevelDict(w, c.level, []byte(c.dict))
+	default:
+		return nil, fmt.Errorf("rollingf: unsupported compress format %q", c.format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pooledWriter{resetWriter: zw, pool: pool}, nil
+}
+
+// reader returns the reader of the content of r compressed by c. The dictionary is only used by the streams
+// compressed with it, so the backups compressed before it was set are read as well.
+func (c codec) reader(r io.Reader) (io.ReadCloser, error) {
+	switch c.format {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zlib:
+		return zlib.NewReaderDict(r, []byte(c.dict))
+	}
+	return io.NopCloser(r), nil
+}
+
+// pooledWriter returns the writer to its pool on Close.
+type pooledWriter struct {
+	resetWriter
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.resetWriter.Close()
+	// the writer must not hold the output
+	w.resetWriter.Reset(io.Discard)
+	w.pool.Put(w.resetWriter)
+	return err
+}
+
+// copyPooled is io.Copy by a pooled buffer.
+func copyPooled(dst io.Writer, src io.Reader) (int64, error) {
+	bp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bp)
+	return io.CopyBuffer(dst, src, *bp)
+}
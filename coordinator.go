@@ -0,0 +1,83 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"sync"
+)
+
+// Coordinator staggers the filtering and processing of the rollings across the processes,
+// eg. the replicas writing distinct files to a shared volume, to smooth the I/O of the backend.
+//
+// The writes are never blocked, they go to the temporary file while waiting for the Coordinator.
+type Coordinator interface {
+	// Lock blocks until the caller is allowed to filter and process the files.
+	Lock() error
+	Unlock() error
+}
+
+var _ Coordinator = (*fileLock)(nil)
+
+type fileLock struct {
+	path string
+
+	mu sync.Mutex // serializes the Rolls of this process sharing the fileLock
+	f  *os.File
+}
+
+// FileLockCoordinator coordinates the processes by an exclusive advisory lock on the file at lockPath,
+// which is created if not exists. All the processes must use the same lockPath on the shared volume.
+//
+// The lock is released by the OS if the process dies. Only the Rolls of this process are coordinated on
+// the platforms without flock(2), eg. windows.
+func FileLockCoordinator(lockPath string) *fileLock {
+	return &fileLock{
+		path: lockPath,
+	}
+}
+
+func (l *fileLock) Lock() error {
+	l.mu.Lock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		l.mu.Unlock()
+		return err
+	}
+	l.f = f
+	return nil
+}
+
+func (l *fileLock) Unlock() error {
+	defer l.mu.Unlock()
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
+
+// Coordinate waits for c before filtering and processing the files of every rolling.
+func Coordinate(c Coordinator) Option {
+	return OptionFunc(func(r *Roll) {
+		r.coordinator = c
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"time"
+)
+
+var (
+	_ FS            = (*createFS)(nil)
+	_ chtimeser     = (*createFS)(nil)
+	_ fsWrapper     = (*createFS)(nil)
+	_ symlinker     = (*createFS)(nil)
+	_ mkdirAller    = (*createFS)(nil)
+	_ emitterSetter = (*createFS)(nil)
+)
+
+// CreateDirs creates the directories of the files created by the Roll if they are missing, on start and whenever
+// they are removed at runtime, eg. an emptyDir of a container remounted. Each directory created again is reported
+// by a DirCreated event. The next rolling opens the file again in the directory created, or WatchFile does it
+// at once, the writes in between are lost with the directory. The directory fd held on Linux is opened again too.
+//
+// It must follow the WithFS option. The directories are created with the permissions 0755 before the umask.
+func CreateDirs() Option {
+	return OptionFunc(func(r *Roll) {
+		r.createFS().dirs = true
+	})
+}
+
+// WithOwner chowns the files created by the Roll to uid and gid, the file, the backups compressed and the other outputs,
+// eg. when the process runs as root but the logs must belong to a service user. The renamed backups keep the owner of the file.
+// A uid or gid of -1 is not changed, the same as os.Chown.
+//
+// It must follow the WithFS option. It is a no-op on the platforms without chown(2) and the FS whose files have no fd, eg. MemFS.
+func WithOwner(uid, gid int) Option {
+	return OptionFunc(func(r *Roll) {
+		f := r.createFS()
+		f.chown, f.uid, f.gid = true, uid, gid
+	})
+}
+
+// WithFileMode sets the permissions of the files created by the Roll to mode exactly, whatever the umask of the process,
+// by chmod(2) after the creation, eg. 0640 for the audit requirements. The file opened again is chmoded too.
+// The renamed backups keep the permissions of the file.
+//
+// It must follow the WithFS option. It is a no-op on the FS whose files have no fd, eg. MemFS.
+func WithFileMode(mode os.FileMode) Option {
+	return OptionFunc(func(r *Roll) {
+		r.createFS().mode = mode.Perm()
+	})
+}
+
+// createFS returns the createFS wrapping the FS, it wraps the FS first if not yet.
+func (r *Roll) createFS() *createFS {
+	if f, ok := r.fs.(*createFS); ok {
+		return f
+	}
+	f := &createFS{FS: r.fs}
+	r.fs = f
+	r.setupAll()
+	return f
+}
+
+// createFS sets the owner and the permissions of the files opened with os.O_CREATE.
+type createFS struct {
+	FS
+	chown    bool
+	uid, gid int
+	mode     os.FileMode // not changed if 0
+	dirs     bool        // CreateDirs
+	emit     func(Event)
+}
+
+func (f *createFS) unwrapFS() FS {
+	return f.FS
+}
+
+func (f *createFS) setEmitter(emit func(Event)) {
+	f.emit = emit
+}
+
+func (f *createFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if f.mode != 0 {
+		perm = f.mode
+	}
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if os.IsNotExist(err) && f.dirs && flag&os.O_CREATE != 0 {
+		if err = f.ensureDir(path.Dir(name)); err != nil {
+			return nil, err
+		}
+		// the directory fd of the FS refers to the removed directory
+		if err = renewDir(f.FS); err != nil {
+			return nil, err
+		}
+		file, err = f.FS.OpenFile(name, flag, perm)
+	}
+	if err != nil || flag&os.O_CREATE == 0 {
+		return file, err
+	}
+	if err = f.setAttrs(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// ensureDir creates dir if it is missing and CreateDirs is set.
+func (f *createFS) ensureDir(dir string) error {
+	if !f.dirs {
+		return nil
+	}
+	if _, err := f.FS.Stat(dir); !os.IsNotExist(err) {
+		return err
+	}
+	if err := mkdirAll(f.FS, dir, 0755); err != nil {
+		return err
+	}
+	debug("[createFS] created %s", dir)
+	if f.emit != nil {
+		f.emit(DirCreated{Name: dir})
+	}
+	return nil
+}
+
+// ensureDir creates the directory of the file if it is missing and CreateDirs is set.
+func (r *Roll) ensureDir() error {
+	if f, ok := r.fs.(*createFS); ok {
+		return f.ensureDir(path.Dir(r.filePath))
+	}
+	return nil
+}
+
+// setAttrs chowns and chmods file by its fd.
+func (f *createFS) setAttrs(file File) error {
+	if f.chown {
+		if err := chownFile(file, f.uid, f.gid); err != nil {
+			return err
+		}
+	}
+	if f.mode != 0 {
+		if c, ok := file.(interface{ Chmod(mode os.FileMode) error }); ok {
+			return c.Chmod(f.mode)
+		}
+	}
+	return nil
+}
+
+func (f *createFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if c, ok := f.FS.(chtimeser); ok {
+		return c.Chtimes(name, atime, mtime)
+	}
+	return nil
+}
+
+func (f *createFS) Symlink(target, link string) error {
+	if s, ok := f.FS.(symlinker); ok {
+		return s.Symlink(target, link)
+	}
+	debug("[createFS] %T does not support symlinks", f.FS)
+	return nil
+}
+
+func (f *createFS) MkdirAll(name string, perm os.FileMode) error {
+	return mkdirAll(f.FS, name, perm)
+}
@@ -0,0 +1,110 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("chown needs root")
+	}
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WithOwner(65534, 65534), Compress(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	r.Write([]byte("a\n"))
+	if err = rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	for _, name := range []string{"app.log", "app.log.1.gz"} {
+		info, err := os.Stat(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st := info.Sys().(*syscall.Stat_t); st.Uid != 65534 || st.Gid != 65534 {
+			t.Errorf("%s: %d:%d", name, st.Uid, st.Gid)
+		}
+	}
+}
+
+func TestWithFileMode(t *testing.T) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WithFileMode(0644), Compress(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	r.Write([]byte("a\n"))
+	if err = rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	for _, name := range []string{"app.log", "app.log.1.gz"} {
+		info, err := os.Stat(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0644 {
+			t.Errorf("%s: %v", name, info.Mode())
+		}
+	}
+}
+
+func TestCreateDirs(t *testing.T) {
+	dir := path.Join(t.TempDir(), "logs")
+	fp := path.Join(dir, "app.log")
+	r := NewC(fp, CreateDirs()).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	evs := r.Events()
+	rotated := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { rotated <- ev })
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := rollSync(t, r, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(fp); err != nil || string(b) != "after" {
+		t.Fatalf("%q %v", b, err)
+	}
+	if _, err := os.Stat(fp + ".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-evs:
+		if ev, ok := ev.(DirCreated); !ok || ev.Name != dir {
+			t.Fatalf("%#v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no DirCreated")
+	}
+}
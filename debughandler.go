@@ -0,0 +1,190 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// DebugHandler returns a http.Handler for inspecting and controlling the Roll on a live service, mount it under any prefix:
+//
+//	GET  {prefix}         the stats, the backups and the recent rotations in JSON
+//	POST {prefix}/rotate  rotates the file now
+//	POST {prefix}/purge   runs the filters over the backups now, without rotating
+//	                      with ?dry_run=1, returns the backups the filters would remove and why in JSON instead
+//
+// eg.
+//
+//	http.Handle("/debug/rollingf/", http.StripPrefix("/debug/rollingf", rf.DebugHandler()))
+//
+// The handler is not authenticated, protect it as the other debug endpoints, eg. net/http/pprof.
+func (r *Roll) DebugHandler() http.Handler {
+	return http.HandlerFunc(r.serveDebug)
+}
+
+type debugStatus struct {
+	File      string          `json:"file"`
+	Size      int64           `json:"size"`
+	Stats     debugStats      `json:"stats"`
+	Backups   []debugBackup   `json:"backups"`
+	Rotations []debugRotation `json:"rotations"`
+}
+
+type debugStats struct {
+	Rotations    int64     `json:"rotations"`
+	Failures     int64     `json:"failures"`
+	LastRotation time.Time `json:"last_rotation"`
+	LastReason   string    `json:"last_reason,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	Dropped      int64     `json:"dropped"`
+	Fallbacks    int64     `json:"fallbacks"`
+}
+
+type debugBackup struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Age        string    `json:"age"`
+	Compressed bool      `json:"compressed"`
+	Index      int       `json:"index,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+type debugRotation struct {
+	Cycle    uint64    `json:"cycle"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"time"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func (r *Roll) serveDebug(w http.ResponseWriter, req *http.Request) {
+	action := path.Base(strings.TrimSuffix(req.URL.Path, "/"))
+	switch {
+	case action == "rotate" || action == "purge":
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if action == "purge" && req.URL.Query().Get("dry_run") != "" {
+			r.serveDryRun(w, req)
+			return
+		}
+		var err error
+		if action == "rotate" {
+			err = r.roll("rotated by DebugHandler")
+		} else {
+			err = r.Purge(req.Context())
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+		status, err := r.debugStatus()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(status)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+type debugRemoval struct {
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r *Roll) serveDryRun(w http.ResponseWriter, req *http.Request) {
+	results, err := r.PurgeDryRun(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	removals := []debugRemoval{}
+	for _, res := range results {
+		removals = append(removals, debugRemoval{Name: res.Name, Filter: res.Filter, Reason: res.Reason})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(removals)
+}
+
+func (r *Roll) debugStatus() (*debugStatus, error) {
+	s := r.stats.snapshot()
+	status := &debugStatus{
+		File: r.filePath,
+		Stats: debugStats{
+			Rotations:    s.Rotations,
+			Failures:     s.Failures,
+			LastRotation: s.LastRotation,
+			LastReason:   s.LastReason,
+			Dropped:      s.Dropped,
+			Fallbacks:    s.Fallbacks,
+		},
+		Backups:   []debugBackup{},
+		Rotations: []debugRotation{},
+	}
+	if s.LastError != nil {
+		status.Stats.LastError = s.LastError.Error()
+	}
+	if info, err := r.fs.Stat(r.filePath); err == nil {
+		status.Size = info.Size()
+	}
+
+	backups, err := r.Backups()
+	if err != nil {
+		return nil, err
+	}
+	now := r.now()
+	for _, b := range backups {
+		status.Backups = append(status.Backups, debugBackup{
+			Name:       b.Name,
+			Size:       b.Size,
+			ModTime:    b.ModTime,
+			Age:        now.Sub(b.ModTime).Truncate(time.Second).String(),
+			Compressed: b.Compressed,
+			Index:      b.Index,
+			Time:       b.Time,
+		})
+	}
+
+	for _, ev := range r.stats.recentRotations() {
+		rot := debugRotation{
+			Cycle:    ev.Cycle,
+			Reason:   ev.Reason,
+			Time:     ev.Time,
+			Duration: ev.Duration.String(),
+		}
+		if ev.Err != nil {
+			rot.Error = ev.Err.Error()
+		}
+		status.Rotations = append(status.Rotations, rot)
+	}
+	return status, nil
+}
@@ -0,0 +1,86 @@
+package rollingf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	rotated := make(chan struct{}, 1)
+	r.OnRotate(func(RotateEvent) { rotated <- struct{}{} })
+
+	for _, name := range []string{"app.log.1", "app.log.2", "app.log.3"} {
+		os.WriteFile(path.Join(dir, name), []byte(name), 0644)
+	}
+	srv := httptest.NewServer(http.StripPrefix("/debug", r.DebugHandler()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/debug/rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatal(resp.Status)
+	}
+
+	r.Write([]byte("x"))
+	resp, err = http.Post(srv.URL+"/debug/rotate", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal(resp.Status)
+	}
+	<-rotated
+
+	// the rotation kept 2 backups, add one more for the purge
+	os.WriteFile(path.Join(dir, "app.log.3"), []byte("3"), 0644)
+	resp, err = http.Post(srv.URL+"/debug/purge?dry_run=1", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removals []debugRemoval
+	err = json.NewDecoder(resp.Body).Decode(&removals)
+	resp.Body.Close()
+	if err != nil || len(removals) != 1 || removals[0].Name != path.Join(dir, "app.log.3") || removals[0].Reason != "count>2" {
+		t.Fatalf("%+v %v", removals, err)
+	}
+
+	resp, err = http.Post(srv.URL+"/debug/purge", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal(resp.Status)
+	}
+
+	resp, err = http.Get(srv.URL + "/debug/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status debugStatus
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Stats.Rotations != 1 || len(status.Rotations) != 1 || status.Rotations[0].Error != "" {
+		t.Fatalf("%+v", status)
+	}
+	if len(status.Backups) != 2 || status.Backups[0].Name != "app.log.1" || status.Backups[0].Size != 1 {
+		t.Fatalf("%+v", status.Backups)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+// ErrNoDefault is returned by the package-level Write when SetDefault has not been called.
+var ErrNoDefault = errors.New("rollingf: no default Roll, see SetDefault")
+
+var (
+	defaultMu   sync.RWMutex
+	defaultRoll *Roll
+)
+
+// SetDefault sets the Roll used by the package-level Write, nil unsets it.
+func SetDefault(r *Roll) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultRoll = r
+}
+
+// Default returns the Roll set by SetDefault, or nil.
+func Default() *Roll {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRoll
+}
+
+// Write writes p to the default Roll.
+func Write(p []byte) (int, error) {
+	r := Default()
+	if r == nil {
+		return 0, ErrNoDefault
+	}
+	return r.Write(p)
+}
+
+// RedirectStdLog points the standard library log package at r, and sets r as the default Roll.
+//
+// eg.
+//
+//	rollingf.RedirectStdLog(rollingf.New(rollingf.NewRollConf("/var/log/app.log", rollingf.DurOneDay, 100*rollingf.SizeMB, 0, 7)))
+func RedirectStdLog(r *Roll) {
+	if r == nil {
+		return
+	}
+	SetDefault(r)
+	log.SetOutput(r)
+}
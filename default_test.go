@@ -0,0 +1,38 @@
+package rollingf
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	if _, err := Write([]byte("x")); err != ErrNoDefault {
+		t.Fatal(err)
+	}
+
+	fp := t.TempDir() + "/app.log"
+	r := NewC(fp)
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	RedirectStdLog(r)
+	defer func() {
+		SetDefault(nil)
+		log.SetOutput(os.Stderr)
+	}()
+	if Default() != r {
+		t.Fatal("default not set")
+	}
+
+	Write([]byte("package\n"))
+	log.SetFlags(0)
+	defer log.SetFlags(log.LstdFlags)
+	log.Print("stdlog")
+
+	if b, _ := os.ReadFile(fp); string(b) != "package\nstdlog\n" {
+		t.Fatalf("%q", b)
+	}
+}
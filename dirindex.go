@@ -0,0 +1,242 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	_ FS        = (*indexFS)(nil)
+	_ fsWrapper = (*indexFS)(nil)
+	_ chtimeser = (*indexFS)(nil)
+	_ symlinker = (*indexFS)(nil)
+)
+
+// DirIndex caches the entries of the file's directory, and updates them by the renames, the removals and
+// the creations of the Roll, so the rollings do not read the whole directory of tens of thousands of backups.
+//
+// The cache is dropped once the modification time of the directory tells it is changed by the others,
+// though a change racing with an operation of the Roll is missed until the next one. It must follow the WithFS option, the FS must report the modification time of the directory.
+func DirIndex() Option {
+	return OptionFunc(func(r *Roll) {
+		if _, ok := r.fs.(*indexFS); ok {
+			return
+		}
+		r.fs = &indexFS{FS: r.fs, dir: path.Dir(r.filePath)}
+		r.setupAll()
+	})
+}
+
+// indexFS caches the sorted entries of dir, the other directories are passed through.
+type indexFS struct {
+	FS
+	dir string
+
+	mu      sync.Mutex
+	entries []os.DirEntry // sorted by name, nil if not cached
+	mod     time.Time     // the modification time of dir when the entries were known
+}
+
+// lazyEntry is the entry added to the cache, its info is read on demand as the file keeps changing.
+type lazyEntry struct {
+	fsys FS
+	name string
+	path string
+	typ  fs.FileMode
+}
+
+func (e *lazyEntry) Name() string               { return e.name }
+func (e *lazyEntry) IsDir() bool                { return e.typ.IsDir() }
+func (e *lazyEntry) Type() fs.FileMode          { return e.typ }
+func (e *lazyEntry) Info() (fs.FileInfo, error) { return e.fsys.Stat(e.path) }
+
+func (f *indexFS) unwrapFS() FS {
+	return f.FS
+}
+
+func (f *indexFS) inDir(name string) bool {
+	return path.Dir(name) == f.dir
+}
+
+// dirMod returns the modification time of dir, false if it is unknown.
+func (f *indexFS) dirMod() (time.Time, bool) {
+	info, err := f.FS.Stat(f.dir)
+	if err != nil || info.ModTime().IsZero() {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// fresh reports whether the cache is still valid, the caller holds f.mu.
+func (f *indexFS) fresh() bool {
+	if f.entries == nil {
+		return false
+	}
+	mod, ok := f.dirMod()
+	if !ok || !mod.Equal(f.mod) {
+		debug("[indexFS] %s is changed, drop the cache", f.dir)
+		f.entries = nil
+		return false
+	}
+	return true
+}
+
+// touched records the modification time of dir after an operation of the Roll, the caller holds f.mu.
+func (f *indexFS) touched() {
+	mod, ok := f.dirMod()
+	if !ok {
+		f.entries = nil
+		return
+	}
+	f.mod = mod
+}
+
+func (f *indexFS) find(name string) (int, bool) {
+	i := sort.Search(len(f.entries), func(i int) bool {
+		return f.entries[i].Name() >= name
+	})
+	return i, i < len(f.entries) && f.entries[i].Name() == name
+}
+
+func (f *indexFS) drop(name string) {
+	if i, ok := f.find(name); ok {
+		f.entries = append(f.entries[:i], f.entries[i+1:]...)
+	}
+}
+
+// add adds the file at p to the cache, the cache is dropped if the file is gone.
+func (f *indexFS) add(p string) {
+	info, err := f.FS.Stat(p)
+	if err != nil {
+		f.entries = nil
+		return
+	}
+	e := &lazyEntry{fsys: f.FS, name: path.Base(p), path: p, typ: info.Mode().Type()}
+	i, ok := f.find(e.name)
+	if ok {
+		f.entries[i] = e
+		return
+	}
+	f.entries = append(f.entries, nil)
+	copy(f.entries[i+1:], f.entries[i:])
+	f.entries[i] = e
+}
+
+func (f *indexFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if path.Clean(name) != f.dir {
+		return f.FS.ReadDir(name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.fresh() {
+		// the modification time is taken first, the changes meanwhile drop the cache next time
+		mod, ok := f.dirMod()
+		entries, err := f.FS.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return entries, nil
+		}
+		f.entries, f.mod = entries, mod
+	}
+	return append([]os.DirEntry(nil), f.entries...), nil
+}
+
+func (f *indexFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&os.O_CREATE == 0 || !f.inDir(name) {
+		return f.FS.OpenFile(name, flag, perm)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fresh := f.fresh()
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || !fresh {
+		return file, err
+	}
+	if _, ok := f.find(path.Base(name)); !ok {
+		f.add(name)
+	}
+	f.touched()
+	return file, nil
+}
+
+func (f *indexFS) Rename(oldpath, newpath string) error {
+	if !f.inDir(oldpath) && !f.inDir(newpath) {
+		return f.FS.Rename(oldpath, newpath)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fresh := f.fresh()
+	if err := f.FS.Rename(oldpath, newpath); err != nil || !fresh {
+		return err
+	}
+	if f.inDir(oldpath) {
+		f.drop(path.Base(oldpath))
+	}
+	if f.inDir(newpath) {
+		f.add(newpath)
+	}
+	f.touched()
+	return nil
+}
+
+func (f *indexFS) Remove(name string) error {
+	if !f.inDir(name) {
+		return f.FS.Remove(name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fresh := f.fresh()
+	if err := f.FS.Remove(name); err != nil || !fresh {
+		return err
+	}
+	f.drop(path.Base(name))
+	f.touched()
+	return nil
+}
+
+func (f *indexFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if c, ok := f.FS.(chtimeser); ok {
+		return c.Chtimes(name, atime, mtime)
+	}
+	return nil
+}
+
+func (f *indexFS) Symlink(target, link string) error {
+	s, ok := f.FS.(symlinker)
+	if !ok {
+		debug("[indexFS] %T does not support symlinks", f.FS)
+		return nil
+	}
+	if !f.inDir(link) {
+		return s.Symlink(target, link)
+	}
+	// the symlink replaced in dir changes dir
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = nil
+	return s.Symlink(target, link)
+}
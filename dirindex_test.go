@@ -0,0 +1,54 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// readDirCountFS counts the ReadDir calls.
+type readDirCountFS struct {
+	FS
+	n int
+}
+
+func (f *readDirCountFS) ReadDir(name string) ([]os.DirEntry, error) {
+	f.n++
+	return f.FS.ReadDir(name)
+}
+
+func TestDirIndex(t *testing.T) {
+	dir := t.TempDir()
+	cfs := &readDirCountFS{FS: osFS{}}
+	r, err := NewE(NewRollConf(path.Join(dir, "app.log"), DurOneDay, 0, 0, 3), WithFS(cfs), DirIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	for i := 0; i < 5; i++ {
+		r.Write([]byte("hello"))
+		if err := rollSync(t, r, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cfs.n != 1 {
+		t.Fatal(cfs.n, "reads of the directory")
+	}
+	backups, err := r.Backups()
+	if err != nil || len(backups) != 3 || backups[2].Name != "app.log.3" || backups[2].Size != 5 {
+		t.Fatalf("%+v %v", backups, err)
+	}
+
+	// an external change
+	time.Sleep(10 * time.Millisecond)
+	if err := os.Remove(path.Join(dir, "app.log.3")); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = r.Backups(); len(backups) != 2 || cfs.n != 2 {
+		t.Fatalf("%+v, %d reads", backups, cfs.n)
+	}
+}
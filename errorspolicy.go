@@ -0,0 +1,69 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "fmt"
+
+// ErrorsPolicy decides how the filters go on when dealing a filtered backup fails, eg. removing it by EBUSY or EACCES.
+type ErrorsPolicy int
+
+const (
+	AbortOnError ErrorsPolicy = iota // stop dealing the backups filtered by the filter at the first error, the default
+	SkipOnError                      // skip the backup failed and deal the rest, the errors are aggregated
+)
+
+// RetentionErrors sets the ErrorsPolicy of the filters, AbortOnError by default.
+//
+// Under SkipOnError a Filter which is not a FilterV2 deals the backups one by one by DealFiltered, so one stuck
+// backup never keeps the older ones after it. The failures of a rolling or a Purge are emitted as one ErrorEvent
+// of a *RetentionError instead of one per backup, and Purge returns it too. Roll.OnRemove still reports each backup.
+func RetentionErrors(policy ErrorsPolicy) Option {
+	return OptionFunc(func(r *Roll) {
+		r.errorsPolicy = policy
+	})
+}
+
+// RetentionError aggregates the backups the filters failed to deal under SkipOnError.
+type RetentionError struct {
+	Failed []FilterResult
+}
+
+func (e *RetentionError) Error() string {
+	first := e.Failed[0]
+	if len(e.Failed) == 1 {
+		return fmt.Sprintf("rollingf: %s failed to deal %s: %v", first.Filter, first.Name, first.Err)
+	}
+	return fmt.Sprintf("rollingf: failed to deal %d backups, the first by %s %s: %v",
+		len(e.Failed), first.Filter, first.Name, first.Err)
+}
+
+// Unwrap returns the error of the first backup failed, eg. for errors.Is(err, fs.ErrPermission).
+func (e *RetentionError) Unwrap() error {
+	return e.Failed[0].Err
+}
+
+// retentionError returns the *RetentionError of the failed results, nil if none failed.
+func retentionError(results []FilterResult) error {
+	var failed []FilterResult
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &RetentionError{Failed: failed}
+}
@@ -0,0 +1,102 @@
+package rollingf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// stuckFS fails the removals of the file stuck, like a file held open on Windows.
+type stuckFS struct {
+	FS
+	stuck string
+}
+
+func (f *stuckFS) Remove(name string) error {
+	if path.Base(name) == f.stuck {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	return f.FS.Remove(name)
+}
+
+// legacyFilter removes the files by the Filter interface only.
+type legacyFilter struct {
+	*maxBackupsFilter
+}
+
+func (f legacyFilter) DealFiltered(dir string, filtered []os.DirEntry) error {
+	for _, file := range filtered {
+		if err := removeFile(f.fs, dir, file.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRetentionErrors(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		policy ErrorsPolicy
+		filter Filter
+		want   []string
+	}{
+		{"abort", AbortOnError, MaxBackupsFilter(1), []string{"app.log", "app.log.1", "app.log.3", "app.log.4"}},
+		{"skip", SkipOnError, MaxBackupsFilter(1), []string{"app.log", "app.log.1", "app.log.3"}},
+		{"skip legacy", SkipOnError, legacyFilter{MaxBackupsFilter(1)}, []string{"app.log", "app.log.1", "app.log.3"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"app.log.1", "app.log.2", "app.log.3", "app.log.4"} {
+				if err := os.WriteFile(path.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := NewC(path.Join(dir, "app.log"), WithFS(&stuckFS{FS: osFS{}, stuck: "app.log.3"}), RetentionErrors(c.policy)).
+				WithDefaultMatcher().WithDefaultProcessor().WithFilter(c.filter)
+			if r == nil {
+				t.Fatal("nil roll")
+			}
+			defer r.Close()
+			events := r.Events()
+
+			err := r.Purge(context.Background())
+			var rerr *RetentionError
+			if c.policy == SkipOnError {
+				if !errors.As(err, &rerr) || len(rerr.Failed) != 1 || !errors.Is(err, syscall.EBUSY) {
+					t.Fatal(err)
+				}
+				if rerr.Failed[0].Name != path.Join(dir, "app.log.3") {
+					t.Fatal(rerr.Failed[0].Name)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if !reflect.DeepEqual(names, c.want) {
+				t.Fatalf("files %v, want %v", names, c.want)
+			}
+
+			var errs []error
+			for len(events) > 0 {
+				if ev, ok := (<-events).(ErrorEvent); ok {
+					errs = append(errs, ev.Err)
+				}
+			}
+			if len(errs) != 1 {
+				t.Fatal(errs)
+			}
+			if c.policy == SkipOnError && !errors.As(errs[0], &rerr) {
+				t.Fatal(errs[0])
+			}
+		})
+	}
+}
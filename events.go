@@ -0,0 +1,180 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"path"
+	"sync"
+	"time"
+)
+
+// EventBufferSize is the buffer of the channels returned by Roll.Events,
+// the events are dropped for a subscriber falling behind, the rolling never waits for it.
+var EventBufferSize = 64
+
+// Event is a rotation lifecycle event delivered by Roll.Events,
+// it is one of RotationStarted, RotationCompleted, BackupRemoved, CompressionDone, FileTampered, DirCreated and ErrorEvent.
+type Event interface {
+	event()
+}
+
+// RotationStarted is emitted when the writes are switched to the new file.
+type RotationStarted struct {
+	Cycle  uint64    // the ID of the check cycle
+	Reason string    // which checker triggered the rotation and why
+	Time   time.Time // when the rotation started
+}
+
+// RotationCompleted is emitted after the backups are processed.
+type RotationCompleted struct {
+	Cycle    uint64        // the ID of the check cycle
+	Old      string        // the path of the backup the rolled file became, empty if unknown
+	New      string        // the path of the file receiving the writes
+	Duration time.Duration // how long the processing took
+}
+
+// BackupRemoved is emitted for each backup removed by a filter.
+type BackupRemoved struct {
+	Name   string // the path of the removed backup
+	Reason string // the name of the filter which removed it
+	Detail string // why the filter removed it, eg. "age=49h0m0s max=48h0m0s", empty if the filter is not a FilterV2
+}
+
+// CompressionDone is emitted for each backup compressed.
+type CompressionDone struct {
+	Name   string // the path of the compressed backup
+	Format CompressFormat
+}
+
+// FileTampered is emitted when WatchFile finds the file changed by another process, after the Roll recovered.
+type FileTampered struct {
+	Name string // the path of the file
+	Kind string // "removed", "replaced" or "truncated"
+}
+
+// DirCreated is emitted when CreateDirs creates a directory missing, eg. the directory of the file removed at runtime.
+type DirCreated struct {
+	Name string // the path of the directory
+}
+
+// ErrorEvent is emitted for the errors of the rotation and the retention.
+type ErrorEvent struct {
+	Cycle uint64 // the ID of the check cycle, 0 if unknown
+	Err   error
+}
+
+func (RotationStarted) event()   {}
+func (RotationCompleted) event() {}
+func (BackupRemoved) event()     {}
+func (CompressionDone) event()   {}
+func (FileTampered) event()      {}
+func (DirCreated) event()        {}
+func (ErrorEvent) event()        {}
+
+// emitterSetter is implemented by the components emitting the events, eg. the compressor.
+type emitterSetter interface {
+	setEmitter(emit func(Event))
+}
+
+type eventBus struct {
+	mu     sync.Mutex
+	subs   []chan Event
+	closed bool
+}
+
+// Events subscribes to the rotation lifecycle events, each call returns a new channel closed by Close.
+//
+// The events are dropped if the channel is full, see EventBufferSize.
+//
+// eg.
+//
+//	for ev := range rf.Events() {
+//		switch ev := ev.(type) {
+//		case rollingf.BackupRemoved:
+//			log.Println("removed", ev.Name, "by", ev.Reason)
+//		case rollingf.ErrorEvent:
+//			log.Println(ev.Err)
+//		}
+//	}
+func (r *Roll) Events() <-chan Event {
+	b := r.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, EventBufferSize)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subs = append(b.subs, ch)
+	return ch
+}
+
+// subscribed reports whether anyone listens, so the costly events can be skipped.
+func (b *eventBus) subscribed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs) > 0
+}
+
+func (r *Roll) emit(ev Event) {
+	b := r.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			r.debug("[emit] drop %T", ev)
+		}
+	}
+}
+
+// reopen accepts the subscribers again after close.
+func (b *eventBus) reopen() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = false
+}
+
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+}
+
+// emitCompleted emits RotationCompleted or ErrorEvent of the rotation.
+func (r *Roll) emitCompleted(id uint64, d time.Duration, err error) {
+	if !r.events.subscribed() {
+		return
+	}
+	if err != nil {
+		r.emit(ErrorEvent{Cycle: id, Err: err})
+		return
+	}
+
+	ev := RotationCompleted{Cycle: id, New: r.filePath, Duration: d}
+	if backups, berr := r.backupEntries(path.Dir(r.filePath)); berr == nil && len(backups) > 0 {
+		ev.Old = path.Join(path.Dir(r.filePath), backups[0].Name())
+	}
+	r.emit(ev)
+}
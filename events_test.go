@@ -0,0 +1,87 @@
+package rollingf
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	for _, name := range []string{"app.log.1.gz", "app.log.2.gz"} {
+		os.WriteFile(path.Join(dir, name), nil, 0644)
+	}
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 1), Compress(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := r.Events()
+
+	r.Write([]byte("hello"))
+	if err = r.roll("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Event
+	for ev := range events {
+		got = append(got, ev)
+		if _, ok := ev.(RotationCompleted); ok {
+			break
+		}
+	}
+	r.Close()
+	if _, ok := <-events; ok {
+		t.Error("events not closed")
+	}
+
+	want := []Event{
+		RotationStarted{Cycle: 1, Reason: "test"},
+		BackupRemoved{Name: path.Join(dir, "app.log.1.gz"), Reason: "MaxBackupsFilter", Detail: "count>1"},
+		BackupRemoved{Name: path.Join(dir, "app.log.2.gz"), Reason: "MaxBackupsFilter", Detail: "count>1"},
+		CompressionDone{Name: fp + ".1.gz", Format: Gzip},
+		RotationCompleted{Cycle: 1, Old: fp + ".1.gz", New: fp},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%+v", got)
+	}
+	for i, ev := range got {
+		switch ev := ev.(type) {
+		case RotationStarted:
+			ev.Time = want[i].(RotationStarted).Time
+			got[i] = ev
+		case RotationCompleted:
+			ev.Duration = 0
+			got[i] = ev
+		}
+		if got[i] != want[i] {
+			t.Errorf("%d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEventsError(t *testing.T) {
+	ffs := newFaultFS()
+	ffs.FS = NewMemFS()
+	r := NewC("/mem/app.log", WithFS(ffs)).
+		WithDefaultMatcher().
+		WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := r.Events()
+
+	r.Write([]byte("hello"))
+	ffs.failNext("rename", 1, errors.New("rename failed"))
+	r.roll("test")
+	for ev := range events {
+		if ev, ok := ev.(ErrorEvent); ok {
+			if ev.Cycle != 1 || ev.Err == nil {
+				t.Fatalf("%+v", ev)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// FallbackProbeInterval is how often the file is retried after it failed, see WithFallback.
+const FallbackProbeInterval = 5 * time.Second
+
+type fallbackWriter struct {
+	w io.Writer
+
+	mu        sync.Mutex // serializes the writes to w
+	lastProbe time.Time  // zero if the file is healthy
+}
+
+// WithFallback redirects the writes to w when the file fails, eg. the disk is full or the permission is lost,
+// instead of returning the error and losing the logs. w is eg. os.Stderr, another Roll or an in-memory ring.
+//
+// The file is retried every FallbackProbeInterval, the writes go back to the file once it recovers.
+// The records written to w are counted by Stats.Fallbacks.
+func WithFallback(w io.Writer) Option {
+	return OptionFunc(func(r *Roll) {
+		r.fallback = &fallbackWriter{w: w}
+	})
+}
+
+func (f *fallbackWriter) write(r *Roll, records [][]byte) (int, error) {
+	now := r.now()
+	f.mu.Lock()
+	probe := f.lastProbe.IsZero() || now.Sub(f.lastProbe) >= FallbackProbeInterval
+	if probe && !f.lastProbe.IsZero() {
+		// one probe at a time, the others keep falling back
+		f.lastProbe = now
+	}
+	f.mu.Unlock()
+
+	if probe {
+		n, err := r.writeRecords(records)
+		f.mu.Lock()
+		if err == nil {
+			if !f.lastProbe.IsZero() {
+				r.debug("[fallback] the file recovered")
+			}
+			f.lastProbe = time.Time{}
+			f.mu.Unlock()
+			return n, nil
+		}
+		if f.lastProbe.IsZero() {
+			r.warn("[fallback] the file failed: %v", err)
+		}
+		f.lastProbe = now
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int
+	for _, p := range records {
+		if _, err := f.w.Write(r.intercept(p)); err != nil {
+			return n, err
+		}
+		n += len(p)
+	}
+	r.stats.fallback(int64(len(records)))
+	return n, nil
+}
@@ -0,0 +1,444 @@
+package rollingf
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// faultFS injects the faults into the file operations of the Roll.
+type faultFS struct {
+	FS
+
+	mu     sync.Mutex
+	faults map[string][]error // op --> the errors returned by the next calls
+	random float64            // the probability of a random EIO
+	rnd    *rand.Rand
+	delay  time.Duration // the latency of every call
+	full   string        // the file writes to which return ENOSPC
+	flip   string        // the suffix of the files whose written bytes are silently corrupted
+}
+
+func newFaultFS() *faultFS {
+	return &faultFS{
+		FS:     osFS{},
+		faults: map[string][]error{},
+		rnd:    rand.New(rand.NewSource(1)),
+	}
+}
+
+// failNext makes the next n calls of op fail with err.
+func (f *faultFS) failNext(op string, n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < n; i++ {
+		f.faults[op] = append(f.faults[op], err)
+	}
+}
+
+func (f *faultFS) fault(op string) error {
+	f.mu.Lock()
+	delay := f.delay
+	var err error
+	if errs := f.faults[op]; len(errs) > 0 {
+		err, f.faults[op] = errs[0], errs[1:]
+	} else if f.random > 0 && f.rnd.Float64() < f.random {
+		err = syscall.EIO
+	}
+	f.mu.Unlock()
+
+	time.Sleep(delay)
+	return err
+}
+
+func (f *faultFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := f.fault("open"); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	f.mu.Lock()
+	full, flip := f.full, f.flip
+	f.mu.Unlock()
+	if full == name {
+		return os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	}
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err == nil && flip != "" && strings.HasSuffix(name, flip) {
+		return &flipFile{File: file}, nil
+	}
+	return file, err
+}
+
+// flipFile flips the last bit of every write, like a bad disk.
+type flipFile struct {
+	File
+}
+
+func (f *flipFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b := append([]byte(nil), p...)
+	b[len(b)-1] ^= 1
+	return f.File.Write(b)
+}
+
+func (f *faultFS) Rename(oldpath, newpath string) error {
+	if err := f.fault("rename"); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func (f *faultFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if err := f.fault("readdir"); err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return f.FS.ReadDir(name)
+}
+
+func (f *faultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.fault("stat"); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return f.FS.Stat(name)
+}
+
+// faultRoll creates a Roll which never rolls by itself, the rollings are triggered by rollSync.
+func faultRoll(t *testing.T) (*Roll, *faultFS, chan RotateEvent) {
+	fp := t.TempDir() + "/app.log"
+	r := NewC(fp).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	ffs := newFaultFS()
+	r.fs = ffs
+
+	events := make(chan RotateEvent, 16)
+	r.OnRotate(func(ev RotateEvent) {
+		events <- ev
+	})
+	return r, ffs, events
+}
+
+func rollSync(t *testing.T, r *Roll, events chan RotateEvent) error {
+	r.roll("test")
+	select {
+	case ev := <-events:
+		return ev.Err
+	case <-time.After(5 * time.Second):
+		t.Fatal("rolling timeout")
+		return nil
+	}
+}
+
+// totalSize returns the size of all the files matched by the Roll, and whether the file exists.
+func totalSize(t *testing.T, r *Roll) (int64, bool) {
+	entries, err := os.ReadDir(path.Dir(r.filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var size int64
+	var exist bool
+	for _, e := range entries {
+		if !strings.Contains(e.Name(), "app.log") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+		exist = exist || e.Name() == "app.log"
+	}
+	return size, exist
+}
+
+func writeN(t *testing.T, r *Roll, n int) int64 {
+	var written int64
+	for i := 0; i < n; i++ {
+		m, err := r.Write([]byte("0123456789\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		written += int64(m)
+	}
+	return written
+}
+
+func TestFaultRename(t *testing.T) {
+	r, ffs, events := faultRoll(t)
+	defer r.Close()
+
+	written := writeN(t, r, 10)
+	ffs.failNext("rename", 1, syscall.EIO)
+	if err := rollSync(t, r, events); !errors.Is(err, syscall.EIO) {
+		t.Fatal("expect EIO, got", err)
+	}
+	written += writeN(t, r, 10)
+
+	// the next rolling finishes the interrupted one
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	written += writeN(t, r, 10)
+
+	size, exist := totalSize(t, r)
+	if !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestFaultReadDir(t *testing.T) {
+	r, ffs, events := faultRoll(t)
+	defer r.Close()
+
+	written := writeN(t, r, 10)
+	ffs.failNext("readdir", 1, syscall.EIO)
+	if err := rollSync(t, r, events); !errors.Is(err, syscall.EIO) {
+		t.Fatal("expect EIO, got", err)
+	}
+	written += writeN(t, r, 10)
+
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	size, exist := totalSize(t, r)
+	if !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestFaultOpen(t *testing.T) {
+	r, ffs, events := faultRoll(t)
+	defer r.Close()
+
+	written := writeN(t, r, 10)
+	ffs.failNext("open", 1, syscall.EACCES)
+	if err := rollSync(t, r, events); !errors.Is(err, syscall.EACCES) {
+		t.Fatal("expect EACCES, got", err)
+	}
+	// still writable
+	written += writeN(t, r, 10)
+
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	size, exist := totalSize(t, r)
+	if !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestFaultENOSPC(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	r, ffs, events := faultRoll(t)
+	defer r.Close()
+
+	ffs.full = r.tmpFilePath
+	ffs.failNext("readdir", 1, syscall.EIO) // keep writing to the temporary file
+	rollSync(t, r, events)
+
+	if _, err := r.Write([]byte("x")); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatal("expect ENOSPC, got", err)
+	}
+}
+
+func TestFaultSlow(t *testing.T) {
+	r, ffs, events := faultRoll(t)
+
+	ffs.delay = 20 * time.Millisecond
+	written := writeN(t, r, 10)
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	written += writeN(t, r, 10)
+	r.Close()
+
+	size, exist := totalSize(t, r)
+	if !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestFaultRandom(t *testing.T) {
+	r, ffs, events := faultRoll(t)
+	defer r.Close()
+
+	ffs.random = 0.3
+	var written int64
+	var failures int
+	for i := 0; i < 50; i++ {
+		written += writeN(t, r, 3)
+		r.roll("test")
+		select {
+		case ev := <-events:
+			if ev.Err != nil {
+				failures++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("rolling timeout")
+		}
+	}
+	if failures == 0 {
+		t.Fatal("no fault injected")
+	}
+
+	ffs.mu.Lock()
+	ffs.random = 0
+	ffs.mu.Unlock()
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	size, exist := totalSize(t, r)
+	if !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestMaxMatchedFiles(t *testing.T) {
+	r, _, events := faultRoll(t)
+	defer r.Close()
+	r.WithMatcher(NewRegexMatcher(`.*`)).WithOptions(MaxMatchedFiles(3))
+
+	dir := path.Dir(r.filePath)
+	for _, name := range []string{"app.log.a", "app.log.b", "app.log.c"} {
+		if err := os.WriteFile(path.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written := writeN(t, r, 10)
+	if err := rollSync(t, r, events); err == nil {
+		t.Fatal("expect too many matches")
+	}
+	for _, name := range []string{"app.log.a", "app.log.b", "app.log.c"} {
+		if _, err := os.Stat(path.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size, exist := totalSize(t, r); !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestCoordinate(t *testing.T) {
+	r, _, events := faultRoll(t)
+	defer r.Close()
+	c := FileLockCoordinator(path.Join(t.TempDir(), "rolling.lock"))
+	r.WithOptions(Coordinate(c))
+
+	if err := c.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	written := writeN(t, r, 10)
+	r.roll("test")
+
+	// the writes go on while waiting for the other process
+	written += writeN(t, r, 10)
+	select {
+	case ev := <-events:
+		t.Fatal("rolled without the lock", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := c.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Err != nil {
+			t.Fatal(ev.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rolling timeout")
+	}
+
+	if size, exist := totalSize(t, r); !exist || size != written {
+		t.Fatal(exist, size, written)
+	}
+}
+
+func TestCycleID(t *testing.T) {
+	r, ffs, events := faultRoll(t)
+	defer r.Close()
+
+	writeN(t, r, 1)
+	ffs.failNext("readdir", 1, syscall.EIO)
+	id := r.nextCycle()
+	r.roll("test")
+	ev := <-events
+	// the writes may start the check cycles concurrently
+	if ev.Cycle < id || !errors.Is(ev.Err, syscall.EIO) || !strings.Contains(ev.Err.Error(), "cycle #"+strconv.FormatUint(ev.Cycle, 10)+":") {
+		t.Fatal(id, ev.Cycle, ev.Err)
+	}
+	if err := r.Stats().LastError; err != ev.Err {
+		t.Fatal(err)
+	}
+
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if r.nextCycle() <= ev.Cycle+1 {
+		t.Fatal("the cycle ID is not increased", r.nextCycle())
+	}
+}
+
+// brokenFile fails the writes while broken is set.
+type brokenFile struct {
+	File
+	broken int32
+}
+
+func (f *brokenFile) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&f.broken) != 0 {
+		return 0, syscall.ENOSPC
+	}
+	return f.File.Write(p)
+}
+
+func TestFallback(t *testing.T) {
+	var sink bytes.Buffer
+	r := NewC(t.TempDir()+"/app.log", WithFallback(&sink))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	clock := &fakeClock{now: time.Now()}
+	r.WithClock(clock)
+	bf := &brokenFile{File: r.f, broken: 1}
+	r.f = bf
+
+	for _, s := range []string{"a\n", "b\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the file recovered, but it is not probed yet
+	atomic.StoreInt32(&bf.broken, 0)
+	r.Write([]byte("c\n"))
+	if sink.String() != "a\nb\nc\n" || r.Stats().Fallbacks != 3 {
+		t.Fatal(sink.String(), r.Stats().Fallbacks)
+	}
+
+	clock.Add(FallbackProbeInterval)
+	r.Write([]byte("d\n"))
+	r.Write([]byte("e\n"))
+	if b, _ := os.ReadFile(r.filePath); string(b) != "d\ne\n" || r.Stats().Fallbacks != 3 {
+		t.Fatal(string(b), r.Stats().Fallbacks)
+	}
+}
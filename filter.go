@@ -15,8 +15,13 @@
 package rollingf
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,63 +32,176 @@ type Filter interface {
 	DealFiltered(dir string, filtered []os.DirEntry) error
 }
 
+// FilterV2 is a filter dealing the filtered files one by one, each annotated with the reason,
+// so the Roll reports the result per file through Roll.OnRemove, the BackupRemoved events and Roll.PurgeDryRun.
+//
+// The built-in filters implement both Filter and FilterV2, the third-party ones are registered by Roll.WithFilterV2.
+type FilterV2 interface {
+	Name() string
+	// Filter is the same as Filter.Filter.
+	Filter(input []os.DirEntry) (remains []os.DirEntry, filtered []os.DirEntry, err error)
+	// Reason explains why the file is filtered, eg. "age=49h0m0s max=48h0m0s".
+	Reason(file os.DirEntry) string
+	// DealFile deals a filtered file, eg. removes it. It is not called in the dry run.
+	DealFile(dir string, file os.DirEntry) error
+}
+
+// ContextFilter is a Filter whose dealing can be cancelled, the Roll calls DealFilteredContext instead of DealFiltered,
+// the ctx is done by Close or the deadline of Shutdown, or by the ctx of Purge.
+type ContextFilter interface {
+	Filter
+	DealFilteredContext(ctx context.Context, dir string, filtered []os.DirEntry) error
+}
+
+// dealFilteredContext deals the filtered files by ctx if f is a ContextFilter.
+func dealFilteredContext(ctx context.Context, f Filter, dir string, filtered []os.DirEntry) error {
+	if cf, ok := f.(ContextFilter); ok {
+		return cf.DealFilteredContext(ctx, dir, filtered)
+	}
+	return f.DealFiltered(dir, filtered)
+}
+
+// FilterResult is the result of a file filtered out by a filter.
+type FilterResult struct {
+	Name   string // the path of the filtered file
+	Filter string // the name of the filter
+	Reason string // why the file is filtered, empty if the filter is not a FilterV2
+	Err    error  // the error dealing the file, nil if it is dealt or in the dry run
+}
+
 var (
-	_ Filter = (*maxBackupsFilter)(nil)
-	_ Filter = (*maxAgeFilter)(nil)
+	_ Filter   = (*maxBackupsFilter)(nil)
+	_ Filter   = (*maxAgeFilter)(nil)
+	_ Filter   = (*nameAgeFilter)(nil)
+	_ Filter   = (*tieredFilter)(nil)
+	_ Filter   = (*v2Filter)(nil)
+	_ FilterV2 = (*maxBackupsFilter)(nil)
+	_ FilterV2 = (*maxAgeFilter)(nil)
+	_ FilterV2 = (*nameAgeFilter)(nil)
+	_ FilterV2 = (*tieredFilter)(nil)
 )
 
+// v2Filter adapts a FilterV2 to the Filter chain of the Roll.
+type v2Filter struct {
+	FilterV2
+}
+
+func (f *v2Filter) Init(base string) {
+	if i, ok := f.FilterV2.(interface{ Init(base string) }); ok {
+		i.Init(base)
+	}
+}
+
+func (f *v2Filter) DealFiltered(dir string, filtered []os.DirEntry) error {
+	for _, file := range filtered {
+		if err := f.DealFile(dir, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type maxBackupsFilter struct {
-	maxBackups int
+	maxBackups int64 // atomic
+	fs         FS
+	logs
 }
 
 // MaxSizeFilter filter files by size
 func MaxBackupsFilter(maxBackups int) *maxBackupsFilter {
 	return &maxBackupsFilter{
-		maxBackups: maxBackups,
+		maxBackups: int64(maxBackups),
 	}
 }
 
+func (f *maxBackupsFilter) setFS(fsys FS) {
+	f.fs = fsys
+}
+
 func (f *maxBackupsFilter) Name() string {
 	return "MaxBackupsFilter"
 }
 
+// Threshold returns the max count of the backups.
+func (f *maxBackupsFilter) Threshold() int64 {
+	return atomic.LoadInt64(&f.maxBackups)
+}
+
+// SetThreshold sets the max count of the backups.
+func (f *maxBackupsFilter) SetThreshold(v int64) {
+	atomic.StoreInt64(&f.maxBackups, v)
+}
+
 func (f *maxBackupsFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry, error) {
+	maxBackups := int(f.Threshold())
 	var removes []os.DirEntry
-	if f.maxBackups >= 0 && len(files) > f.maxBackups {
-		removes = files[f.maxBackups:]
+	if maxBackups >= 0 && len(files) > maxBackups {
+		removes = files[maxBackups:]
 	}
-	return files[:min(len(files), f.maxBackups)], removes, nil
+	return files[:min(len(files), maxBackups)], removes, nil
 }
 
 func (f *maxBackupsFilter) DealFiltered(dir string, filtered []os.DirEntry) error {
-	debugArray(filtered, func(idx int) string { return filtered[idx].Name() }, "[remove]")
+	f.debug("[remove]%s", entryNames(filtered, func(idx int) string { return filtered[idx].Name() }))
 	for _, file := range filtered {
-		if err := os.Remove(path.Join(dir, file.Name())); err != nil {
+		if err := removeFile(f.fs, dir, file.Name()); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (f *maxBackupsFilter) Reason(os.DirEntry) string {
+	return fmt.Sprintf("count>%d", f.Threshold())
+}
+
+func (f *maxBackupsFilter) DealFile(dir string, file os.DirEntry) error {
+	f.debug("[remove] %v", file.Name())
+	return removeFile(f.fs, dir, file.Name())
+}
+
 type maxAgeFilter struct {
-	maxAge time.Duration
+	maxAge time.Duration // atomic
+	clock  Clock
+	fs     FS
+	logs
 }
 
 // MaxAgeFilter filter files by age
 func MaxAgeFilter(maxAge time.Duration) (obj *maxAgeFilter) {
 	return &maxAgeFilter{
 		maxAge: maxAge,
+		clock:  systemClock{},
 	}
 }
 
+func (f *maxAgeFilter) setClock(clock Clock) {
+	f.clock = clock
+}
+
+func (f *maxAgeFilter) setFS(fsys FS) {
+	f.fs = fsys
+}
+
 func (f *maxAgeFilter) Name() string {
 	return "MaxAgeFilter"
 }
 
+// Threshold returns the max age in nanoseconds.
+func (f *maxAgeFilter) Threshold() int64 {
+	return atomic.LoadInt64((*int64)(&f.maxAge))
+}
+
+// SetThreshold sets the max age in nanoseconds, eg. int64(48 * time.Hour).
+func (f *maxAgeFilter) SetThreshold(v int64) {
+	atomic.StoreInt64((*int64)(&f.maxAge), v)
+}
+
 func (f *maxAgeFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry, error) {
 	// todo binary search improve
-	if f.maxAge <= 0 {
-		return nil, nil, nil
+	maxAge := time.Duration(f.Threshold())
+	if maxAge <= 0 {
+		return files, nil, nil
 	}
 
 	var idx int
@@ -92,7 +210,7 @@ func (f *maxAgeFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry
 		if err != nil {
 			return nil, nil, err
 		}
-		if time.Since(info.ModTime()) >= f.maxAge {
+		if f.clock.Since(info.ModTime()) >= maxAge {
 			break
 		}
 	}
@@ -101,10 +219,300 @@ func (f *maxAgeFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry
 
 func (f *maxAgeFilter) DealFiltered(dir string, filtered []os.DirEntry) error {
 	for _, file := range filtered {
-		debug("[remove] %v", file.Name())
-		if err := os.Remove(path.Join(dir, file.Name())); err != nil {
+		if err := f.DealFile(dir, file); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func (f *maxAgeFilter) Reason(file os.DirEntry) string {
+	info, err := file.Info()
+	if err != nil {
+		return fmt.Sprintf("max=%v", time.Duration(f.Threshold()))
+	}
+	return f.explainAge(info.ModTime())
+}
+
+func (f *maxAgeFilter) explainAge(t time.Time) string {
+	return fmt.Sprintf("age=%v max=%v", f.clock.Since(t).Truncate(time.Second), time.Duration(f.Threshold()))
+}
+
+func (f *maxAgeFilter) DealFile(dir string, file os.DirEntry) error {
+	f.debug("[remove] %v", file.Name())
+	return removeFile(f.fs, dir, file.Name())
+}
+
+type nameAgeFilter struct {
+	*maxAgeFilter
+	parser timeParser
+	base   string
+}
+
+// MaxAgeByNameFilter filter files by the rolling time embedded in the names produced by n, eg. TimestampNamer and LumberjackNamer.
+//
+// Unlike the ModTime, the names survive the copies, restores and clock changes.
+// It falls back to the ModTime if the name has no timestamp, eg. the file being rolled.
+func MaxAgeByNameFilter(maxAge time.Duration, n Namer) *nameAgeFilter {
+	f := &nameAgeFilter{
+		maxAgeFilter: MaxAgeFilter(maxAge),
+	}
+	f.parser, _ = n.(timeParser)
+	return f
+}
+
+func (f *nameAgeFilter) Init(base string) {
+	f.base = base
+}
+
+func (f *nameAgeFilter) Name() string {
+	return "MaxAgeByNameFilter"
+}
+
+func (f *nameAgeFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry, error) {
+	maxAge := time.Duration(f.Threshold())
+	if maxAge <= 0 {
+		return files, nil, nil
+	}
+
+	var remains, filtered []os.DirEntry
+	for _, file := range files {
+		t, err := f.rolledAt(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if f.clock.Since(t) >= maxAge {
+			filtered = append(filtered, file)
+		} else {
+			remains = append(remains, file)
+		}
+	}
+	return remains, filtered, nil
+}
+
+func (f *nameAgeFilter) Reason(file os.DirEntry) string {
+	t, err := f.rolledAt(file)
+	if err != nil {
+		return fmt.Sprintf("max=%v", time.Duration(f.Threshold()))
+	}
+	return f.explainAge(t)
+}
+
+func (f *nameAgeFilter) rolledAt(file os.DirEntry) (time.Time, error) {
+	if f.parser != nil {
+		if t, ok := f.parser.parseTime(f.base, path.Base(file.Name())); ok {
+			return t, nil
+		}
+	}
+	info, err := file.Info()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Bucket is the calendar period of the backups thinned out by TieredFilter.
+type Bucket int
+
+const (
+	HourBucket Bucket = iota + 1
+	DayBucket
+	WeekBucket
+	MonthBucket
+)
+
+func (b Bucket) String() string {
+	switch b {
+	case HourBucket:
+		return "hour"
+	case DayBucket:
+		return "day"
+	case WeekBucket:
+		return "week"
+	case MonthBucket:
+		return "month"
+	}
+	return fmt.Sprintf("Bucket(%d)", int(b))
+}
+
+// key returns the bucket of t, t is in the location of the buckets.
+func (b Bucket) key(t time.Time) string {
+	switch b {
+	case HourBucket:
+		return t.Format("2006-01-02T15")
+	case DayBucket:
+		return t.Format("2006-01-02")
+	case WeekBucket:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	default:
+		return t.Format("2006-01")
+	}
+}
+
+// Tier keeps at most Keep backups per Bucket among the backups younger than Within, 0 means any age.
+type Tier struct {
+	Within time.Duration
+	Bucket Bucket
+	Keep   int
+}
+
+type tieredFilter struct {
+	tiers  []Tier
+	parser timeParser
+	base   string
+	fs     FS
+	logs
+
+	mu      sync.Mutex
+	loc     *time.Location
+	clock   Clock
+	reasons map[string]string // the reasons of the last filtering
+}
+
+// TieredFilter thins out the older backups, each backup is counted by the first tier it is younger than,
+// the first Keep backups in the sorted order of each bucket are kept, the rest and the backups older than all the tiers are filtered.
+//
+// eg. the hourly backups of today, the daily ones of the last week and the weekly ones beyond:
+//
+//	TieredFilter(
+//		Tier{Within: 24 * time.Hour, Bucket: HourBucket, Keep: 1},
+//		Tier{Within: 7 * 24 * time.Hour, Bucket: DayBucket, Keep: 1},
+//		Tier{Bucket: WeekBucket, Keep: 1},
+//	)
+//
+// The file itself is always kept. The buckets are computed in the local time by default, see In and Roll.WithLocation.
+func TieredFilter(tiers ...Tier) *tieredFilter {
+	tiers = append([]Tier(nil), tiers...)
+	sort.SliceStable(tiers, func(i, j int) bool {
+		wi, wj := tiers[i].Within, tiers[j].Within
+		return wi > 0 && (wj <= 0 || wi < wj)
+	})
+	return &tieredFilter{
+		tiers: tiers,
+		loc:   time.Local,
+		clock: systemClock{},
+	}
+}
+
+// WithNamer takes the rolling time embedded in the names produced by n instead of the ModTime, see MaxAgeByNameFilter.
+func (f *tieredFilter) WithNamer(n Namer) *tieredFilter {
+	f.parser, _ = n.(timeParser)
+	return f
+}
+
+// In computes the buckets in loc, eg. time.UTC.
+func (f *tieredFilter) In(loc *time.Location) *tieredFilter {
+	f.setLocation(loc)
+	return f
+}
+
+func (f *tieredFilter) Init(base string) {
+	f.base = base
+}
+
+func (f *tieredFilter) setLocation(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loc = loc
+}
+
+func (f *tieredFilter) setClock(clock Clock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clock = clock
+}
+
+func (f *tieredFilter) setFS(fsys FS) {
+	f.fs = fsys
+}
+
+func (f *tieredFilter) Name() string {
+	return "TieredFilter"
+}
+
+func (f *tieredFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reasons = map[string]string{}
+	counts := make([]map[string]int, len(f.tiers))
+	var remains, filtered []os.DirEntry
+	for _, file := range files {
+		if file.Name() == f.base {
+			remains = append(remains, file)
+			continue
+		}
+		t, err := f.rolledAt(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		age := f.clock.Since(t)
+		i := f.tierOf(age)
+		if i < 0 {
+			f.reasons[file.Name()] = fmt.Sprintf("age=%v beyond the tiers", age.Truncate(time.Second))
+			filtered = append(filtered, file)
+			continue
+		}
+		tier := f.tiers[i]
+		if counts[i] == nil {
+			counts[i] = map[string]int{}
+		}
+		key := tier.Bucket.key(t.In(f.loc))
+		if counts[i][key] >= tier.Keep {
+			f.reasons[file.Name()] = fmt.Sprintf("%s=%s keep=%d", tier.Bucket, key, tier.Keep)
+			filtered = append(filtered, file)
+			continue
+		}
+		counts[i][key]++
+		remains = append(remains, file)
+	}
+	return remains, filtered, nil
+}
+
+// tierOf returns the index of the first tier the age is younger than, -1 if none.
+func (f *tieredFilter) tierOf(age time.Duration) int {
+	for i, tier := range f.tiers {
+		if tier.Within <= 0 || age < tier.Within {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *tieredFilter) rolledAt(file os.DirEntry) (time.Time, error) {
+	if f.parser != nil {
+		if t, ok := f.parser.parseTime(f.base, path.Base(file.Name())); ok {
+			return t, nil
+		}
+	}
+	info, err := file.Info()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (f *tieredFilter) DealFiltered(dir string, filtered []os.DirEntry) error {
+	for _, file := range filtered {
+		if err := f.DealFile(dir, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *tieredFilter) Reason(file os.DirEntry) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reasons[file.Name()]
+}
+
+func (f *tieredFilter) DealFile(dir string, file os.DirEntry) error {
+	f.debug("[remove] %v", file.Name())
+	return removeFile(f.fs, dir, file.Name())
+}
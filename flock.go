@@ -0,0 +1,80 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrLocked is returned by the constructors if the file is already opened by another Roll, see WithFlock.
+var ErrLocked = errors.New("rollingf: the file is locked by another Roll")
+
+const defaultLockName = ".{base}.lock"
+
+// WithFlock takes an exclusive advisory lock on the lock file ".{base}.lock" in the file's directory until Close,
+// so a second Roll of the same path, in this or another process, fails fast with ErrLocked instead of
+// corrupting the rotations of each other.
+//
+// The lock is released by the OS if the process dies. It is a no-op on the platforms without flock(2)
+// and the FS whose files have no fd, eg. MemFS.
+func WithFlock(enabled bool) Option {
+	return OptionFunc(func(r *Roll) {
+		r.flock = enabled
+	})
+}
+
+// lockPath returns the path of the lock file of the Roll.
+func (r *Roll) lockPath() string {
+	dir, base := path.Split(r.filePath)
+	return path.Join(dir, strings.ReplaceAll(defaultLockName, "{base}", base))
+}
+
+// acquireFlock takes the lock of WithFlock without blocking.
+func (r *Roll) acquireFlock() error {
+	if !r.flock || r.lockf != nil {
+		return nil
+	}
+	f, err := r.fs.OpenFile(r.lockPath(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	fd, ok := f.(fder)
+	if !ok {
+		f.Close()
+		return nil
+	}
+	if err = tryLockFd(fd.Fd()); err != nil {
+		f.Close()
+		return err
+	}
+	r.debug("[acquireFlock] %s", r.lockPath())
+	r.lockf = f
+	return nil
+}
+
+// releaseFlock releases the lock of WithFlock, the lock file is kept as removing it races with the next Roll.
+func (r *Roll) releaseFlock() {
+	if r.lockf == nil {
+		return
+	}
+	if fd, ok := r.lockf.(fder); ok {
+		unlockFd(fd.Fd())
+	}
+	r.lockf.Close()
+	r.lockf = nil
+}
@@ -0,0 +1,31 @@
+package rollingf
+
+import (
+	"errors"
+	"path"
+	"runtime"
+	"testing"
+)
+
+func TestFlock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no flock")
+	}
+	fp := path.Join(t.TempDir(), "app.log")
+	c := NewRollConf(fp, DurOneDay, 0, 0, 2)
+	r, err := NewE(c, WithFlock(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewE(c, WithFlock(true)); !errors.Is(err, ErrLocked) {
+		t.Fatal("expect ErrLocked, got", err)
+	}
+
+	r.Close()
+	r, err = NewE(c, WithFlock(true))
+	if err != nil {
+		t.Fatal("the lock is not released by Close:", err)
+	}
+	r.Close()
+}
@@ -0,0 +1,327 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ io.WriteCloser = (*forwarder)(nil)
+
+type forwarder struct {
+	network string
+	addr    string
+	spool   *Roll
+
+	mu      sync.Mutex
+	tlsConf *tls.Config
+	retry   time.Duration
+	timeout time.Duration
+	syslog  string // the header of the syslog records, empty if the records are sent as they are
+	conn    net.Conn
+
+	down   chan struct{} // wakes the reconnection
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// Forward sends the records to the remote endpoint at network and addr, eg. a syslog collector by "tcp" or "udp".
+// While the remote is down, the records are written to spool, whose checkers and filters bound the spool on disk
+// like any Roll, and the backups of spool are sent in order once the remote is back, then removed.
+//
+// Each write is a record. Use WithRecordFormat(LengthPrefixed) or JSONLines for spool so the records spooled keep
+// their boundaries, the RawRecords of a backup are sent as one record. spool is not closed by Close.
+//
+// eg.
+//
+//	spool := rollingf.NewC("/var/spool/app/app.log", rollingf.WithRecordFormat(rollingf.LengthPrefixed)).
+//		WithDefaultMatcher().WithDefaultProcessor().WithFilter(rollingf.MaxBackupsFilter(100))
+//	log.SetOutput(rollingf.Forward("tcp", "logs:514", spool).WithSyslog(rollingf.SyslogInfo, "app"))
+func Forward(network, addr string, spool *Roll) *forwarder {
+	f := &forwarder{
+		network: network,
+		addr:    addr,
+		spool:   spool,
+		retry:   time.Second,
+		timeout: 5 * time.Second,
+		down:    make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	f.down <- struct{}{}
+	go f.reconnect()
+	return f
+}
+
+// WithTLS connects to the remote by TLS.
+func (f *forwarder) WithTLS(conf *tls.Config) *forwarder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tlsConf = conf
+	return f
+}
+
+// WithRetry dials the remote every d while it is down, 1s by default.
+func (f *forwarder) WithRetry(d time.Duration) *forwarder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d > 0 {
+		f.retry = d
+	}
+	return f
+}
+
+// WithTimeout gives up the dialing and the sending after d, the record is spooled then, 5s by default.
+func (f *forwarder) WithTimeout(d time.Duration) *forwarder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d > 0 {
+		f.timeout = d
+	}
+	return f
+}
+
+// The priorities of the syslog records, the facility user combined with a severity.
+const (
+	SyslogErr     = 8 + 3
+	SyslogWarning = 8 + 4
+	SyslogNotice  = 8 + 5
+	SyslogInfo    = 8 + 6
+	SyslogDebug   = 8 + 7
+)
+
+// WithSyslog sends each record as a RFC 5424 syslog message of the priority by the app, ended by a newline,
+// the non-transparent framing of RFC 6587. The time of the message is the time it is written, not sent.
+func (f *forwarder) WithSyslog(priority int, app string) *forwarder {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "-"
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.syslog = "<" + strconv.Itoa(priority) + ">1 %s " + host + " " + app + " " + strconv.Itoa(os.Getpid()) + " - - "
+	return f
+}
+
+// Write sends p to the remote, or writes it to the spool if the remote is down.
+func (f *forwarder) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	select {
+	case <-f.closed:
+		return 0, ErrClosed
+	default:
+	}
+
+	rec := f.format(p)
+	if f.conn != nil {
+		err := send(f.conn, rec, f.timeout)
+		if err == nil {
+			return len(p), nil
+		}
+		debug("[forward] %s down: %v", f.addr, err)
+		f.conn.Close()
+		f.conn = nil
+		select {
+		case f.down <- struct{}{}:
+		default:
+		}
+	}
+	if _, err := f.spool.Write(rec); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// format adds the syslog header to p, the caller holds f.mu.
+func (f *forwarder) format(p []byte) []byte {
+	if f.syslog == "" {
+		return p
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, f.syslog, time.Now().Format(time.RFC3339Nano))
+	b.Write(bytes.TrimRight(p, "\n"))
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func send(conn net.Conn, rec []byte, timeout time.Duration) error {
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err := conn.Write(rec)
+	return err
+}
+
+// reconnect dials the remote whenever it is down, and sends the spool before the writes go to the remote again.
+func (f *forwarder) reconnect() {
+	defer close(f.done)
+	for {
+		select {
+		case <-f.closed:
+			return
+		case <-f.down:
+		}
+
+		for {
+			err := f.connect()
+			if err == nil {
+				break
+			}
+			debug("[forward] %s err: %v", f.addr, err)
+			f.mu.Lock()
+			retry := f.retry
+			f.mu.Unlock()
+			select {
+			case <-f.closed:
+				return
+			case <-time.After(retry):
+			}
+		}
+	}
+}
+
+// connect dials the remote and sends the spool, the writes are spooled until the last backup is sent.
+func (f *forwarder) connect() error {
+	f.mu.Lock()
+	conf, timeout := f.tlsConf, f.timeout
+	f.mu.Unlock()
+
+	d := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if conf != nil {
+		conn, err = tls.DialWithDialer(d, f.network, f.addr, conf)
+	} else {
+		conn, err = d.Dial(f.network, f.addr)
+	}
+	if err != nil {
+		return err
+	}
+	if err = f.drain(conn, timeout); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// the rest of the spool, no record is written meanwhile
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-f.closed:
+		conn.Close()
+		return nil
+	default:
+	}
+	if err = f.spool.MarkRotate(); err == nil {
+		err = f.drain(conn, timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	debug("[forward] %s up", f.addr)
+	f.conn = conn
+	return nil
+}
+
+// drain sends the backups of the spool from the oldest, each backup is removed once sent.
+func (f *forwarder) drain(conn net.Conn, timeout time.Duration) error {
+	for {
+		unlock, err := f.spool.lockBackups(context.Background())
+		if err != nil {
+			return err
+		}
+		dir := path.Dir(f.spool.filePath)
+		files, err := f.spool.backupEntries(dir)
+		if err == nil && len(files) > 0 {
+			oldest := files[len(files)-1].Name()
+			if err = f.sendFile(conn, timeout, dir, oldest); err == nil {
+				err = removeFile(f.spool.fs, dir, oldest)
+			}
+		}
+		unlock()
+		if err != nil || len(files) == 0 {
+			return err
+		}
+	}
+}
+
+func (f *forwarder) sendFile(conn net.Conn, timeout time.Duration, dir, name string) error {
+	debug("[forward] send %s", name)
+	file, err := fsOrDefault(f.spool.fs).OpenFile(path.Join(dir, name), os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rc, err := codec{format: compressFormat(name)}.reader(file)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	rr := NewRecordReader(rc, f.spool.recordFormat)
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err == ErrTruncatedRecord || err == ErrCorruptRecord {
+			// the tail of a crash, the records before it are sent
+			debug("[forward] %s: %v", name, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f.spool.recordFormat == JSONLines {
+			rec = append(rec, '\n')
+		}
+		if len(rec) == 0 {
+			continue
+		}
+		if err := send(conn, rec, timeout); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the connection, the spool is left to its owner.
+func (f *forwarder) Close() error {
+	f.mu.Lock()
+	select {
+	case <-f.closed:
+		f.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	close(f.closed)
+	var err error
+	if f.conn != nil {
+		err = f.conn.Close()
+		f.conn = nil
+	}
+	f.mu.Unlock()
+	<-f.done
+	return err
+}
@@ -0,0 +1,76 @@
+package rollingf
+
+import (
+	"bufio"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForward(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spool := NewC(path.Join(t.TempDir(), "spool.log"), WithRecordFormat(LengthPrefixed)).
+		WithDefaultMatcher().
+		WithDefaultProcessor()
+	if spool == nil {
+		t.Fatal("nil roll")
+	}
+	defer spool.Close()
+
+	f := Forward("tcp", addr, spool).WithRetry(10*time.Millisecond).WithSyslog(SyslogInfo, "app")
+	defer f.Close()
+
+	// the remote is down
+	f.Write([]byte("one"))
+	spool.MarkRotate()
+	f.Write([]byte("two\n"))
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("the port is taken:", err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the spool is sent before the new records
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		up := f.conn != nil
+		f.mu.Unlock()
+		if up || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.Write([]byte("three"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	sc := bufio.NewScanner(conn)
+	for _, want := range []string{"one", "two", "three"} {
+		if !sc.Scan() {
+			t.Fatal("read", sc.Err())
+		}
+		line := sc.Text()
+		if !strings.HasPrefix(line, "<14>1 ") || !strings.Contains(line, " app ") || !strings.HasSuffix(line, "- - "+want) {
+			t.Errorf("line %q, want %q", line, want)
+		}
+	}
+
+	backups, _ := spool.Backups()
+	if len(backups) != 0 {
+		t.Errorf("spool left %+v", backups)
+	}
+}
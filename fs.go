@@ -0,0 +1,172 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// File is an opened file of a FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// FS abstracts the file operations of the Roll, the checkers, the filters and the processors.
+//
+// The errors should be compatible with the os package, eg. os.IsNotExist.
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	ReadDir(name string) ([]os.DirEntry, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// chtimeser is implemented by the FS which can change the modification time of the files.
+type chtimeser interface {
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// dirCloser is implemented by the FS holding the directory of the file open, eg. the fd of the *at syscalls on Linux.
+type dirCloser interface {
+	// closeDir closes the directory, the FS keeps working without it.
+	closeDir() error
+	// reopenDir opens the directory again, eg. on Reopen.
+	reopenDir() error
+	// renewDir opens the directory again if it is open, eg. it is recreated and the fd refers to the removed one.
+	renewDir() error
+}
+
+// fsWrapper is implemented by the FS wrapping another one.
+type fsWrapper interface {
+	unwrapFS() FS
+}
+
+// dirCloserOf returns the dirCloser wrapped by fsys, nil if none.
+func dirCloserOf(fsys FS) dirCloser {
+	for fsys != nil {
+		if d, ok := fsys.(dirCloser); ok {
+			return d
+		}
+		w, ok := fsys.(fsWrapper)
+		if !ok {
+			return nil
+		}
+		fsys = w.unwrapFS()
+	}
+	return nil
+}
+
+// closeDir closes the directory held by fsys, if any.
+func closeDir(fsys FS) error {
+	if d := dirCloserOf(fsys); d != nil {
+		return d.closeDir()
+	}
+	return nil
+}
+
+// reopenDir opens the directory held by fsys again, if any.
+func reopenDir(fsys FS) error {
+	if d := dirCloserOf(fsys); d != nil {
+		return d.reopenDir()
+	}
+	return nil
+}
+
+// renewDir opens the directory held open by fsys again, if any.
+func renewDir(fsys FS) error {
+	if d := dirCloserOf(fsys); d != nil {
+		return d.renewDir()
+	}
+	return nil
+}
+
+// fsSetter is implemented by the components operating the files.
+type fsSetter interface {
+	setFS(fsys FS)
+}
+
+var (
+	_ FS        = osFS{}
+	_ chtimeser = osFS{}
+
+	_ File = (*os.File)(nil)
+)
+
+// osFS is the portable FS backed by the os package.
+type osFS struct{}
+
+// OSFS returns the FS backed by the os package.
+func OSFS() FS {
+	return osFS{}
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// avoid the non-nil interface holding a nil *os.File
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// WithFS operates the files through fsys, eg. a MemFS for the hermetic tests.
+//
+// It must be passed to the constructors, the file is opened through it.
+func WithFS(fsys FS) Option {
+	return OptionFunc(func(r *Roll) {
+		if r.fs != nil && r.fs != fsys {
+			// the FS replaced is never used again, unless fsys wraps it
+			closeDir(r.fs)
+		}
+		r.fs = fsys
+		r.setupAll()
+	})
+}
+
+func fsOrDefault(fsys FS) FS {
+	if fsys == nil {
+		return osFS{}
+	}
+	return fsys
+}
@@ -0,0 +1,286 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	_ FS        = (*dirFS)(nil)
+	_ dirCloser = (*dirFS)(nil)
+)
+
+// dirFS operates the files in dir relative to a cached directory fd by the *at syscalls,
+// so the rolling sequence is immune to the renames of the directory.
+// The files out of dir fall back to osFS, so do all the files once the fd is closed.
+type dirFS struct {
+	osFS
+
+	dir string
+	mu  sync.RWMutex // held while the fd is used
+	d   *os.File     // nil once closed
+}
+
+func newFileSystem(dir string) FS {
+	d, err := os.Open(dir)
+	if err != nil {
+		debug("[newFileSystem] %v, fall back to osFS", err)
+		return osFS{}
+	}
+	return &dirFS{
+		dir: path.Clean(dir),
+		d:   d,
+	}
+}
+
+// rel returns the name relative to the dir, ok is false if the name is out of the dir.
+func (f *dirFS) rel(name string) (string, bool) {
+	dir, base := path.Split(name)
+	if path.Clean(dir) != f.dir {
+		return "", false
+	}
+	return base, true
+}
+
+// at calls fn with the directory fd, it returns false without calling fn if the fd is closed.
+func (f *dirFS) at(fn func(fd int)) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.d == nil {
+		return false
+	}
+	fn(int(f.d.Fd()))
+	return true
+}
+
+func (f *dirFS) closeDir() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.d == nil {
+		return nil
+	}
+	err := f.d.Close()
+	f.d = nil
+	return err
+}
+
+func (f *dirFS) reopenDir() error {
+	return f.openDir(false)
+}
+
+func (f *dirFS) renewDir() error {
+	return f.openDir(true)
+}
+
+// openDir replaces the directory fd by a new one, but keeps it closed if onlyOpen is set and it is closed.
+func (f *dirFS) openDir(onlyOpen bool) error {
+	d, err := os.Open(f.dir)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	old := f.d
+	if old == nil && onlyOpen {
+		f.mu.Unlock()
+		return d.Close()
+	}
+	f.d = d
+	f.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+func (f *dirFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	base, ok := f.rel(name)
+	if !ok {
+		return f.osFS.OpenFile(name, flag, perm)
+	}
+
+	var fd int
+	var err error
+	if !f.at(func(dir int) {
+		fd, err = syscall.Openat(dir, base, flag|syscall.O_CLOEXEC, uint32(perm.Perm()))
+	}) {
+		return f.osFS.OpenFile(name, flag, perm)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+func (f *dirFS) Rename(oldpath, newpath string) error {
+	oldBase, ok1 := f.rel(oldpath)
+	newBase, ok2 := f.rel(newpath)
+	if !ok1 || !ok2 {
+		return f.osFS.Rename(oldpath, newpath)
+	}
+
+	var err error
+	if !f.at(func(dir int) {
+		err = syscall.Renameat(dir, oldBase, dir, newBase)
+	}) {
+		return f.osFS.Rename(oldpath, newpath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "renameat", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+func (f *dirFS) Remove(name string) error {
+	base, ok := f.rel(name)
+	if !ok {
+		return f.osFS.Remove(name)
+	}
+
+	var err error
+	if !f.at(func(dir int) {
+		err = syscall.Unlinkat(dir, base)
+	}) {
+		return f.osFS.Remove(name)
+	}
+	if err != nil {
+		return &os.PathError{Op: "unlinkat", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (f *dirFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if path.Clean(name) != f.dir {
+		return f.osFS.ReadDir(name)
+	}
+
+	var fd int
+	var err error
+	if !f.at(func(dir int) {
+		fd, err = syscall.Openat(dir, ".", os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	}) {
+		return f.osFS.ReadDir(name)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: name, Err: err}
+	}
+	d := os.NewFile(uintptr(fd), name)
+	defer d.Close()
+
+	entries, err := d.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, err
+}
+
+// Stat stats the file by fstatat, without opening it.
+func (f *dirFS) Stat(name string) (os.FileInfo, error) {
+	base, ok := f.rel(name)
+	if !ok {
+		return f.osFS.Stat(name)
+	}
+
+	var st unix.Stat_t
+	var err error
+	if !f.at(func(dir int) {
+		err = unix.Fstatat(dir, base, &st, 0)
+	}) {
+		return f.osFS.Stat(name)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "fstatat", Path: name, Err: err}
+	}
+	return newStatInfo(base, &st), nil
+}
+
+// statInfo is the os.FileInfo of a unix.Stat_t, Sys returns the *syscall.Stat_t as os.Stat does.
+type statInfo struct {
+	name string
+	sys  syscall.Stat_t
+}
+
+func newStatInfo(name string, st *unix.Stat_t) *statInfo {
+	return &statInfo{
+		name: name,
+		sys: syscall.Stat_t{
+			Dev:     st.Dev,
+			Ino:     st.Ino,
+			Nlink:   st.Nlink,
+			Mode:    st.Mode,
+			Uid:     st.Uid,
+			Gid:     st.Gid,
+			Rdev:    st.Rdev,
+			Size:    st.Size,
+			Blksize: st.Blksize,
+			Blocks:  st.Blocks,
+			Atim:    syscall.Timespec{Sec: st.Atim.Sec, Nsec: st.Atim.Nsec},
+			Mtim:    syscall.Timespec{Sec: st.Mtim.Sec, Nsec: st.Mtim.Nsec},
+			Ctim:    syscall.Timespec{Sec: st.Ctim.Sec, Nsec: st.Ctim.Nsec},
+		},
+	}
+}
+
+func (i *statInfo) Name() string       { return i.name }
+func (i *statInfo) Size() int64        { return i.sys.Size }
+func (i *statInfo) ModTime() time.Time { return time.Unix(i.sys.Mtim.Unix()) }
+func (i *statInfo) IsDir() bool        { return i.Mode().IsDir() }
+func (i *statInfo) Sys() interface{}   { return &i.sys }
+
+// Mode converts the mode bits as os.Stat does.
+func (i *statInfo) Mode() os.FileMode {
+	mode := os.FileMode(i.sys.Mode & 0777)
+	switch i.sys.Mode & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		mode |= os.ModeDevice
+	case syscall.S_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case syscall.S_IFDIR:
+		mode |= os.ModeDir
+	case syscall.S_IFIFO:
+		mode |= os.ModeNamedPipe
+	case syscall.S_IFLNK:
+		mode |= os.ModeSymlink
+	case syscall.S_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	if i.sys.Mode&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if i.sys.Mode&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if i.sys.Mode&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// sameFile is os.SameFile, which knows the FileInfo of dirFS too.
+func sameFile(fi1, fi2 os.FileInfo) bool {
+	st1, ok1 := fi1.Sys().(*syscall.Stat_t)
+	st2, ok2 := fi2.Sys().(*syscall.Stat_t)
+	if ok1 && ok2 {
+		return st1.Dev == st2.Dev && st1.Ino == st2.Ino
+	}
+	return os.SameFile(fi1, fi2)
+}
@@ -0,0 +1,149 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestDirFSStat(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "app.log"), []byte("hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(path.Join(dir, "fifo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fsys := newFileSystem(dir).(*dirFS)
+	defer fsys.closeDir()
+
+	for _, name := range []string{"app.log", "fifo"} {
+		info, err := fsys.Stat(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := os.Stat(path.Join(dir, name))
+		if info.Name() != name || info.Size() != want.Size() || info.Mode() != want.Mode() ||
+			!info.ModTime().Equal(want.ModTime()) || info.IsDir() {
+			t.Fatal(name, info.Mode(), want.Mode())
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); !ok || st.Ino != want.Sys().(*syscall.Stat_t).Ino {
+			t.Fatal(name, "Sys", info.Sys())
+		}
+	}
+	if _, err := fsys.Stat(path.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	// by the directory fd, the directory renamed
+	moved := dir + ".moved"
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(moved, dir)
+	if info, err := fsys.Stat(path.Join(dir, "app.log")); err != nil || info.Size() != 5 {
+		t.Fatal(info, err)
+	}
+}
+
+func TestDirFSClose(t *testing.T) {
+	dir := t.TempDir()
+	fsys := newFileSystem(dir).(*dirFS)
+	f, err := fsys.OpenFile(path.Join(dir, "app.log"), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// by the paths once closed
+	if err := fsys.closeDir(); err != nil || fsys.d != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Rename(path.Join(dir, "app.log"), path.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := fsys.ReadDir(dir); err != nil || len(entries) != 1 || entries[0].Name() != "app.log.1" {
+		t.Fatal(entries, err)
+	}
+	// not renewed once closed
+	if err := fsys.renewDir(); err != nil || fsys.d != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.reopenDir(); err != nil || fsys.d == nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Remove(path.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	fsys.closeDir()
+}
+
+func TestDirFSLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	r := NewC(dir+"/app.log", CreateDirs())
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	fsys := dirCloserOf(r.fs).(*dirFS)
+	if fsys.d == nil {
+		t.Fatal("the directory is not opened")
+	}
+
+	r.Close()
+	if fsys.d != nil {
+		t.Fatal("the directory is not closed by Close")
+	}
+	if err := r.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if fsys.d == nil {
+		t.Fatal("the directory is not opened by Reopen")
+	}
+
+	// the FS replaced
+	r.WithOptions(WithFS(NewMemFS()))
+	if fsys.d != nil {
+		t.Fatal("the directory is not closed by WithFS")
+	}
+	r.Close()
+}
+
+func TestDirFSRecreated(t *testing.T) {
+	dir := path.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fp := path.Join(dir, "app.log")
+	r := NewC(fp, CreateDirs()).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	if _, ok := dirCloserOf(r.fs).(*dirFS); !ok {
+		t.Fatalf("%T", r.fs)
+	}
+	rotated := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { rotated <- ev })
+
+	// removed at runtime, the fd refers to the removed directory
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := rollSync(t, r, rotated); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Write([]byte("after")); err != nil {
+			t.Fatal(err)
+		}
+		if err := rollSync(t, r, rotated); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	for _, name := range []string{"app.log.1", "app.log.2"} {
+		if b, err := os.ReadFile(path.Join(dir, name)); err != nil || string(b) != "after" {
+			t.Fatalf("%s %q %v", name, b, err)
+		}
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/ignorantshr/rollingf
 
 go 1.15
+
+require golang.org/x/sys v0.7.0
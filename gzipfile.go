@@ -0,0 +1,92 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"compress/gzip"
+	"sync"
+	"time"
+)
+
+// CompressActive writes the file itself through gzip, eg. app.log.gz, so the backups need no compression after the rolling,
+// use it with DefaultProcessor rather than Compressor. Each opening of the file appends a gzip member,
+// which gzip and the readers of compress/gzip read as one stream.
+//
+// The compressed bytes reach the file on Sync, the idle sync of WithIdle, the rolling and Close, and every flushEvery
+// if it is > 0, which bounds the bytes lost by a crash. The size checked by MaxSizeChecker is the compressed size
+// when the file is opened plus the bytes written since, before the compression.
+func CompressActive(flushEvery time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		r.gzActive = true
+		r.gzFlush = flushEvery
+	})
+}
+
+// gzipFile compresses the writes to the file, the writes of the Roll hold the file lock shared, hence mu.
+type gzipFile struct {
+	File
+
+	mu sync.Mutex
+	zw *gzip.Writer
+}
+
+func newGzipFile(f File) *gzipFile {
+	return &gzipFile{
+		File: f,
+		zw:   gzip.NewWriter(f),
+	}
+}
+
+func (f *gzipFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.zw.Write(p)
+}
+
+// Flush writes the compressed bytes pending to the file.
+func (f *gzipFile) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.zw.Flush()
+}
+
+func (f *gzipFile) Sync() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+// Close completes the gzip member before closing the file.
+func (f *gzipFile) Close() error {
+	f.mu.Lock()
+	err := f.zw.Close()
+	f.mu.Unlock()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// flushActive flushes the compressed file, every r.gzFlush until Close.
+func (r *Roll) flushActive() {
+	r.fWLock()
+	defer r.fWUnlock()
+	if f, ok := r.f.(*gzipFile); ok {
+		if err := f.Flush(); err != nil {
+			r.warn("[flushActive] err: %v", err)
+		}
+	}
+}
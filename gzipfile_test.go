@@ -0,0 +1,66 @@
+package rollingf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCompressActive(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log.gz")
+	open := func() *Roll {
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), CompressActive(10*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	read := func(name string) string {
+		f, err := os.Open(path.Join(path.Dir(fp), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		return string(b)
+	}
+
+	r := open()
+	r.Write([]byte("one\n"))
+	r.MarkRotate()
+	r.Write([]byte("two\n"))
+	// flushed in background, readable up to the flush point before Close
+	time.Sleep(100 * time.Millisecond)
+	b, _ := os.ReadFile(fp)
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != "two\n" {
+		t.Errorf("flushed %q", got)
+	}
+	r.Close()
+
+	// the second opening appends a gzip member
+	r = open()
+	r.Write([]byte("three\n"))
+	r.Close()
+
+	if got := read("app.log.gz.1"); got != "one\n" {
+		t.Errorf("app.log.gz.1: %q", got)
+	}
+	if got := read("app.log.gz"); got != "two\nthree\n" {
+		t.Errorf("app.log.gz: %q", got)
+	}
+}
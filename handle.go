@@ -0,0 +1,141 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrNoThreshold is returned by Handle.SetThreshold if the component has no threshold.
+var ErrNoThreshold = errors.New("rollingf: the component has no threshold")
+
+// Thresholder is implemented by the components tuned by a single threshold, which can be changed while the Roll runs.
+//
+// The built-in ones are MaxSizeChecker (bytes), IntervalChecker (nanoseconds), MaxBackupsFilter (count),
+// MaxAgeFilter and MaxAgeByNameFilter (nanoseconds).
+type Thresholder interface {
+	Threshold() int64
+	SetThreshold(v int64)
+}
+
+var (
+	_ Thresholder = (*maxSizeChecker)(nil)
+	_ Thresholder = (*intervalChecker)(nil)
+	_ Thresholder = (*maxBackupsFilter)(nil)
+	_ Thresholder = (*maxAgeFilter)(nil)
+	_ Thresholder = (*nameAgeFilter)(nil)
+)
+
+// Handle controls a checker or a filter registered to a Roll, eg. from an admin endpoint loosening the retention during an incident.
+//
+// The disabled checkers are skipped by the checks, the disabled filters by the retention, including Purge and PurgeDryRun.
+// The handles are replaced with the components by UpdateConf.
+type Handle struct {
+	component any
+	name      string
+	disabled  int32 // atomic
+}
+
+func newHandle(component any, name string) *Handle {
+	return &Handle{component: component, name: name}
+}
+
+// Name returns the name of the component.
+func (h *Handle) Name() string {
+	return h.name
+}
+
+// Component returns the Checker or the Filter.
+func (h *Handle) Component() any {
+	return h.component
+}
+
+// Enabled reports whether the component runs, the components are enabled when registered.
+func (h *Handle) Enabled() bool {
+	return atomic.LoadInt32(&h.disabled) == 0
+}
+
+// SetEnabled enables or disables the component, the check or the retention in progress is not affected.
+func (h *Handle) SetEnabled(enabled bool) {
+	var v int32
+	if !enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&h.disabled, v)
+}
+
+// Threshold returns the threshold of the component, false if it is not a Thresholder.
+func (h *Handle) Threshold() (int64, bool) {
+	t, ok := h.thresholder()
+	if !ok {
+		return 0, false
+	}
+	return t.Threshold(), true
+}
+
+// SetThreshold changes the threshold of the component, it returns ErrNoThreshold if it is not a Thresholder.
+func (h *Handle) SetThreshold(v int64) error {
+	t, ok := h.thresholder()
+	if !ok {
+		return ErrNoThreshold
+	}
+	t.SetThreshold(v)
+	return nil
+}
+
+func (h *Handle) thresholder() (Thresholder, bool) {
+	switch c := h.component.(type) {
+	case Thresholder:
+		return c, true
+	case *v2Checker:
+		t, ok := c.c.(Thresholder)
+		return t, ok
+	case *v2Filter:
+		t, ok := c.FilterV2.(Thresholder)
+		return t, ok
+	}
+	return nil, false
+}
+
+// Checkers returns the handles of the checkers in the order they run.
+func (r *Roll) Checkers() []*Handle {
+	r.fOpLock()
+	defer r.fOpUnlock()
+	return append([]*Handle(nil), r.checkerHandles...)
+}
+
+// Filters returns the handles of the filters in the order they run.
+func (r *Roll) Filters() []*Handle {
+	r.filtersMu.Lock()
+	defer r.filtersMu.Unlock()
+	return append([]*Handle(nil), r.filterHandles...)
+}
+
+func checkerHandles(checkers []Checker) []*Handle {
+	handles := make([]*Handle, len(checkers))
+	for i, c := range checkers {
+		handles[i] = newHandle(c, c.Name())
+	}
+	return handles
+}
+
+func filterHandles(filters []Filter) []*Handle {
+	handles := make([]*Handle, len(filters))
+	for i, f := range filters {
+		handles[i] = newHandle(f, f.Name())
+	}
+	return handles
+}
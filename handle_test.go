@@ -0,0 +1,65 @@
+package rollingf
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestHandles(t *testing.T) {
+	mfs := NewMemFS()
+	for _, name := range []string{"app.log.1", "app.log.2", "app.log.3"} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	r := NewC("/mem/app.log", WithFS(mfs)).
+		WithChecker(MaxSizeChecker(4)).
+		WithMatcher(NewRegexMatcher(`\.\d+$`)).
+		WithDefaultProcessor().
+		WithFilterV2(gzFilter{}).
+		WithFilter(MaxBackupsFilter(1))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	checkers := r.Checkers()
+	if len(checkers) != 1 || checkers[0].Name() != "MaxSizeChecker" {
+		t.Fatal(checkers)
+	}
+	r.st.refresh(5)
+	if rolling, _, _ := r.checkChain(r.nextCycle()); !rolling {
+		t.Error("not rolling")
+	}
+	checkers[0].SetEnabled(false)
+	if rolling, _, _ := r.checkChain(r.nextCycle()); rolling {
+		t.Error("rolling by the disabled checker")
+	}
+	checkers[0].SetEnabled(true)
+	if err := checkers[0].SetThreshold(10); err != nil {
+		t.Fatal(err)
+	}
+	if rolling, _, _ := r.checkChain(r.nextCycle()); rolling {
+		t.Error("rolling below the threshold")
+	}
+
+	filters := r.Filters()
+	if len(filters) != 2 {
+		t.Fatal(filters)
+	}
+	if err := filters[0].SetThreshold(1); err != ErrNoThreshold {
+		t.Errorf("gzFilter: %v", err)
+	}
+	filters[1].SetThreshold(2)
+	if v, ok := filters[1].Threshold(); !ok || v != 2 {
+		t.Error(v, ok)
+	}
+	results, err := r.PurgeDryRun(context.Background())
+	if err != nil || len(results) != 1 || results[0].Name != "/mem/app.log.3" {
+		t.Fatalf("%+v %v", results, err)
+	}
+	filters[1].SetEnabled(false)
+	if results, _ = r.PurgeDryRun(context.Background()); len(results) != 0 {
+		t.Fatalf("%+v", results)
+	}
+}
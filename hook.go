@@ -0,0 +1,77 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"time"
+)
+
+// RotateEvent describes a finished rotation.
+type RotateEvent struct {
+	Cycle    uint64        // the ID of the check cycle, which tags the debug output and the error too
+	File     string        // the rolling file
+	Reason   string        // which checker triggered the rotation and why
+	Time     time.Time     // when the rotation started
+	Duration time.Duration // how long the rotation took
+	Resource Resource      // where the file was written
+	Err      error         // the error stopped the rotation, if any
+}
+
+// OnRotate registers fn which is called after every rotation, in the rotating goroutine.
+func (r *Roll) OnRotate(fn func(RotateEvent)) *Roll {
+	return r.OnRotateContext(func(_ context.Context, ev RotateEvent) {
+		fn(ev)
+	})
+}
+
+// OnRotateContext is OnRotate, fn gets the ctx of the rotation, which is done by Close or the deadline of Shutdown,
+// so the long hooks can be cancelled, eg. uploading the backup.
+func (r *Roll) OnRotateContext(fn func(ctx context.Context, ev RotateEvent)) *Roll {
+	r.rotateHooks = append(r.rotateHooks, fn)
+	return r
+}
+
+func (r *Roll) notifyRotate(ctx context.Context, id uint64, start time.Time, reason string, err error) {
+	ev := RotateEvent{
+		Cycle:    id,
+		File:     r.filePath,
+		Reason:   reason,
+		Time:     start,
+		Duration: r.now().Sub(start),
+		Resource: DetectResource(),
+		Err:      err,
+	}
+	r.stats.rotated(ev)
+	r.emitCompleted(id, ev.Duration, err)
+	for _, fn := range r.rotateHooks {
+		fn(ctx, ev)
+	}
+}
+
+// OnRemove registers fn which is called for every file filtered out by the filters after it is dealt,
+// with the error if it is not removed, in the rolling goroutine or the caller of Purge. Not called by PurgeDryRun.
+func (r *Roll) OnRemove(fn func(FilterResult)) *Roll {
+	r.removeHooks = append(r.removeHooks, fn)
+	return r
+}
+
+func (r *Roll) notifyRemove(results []FilterResult) {
+	for _, res := range results {
+		for _, fn := range r.removeHooks {
+			fn(res)
+		}
+	}
+}
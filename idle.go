@@ -0,0 +1,167 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// IdleMode decides what IdleTimeout does with the idle file.
+type IdleMode int
+
+const (
+	// IdleSync flushes the buffer and fsyncs the idle file once.
+	IdleSync IdleMode = iota
+	// IdleClose fsyncs and closes the idle file, the next write reopens it.
+	// The processes writing rarely do not pin the fd and the page cache, and the locks on NFS are released.
+	IdleClose
+)
+
+// IdleTimeout syncs or closes the file by mode after no writes for d.
+//
+// IdleClose needs the lock, see the Lock option, it degrades to IdleSync without the lock.
+// No rolling is checked while the file is closed, the next write checks it.
+func IdleTimeout(d time.Duration, mode IdleMode) Option {
+	return OptionFunc(func(r *Roll) {
+		if d <= 0 {
+			r.idle = nil
+			return
+		}
+		r.idle = &idleWatcher{timeout: d, mode: mode}
+	})
+}
+
+type idleWatcher struct {
+	timeout time.Duration
+	mode    IdleMode
+	last    int64 // atomic, the unix nano of the last write
+	closed  int32 // atomic, 1 if the file is closed for idling
+	synced  int64 // the last write synced, only the watching goroutine touches it
+}
+
+func (w *idleWatcher) touch(t time.Time) {
+	atomic.StoreInt64(&w.last, t.UnixNano())
+}
+
+func (w *idleWatcher) lastWrite() int64 {
+	return atomic.LoadInt64(&w.last)
+}
+
+func (w *idleWatcher) isClosed() bool {
+	return atomic.LoadInt32(&w.closed) == 1
+}
+
+// lockFile acquires the lock for writing, the file closed for idling is reopened.
+// The lock is held only if it returns nil, ErrClosed is returned after Close, eg. to the writes abandoned by Shutdown.
+func (r *Roll) lockFile() error {
+	r.fWLock()
+	select {
+	case <-r.closed:
+		r.fWUnlock()
+		return ErrClosed
+	default:
+	}
+	if r.idle == nil {
+		return nil
+	}
+	r.idle.touch(r.now())
+	for r.idle.isClosed() {
+		r.fWUnlock()
+		if err := r.wake(); err != nil {
+			return err
+		}
+		r.fWLock()
+	}
+	return nil
+}
+
+// wake reopens the file closed for idling.
+func (r *Roll) wake() error {
+	r.fOpLock()
+	defer r.fOpUnlock()
+	return r.wakeLocked()
+}
+
+func (r *Roll) wakeLocked() error {
+	if r.idle == nil || !r.idle.isClosed() {
+		return nil
+	}
+	select {
+	case <-r.closed:
+		return ErrClosed
+	default:
+	}
+
+	r.debug("[wake]")
+	if err := r.openFile(r.filePath); err != nil {
+		return err
+	}
+	r.idle.touch(r.now())
+	atomic.StoreInt32(&r.idle.closed, 0)
+	return nil
+}
+
+// idleEvery is the period of watchIdle.
+func (r *Roll) idleEvery() time.Duration {
+	every := r.idle.timeout / 2
+	if every < time.Millisecond {
+		every = time.Millisecond
+	}
+	return every
+}
+
+// watchIdle syncs or closes the idle file, every idleEvery until Close.
+func (r *Roll) watchIdle() {
+	last := r.idle.lastWrite()
+	if r.idle.isClosed() || last == r.idle.synced || r.now().Sub(time.Unix(0, last)) < r.idle.timeout {
+		return
+	}
+	if err := r.idleOnce(last); err != nil {
+		r.warn("[idle] err: %v", err)
+	}
+}
+
+func (r *Roll) idleOnce(last int64) error {
+	r.fOpLock()
+	defer r.fOpUnlock()
+	// a rolling in progress renames the file later
+	select {
+	case r.rotateCh <- struct{}{}:
+	default:
+		return nil
+	}
+	defer r.releaseRotate()
+	if r.f == nil || r.f.Name() != r.filePath || r.idle.lastWrite() != last {
+		return nil
+	}
+
+	r.debug("[idle] %v", r.idle.timeout)
+	r.idle.synced = last
+	if err := r.flushBuffer(); err != nil {
+		return err
+	}
+	if err := r.f.Sync(); err != nil {
+		return err
+	}
+	if r.idle.mode != IdleClose || r.rwmu == nil {
+		return nil
+	}
+
+	atomic.StoreInt32(&r.idle.closed, 1)
+	err := r.closeFile()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,73 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitIdle(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("not idle")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIdleClose(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), IdleTimeout(5*time.Millisecond, IdleClose))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Write([]byte("a\n"))
+	waitIdle(t, r.idle.isClosed)
+	r.fOpLock()
+	if r.f != nil {
+		t.Error("file not closed")
+	}
+	r.fOpUnlock()
+
+	if _, err = r.Write([]byte("b\n")); err != nil {
+		t.Fatal(err)
+	}
+	if r.idle.isClosed() {
+		t.Error("file not reopened")
+	}
+	waitIdle(t, r.idle.isClosed)
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Write([]byte("c\n")); err != os.ErrClosed {
+		t.Errorf("write after close: %v", err)
+	}
+
+	if b, _ := os.ReadFile(fp); string(b) != "a\nb\n" {
+		t.Fatalf("%q", b)
+	}
+}
+
+func TestIdleSync(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), IdleTimeout(5*time.Millisecond, IdleSync))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("a\n"))
+	waitIdle(t, func() bool {
+		r.fOpLock()
+		defer r.fOpUnlock()
+		return r.idle.synced == atomic.LoadInt64(&r.idle.last)
+	})
+	if r.idle.isClosed() {
+		t.Error("file closed")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Inventory is the file and its backups found by Inspect.
+type Inventory struct {
+	Path      string
+	Exists    bool         // whether the file exists
+	Size      int64        // the size of the file, 0 if it does not exist
+	ModTime   time.Time    // the last write of the file
+	Backups   []BackupInfo // sorted from the newest to the oldest, like Roll.Backups
+	TotalSize int64        // the size on disk of the file and the backups
+	State     *RollState   // the state of StateFile at the default path, nil if none
+	Policy    InferredPolicy
+}
+
+// InferredPolicy is the retention and the rolling the backups on disk suggest, eg. for auditing a directory
+// whose configuration is unknown. The figures are observed, not configured: a MaxBackupsFilter of 10 keeping
+// 3 backups yet is inferred as 3.
+type InferredPolicy struct {
+	MaxBackups   int            // the number of the backups
+	MaxAge       time.Duration  // the age of the oldest backup, by the time embedded in the name if any
+	Interval     time.Duration  // the median interval between the consecutive backups, 0 if less than 2
+	Format       CompressFormat // the format of the newest backup compressed, NoCompress if none is
+	Uncompressed int            // the newest backups before the first compressed one, eg. kept by CompressAfter
+	Interrupted  []string       // the paths left by a rolling interrupted or in progress, see Roll.Reopen
+}
+
+// Inspect returns the inventory of the file at filePath and its backups matched by m, without creating or opening
+// the file, so the CLI tools and the tests analyze a directory managed by a Roll, even by another process, untouched.
+//
+// m is initialized with the base name like Roll.WithMatcher, AnyFormatMatcher if nil. The backups are sorted by the
+// TimestampSorter if m is a NamerMatcher of a namer embedding the time, by the NumericSorter otherwise.
+// The backups moved by ShardByDate are not found.
+func Inspect(filePath string, m Matcher) (*Inventory, error) {
+	if m == nil {
+		m = AnyFormatMatcher()
+	}
+	r := &Roll{filePath: filePath, fs: osFS{}, st: &Rstat{}, quiet: true}
+	r.setTmpFile("", defaultTmpName)
+	if nm, ok := m.(*namerMatcher); ok {
+		r.namer = nm.namer
+		if _, ok := nm.namer.(timeParser); ok {
+			r.WithSorter(TimestampSorter(nm.namer))
+		}
+	}
+	r.WithMatcher(m)
+
+	inv := &Inventory{Path: filePath}
+	info, err := r.fs.Stat(filePath)
+	switch {
+	case err == nil:
+		inv.Exists, inv.Size, inv.ModTime = true, info.Size(), info.ModTime()
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	if inv.Backups, err = r.Backups(); err != nil {
+		return nil, err
+	}
+	inv.TotalSize = inv.Size
+	for _, b := range inv.Backups {
+		inv.TotalSize += b.Size
+	}
+	if inv.State, err = inspectState(r.fs, filePath); err != nil {
+		return nil, err
+	}
+	inv.Policy = inferPolicy(inv.Backups, time.Now())
+	if inv.Policy.Interrupted, err = r.interrupted(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// inspectState reads the state file at the default path, nil if none.
+func inspectState(fsys FS, filePath string) (*RollState, error) {
+	dir, base := path.Split(filePath)
+	s := &stateStore{path: path.Join(dir, strings.ReplaceAll(defaultStateName, "{base}", base))}
+	if err := s.load(fsys); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &s.s, nil
+}
+
+// inferPolicy infers the policy from the backups sorted from the newest to the oldest.
+func inferPolicy(backups []BackupInfo, now time.Time) InferredPolicy {
+	p := InferredPolicy{MaxBackups: len(backups), Uncompressed: len(backups)}
+	var times []time.Time
+	for i, b := range backups {
+		if b.Compressed && p.Format == NoCompress {
+			p.Format, p.Uncompressed = b.Format, i
+		}
+		t := b.Time
+		if t.IsZero() {
+			t = b.ModTime
+		}
+		times = append(times, t)
+	}
+	if len(times) == 0 {
+		return p
+	}
+	if p.Format == NoCompress {
+		p.Uncompressed = 0
+	}
+
+	oldest := times[0]
+	for _, t := range times {
+		if t.Before(oldest) {
+			oldest = t
+		}
+	}
+	p.MaxAge = now.Sub(oldest)
+
+	if len(times) > 1 {
+		gaps := make([]time.Duration, 0, len(times)-1)
+		for i := 1; i < len(times); i++ {
+			gap := times[i-1].Sub(times[i])
+			if gap < 0 {
+				gap = -gap
+			}
+			gaps = append(gaps, gap)
+		}
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		p.Interval = gaps[len(gaps)/2]
+	}
+	return p
+}
+
+// interrupted returns the paths left by a rolling interrupted: the temporary file, the partial compressions
+// and the journal of a renumbering.
+func (r *Roll) interrupted() ([]string, error) {
+	dir, base := path.Split(r.filePath)
+	dir = path.Clean(dir)
+	var paths []string
+	if _, err := r.fs.Stat(r.tmpFilePath); err == nil {
+		paths = append(paths, r.tmpFilePath)
+	}
+	entries, err := r.fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, base) && strings.HasSuffix(name, compressTmpSuffix) &&
+			compressFormat(strings.TrimSuffix(name, compressTmpSuffix)) != NoCompress {
+			paths = append(paths, path.Join(dir, name))
+		}
+	}
+	if _, err := r.fs.Stat(journalPath(dir, base)); err == nil {
+		paths = append(paths, journalPath(dir, base))
+	}
+	return paths, nil
+}
+
+// Verify decompresses the compressed backups of inv to the end, and returns the errors wrapping ErrCorruptArchive
+// of the ones truncated or corrupted, eg. by a crash or a bad disk, until ctx is done.
+// The backups compressed with a dictionary are skipped, see Compressor.WithDictionary.
+func (inv *Inventory) Verify(ctx context.Context) []error {
+	var errs []error
+	for _, b := range inv.Backups {
+		if !b.Compressed {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return append(errs, err)
+		}
+		if err := verifyBackup(b); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func verifyBackup(b BackupInfo) error {
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rc, err := codec{format: b.Format}.reader(f)
+	if errors.Is(err, zlib.ErrDictionary) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptArchive, b.Path, err)
+	}
+	defer rc.Close()
+	if _, err = copyPooled(io.Discard, rc); errors.Is(err, zlib.ErrDictionary) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptArchive, b.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	now := time.Now()
+	for i, name := range []string{"app.log.1", "app.log.2", "app.log.3.gz", "app.log.4.gz", "other.log", "app.log.5.gz.tmp", "_app.log"} {
+		p := path.Join(dir, name)
+		if err := os.WriteFile(p, []byte("1234"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mt := now.Add(-time.Duration(i+1) * time.Hour)
+		os.Chtimes(p, mt, mt)
+	}
+
+	inv, err := Inspect(fp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fp); !os.IsNotExist(err) {
+		t.Fatal("the file is created", err)
+	}
+	if inv.Exists || inv.Size != 0 || inv.State != nil {
+		t.Fatalf("%+v", inv)
+	}
+	var names []string
+	for _, b := range inv.Backups {
+		names = append(names, b.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"app.log.1", "app.log.2", "app.log.3.gz", "app.log.4.gz"}) {
+		t.Fatal(names)
+	}
+	if inv.TotalSize != 16 {
+		t.Fatal(inv.TotalSize)
+	}
+
+	p := inv.Policy
+	if p.MaxBackups != 4 || p.Format != Gzip || p.Uncompressed != 2 || p.Interval != time.Hour {
+		t.Fatalf("%+v", p)
+	}
+	if p.MaxAge < 4*time.Hour || p.MaxAge > 5*time.Hour {
+		t.Fatal(p.MaxAge)
+	}
+	if !reflect.DeepEqual(p.Interrupted, []string{path.Join(dir, "_app.log"), path.Join(dir, "app.log.5.gz.tmp")}) {
+		t.Fatal(p.Interrupted)
+	}
+
+	// the Roll finishes the rolling interrupted, and leaves the state behind
+	r := NewC(fp, StateFile("")).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	r.Write([]byte("hello"))
+	r.Close()
+	if inv, err = Inspect(fp, DefaultMatcher()); err != nil {
+		t.Fatal(err)
+	}
+	if !inv.Exists || inv.Size != 9 || inv.State == nil || len(inv.Backups) != 2 || len(inv.Policy.Interrupted) != 0 {
+		t.Fatalf("%+v", inv)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// WriteInterceptor intercepts the payload of every Write before it is persisted.
+type WriteInterceptor interface {
+	// Intercept returns the bytes to be written instead of p.
+	// It must not modify p in place, p belongs to the caller.
+	Intercept(p []byte) []byte
+}
+
+// InterceptorFunc adapts an ordinary function to a WriteInterceptor.
+type InterceptorFunc func(p []byte) []byte
+
+func (f InterceptorFunc) Intercept(p []byte) []byte {
+	return f(p)
+}
+
+var _ WriteInterceptor = (*redactor)(nil)
+
+// noSubmatch expands the replacement of the fixed secrets.
+var noSubmatch = regexp.MustCompile(``)
+
+type redactor struct {
+	replacement []byte
+	literal     []byte // the replacement of the fixed secrets, which have no submatches
+	fixed       [][]byte
+	regs        []*regexp.Regexp
+}
+
+// Redactor scrubs secrets from the payload, replacing them with replacement.
+// The references to the submatches are expanded for the Regexp patterns only, they are empty for the Fixed secrets,
+// eg. "${1}***" replaces a fixed secret with "***".
+//
+// eg.
+//
+//	Redactor("***").Fixed(apiKey).Regexp(`(password=)\S+`)
+func Redactor(replacement string) *redactor {
+	return &redactor{
+		replacement: []byte(replacement),
+		literal:     noSubmatch.ExpandString(nil, replacement, "", []int{0, 0}),
+	}
+}
+
+// Fixed adds the secrets that will be matched literally.
+func (r *redactor) Fixed(secrets ...string) *redactor {
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		r.fixed = append(r.fixed, []byte(s))
+	}
+	return r
+}
+
+// Regexp adds the patterns of secrets, it panics if a pattern can not be compiled.
+//
+// The replacement may refer to the submatches of the patterns, eg. "${1}***".
+func (r *redactor) Regexp(patterns ...string) *redactor {
+	for _, p := range patterns {
+		r.regs = append(r.regs, regexp.MustCompile(p))
+	}
+	return r
+}
+
+func (r *redactor) Intercept(p []byte) []byte {
+	for _, s := range r.fixed {
+		if bytes.Contains(p, s) {
+			p = bytes.ReplaceAll(p, s, r.literal)
+		}
+	}
+	for _, reg := range r.regs {
+		if reg.Match(p) {
+			p = reg.ReplaceAll(p, r.replacement)
+		}
+	}
+	return p
+}
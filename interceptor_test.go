@@ -0,0 +1,80 @@
+package rollingf
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := Redactor("***").Fixed("s3cr3t").Regexp(`(token=)\w+`)
+
+	in := []byte("user=a password=s3cr3t token=abc123 end")
+	out := r.Intercept(in)
+	if string(out) != "user=a password=*** *** end" {
+		t.Fatal(string(out))
+	}
+	if string(in) != "user=a password=s3cr3t token=abc123 end" {
+		t.Fatal("input modified", string(in))
+	}
+
+	r = Redactor("${1}***").Regexp(`(token=)\w+`)
+	if out := r.Intercept([]byte("token=abc")); string(out) != "token=***" {
+		t.Fatal(string(out))
+	}
+}
+
+func TestRollInterceptor(t *testing.T) {
+	mfs := NewMemFS()
+	r := NewC("/mem/app.log", WithFS(mfs))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	r.WithInterceptor(Redactor("${1}***").Fixed("s3cr3t").Regexp(`(token=)\w+`))
+
+	in := "password=s3cr3t token=abc123\n"
+	if n, err := r.Write([]byte(in)); n != len(in) || err != nil {
+		t.Fatal(n, err)
+	}
+	if b, _ := mfs.ReadFile("/mem/app.log"); string(b) != "password=*** token=***\n" {
+		t.Fatalf("%q", b)
+	}
+}
+
+// shortFS writes one byte less than asked to the files opened for writing, without an error.
+type shortFS struct {
+	FS
+}
+
+type shortFile struct {
+	File
+}
+
+func (f shortFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || flag&os.O_WRONLY == 0 {
+		return file, err
+	}
+	return shortFile{file}, nil
+}
+
+func (f shortFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return f.File.Write(p[:len(p)-1])
+}
+
+func TestRollInterceptorShortWrite(t *testing.T) {
+	r := NewC("/mem/app.log", WithFS(shortFS{NewMemFS()}))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	r.WithInterceptor(Redactor("***").Fixed("s3cr3t"))
+
+	if n, err := r.Write([]byte("password=s3cr3t\n")); n != 0 || err != io.ErrShortWrite {
+		t.Fatal(n, err)
+	}
+}
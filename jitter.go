@@ -0,0 +1,46 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"math/rand"
+	"os"
+	"time"
+)
+
+// jitterSetter is implemented by the time-based checkers, which delay their rollings by the jitter.
+type jitterSetter interface {
+	setJitter(d time.Duration)
+}
+
+// WithJitter delays the time-based rollings, of IntervalChecker, RotateDaily and RotateHourly, by a random offset
+// in [0, d), so the instances of a fleet do not roll, compress and upload at the same second.
+// The offset is drawn once, every rolling of the Roll is delayed by it, eg. daily at 00:03:27 with WithJitter(5*time.Minute).
+// d <= 0 removes the offset.
+func (r *Roll) WithJitter(d time.Duration) *Roll {
+	r.jitter = 0
+	if d > 0 {
+		// the global source is not seeded before go1.20, the same offset in the whole fleet
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())<<32))
+		r.jitter = time.Duration(rnd.Int63n(int64(d)))
+	}
+	r.setupAll()
+	return r
+}
+
+// Jitter returns the offset of the time-based rollings drawn by WithJitter.
+func (r *Roll) Jitter() time.Duration {
+	return r.jitter
+}
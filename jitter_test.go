@@ -0,0 +1,70 @@
+package rollingf
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithJitter(t *testing.T) {
+	daily, interval := RotateDaily(), IntervalChecker(time.Hour)
+	r := NewC(t.TempDir()+"/app.log").WithChecker(daily, interval).WithJitter(10 * time.Minute)
+	defer r.Close()
+
+	if j := r.Jitter(); j < 0 || j >= 10*time.Minute {
+		t.Fatal("jitter", j)
+	}
+	if daily.jitter != r.Jitter() || time.Duration(interval.jitter) != r.Jitter() {
+		t.Fatal("checkers", daily.jitter, interval.jitter)
+	}
+
+	r.WithJitter(0)
+	if r.Jitter() != 0 || daily.jitter != 0 || interval.jitter != 0 {
+		t.Fatal("jitter not removed", r.Jitter(), daily.jitter, interval.jitter)
+	}
+}
+
+func TestCheckerJitter(t *testing.T) {
+	fp := t.TempDir() + "/app.log"
+	if err := os.WriteFile(fp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &Rstat{}
+	st.reset(info)
+
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 23, 58, 0, 0, time.UTC)}
+	daily := RotateDaily().In(time.UTC)
+	daily.setClock(clock)
+	daily.setJitter(5 * time.Minute)
+	daily.Check(fp, st)
+
+	// 00:04
+	clock.Add(6 * time.Minute)
+	if ok, _ := daily.Check(fp, st); ok {
+		t.Fatal("unexpected rolling before the jitter")
+	}
+	clock.Add(2 * time.Minute)
+	if ok, _ := daily.Check(fp, st); !ok {
+		t.Fatal("expect rolling after midnight and the jitter")
+	}
+
+	ok, birth := st.Birthtimespec()
+	if !ok {
+		t.Skip("no birth time")
+	}
+	clock.now = time.Unix(birth.Unix()).Add(time.Hour + 30*time.Second)
+	interval := IntervalChecker(time.Hour)
+	interval.setClock(clock)
+	interval.setJitter(time.Minute)
+	if ok, _ := interval.Check(fp, st); ok {
+		t.Fatal("unexpected rolling before the jitter")
+	}
+	clock.Add(time.Minute)
+	if ok, _ := interval.Check(fp, st); !ok {
+		t.Fatal("expect rolling after the interval and the jitter")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+// ErrClosed is returned by the writes and the other operations of the closed Roll, it is os.ErrClosed.
+var ErrClosed = os.ErrClosed
+
+// ErrNotClosed is returned by Reopen if the Roll is not closed.
+var ErrNotClosed = errors.New("rollingf: not closed")
+
+// Reopen revives the closed Roll with the same options and components, eg. the file is closed during a maintenance.
+// The file is opened again and the rolling interrupted by Close is finished first, like a new start.
+//
+// The subscribers of Events and Tail must subscribe again, so does CaptureStdio. It must not be called
+// concurrently with Close. The Roll stays closed if it fails.
+func (r *Roll) Reopen() error {
+	r.fOpLock()
+	select {
+	case <-r.closed:
+	default:
+		r.fOpUnlock()
+		return ErrNotClosed
+	}
+
+	r.closed = make(chan struct{})
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	if r.async != nil {
+		r.async = newAsyncWriter(cap(r.async.ch), r.async.policy)
+	}
+	if r.timeout != nil {
+		r.timeout = &timeoutWriter{timeout: r.timeout.timeout, jobs: make(chan writeJob)}
+	}
+	if r.repeats != nil {
+		r.repeats.mu.Lock()
+		r.repeats.closed = false
+		r.repeats.mu.Unlock()
+	}
+	r.events.reopen()
+	r.tails.reopen()
+	// Close holds the token of the rolling
+	<-r.rotateCh
+	r.fOpUnlock()
+
+	if err := reopenDir(r.fs); err != nil {
+		// the files are operated by the paths meanwhile
+		r.warn("[Reopen] directory err: %v", err)
+	}
+	if err := r.start(); err != nil {
+		r.rotateCh <- struct{}{}
+		r.cancel()
+		close(r.closed)
+		return err
+	}
+	atomic.StoreInt32(&r.stopping, 0)
+	return nil
+}
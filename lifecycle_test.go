@@ -0,0 +1,54 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestReopen(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), NonBlocking(16, DropNewest), WithWriteTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("a"))
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.Write([]byte("x")); err != ErrClosed {
+		t.Fatal("write after close", err)
+	}
+	if _, err = r.WriteBatch([][]byte{[]byte("x")}); err != ErrClosed {
+		t.Fatal("write after close", err)
+	}
+	if err = r.Close(); err != ErrClosed {
+		t.Fatal("second close", err)
+	}
+
+	if err = r.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reopen(); err != ErrNotClosed {
+		t.Fatal("reopen the open roll", err)
+	}
+	r.Write([]byte("b"))
+	for r.async.pendingBytes() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err = r.MarkRotate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("c"))
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"app.log": "c", "app.log.1": "ab"} {
+		if b, err := os.ReadFile(path.Join(path.Dir(fp), name)); err != nil || string(b) != want {
+			t.Errorf("%s: %q, want %q, %v", name, b, want, err)
+		}
+	}
+}
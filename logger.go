@@ -0,0 +1,130 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// Level is the severity of a diagnostic, the values are those of log/slog, so slog.Level(level) converts it.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Logger receives the diagnostics of a Roll and its processors and filters, see WithLogger.
+// The keyvals alternate the keys and the values, "caller" with the location, and "file" with the path of the Roll.
+type Logger interface {
+	// Enabled reports whether the diagnostics at level are logged, the others are not even formatted.
+	Enabled(level Level) bool
+	Log(level Level, msg string, keyvals ...any)
+}
+
+// StdLogger logs the diagnostics at least min to l, as "LEVEL msg key=value ...".
+func StdLogger(l *log.Logger, min Level) Logger {
+	return &stdLogger{l: l, min: min}
+}
+
+type stdLogger struct {
+	l   *log.Logger
+	min Level
+}
+
+func (l *stdLogger) Enabled(level Level) bool {
+	return level >= l.min
+}
+
+func (l *stdLogger) Log(level Level, msg string, keyvals ...any) {
+	var sb strings.Builder
+	sb.WriteString(level.String())
+	sb.WriteByte(' ')
+	sb.WriteString(msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fmt.Fprintf(&sb, " %v=%v", keyvals[i], keyvals[i+1])
+	}
+	l.l.Output(2, sb.String())
+}
+
+// WithLogger routes the diagnostics of the Roll, its processors and its filters to l instead of the global
+// debug output, whether SetDebug is enabled or not, so each Roll is diagnosed on its own.
+// The errors handled in background are logged at LevelWarn, the rest at LevelDebug.
+func WithLogger(l Logger) Option {
+	return OptionFunc(func(r *Roll) {
+		r.logger = l
+		r.setupAll()
+	})
+}
+
+// loggerSetter is implemented by the components logging to the Logger of their Roll.
+type loggerSetter interface {
+	setLogger(l Logger)
+}
+
+// logs routes the diagnostics of a component to the Logger of its Roll, or the global debug output without one.
+type logs struct {
+	logger Logger
+}
+
+func (l *logs) setLogger(logger Logger) {
+	l.logger = logger
+}
+
+func (l *logs) debug(format string, args ...any) {
+	logAt(l.logger, 3, LevelDebug, "", format, args...)
+}
+
+func (l *logs) warn(format string, args ...any) {
+	logAt(l.logger, 3, LevelWarn, "", format, args...)
+}
+
+// logAt logs the message at level to l with the location of the caller at calldepth, and the path of the Roll
+// unless file is empty. It falls back to the global debug output if l is nil.
+func logAt(l Logger, calldepth int, level Level, file, format string, args ...any) {
+	if l == nil {
+		logDebug(calldepth+1, format, args...)
+		return
+	}
+	if !l.Enabled(level) {
+		return
+	}
+	_, f, line, _ := runtime.Caller(calldepth)
+	keyvals := []any{"caller", fmt.Sprintf("%s:%d", path.Base(f), line)}
+	if file != "" {
+		keyvals = append(keyvals, "file", file)
+	}
+	l.Log(level, fmt.Sprintf(format, args...), keyvals...)
+}
@@ -0,0 +1,136 @@
+package rollingf
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type record struct {
+	level   Level
+	msg     string
+	keyvals []any
+}
+
+// recordLogger records the diagnostics at least min.
+type recordLogger struct {
+	min Level
+
+	mu      sync.Mutex
+	records []record
+}
+
+func (l *recordLogger) Enabled(level Level) bool {
+	return level >= l.min
+}
+
+func (l *recordLogger) Log(level Level, msg string, keyvals ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, record{level, msg, keyvals})
+}
+
+func (l *recordLogger) find(prefix string) (record, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, rec := range l.records {
+		if strings.HasPrefix(rec.msg, prefix) {
+			return rec, true
+		}
+	}
+	return record{}, false
+}
+
+func TestWithLogger(t *testing.T) {
+	// the Logger is used whether the global debug output is enabled or not
+	old := debugEnabled
+	SetDebug(false)
+	defer SetDebug(old)
+
+	logger := &recordLogger{min: LevelDebug}
+	fp := t.TempDir() + "/app.log"
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	r.Write([]byte("a\n"))
+	if err = rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	// by the Roll
+	rec, ok := logger.find("[openFile]")
+	if !ok || rec.level != LevelDebug {
+		t.Fatal("openFile", rec)
+	}
+	if len(rec.keyvals) != 4 || rec.keyvals[0] != "caller" || !strings.HasPrefix(rec.keyvals[1].(string), "roll.go:") ||
+		rec.keyvals[2] != "file" || rec.keyvals[3] != fp {
+		t.Fatal("keyvals", rec.keyvals)
+	}
+	// by the processor
+	if rec, ok = logger.find("[Rename] app.log --> app.log.1"); !ok || len(rec.keyvals) != 2 {
+		t.Fatal("processor", rec)
+	}
+
+	quiet := &recordLogger{min: LevelWarn}
+	r.WithOptions(WithLogger(quiet))
+	r.Write([]byte("b\n"))
+	if err = rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if len(quiet.records) != 0 {
+		t.Fatal("records below the level", quiet.records)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := StdLogger(log.New(&buf, "", 0), LevelInfo)
+	if l.Enabled(LevelDebug) || !l.Enabled(LevelWarn) {
+		t.Fatal("enabled")
+	}
+	l.Log(LevelWarn, "[sweep] err: boom", "caller", "retention.go:34", "file", "/var/log/app.log")
+	if got, want := buf.String(), "WARN [sweep] err: boom caller=retention.go:34 file=/var/log/app.log\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSetDebugOutput(t *testing.T) {
+	SetDebug(true)
+	dir := t.TempDir()
+	if err := SetDebugOutput(dir + "/debug.log"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDebugOutput("")
+
+	r, err := NewE(NewRollConf(dir+"/app.log", DurOneDay, 0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	r.Write([]byte("a\n"))
+	if err = rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if err := SetDebugOutput(""); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(dir + "/debug.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the Roll of the debug output is quiet from the start
+	if !strings.Contains(string(b), "[Rename] app.log --> app.log.1") || strings.Contains(string(b), "debug.log") {
+		t.Fatal(string(b))
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "runtime"
+
+// CompressLowPriority runs the compressions at the idle I/O and CPU priorities, so compressing a large backup
+// does not starve the disk of the application, see WithCompressRateLimit to throttle it instead.
+// It must follow the Compress option. It is a no-op on the platforms other than Linux.
+func CompressLowPriority() Option {
+	return OptionFunc(func(r *Roll) {
+		if c, ok := r.processor.(*compressor); ok {
+			c.WithLowPriority()
+		}
+	})
+}
+
+// WithLowPriority compresses each file in a thread of the idle I/O class and the SCHED_IDLE policy on Linux,
+// the application keeps its priorities.
+func (p *compressor) WithLowPriority() *compressor {
+	p.lowPriority = true
+	return p
+}
+
+// runLowPriority runs fn in a thread of the lowest priorities. The thread is locked and never unlocked,
+// so it exits with the goroutine and its priorities do not leak to the other goroutines.
+// fn runs anyway if the priorities cannot be lowered.
+func runLowPriority(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := lowerThreadPriority(); err != nil {
+			debug("[lowPriority] err: %v", err)
+		}
+		done <- fn()
+	}()
+	return <-done
+}
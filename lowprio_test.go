@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package rollingf
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// threadPriority returns the I/O class and the scheduling policy of the calling thread.
+func threadPriority(t *testing.T) (int, int) {
+	tid := syscall.Gettid()
+	prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(tid), 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	policy, _, errno := syscall.Syscall(syscall.SYS_SCHED_GETSCHEDULER, uintptr(tid), 0, 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	return int(prio >> ioprioClassShift), int(policy)
+}
+
+func TestRunLowPriority(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	class, policy := threadPriority(t)
+
+	var lowClass, lowPolicy int
+	if err := runLowPriority(func() error {
+		lowClass, lowPolicy = threadPriority(t)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if lowClass != ioprioClassIdle || lowPolicy != schedIdle {
+		t.Fatal("low priority", lowClass, lowPolicy)
+	}
+	if c, p := threadPriority(t); c != class || p != policy {
+		t.Fatal("caller changed", c, p)
+	}
+}
+
+func TestCompressLowPriority(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("hello\n"), 1000)
+	if err := os.WriteFile(path.Join(dir, "app.log"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := Compressor(Gzip).WithLowPriority().WithVerify()
+	p.Init("app.log")
+	if err := p.Process(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := os.ReadDir(dir); len(names) != 1 || names[0].Name() != "app.log.1.gz" {
+		t.Fatal("files", names)
+	}
+}
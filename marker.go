@@ -0,0 +1,70 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// RotateMarker rolls the file when a record equal to marker is written, the marker itself is not written.
+//
+// The records written before the marker end the file and the ones after it start the new file,
+// eg. a batch job writes the marker at the end of each batch. A WriteBatch is split by the markers in it.
+func RotateMarker(marker []byte) Option {
+	return OptionFunc(func(r *Roll) {
+		if len(marker) > 0 {
+			r.marker = append([]byte(nil), marker...)
+		}
+	})
+}
+
+// MarkRotate rolls the file at the current record boundary, no later write goes to the file rolled.
+//
+// Unlike the rolling triggered by the checkers, it waits for the last rolling in progress instead of skipping.
+func (r *Roll) MarkRotate() error {
+	return r.rotate(atomic.AddUint64(&r.cycles, 1), "MarkRotate", true)
+}
+
+// writeMarked writes the records between the markers, and rolls the file at each marker.
+func (r *Roll) writeMarked(records [][]byte) (int, error) {
+	var n, from int
+	for i, p := range records {
+		if !bytes.Equal(p, r.marker) {
+			continue
+		}
+		if from < i {
+			m, err := r.writeUnmarked(records[from:i])
+			n += m
+			if err != nil {
+				return n, err
+			}
+		}
+		if err := r.MarkRotate(); err != nil {
+			return n, err
+		}
+		n += len(p)
+		from = i + 1
+	}
+
+	if from < len(records) {
+		m, err := r.writeUnmarked(records[from:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
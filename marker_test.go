@@ -0,0 +1,44 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRotateMarker(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 3), RotateMarker([]byte("--\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Write([]byte("a\n"))
+	if n, err := r.WriteBatch([][]byte{[]byte("b\n"), []byte("--\n"), []byte("c\n")}); err != nil || n != 7 {
+		t.Fatal(n, err)
+	}
+	// the rolling in progress is waited
+	r.Write([]byte("--\n"))
+	r.Write([]byte("d\n"))
+	if err = r.MarkRotate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("e\n"))
+	r.Close()
+
+	for name, want := range map[string]string{
+		"app.log":   "e\n",
+		"app.log.1": "d\n",
+		"app.log.2": "c\n",
+		"app.log.3": "a\nb\n",
+	} {
+		b, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: %q, want %q", name, b, want)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package rollingf
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -29,7 +30,11 @@ type Matcher interface {
 	Init(base string)
 }
 
-var _ Matcher = (*regexMatcher)(nil)
+var (
+	_ Matcher = (*regexMatcher)(nil)
+	_ Matcher = (*namerMatcher)(nil)
+	_ Matcher = (*indexMatcher)(nil)
+)
 
 type regexMatcher struct {
 	suffixPattern string
@@ -41,18 +46,30 @@ type regexMatcher struct {
 //
 // eg.
 // app.log app.log.1 app.log.2 ...
-func DefaultMatcher() *regexMatcher {
-	return NewRegexMatcher(`(\.\d+)?$`)
+func DefaultMatcher() *indexMatcher {
+	return newIndexMatcher("", false)
 }
 
 // CompressMatcher matches the file names with the .1.gz suffix
 //
 // eg.
 // app.log app.log.1.gz app.log.2.gz ...
-func CompressMatcher(format CompressFormat) *regexMatcher {
-	return NewRegexMatcher(`(\.\d+\` + cfSuffix[format] + `)?$`)
+func CompressMatcher(format CompressFormat) *indexMatcher {
+	return newIndexMatcher(cfSuffix[format], false)
+}
+
+// AnyFormatMatcher matches the file names with any compression suffix or none, eg. after switching the format of
+// the Compressor, so the backups left in the other formats are filtered together with the new ones.
+//
+// eg.
+// app.log app.log.1 app.log.2.gz app.log.3.z ...
+func AnyFormatMatcher() *indexMatcher {
+	return &indexMatcher{anyFormat: true}
 }
 
+// NewRegexMatcher matches the file names by the regular expression of the suffix after the base name.
+//
+// It is much slower than DefaultMatcher and CompressMatcher, use it for the custom patterns only.
 func NewRegexMatcher(suffixPattern string) *regexMatcher {
 	return &regexMatcher{
 		suffixPattern: suffixPattern,
@@ -70,3 +87,98 @@ func (m *regexMatcher) Init(base string) {
 		debug("[regexMatcher] pattern: %v", m.reg)
 	})
 }
+
+type namerMatcher struct {
+	namer Namer
+	reg   *regexp.Regexp
+	once  sync.Once
+}
+
+// NamerMatcher matches the file names produced by the built-in namers, with or without a compression suffix
+//
+// eg.
+// app.log app.log.20240601T120000 app.log.20240601T130000.gz ...
+func NamerMatcher(n Namer) *namerMatcher {
+	return &namerMatcher{
+		namer: n,
+	}
+}
+
+func (m *namerMatcher) Match(other string) bool {
+	return m.reg != nil && m.reg.MatchString(other)
+}
+
+func (m *namerMatcher) Init(base string) {
+	m.once.Do(func() {
+		p, ok := m.namer.(patterner)
+		if !ok {
+			debug("[namerMatcher] unknown namer %T", m.namer)
+			return
+		}
+
+		var suffixes []string
+		for _, s := range cfSuffix {
+			suffixes = append(suffixes, regexp.QuoteMeta(s))
+		}
+		sort.Strings(suffixes)
+		m.reg = regexp.MustCompile("^" + p.pattern(base) + "(" + strings.Join(suffixes, "|") + ")?$")
+		debug("[namerMatcher] pattern: %v", m.reg)
+	})
+}
+
+// indexMatcher is the fast path of the default naming scheme, it is equivalent to
+// the regular expression `^base(\.\d+suffix)?$`, the suffix may be optional or any of the compression suffixes.
+type indexMatcher struct {
+	suffix         string
+	optionalSuffix bool
+	anyFormat      bool
+
+	base   string
+	prefix string
+}
+
+func newIndexMatcher(suffix string, optionalSuffix bool) *indexMatcher {
+	return &indexMatcher{
+		suffix:         suffix,
+		optionalSuffix: optionalSuffix,
+	}
+}
+
+func (m *indexMatcher) Match(other string) bool {
+	if other == m.base {
+		return true
+	}
+	if !strings.HasPrefix(other, m.prefix) {
+		return false
+	}
+
+	rest := other[len(m.prefix):]
+	if m.anyFormat {
+		rest = trimCompressSuffix(rest)
+	} else if m.suffix != "" {
+		if strings.HasSuffix(rest, m.suffix) {
+			rest = rest[:len(rest)-len(m.suffix)]
+		} else if !m.optionalSuffix {
+			return false
+		}
+	}
+	return isDigits(rest)
+}
+
+func (m *indexMatcher) Init(base string) {
+	m.base = base
+	m.prefix = base + "."
+}
+
+// isDigits reports whether s is not empty and contains only ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
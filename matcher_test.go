@@ -0,0 +1,55 @@
+package rollingf
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestIndexMatcher(t *testing.T) {
+	cases := []struct {
+		fast  Matcher
+		regex Matcher
+	}{
+		{DefaultMatcher(), NewRegexMatcher(`(\.\d+)?$`)},
+		{CompressMatcher(Gzip), NewRegexMatcher(`(\.\d+\.gz)?$`)},
+		{newIndexMatcher(".gz", true), NewRegexMatcher(`(\.\d+(\.gz)?)?$`)},
+		{AnyFormatMatcher(), NewRegexMatcher(`(\.\d+(\.gz|\.z)?)?$`)},
+	}
+
+	names := []string{
+		"app.log", "app.log.1", "app.log.12", "app.log.1.gz", "app.log.12.gz", "app.log.", "app.log.gz",
+		"app.log.1a", "app.log.a1", "_app.log", "app.log.1.gz.tmp", "app.logx", "app.log.1.z", "app.log..gz", "app",
+	}
+	for _, c := range cases {
+		c.fast.Init("app.log")
+		c.regex.Init("app.log")
+		for _, name := range names {
+			if c.fast.Match(name) != c.regex.Match(name) {
+				t.Fatalf("%s: %v != %v", name, c.fast.Match(name), c.regex.Match(name))
+			}
+		}
+	}
+}
+
+func benchmarkMatcher(b *testing.B, m Matcher) {
+	m.Init("app.log")
+	names := make([]string, 10000)
+	for i := range names {
+		names[i] = "app.log." + strconv.Itoa(i) + ".gz"
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, name := range names {
+			m.Match(name)
+		}
+	}
+}
+
+func BenchmarkRegexMatcher(b *testing.B) {
+	benchmarkMatcher(b, NewRegexMatcher(`(\.\d+\.gz)?$`))
+}
+
+func BenchmarkIndexMatcher(b *testing.B) {
+	benchmarkMatcher(b, CompressMatcher(Gzip))
+}
@@ -0,0 +1,312 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ FS          = (*MemFS)(nil)
+	_ chtimeser   = (*MemFS)(nil)
+	_ clockSetter = (*MemFS)(nil)
+	_ File        = (*memFile)(nil)
+)
+
+// MemFS is an in-memory FS for the hermetic tests, the directories are implicit.
+//
+// Like the inodes, the opened files keep the content after being renamed or removed.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	clock Clock
+}
+
+type memData struct {
+	mu      sync.Mutex
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemFS creates an empty MemFS, the modification time of the files follows the Clock of the Roll.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: map[string]*memData{},
+		clock: systemClock{},
+	}
+}
+
+// SetClock stamps the modification times by c, the Roll sets its own Clock if the MemFS is passed to WithFS directly.
+func (m *MemFS) SetClock(c Clock) {
+	m.setClock(c)
+}
+
+func (m *MemFS) setClock(c Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
+func (m *MemFS) now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock.Now()
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = path.Clean(name)
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		d = &memData{mode: perm.Perm(), modTime: now}
+		m.files[name] = d
+	case flag&os.O_TRUNC != 0:
+		d.mu.Lock()
+		d.data = nil
+		d.modTime = now
+		d.mu.Unlock()
+	}
+
+	return &memFile{fs: m, d: d, name: name, flag: flag}, nil
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	oldpath, newpath = path.Clean(oldpath), path.Clean(newpath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = d
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	name = path.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	name = path.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []os.DirEntry
+	dirs := map[string]bool{}
+	for p, d := range m.files {
+		if path.Dir(p) == name {
+			entries = append(entries, d.info(path.Base(p)))
+			continue
+		}
+		// the directories exist as long as the files in them
+		if rel := strings.TrimPrefix(p, name+"/"); rel != p {
+			dir := rel[:strings.Index(rel, "/")]
+			if !dirs[dir] {
+				dirs[dir] = true
+				entries = append(entries, &memInfo{name: dir, mode: os.ModeDir | 0755})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = path.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return d.info(path.Base(name)), nil
+}
+
+func (m *MemFS) Chtimes(name string, _ time.Time, mtime time.Time) error {
+	name = path.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.files[name]
+	if !ok {
+		return &os.PathError{Op: "chtimes", Path: name, Err: os.ErrNotExist}
+	}
+	d.mu.Lock()
+	d.modTime = mtime
+	d.mu.Unlock()
+	return nil
+}
+
+// ReadFile returns a copy of the content of the file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	name = path.Clean(name)
+
+	m.mu.Lock()
+	d, ok := m.files[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]byte(nil), d.data...), nil
+}
+
+func (d *memData) info(name string) *memInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &memInfo{name: name, size: int64(len(d.data)), mode: d.mode, modTime: d.modTime}
+}
+
+type memFile struct {
+	fs   *MemFS
+	d    *memData
+	name string
+	flag int
+
+	mu     sync.Mutex
+	off    int64
+	closed bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrClosed}
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == os.O_WRONLY {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if f.off >= int64(len(f.d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	now := f.fs.now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrClosed}
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.d.data))
+	}
+	if gap := f.off - int64(len(f.d.data)); gap > 0 {
+		f.d.data = append(f.d.data, make([]byte, gap)...)
+	}
+	n := copy(f.d.data[f.off:], p)
+	f.d.data = append(f.d.data, p[n:]...)
+	f.off += int64(len(p))
+	f.d.modTime = now
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.d.info(path.Base(f.name)), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+var (
+	_ os.FileInfo = (*memInfo)(nil)
+	_ os.DirEntry = (*memInfo)(nil)
+)
+
+// memInfo is both the os.FileInfo and the os.DirEntry of a MemFS file.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string               { return i.name }
+func (i *memInfo) Size() int64                { return i.size }
+func (i *memInfo) Mode() os.FileMode          { return i.mode }
+func (i *memInfo) ModTime() time.Time         { return i.modTime }
+func (i *memInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *memInfo) Sys() interface{}           { return nil }
+func (i *memInfo) Type() os.FileMode          { return i.mode.Type() }
+func (i *memInfo) Info() (os.FileInfo, error) { return i, nil }
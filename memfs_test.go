@@ -0,0 +1,112 @@
+package rollingf
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemFS(t *testing.T) {
+	mfs := NewMemFS()
+	r := NewC("/mem/app.log", WithFS(mfs)).
+		WithDefaultMatcher().
+		WithDefaultProcessor().
+		WithFilter(MaxBackupsFilter(2))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 16)
+	r.OnRotate(func(ev RotateEvent) {
+		events <- ev
+	})
+
+	for i := 0; i < 4; i++ {
+		if _, err := r.Write([]byte{'a' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := rollSync(t, r, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := mfs.ReadDir("/mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"app.log", "app.log.1", "app.log.2"}
+	if len(names) != len(want) {
+		t.Fatalf("files %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("files %v, want %v", names, want)
+		}
+	}
+
+	for name, content := range map[string]string{"app.log.1": "d", "app.log.2": "c"} {
+		b, err := mfs.ReadFile("/mem/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, []byte(content)) {
+			t.Errorf("%s: %q, want %q", name, b, content)
+		}
+	}
+
+	if _, err := os.Stat("/mem"); !os.IsNotExist(err) {
+		t.Errorf("touched the disk: %v", err)
+	}
+}
+
+func TestMemFSOpenFile(t *testing.T) {
+	mfs := NewMemFS()
+	c := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mfs.setClock(c)
+
+	if _, err := mfs.OpenFile("/a", os.O_RDONLY, 0); !os.IsNotExist(err) {
+		t.Fatalf("open missing: %v", err)
+	}
+	f, err := mfs.OpenFile("/a", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello"))
+	if _, err := mfs.OpenFile("/a", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !os.IsExist(err) {
+		t.Fatalf("exclusive open: %v", err)
+	}
+
+	// the opened file follows the rename like an inode
+	if err := mfs.Rename("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	c.Add(time.Minute)
+	f.Write([]byte(" world"))
+	f.Close()
+
+	info, err := mfs.Stat("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 11 || !info.ModTime().Equal(c.Now()) {
+		t.Errorf("size %d modtime %v", info.Size(), info.ModTime())
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("write after close")
+	}
+
+	f, err = mfs.OpenFile("/b", os.O_TRUNC|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if info, _ := mfs.Stat("/b"); info.Size() != 0 {
+		t.Errorf("truncated size %d", info.Size())
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mmapHeaderLen is the length of the header of the scratch file, which holds the length of the buffered data.
+const mmapHeaderLen = 8
+
+const defaultMmapName = ".{base}.buf"
+
+// mmapBuffer buffers the writes in a memory-mapped scratch file, which survives the process crashes.
+type mmapBuffer struct {
+	path string
+	size int
+	f    *os.File
+
+	mu   sync.Mutex
+	data []byte
+	n    int
+	done chan struct{}
+}
+
+// MmapBuffer buffers the writes in a memory-mapped scratch file of size bytes next to the file, it is EXPERIMENTAL.
+//
+// The buffer is appended to the file when it is full, before the rolling, on Close and every flushEvery if positive.
+// A buffer left by a crashed process is appended to the file on start before the new writes, it survives the
+// process crashes but not the power loss. The recovered records may be duplicated if the crash hits a flush.
+//
+// The writes are not buffered on the platforms without mmap(2), eg. windows.
+func MmapBuffer(size int, flushEvery time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		dir, base := path.Split(r.filePath)
+		r.mbuf = &mmapBuffer{
+			path: path.Join(dir, strings.ReplaceAll(defaultMmapName, "{base}", base)),
+			size: size,
+		}
+		r.mbufEvery = flushEvery
+	})
+}
+
+// open maps the scratch file, it returns the data left by the last process.
+func (b *mmapBuffer) open() ([]byte, error) {
+	if b.size <= 0 {
+		b.size = 1 << 20
+	}
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Truncate(int64(mmapHeaderLen + b.size)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	data, err := mmap(f, mmapHeaderLen+b.size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	b.f, b.data = f, data
+
+	n := int(binary.LittleEndian.Uint64(data[:mmapHeaderLen]))
+	if n > b.size {
+		// torn or foreign header, nothing can be trusted
+		n = 0
+	}
+	b.n = n
+	return append([]byte(nil), data[mmapHeaderLen:mmapHeaderLen+n]...), nil
+}
+
+// write buffers p, the buffer is flushed by flush first if p does not fit.
+func (b *mmapBuffer) write(p []byte, flush func([]byte) (int, error)) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.data == nil {
+		return flush(p)
+	}
+	if b.n+len(p) > b.size {
+		if err := b.flushLocked(flush); err != nil {
+			return 0, err
+		}
+		if len(p) > b.size {
+			return flush(p)
+		}
+	}
+	copy(b.data[mmapHeaderLen+b.n:], p)
+	b.n += len(p)
+	// the header is updated after the data, a crash in between only loses p
+	binary.LittleEndian.PutUint64(b.data[:mmapHeaderLen], uint64(b.n))
+	return len(p), nil
+}
+
+func (b *mmapBuffer) flush(flush func([]byte) (int, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked(flush)
+}
+
+func (b *mmapBuffer) flushLocked(flush func([]byte) (int, error)) error {
+	if b.n == 0 {
+		return nil
+	}
+	if _, err := flush(b.data[mmapHeaderLen : mmapHeaderLen+b.n]); err != nil {
+		return err
+	}
+	b.reset()
+	return nil
+}
+
+// buffered returns the bytes in the buffer.
+func (b *mmapBuffer) buffered() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(b.n)
+}
+
+func (b *mmapBuffer) reset() {
+	b.n = 0
+	binary.LittleEndian.PutUint64(b.data[:mmapHeaderLen], 0)
+}
+
+// close unmaps the scratch file, the buffer must be flushed already.
+func (b *mmapBuffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.done != nil {
+		close(b.done)
+		b.done = nil
+	}
+	empty := b.n == 0
+	err := munmap(b.data)
+	b.data, b.n = nil, 0
+	if cerr := b.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && empty {
+		err = os.Remove(b.path)
+	}
+	return err
+}
+
+// startBuffer maps the scratch file and recovers the data left by the last process,
+// the writes are not buffered if it fails.
+func (r *Roll) startBuffer() error {
+	if r.mbuf == nil {
+		return nil
+	}
+
+	left, err := r.mbuf.open()
+	if err != nil {
+		r.warn("[startBuffer] %v, the writes are not buffered", err)
+		r.mbuf = nil
+		return nil
+	}
+	if len(left) > 0 {
+		r.debug("[startBuffer] recover %d bytes", len(left))
+		n, err := r.writeF(left)
+		if err != nil {
+			return err
+		}
+		r.st.update(int64(n))
+		r.mbuf.reset()
+	}
+
+	if r.mbufEvery > 0 {
+		done := make(chan struct{})
+		r.mbuf.done = done
+		go r.flushEvery(r.mbufEvery, done)
+	}
+	return nil
+}
+
+func (r *Roll) flushEvery(every time.Duration, done chan struct{}) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.fWLock()
+			if r.f != nil {
+				if err := r.mbuf.flush(r.writeF); err != nil {
+					r.warn("[flushEvery] err: %v", err)
+				}
+			}
+			r.fWUnlock()
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeFile writes p to the file through the buffer if any.
+func (r *Roll) writeFile(p []byte) (int, error) {
+	if r.mbuf == nil {
+		return r.writeF(p)
+	}
+	return r.mbuf.write(p, r.writeF)
+}
+
+// writeF writes p to the file, a short write without an error fails by io.ErrShortWrite.
+func (r *Roll) writeF(p []byte) (int, error) {
+	n, err := r.f.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// flushBuffer appends the buffer to the file, the write lock must be held.
+func (r *Roll) flushBuffer() error {
+	if r.mbuf == nil {
+		return nil
+	}
+	return r.mbuf.flush(r.writeF)
+}
@@ -0,0 +1,65 @@
+package rollingf
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMmapBufferRecover(t *testing.T) {
+	fp := t.TempDir() + "/app.log"
+	crashed := NewC(fp, MmapBuffer(64, 0))
+	if crashed == nil || crashed.mbuf == nil {
+		t.Fatal("nil roll or buffer")
+	}
+	crashed.Write([]byte("hello\n"))
+	if b, _ := os.ReadFile(fp); len(b) != 0 {
+		t.Fatalf("not buffered: %q", b)
+	}
+	// the process dies without Close
+	munmap(crashed.mbuf.data)
+	crashed.mbuf.f.Close()
+	crashed.f.Close()
+
+	r := NewC(fp, MmapBuffer(64, 0))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	if b, _ := os.ReadFile(fp); string(b) != "hello\n" {
+		t.Fatalf("recovered %q", b)
+	}
+
+	// the buffer is flushed when full and on Close
+	for i := 0; i < 20; i++ {
+		r.Write([]byte("world\n"))
+	}
+	if b, _ := os.ReadFile(fp); len(b) <= len("hello\n") {
+		t.Fatalf("not flushed when full: %q", b)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(fp); len(b) != 6*21 {
+		t.Fatalf("lost the writes: %d bytes", len(b))
+	}
+	if _, err := os.Stat(r.mbuf.path); !os.IsNotExist(err) {
+		t.Fatal("the scratch file is left", err)
+	}
+}
+
+func TestMmapBufferRoll(t *testing.T) {
+	r, _, events := faultRoll(t)
+	r.WithOptions(MmapBuffer(1024, 0))
+	if err := r.startBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	written := writeN(t, r, 10)
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(r.filePath + ".1")
+	if err != nil || int64(len(b)) != written {
+		t.Fatal(len(b), written, err)
+	}
+}
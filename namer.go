@@ -0,0 +1,205 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namer names the backup files, it decouples the naming scheme from the processors.
+type Namer interface {
+	// Name returns the name of the index-th(starts from 1) backup of base, which was rolled at t.
+	Name(base string, index int, t time.Time) string
+}
+
+// NamerFunc adapts an ordinary function to a Namer.
+type NamerFunc func(base string, index int, t time.Time) string
+
+func (f NamerFunc) Name(base string, index int, t time.Time) string {
+	return f(base, index, t)
+}
+
+// patterner is implemented by the namers which know how to match the names they produced.
+type patterner interface {
+	// pattern returns the regular expression of the backup names without the anchors.
+	pattern(base string) string
+}
+
+// timeParser is implemented by the namers which embed the rolling time in the names.
+type timeParser interface {
+	// parseTime returns the rolling time embedded in the backup name of base, the compression suffix is ignored.
+	parseTime(base, name string) (time.Time, bool)
+}
+
+// collider is implemented by the namers whose names may collide, eg. two rollings within the resolution of the timestamp.
+type collider interface {
+	// collide returns name, which was produced for base, with the n-th(starts from 1) collision suffix.
+	collide(base, name string, n int) string
+}
+
+var (
+	_ timeParser = (*timestampNamer)(nil)
+	_ timeParser = (*lumberjackNamer)(nil)
+	_ collider   = (*timestampNamer)(nil)
+	_ collider   = (*lumberjackNamer)(nil)
+)
+
+var (
+	_ Namer = (*numericNamer)(nil)
+	_ Namer = (*timestampNamer)(nil)
+	_ Namer = (*lumberjackNamer)(nil)
+)
+
+type numericNamer struct{}
+
+// NumericNamer names the backups with a numeric suffix.
+//
+// eg.
+// app.log.1 app.log.2 ...
+func NumericNamer() *numericNamer {
+	return &numericNamer{}
+}
+
+func (n *numericNamer) Name(base string, index int, _ time.Time) string {
+	return base + "." + strconv.Itoa(index)
+}
+
+func (n *numericNamer) pattern(base string) string {
+	return regexp.QuoteMeta(base) + `(\.\d+)?`
+}
+
+// DefaultTimestampLayout is the layout used by TimestampNamer when the layout is empty.
+const DefaultTimestampLayout = "20060102T150405"
+
+type timestampNamer struct {
+	layout string
+}
+
+// TimestampNamer names the backups with a timestamp suffix, the layout should only contain zero-padded numeric elements.
+// The backups rolled within the resolution of the layout get a collision suffix, the later one the greater.
+//
+// eg.
+// app.log.20240601T120000 app.log.20240601T120000-1 app.log.20240601T130000 ...
+func TimestampNamer(layout string) *timestampNamer {
+	if layout == "" {
+		layout = DefaultTimestampLayout
+	}
+	return &timestampNamer{
+		layout: layout,
+	}
+}
+
+func (n *timestampNamer) Name(base string, _ int, t time.Time) string {
+	return base + "." + t.Format(n.layout)
+}
+
+func (n *timestampNamer) pattern(base string) string {
+	return regexp.QuoteMeta(base) + `(\.` + layoutPattern(n.layout) + collisionPattern + `)?`
+}
+
+func (n *timestampNamer) collide(_, name string, i int) string {
+	return name + "-" + strconv.Itoa(i)
+}
+
+func (n *timestampNamer) parseTime(base, name string) (time.Time, bool) {
+	name = trimCompressSuffix(name)
+	if !strings.HasPrefix(name, base+".") {
+		return time.Time{}, false
+	}
+	return parseCollided(n.layout, name[len(base)+1:])
+}
+
+const lumberjackLayout = "2006-01-02T15-04-05.000"
+
+type lumberjackNamer struct{}
+
+// LumberjackNamer names the backups in the style of lumberjack, the timestamp is inserted before the extension.
+//
+// eg.
+// app-2024-06-01T12-00-00.000.log
+func LumberjackNamer() *lumberjackNamer {
+	return &lumberjackNamer{}
+}
+
+func (n *lumberjackNamer) Name(base string, _ int, t time.Time) string {
+	ext := path.Ext(base)
+	return base[:len(base)-len(ext)] + "-" + t.Format(lumberjackLayout) + ext
+}
+
+func (n *lumberjackNamer) pattern(base string) string {
+	ext := path.Ext(base)
+	return regexp.QuoteMeta(base[:len(base)-len(ext)]) + `(-` + layoutPattern(lumberjackLayout) + collisionPattern + `)?` +
+		regexp.QuoteMeta(ext)
+}
+
+func (n *lumberjackNamer) collide(base, name string, i int) string {
+	ext := path.Ext(base)
+	return name[:len(name)-len(ext)] + "-" + strconv.Itoa(i) + ext
+}
+
+func (n *lumberjackNamer) parseTime(base, name string) (time.Time, bool) {
+	name = trimCompressSuffix(name)
+	ext := path.Ext(base)
+	prefix := base[:len(base)-len(ext)] + "-"
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) || len(name) < len(prefix)+len(ext) {
+		return time.Time{}, false
+	}
+	return parseCollided(lumberjackLayout, name[len(prefix):len(name)-len(ext)])
+}
+
+// collisionPattern matches the collision suffix of the names.
+const collisionPattern = `(-[1-9]\d*)?`
+
+// parseCollided parses the timestamp followed by an optional collision suffix. The n-th collision is n nanoseconds
+// later, so the backups rolled within the resolution of the layout keep their order.
+func parseCollided(layout, value string) (time.Time, bool) {
+	ts := len(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout))
+	if len(value) <= ts+1 || value[ts] != '-' {
+		return parseLayout(layout, value)
+	}
+	n, ok := parseIndex(value[ts+1:])
+	if !ok {
+		return time.Time{}, false
+	}
+	t, ok := parseLayout(layout, value[:ts])
+	return t.Add(time.Duration(n)), ok
+}
+
+// parseLayout parses the timestamp in the local time, which the backups are named in.
+func parseLayout(layout, value string) (time.Time, bool) {
+	t, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// layoutPattern converts a numeric time layout to a regular expression.
+func layoutPattern(layout string) string {
+	ref := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout)
+	var b strings.Builder
+	for _, c := range ref {
+		if c >= '0' && c <= '9' {
+			b.WriteString(`\d`)
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(string(c)))
+	}
+	return b.String()
+}
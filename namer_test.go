@@ -0,0 +1,88 @@
+package rollingf
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNamer(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		namer Namer
+		want  string
+	}{
+		{NumericNamer(), "app.log.3"},
+		{TimestampNamer(""), "app.log.20240601T120000"},
+		{LumberjackNamer(), "app-2024-06-01T12-00-00.000.log"},
+	}
+
+	for _, c := range cases {
+		name := c.namer.Name("app.log", 3, ts)
+		if name != c.want {
+			t.Fatalf("%T: %s != %s", c.namer, name, c.want)
+		}
+
+		m := NamerMatcher(c.namer)
+		m.Init("app.log")
+		for _, other := range []string{"app.log", name, name + ".gz"} {
+			if !m.Match(other) {
+				t.Fatalf("%T: %s not matched", c.namer, other)
+			}
+		}
+		if m.Match("_app.log") || m.Match(name+".tmp") {
+			t.Fatalf("%T: unexpected match", c.namer)
+		}
+	}
+}
+
+func TestNamerCollision(t *testing.T) {
+	for _, n := range []Namer{TimestampNamer(""), LumberjackNamer()} {
+		clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)}
+		mfs := NewMemFS()
+		mfs.setClock(clock)
+		r := NewC("/mem/app.log", WithFS(mfs), OptionFunc(func(r *Roll) {
+			r.WithDefaultProcessor()
+		}), Naming(n))
+		if r == nil {
+			t.Fatal("nil roll")
+		}
+
+		events := make(chan RotateEvent, 1)
+		r.OnRotate(func(ev RotateEvent) { events <- ev })
+		// the rollings within one second
+		for i := 0; i < 3; i++ {
+			r.Write([]byte{'a' + byte(i)})
+			if err := rollSync(t, r, events); err != nil {
+				t.Fatalf("%T: %v", n, err)
+			}
+			clock.Add(100 * time.Microsecond)
+		}
+		r.Close()
+
+		first := n.Name("app.log", 1, clock.now)
+		c := n.(collider)
+		want := []string{"app.log", c.collide("app.log", first, 2), c.collide("app.log", first, 1), first}
+		all, _ := mfs.ReadDir("/mem")
+		m := NamerMatcher(n)
+		m.Init("app.log")
+		var entries []os.DirEntry
+		for _, e := range all {
+			if m.Match(e.Name()) {
+				entries = append(entries, e)
+			}
+		}
+		s := TimestampSorter(n)
+		s.Init("app.log")
+		s.Sort(entries)
+		if len(entries) != len(want) {
+			t.Fatalf("%T: %v", n, all)
+		}
+		for i, e := range entries {
+			b, _ := mfs.ReadFile("/mem/" + e.Name())
+			if e.Name() != want[i] || (i > 0 && string(b) != string(rune('a'+3-i))) {
+				t.Fatalf("%T: %s(%s) != %s", n, e.Name(), b, want[i])
+			}
+		}
+	}
+}
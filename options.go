@@ -19,13 +19,114 @@ func Lock(enable bool) Option {
 	})
 }
 
-// Compress specifies the format of the compressed file
+// Compress specifies the format of the compressed file, the backups in the other formats are matched too,
+// see AnyFormatMatcher.
 func Compress(format CompressFormat) Option {
 	return OptionFunc(func(r *Roll) {
 		if format == NoCompress {
 			return
 		}
-		r.WithMatcher(CompressMatcher(format))
+		if r.namer == nil {
+			r.WithMatcher(AnyFormatMatcher())
+		}
 		r.WithProcessor(Compressor(format))
 	})
 }
+
+// Naming names the backups by n, the matcher is replaced by NamerMatcher(n),
+// and the sorter by TimestampSorter(n) if n embeds the time in the names.
+func Naming(n Namer) Option {
+	return OptionFunc(func(r *Roll) {
+		r.namer = n
+		r.WithMatcher(NamerMatcher(n))
+		if _, ok := n.(timeParser); ok {
+			r.WithSorter(TimestampSorter(n))
+		}
+		if r.processor != nil {
+			r.WithProcessor(r.processor)
+		}
+	})
+}
+
+// WithCompressWorkers compresses the backups by n workers in parallel, it must follow the Compress option.
+//
+// The in-flight compressions are drained before Close returns.
+func WithCompressWorkers(n int) Option {
+	return OptionFunc(func(r *Roll) {
+		if c, ok := r.processor.(*compressor); ok {
+			c.WithWorkers(n)
+		}
+	})
+}
+
+// CompressLevel compresses at level, eg. gzip.BestSpeed, it must follow the Compress option.
+func CompressLevel(level int) Option {
+	return OptionFunc(func(r *Roll) {
+		if c, ok := r.processor.(*compressor); ok {
+			c.WithLevel(level)
+		}
+	})
+}
+
+// WithCompressRateLimit limits the bytes per second read by the compression, it must follow the Compress option.
+func WithCompressRateLimit(bytesPerSec int64) Option {
+	return OptionFunc(func(r *Roll) {
+		if c, ok := r.processor.(*compressor); ok {
+			c.WithRateLimit(bytesPerSec)
+		}
+	})
+}
+
+// CompressAfter keeps the most recent n backups uncompressed for grep-ability, it must follow the Compress option.
+func CompressAfter(n int) Option {
+	return OptionFunc(func(r *Roll) {
+		c, ok := r.processor.(*compressor)
+		if !ok || c.format == NoCompress {
+			return
+		}
+		c.WithCompressAfter(n)
+		if r.namer == nil {
+			r.WithMatcher(AnyFormatMatcher())
+		}
+	})
+}
+
+// TempFile sets the temporary file which receives the writes while rolling, default is "_{base}" in the file's directory.
+//
+// An empty dir means the file's directory, "{base}" in name is replaced by the file's base name, eg. ".{base}.tmp".
+// The dir must be on the same filesystem as the file, the temporary file is renamed back after rolling.
+// The temporary file is never matched, even though the matcher accepts its name.
+func TempFile(dir, name string) Option {
+	return OptionFunc(func(r *Roll) {
+		r.setTmpFile(dir, name)
+	})
+}
+
+// RenameReopen rolls the file without the temporary file: the processor renames the file itself to the first backup,
+// after cascading the existing ones, then the file is created again right away. So the path always refers to
+// the latest file, for the tools following the path such as tail -F and the log shippers.
+//
+// The writes wait until the processor returns, so compressing the rolled file blocks them, see CompressAfter.
+// The OnRotate hooks are called meanwhile too, they must not write to the Roll. The TempFile option is ignored.
+func RenameReopen() Option {
+	return OptionFunc(func(r *Roll) {
+		r.renameReopen = true
+	})
+}
+
+// ManualCheck disables the checks after the writes, the checkers run only by CheckNow, eg. in the tests,
+// see the rollingtest package. Otherwise a write may roll in the background while CheckNow runs.
+func ManualCheck() Option {
+	return OptionFunc(func(r *Roll) {
+		r.manual = true
+	})
+}
+
+// MaxMatchedFiles aborts the rolling with an error if the matcher matches more than n files, including the file itself.
+//
+// It guards against a misconfigured matcher renaming or removing the whole directory. Default is no limit.
+func MaxMatchedFiles(n int) Option {
+	return OptionFunc(func(r *Roll) {
+		r.maxMatched = n
+	})
+}
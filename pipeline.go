@@ -0,0 +1,267 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+type pipeline struct {
+	checkers   []Checker
+	filters    []Filter
+	namer      Namer
+	format     CompressFormat
+	archiveDir string
+
+	err error
+}
+
+// Pipeline describes the whole rolling pipeline fluently, it compiles to the checkers, filters, matcher and processor.
+//
+// eg.
+//
+//	Pipeline().CheckEvery(DurOneDay).Or(MaxSizeChecker(100 * SizeMB)).Keep(7).CompressWith(Gzip).Archive("old").Build("/var/log/app.log")
+//
+// Zstd is not supported, the module has no dependency to implement it, use Gzip or Zlib.
+func Pipeline() *pipeline {
+	return &pipeline{}
+}
+
+// CheckEvery rolls the file at regular intervals.
+func (p *pipeline) CheckEvery(interval time.Duration) *pipeline {
+	if interval <= 0 {
+		return p.fail(fmt.Errorf("CheckEvery: interval must be positive, got %v", interval))
+	}
+	return p.Or(IntervalChecker(interval))
+}
+
+// MaxSize rolls the file when its size(bytes) exceeds maxSize.
+func (p *pipeline) MaxSize(maxSize int64) *pipeline {
+	if maxSize <= 0 {
+		return p.fail(fmt.Errorf("MaxSize: size must be positive, got %d", maxSize))
+	}
+	return p.Or(MaxSizeChecker(maxSize))
+}
+
+// Or rolls the file when any of the checkers is triggered.
+func (p *pipeline) Or(c ...Checker) *pipeline {
+	p.checkers = append(p.checkers, c...)
+	return p
+}
+
+// Keep retains at most n backups.
+func (p *pipeline) Keep(n int) *pipeline {
+	if n <= 0 {
+		return p.fail(fmt.Errorf("Keep: the number of backups must be positive, got %d", n))
+	}
+	return p.Filter(MaxBackupsFilter(n))
+}
+
+// KeepFor retains the backups not older than maxAge.
+func (p *pipeline) KeepFor(maxAge time.Duration) *pipeline {
+	if maxAge <= 0 {
+		return p.fail(fmt.Errorf("KeepFor: age must be positive, got %v", maxAge))
+	}
+	return p.Filter(MaxAgeFilter(maxAge))
+}
+
+// Filter appends the filters.
+func (p *pipeline) Filter(f ...Filter) *pipeline {
+	p.filters = append(p.filters, f...)
+	return p
+}
+
+// NameWith names the backups by n.
+func (p *pipeline) NameWith(n Namer) *pipeline {
+	p.namer = n
+	return p
+}
+
+// CompressWith compresses the backups in the format, Gzip or Zlib.
+func (p *pipeline) CompressWith(format CompressFormat) *pipeline {
+	if _, ok := cfSuffix[format]; !ok && format != NoCompress {
+		return p.fail(fmt.Errorf("CompressWith: unsupported format %q", format))
+	}
+	p.format = format
+	return p
+}
+
+// Archive moves the backups dropped by the filters into dir instead of removing them, dir is relative to the directory
+// of the file unless it is absolute. The archived backups are never matched, nor removed by the Roll, the ones named
+// the same as an archived one get a suffix, eg. app.log.1-1.gz.
+func (p *pipeline) Archive(dir string) *pipeline {
+	if dir == "" {
+		return p.fail(errors.New("Archive: empty directory"))
+	}
+	p.archiveDir = dir
+	return p
+}
+
+func (p *pipeline) fail(err error) *pipeline {
+	if p.err == nil {
+		p.err = err
+	}
+	return p
+}
+
+// Validate reports the first misconfiguration of the pipeline.
+func (p *pipeline) Validate() error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.checkers) == 0 {
+		return errors.New("no checker, the file will never roll")
+	}
+	if p.archiveDir != "" && len(p.filters) == 0 {
+		return errors.New("Archive without a filter, no backup will be archived")
+	}
+	for _, c := range p.checkers {
+		if c == nil {
+			return errors.New("nil checker")
+		}
+	}
+	for _, f := range p.filters {
+		if f == nil {
+			return errors.New("nil filter")
+		}
+	}
+	return nil
+}
+
+// Build validates the pipeline and creates a Roll of filePath with it.
+func (p *pipeline) Build(filePath string, opts ...Option) (*Roll, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("rollingf: invalid pipeline: %w", err)
+	}
+
+	filters := p.filters
+	if p.archiveDir != "" {
+		filters = make([]Filter, len(p.filters))
+		for i, f := range p.filters {
+			filters[i] = &archiveFilter{f: f, dir: p.archiveDir}
+		}
+	}
+	// the options follow the components, eg. CompressLevel the compressor, and apply before start
+	components := OptionFunc(func(r *Roll) {
+		r.WithChecker(p.checkers...).WithFilter(filters...)
+		if p.namer != nil {
+			Naming(p.namer).apply(r)
+		} else if p.format != NoCompress {
+			r.WithMatcher(AnyFormatMatcher())
+		} else {
+			r.WithDefaultMatcher()
+		}
+
+		if p.format != NoCompress {
+			r.WithProcessor(Compressor(p.format))
+		} else {
+			r.WithDefaultProcessor()
+		}
+	})
+
+	r, err := NewCE(filePath, append([]Option{components}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// archiveFilter moves the files filtered by the Filter into dir instead of removing them.
+type archiveFilter struct {
+	f   Filter
+	dir string
+	fs  FS
+	logs
+}
+
+var (
+	_ Filter   = (*archiveFilter)(nil)
+	_ FilterV2 = (*archiveFilter)(nil)
+	_ wrapper  = (*archiveFilter)(nil)
+)
+
+func (f *archiveFilter) Init(base string) {
+	if i, ok := f.f.(interface{ Init(base string) }); ok {
+		i.Init(base)
+	}
+}
+
+func (f *archiveFilter) Name() string {
+	return f.f.Name()
+}
+
+func (f *archiveFilter) Filter(files []os.DirEntry) ([]os.DirEntry, []os.DirEntry, error) {
+	return f.f.Filter(files)
+}
+
+func (f *archiveFilter) setFS(fsys FS) {
+	f.fs = fsys
+}
+
+func (f *archiveFilter) unwrap() any {
+	return f.f
+}
+
+func (f *archiveFilter) Reason(file os.DirEntry) string {
+	if fv, ok := f.f.(FilterV2); ok {
+		return fv.Reason(file)
+	}
+	return ""
+}
+
+func (f *archiveFilter) DealFiltered(dir string, filtered []os.DirEntry) error {
+	for _, file := range filtered {
+		if err := f.DealFile(dir, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *archiveFilter) DealFile(dir string, file os.DirEntry) error {
+	to := f.dir
+	if !path.IsAbs(to) {
+		to = path.Join(dir, to)
+	}
+	if err := mkdirAll(f.fs, to, 0755); err != nil {
+		return err
+	}
+
+	// the names are reused by the backups rolled later, the archived ones are never overwritten
+	name := path.Base(file.Name())
+	stem := trimCompressSuffix(name)
+	archived := name
+	for i := 1; ; i++ {
+		_, err := fsOrDefault(f.fs).Stat(path.Join(to, archived))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		archived = stem + "-" + strconv.Itoa(i) + name[len(stem):]
+	}
+	f.debug("[archive] %v --> %v", file.Name(), path.Join(to, archived))
+	return fsOrDefault(f.fs).Rename(path.Join(dir, file.Name()), path.Join(to, archived))
+}
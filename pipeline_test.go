@@ -0,0 +1,141 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	for name, c := range map[string]struct {
+		p    *pipeline
+		want string
+	}{
+		"NoChecker":      {Pipeline().Keep(3), "no checker"},
+		"NilChecker":     {Pipeline().Or(nil), "nil checker"},
+		"NilFilter":      {Pipeline().MaxSize(SizeMB).Filter(nil), "nil filter"},
+		"CheckEvery":     {Pipeline().CheckEvery(0), "CheckEvery"},
+		"MaxSize":        {Pipeline().MaxSize(-1), "MaxSize"},
+		"Keep":           {Pipeline().MaxSize(SizeMB).Keep(0), "Keep"},
+		"KeepFor":        {Pipeline().MaxSize(SizeMB).KeepFor(0), "KeepFor"},
+		"CompressWith":   {Pipeline().MaxSize(SizeMB).CompressWith("zstd"), "unsupported format"},
+		"Archive":        {Pipeline().MaxSize(SizeMB).Keep(3).Archive(""), "empty directory"},
+		"ArchiveNothing": {Pipeline().MaxSize(SizeMB).Archive("old"), "Archive without a filter"},
+		// the first error is reported
+		"FirstError": {Pipeline().MaxSize(0).Keep(0), "MaxSize"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := c.p.Validate()
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatal(err)
+			}
+			if _, err := c.p.Build(t.TempDir() + "/app.log"); err == nil {
+				t.Fatal("built an invalid pipeline")
+			}
+		})
+	}
+
+	if err := Pipeline().CheckEvery(time.Hour).Or(MaxSizeChecker(SizeMB)).Keep(3).KeepFor(time.Hour).
+		CompressWith(Zlib).Archive("old").Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelineBuild(t *testing.T) {
+	r, err := Pipeline().CheckEvery(time.Hour).Or(MaxSizeChecker(SizeMB)).Keep(3).KeepFor(time.Hour).
+		CompressWith(Gzip).Build(t.TempDir() + "/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if len(r.checkers) != 2 || len(r.filters) != 2 {
+		t.Fatal(len(r.checkers), "checkers", len(r.filters), "filters")
+	}
+	if _, ok := r.filters[0].(*maxBackupsFilter); !ok {
+		t.Fatalf("%T", r.filters[0])
+	}
+	if _, ok := r.filters[1].(*maxAgeFilter); !ok {
+		t.Fatalf("%T", r.filters[1])
+	}
+	if c, ok := r.processor.(*compressor); !ok || c.format != Gzip {
+		t.Fatalf("%T", r.processor)
+	}
+	for _, name := range []string{"app.log.1", "app.log.1.gz", "app.log.2.z"} {
+		if !r.matcher.Match(name) {
+			t.Fatal(name, "not matched")
+		}
+	}
+
+	r, err = Pipeline().MaxSize(SizeMB).NameWith(TimestampNamer("")).Build(t.TempDir() + "/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, ok := r.processor.(*defaultProcessor); !ok || r.namer == nil {
+		t.Fatalf("%T", r.processor)
+	}
+	if _, ok := r.sorter.(*timestampSorter); !ok {
+		t.Fatalf("%T", r.sorter)
+	}
+}
+
+func TestPipelineBuildOptions(t *testing.T) {
+	mfs := NewMemFS()
+	// the options taking effect on start
+	r, err := Pipeline().MaxSize(4).Keep(3).Build("/mem/app.log", WithFS(mfs), WithWriteTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	if _, err := r.Write([]byte("large")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := mfs.ReadFile("/mem/app.log.1"); err != nil || string(b) != "large" {
+		t.Fatalf("%q %v", b, err)
+	}
+	if _, err := os.Stat("/mem/app.log"); !os.IsNotExist(err) {
+		t.Fatal("opened on the disk", err)
+	}
+}
+
+func TestPipelineArchive(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Pipeline().MaxSize(SizeMB).Keep(1).Archive("old").Build(dir + "/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	for i := 0; i < 3; i++ {
+		r.Write([]byte{'a' + byte(i)})
+		if err := rollSync(t, r, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"app.log.1": "c",
+		// moved by the MaxBackupsFilter
+		"old/app.log.1":   "a",
+		"old/app.log.1-1": "b",
+	} {
+		b, err := os.ReadFile(path.Join(dir, name))
+		if err != nil || string(b) != want {
+			t.Fatal(name, string(b), err)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "app.log.2")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Plugin processes a rotated file out of the process, eg. a command archiving it or a sidecar uploading it,
+// so the bespoke steps are not linked into every binary. See Roll.WithPlugin.
+type Plugin interface {
+	Run(ctx context.Context, file string) error
+}
+
+// PluginFunc adapts a function to Plugin.
+type PluginFunc func(ctx context.Context, file string) error
+
+func (f PluginFunc) Run(ctx context.Context, file string) error {
+	return f(ctx, file)
+}
+
+// pluginOutputMax is the most of the output of a failed ExecPlugin kept in the error.
+const pluginOutputMax = 4096
+
+// ExecPlugin runs the command name with args and the path of the rotated file appended,
+// the command fails by a non-zero exit status, the end of its output is reported in the error.
+func ExecPlugin(name string, args ...string) Plugin {
+	return PluginFunc(func(ctx context.Context, file string) error {
+		cmd := exec.CommandContext(ctx, name, append(append([]string(nil), args...), file)...)
+		return runPluginCmd(cmd)
+	})
+}
+
+// runPluginCmd runs cmd, the error carries the tail of the combined output.
+func runPluginCmd(cmd *exec.Cmd) error {
+	setWaitDelay(cmd)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if len(out) > pluginOutputMax {
+		out = out[len(out)-pluginOutputMax:]
+	}
+	if s := strings.TrimSpace(string(out)); s != "" {
+		return fmt.Errorf("%s: %w: %s", cmd.Path, err, s)
+	}
+	return fmt.Errorf("%s: %w", cmd.Path, err)
+}
+
+// HTTPPlugin posts the RotatedFile of the file as JSON to url, eg. a sidecar on localhost,
+// any status other than 2xx is a failure. client is http.DefaultClient if nil.
+func HTTPPlugin(url string, client *http.Client) Plugin {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return PluginFunc(func(ctx context.Context, file string) error {
+		payload, err := json.Marshal(RotatedFile{Path: file})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, pluginOutputMax))
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%s: %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil
+	})
+}
+
+// WithPlugin runs p on the newest backup after every successful rotation, in the rotating goroutine.
+// Each attempt is cancelled after timeout unless it is <= 0, the failed ones are retried by b.
+// The failure after the retries is emitted as an ErrorEvent. The attempts are stopped by Close.
+func (r *Roll) WithPlugin(p Plugin, timeout time.Duration, b Backoff) *Roll {
+	return r.OnRotateContext(func(ctx context.Context, ev RotateEvent) {
+		if ev.Err != nil {
+			return
+		}
+		if err := r.runPlugin(ctx, p, timeout, b); err != nil {
+			r.warn("[plugin] [cycle #%d] err: %v", ev.Cycle, err)
+			r.emit(ErrorEvent{Cycle: ev.Cycle, Err: err})
+		}
+	})
+}
+
+func (r *Roll) runPlugin(ctx context.Context, p Plugin, timeout time.Duration, b Backoff) error {
+	backups, err := r.Backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		// removed by the filters
+		return nil
+	}
+	newest := backups[0].Path
+
+	err = b.do(ctx, func() error {
+		actx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			actx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return p.Run(actx, newest)
+	})
+	if err != nil {
+		return fmt.Errorf("rollingf: plugin on %s: %w", newest, err)
+	}
+	return nil
+}
+
+// PostRotateCommand is the shell command run by Roll.WithPostRotateCommand, the same as postrotate of logrotate.
+type PostRotateCommand struct {
+	// Command is run by "sh -c", "{file}" is replaced by the path of the backup quoted for the shell,
+	// eg. "aws s3 cp {file} s3://bucket/logs/".
+	Command string
+	// Timeout kills the command after it, unless it is <= 0.
+	Timeout time.Duration
+	// Env is the environment of the command, "KEY=value" each. The environment of the process is not inherited
+	// unless InheritEnv, the variables in Env take precedence then.
+	Env        []string
+	InheritEnv bool
+	// Backoff retries the failed command, it runs once if Attempts is 1.
+	Backoff Backoff
+}
+
+// WithPostRotateCommand runs c after every successful rotation, a failure is emitted as an ErrorEvent
+// with the end of the output of the command, see WithPlugin.
+func (r *Roll) WithPostRotateCommand(c PostRotateCommand) *Roll {
+	return r.WithPlugin(c, c.Timeout, c.Backoff)
+}
+
+// Run runs the command on file.
+func (c PostRotateCommand) Run(ctx context.Context, file string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", strings.ReplaceAll(c.Command, "{file}", shellQuote(file)))
+	cmd.Env = c.Env
+	if c.InheritEnv {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	if cmd.Env == nil {
+		// nil inherits the environment
+		cmd.Env = []string{}
+	}
+	return runPluginCmd(cmd)
+}
+
+// shellQuote quotes s in the single quotes for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,133 @@
+package rollingf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithPlugin(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r := NewC(fp).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := r.Events()
+
+	calls := 0
+	ran := make(chan string, 1)
+	r.WithPlugin(PluginFunc(func(ctx context.Context, file string) error {
+		if calls++; calls < 2 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		ran <- file
+		return nil
+	}), 10*time.Millisecond, Backoff{Initial: time.Millisecond})
+	r.WithPlugin(PluginFunc(func(context.Context, string) error {
+		return errors.New("sidecar down")
+	}), 0, Backoff{Initial: time.Millisecond, Attempts: 2})
+
+	r.Write([]byte("hello\n"))
+	if err := r.MarkRotate(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case file := <-ran:
+		if file != fp+".1" {
+			t.Error(file)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not run")
+	}
+	for ev := range events {
+		if e, ok := ev.(ErrorEvent); ok {
+			if !strings.Contains(e.Err.Error(), "sidecar down") {
+				t.Error(e.Err)
+			}
+			break
+		}
+	}
+}
+
+func TestExecPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	file := path.Join(dir, "app.log.1")
+	err := ExecPlugin("sh", "-c", `cp "$1" "$1.copy"`, "sh").Run(context.Background(), file)
+	if err == nil || !strings.Contains(err.Error(), "No such file") {
+		t.Fatal(err)
+	}
+	os.WriteFile(file, []byte("a"), 0644)
+	if err = ExecPlugin("sh", "-c", `cp "$1" "$1.copy"`, "sh").Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(file + ".copy"); string(b) != "a" {
+		t.Errorf("%q", b)
+	}
+}
+
+func TestHTTPPlugin(t *testing.T) {
+	var got RotatedFile
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&got)
+		if got.Path == "/bad" {
+			http.Error(w, "no space", http.StatusInsufficientStorage)
+		}
+	}))
+	defer srv.Close()
+
+	p := HTTPPlugin(srv.URL, nil)
+	if err := p.Run(context.Background(), "/var/log/app.log.1"); err != nil || got.Path != "/var/log/app.log.1" {
+		t.Fatal(err, got)
+	}
+	if err := p.Run(context.Background(), "/bad"); err == nil || !strings.Contains(err.Error(), "no space") {
+		t.Fatal(err)
+	}
+}
+
+func TestPostRotateCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	file := path.Join(dir, "it's.log.1")
+	os.WriteFile(file, []byte("a"), 0644)
+
+	c := PostRotateCommand{Command: `echo "$DEST" > {file}.dest; test -z "$HOME"`, Env: []string{"DEST=s3"}}
+	if err := c.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(file + ".dest"); string(b) != "s3\n" {
+		t.Errorf("%q", b)
+	}
+
+	if os.Getenv("HOME") != "" {
+		c.InheritEnv = true
+		if err := c.Run(context.Background(), file); err == nil {
+			t.Error("the environment not inherited")
+		}
+	}
+
+	c = PostRotateCommand{Command: "echo failed >&2; exit 3"}
+	if err := c.Run(context.Background(), file); err == nil || !strings.Contains(err.Error(), "exit status 3: failed") {
+		t.Error(err)
+	}
+	c = PostRotateCommand{Command: "sleep 10"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx, file); err == nil {
+		t.Error("not killed")
+	}
+}
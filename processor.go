@@ -15,13 +15,15 @@
 package rollingf
 
 import (
-	"compress/gzip"
-	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Processor processes the remaining files after filtering
@@ -30,25 +32,86 @@ type Processor interface {
 	Process(dir string, remains []os.DirEntry) error
 }
 
+// ContextProcessor is a Processor which can be cancelled, eg. a long compression or upload.
+// The Roll calls ProcessContext instead of Process, the ctx is done by Close or the deadline of Shutdown.
+//
+// The other processors are not cancelled, Close waits for them. The rolling cancelled is finished by the next start.
+type ContextProcessor interface {
+	Processor
+	ProcessContext(ctx context.Context, dir string, remains []os.DirEntry) error
+}
+
+// processContext runs p by ctx if p is a ContextProcessor.
+func processContext(ctx context.Context, p Processor, dir string, remains []os.DirEntry) error {
+	if cp, ok := p.(ContextProcessor); ok {
+		return cp.ProcessContext(ctx, dir, remains)
+	}
+	return p.Process(dir, remains)
+}
+
 var (
 	_ Processor = (*defaultProcessor)(nil)
 	_ Processor = (*compressor)(nil)
+	_ Processor = (*chainProcessor)(nil)
+	_ Processor = (*nopProcessor)(nil)
 
-	_defaultProcessor = &defaultProcessor{}
+	_ ContextProcessor = (*compressor)(nil)
+	_ ContextProcessor = (*chainProcessor)(nil)
 )
 
+// backupNamer is implemented by the processors which know the names of the backups they produce,
+// Roll.Validate checks them against the matcher.
+type backupNamer interface {
+	// backupNames returns the sample names of the backups of base.
+	backupNames(base string) []string
+}
+
+var (
+	_ backupNamer = (*defaultProcessor)(nil)
+	_ backupNamer = (*compressor)(nil)
+	_ backupNamer = (*nopProcessor)(nil)
+	_ backupNamer = (*chainProcessor)(nil)
+
+	_ emitterSetter = (*compressor)(nil)
+	_ emitterSetter = (*chainProcessor)(nil)
+	_ tracerSetter  = (*compressor)(nil)
+	_ tracerSetter  = (*chainProcessor)(nil)
+	_ recoverer     = (*defaultProcessor)(nil)
+	_ recoverer     = (*chainProcessor)(nil)
+)
+
+// namerSetter is implemented by the processors which name the backups by a Namer.
+type namerSetter interface {
+	// Init the processor with the file's base name
+	Init(base string)
+
+	setNamer(n Namer)
+}
+
 type baseProcessor struct {
-	each func(dir, base string) error
+	each func(ctx context.Context, dir string, idx int, e os.DirEntry) error
+
+	base  string
+	namer Namer
+	fs    FS
+	taken map[string]bool // the names taken in the pass, without the compression suffixes
+	logs
 }
 
-func (p *baseProcessor) Process(dir string, remains []os.DirEntry) error {
+func (p *baseProcessor) process(ctx context.Context, dir string, remains []os.DirEntry) error {
+	// the archives of DailyArchiver are never renamed
+	remains = withoutArchives(p.base, remains)
 	if len(remains) == 0 {
 		return nil
 	}
+	p.taken = takenNames(remains)
 
 	// process the files in reverse order
 	for i := len(remains) - 1; i >= 0; i-- {
-		if err := p.each(dir, remains[i].Name()); err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.each(ctx, dir, i, remains[i]); err != nil {
 			return err
 		}
 	}
@@ -56,6 +119,53 @@ func (p *baseProcessor) Process(dir string, remains []os.DirEntry) error {
 	return nil
 }
 
+// nameByNamer names the idx-th remaining file by the namer, the file's modification time is regarded as the time it rolled.
+func (p *baseProcessor) nameByNamer(idx int, e os.DirEntry) (string, error) {
+	info, err := e.Info()
+	if err != nil {
+		return "", err
+	}
+	// the backups in the date directories of ShardByDate stay there
+	name := path.Join(path.Dir(e.Name()), p.namer.Name(p.base, idx+1, info.ModTime()))
+	if p.taken == nil {
+		return name, nil
+	}
+	name = uniqueName(p.namer, p.base, e.Name(), name, p.taken)
+	p.taken[name] = true
+	return name, nil
+}
+
+// takenNames returns the names of the files without the compression suffixes.
+func takenNames(files []os.DirEntry) map[string]bool {
+	taken := make(map[string]bool, len(files))
+	for _, e := range files {
+		taken[trimCompressSuffix(e.Name())] = true
+	}
+	return taken
+}
+
+// uniqueName returns name produced by n for the file self, with a collision suffix if another file takes it.
+func uniqueName(n Namer, base, self, name string, taken map[string]bool) string {
+	c, ok := n.(collider)
+	if !ok {
+		return name
+	}
+	self = trimCompressSuffix(self)
+	unique := name
+	for i := 1; taken[unique] && unique != self; i++ {
+		unique = c.collide(base, name, i)
+	}
+	return unique
+}
+
+// sampleName returns the name of the first backup of base.
+func (p *baseProcessor) sampleName(base string) string {
+	if p.namer != nil {
+		return p.namer.Name(base, 1, time.Now())
+	}
+	return base + ".1"
+}
+
 type defaultProcessor struct {
 	b *baseProcessor
 }
@@ -64,49 +174,260 @@ type defaultProcessor struct {
 func DefaultProcessor() *defaultProcessor {
 	p := &defaultProcessor{}
 
-	p.b = &baseProcessor{
-		p.each,
-	}
+	p.b = &baseProcessor{}
 	return p
 }
 
-func (p *defaultProcessor) Process(dir string, remains []os.DirEntry) error {
-	return p.b.Process(dir, remains)
+// WithNamer names the backups by n instead of increasing the tail number.
+func (p *defaultProcessor) WithNamer(n Namer) *defaultProcessor {
+	p.setNamer(n)
+	return p
+}
+
+func (p *defaultProcessor) Init(base string) {
+	p.b.base = base
 }
 
-func (p *defaultProcessor) each(dir, base string) error {
-	newName := p.incrTailNumber(base)
+func (p *defaultProcessor) setNamer(n Namer) {
+	p.b.namer = n
+}
+
+func (p *defaultProcessor) setFS(fsys FS) {
+	p.b.fs = fsys
+}
+
+func (p *defaultProcessor) setLogger(l Logger) {
+	p.b.setLogger(l)
+}
 
-	debug("[Rename] %v --> %v", base, newName)
-	if err := renameFile(dir, base, newName); err != nil {
+// Process renames the files in reverse order, through a journal replayed if the renaming is interrupted.
+func (p *defaultProcessor) Process(dir string, remains []os.DirEntry) error {
+	if err := p.recover(dir); err != nil {
 		return err
 	}
-	return nil
+
+	remains = withoutArchives(p.b.base, remains)
+	p.b.taken = takenNames(remains)
+	var steps []renameStep
+	for i := len(remains) - 1; i >= 0; i-- {
+		newName, err := p.newName(i, remains[i])
+		if err != nil {
+			return err
+		}
+		if newName != remains[i].Name() {
+			steps = append(steps, renameStep{From: remains[i].Name(), To: newName})
+		}
+	}
+	return renumber(p.b.fs, &p.b.logs, dir, p.b.base, steps)
+}
+
+func (p *defaultProcessor) recover(dir string) error {
+	return replayJournal(p.b.fs, &p.b.logs, dir, p.b.base)
 }
 
-// incrTailNumber increase the tail number of the file name.
+// newName returns the name of the idx-th remaining file after renaming.
+func (p *defaultProcessor) newName(idx int, e os.DirEntry) (string, error) {
+	if p.b.namer != nil {
+		return p.b.nameByNamer(idx, e)
+	}
+	return p.incrTailNumber(e.Name()), nil
+}
+
+func (p *defaultProcessor) backupNames(base string) []string {
+	return []string{p.b.sampleName(base)}
+}
+
+// incrTailNumber increase the tail number of the file name, the compression suffix is kept.
 //
 // eg.
 //
 //	base: "abc.log",
 //	return: "abc.log.1"
 func (p *defaultProcessor) incrTailNumber(base string) string {
-	if len(base) == 0 {
-		return base
+	return nextBackupName(p.b.base, base, NoCompress)
+}
+
+type nopProcessor struct {
+	base  string
+	namer Namer
+	fs    FS
+	logs
+}
+
+// NopProcessor leaves the backups untouched, it only moves the rolled file out of the way by the namer,
+// TimestampNamer by default. It never reads or writes the contents of the files.
+//
+// Use it for the retention by the filters only, eg. the backups are compressed or shipped by an external tool.
+// Use the Naming option with the same namer, so the matcher and the filters see the backups.
+func NopProcessor() *nopProcessor {
+	return &nopProcessor{
+		namer: TimestampNamer(""),
+	}
+}
+
+func (p *nopProcessor) Init(base string) {
+	p.base = base
+}
+
+func (p *nopProcessor) setNamer(n Namer) {
+	p.namer = n
+}
+
+func (p *nopProcessor) setFS(fsys FS) {
+	p.fs = fsys
+}
+
+func (p *nopProcessor) backupNames(base string) []string {
+	return []string{p.namer.Name(base, 1, time.Now())}
+}
+
+func (p *nopProcessor) Process(dir string, remains []os.DirEntry) error {
+	for _, e := range remains {
+		if e.Name() != p.base {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		newName := uniqueName(p.namer, p.base, p.base, p.namer.Name(p.base, 1, info.ModTime()), takenNames(remains))
+		p.debug("[Rename] %v --> %v", p.base, newName)
+		return renameFile(p.fs, dir, p.base, newName)
+	}
+	return nil
+}
+
+type chainProcessor struct {
+	ps      []Processor
+	rematch func(dir string) ([]os.DirEntry, error)
+}
+
+// ChainProcessor executes the processors in order, eg. rename --> upload --> checksum.
+//
+// When it is set to a Roll, the processors after the first one get the files matched again,
+// so they see the names produced by the previous ones. The Compressor following a renaming processor,
+// eg. DefaultProcessor, compresses in place, the backups are not renamed twice, see compressor.WithInPlace.
+func ChainProcessor(ps ...Processor) *chainProcessor {
+	renamed := false
+	for _, proc := range ps {
+		switch proc := proc.(type) {
+		case *defaultProcessor:
+			renamed = true
+		case *compressor:
+			if renamed {
+				proc.WithInPlace()
+			}
+			renamed = true
+		}
+	}
+	return &chainProcessor{
+		ps: ps,
+	}
+}
+
+func (p *chainProcessor) Process(dir string, remains []os.DirEntry) error {
+	return p.ProcessContext(context.Background(), dir, remains)
+}
+
+func (p *chainProcessor) ProcessContext(ctx context.Context, dir string, remains []os.DirEntry) error {
+	for i, proc := range p.ps {
+		if i > 0 && p.rematch != nil {
+			var err error
+			if remains, err = p.rematch(dir); err != nil {
+				return err
+			}
+		}
+		if err := processContext(ctx, proc, dir, remains); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupNames returns the names produced by the first processor, the others see them.
+func (p *chainProcessor) backupNames(base string) []string {
+	if len(p.ps) == 0 {
+		return nil
+	}
+	if bn, ok := p.ps[0].(backupNamer); ok {
+		return bn.backupNames(base)
+	}
+	return nil
+}
+
+func (p *chainProcessor) Init(base string) {
+	for _, proc := range p.ps {
+		if i, ok := proc.(interface{ Init(base string) }); ok {
+			i.Init(base)
+		}
+	}
+}
+
+func (p *chainProcessor) setClock(c Clock) {
+	for _, proc := range p.ps {
+		if cs, ok := proc.(clockSetter); ok {
+			cs.setClock(c)
+		}
+	}
+}
+
+func (p *chainProcessor) setLocation(loc *time.Location) {
+	for _, proc := range p.ps {
+		if ls, ok := proc.(locationSetter); ok {
+			ls.setLocation(loc)
+		}
 	}
+}
 
-	tail := 1
-	last := path.Ext(base)
-	if len(last) > 0 {
-		last = last[1:]
+func (p *chainProcessor) setNamer(n Namer) {
+	for _, proc := range p.ps {
+		if ns, ok := proc.(namerSetter); ok {
+			ns.setNamer(n)
+		}
 	}
-	pre := base
-	if IsNumeric(last) {
-		tail, _ = strconv.Atoi(last)
-		tail++
-		pre = base[:len(base)-len(last)-1]
+}
+
+func (p *chainProcessor) setTracer(t Tracer) {
+	for _, proc := range p.ps {
+		if ts, ok := proc.(tracerSetter); ok {
+			ts.setTracer(t)
+		}
+	}
+}
+
+func (p *chainProcessor) setEmitter(emit func(Event)) {
+	for _, proc := range p.ps {
+		if es, ok := proc.(emitterSetter); ok {
+			es.setEmitter(emit)
+		}
+	}
+}
+
+func (p *chainProcessor) recover(dir string) error {
+	for _, proc := range p.ps {
+		if rc, ok := proc.(recoverer); ok {
+			if err := rc.recover(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *chainProcessor) setLogger(l Logger) {
+	for _, proc := range p.ps {
+		if ls, ok := proc.(loggerSetter); ok {
+			ls.setLogger(l)
+		}
+	}
+}
+
+func (p *chainProcessor) setFS(fsys FS) {
+	for _, proc := range p.ps {
+		if fss, ok := proc.(fsSetter); ok {
+			fss.setFS(fsys)
+		}
 	}
-	return pre + "." + strconv.Itoa(tail)
 }
 
 type CompressFormat string
@@ -123,130 +444,467 @@ var cfSuffix = map[CompressFormat]string{
 	Zlib: ".z",
 }
 
-func getCompressWriter(format CompressFormat, f io.Writer) io.WriteCloser {
-	var w io.WriteCloser
-	switch format {
-	case Gzip:
-		w = gzip.NewWriter(f)
-	case Zlib:
-		w = zlib.NewWriter(f)
-	}
-	return w
-}
-
 type compressor struct {
 	b *baseProcessor
 
 	format      CompressFormat
 	suffix      string
-	suffixFirst string
 	suffixLen   int
+	after       int
+	verify      bool
+	xattrs      bool
+	lowPriority bool
+	level       int
+	dict        string
+	inPlace     bool // compresses the backups under their names, see WithInPlace
+
+	workers *workerGroup
+	limiter *rateLimiter
+	emit    func(Event)
+	tracer  Tracer
+
+	mu        sync.Mutex
+	compLocks map[string]chan struct{} // the sources being compressed by the workers, closed once done
+}
+
+// CompressorOption configures a Compressor.
+type CompressorOption func(c *compressor)
+
+// WithLevel is the CompressorOption of compressor.WithLevel.
+func WithLevel(level int) CompressorOption {
+	return func(c *compressor) {
+		c.WithLevel(level)
+	}
 }
 
-// Compressor compresses and rename the files
+// WithDictionary is the CompressorOption of compressor.WithDictionary.
+func WithDictionary(dict []byte) CompressorOption {
+	return func(c *compressor) {
+		c.WithDictionary(dict)
+	}
+}
+
+// Compressor compresses and rename the files, eg. Compressor(Zlib, WithLevel(zlib.BestSpeed))
 //
 // eg.
 //
 //	base: "abc.log",
 //	return: "abc.log.1.gz"
-func Compressor(format CompressFormat) *compressor {
+func Compressor(format CompressFormat, opts ...CompressorOption) *compressor {
 	c := &compressor{}
 
 	c.b = &baseProcessor{
-		c.each,
+		each: c.each,
 	}
 
 	c.format = format
+	c.level = DefaultCompressLevel
 	c.suffix = cfSuffix[format]
-	c.suffixLen = len(c.suffix)
-	c.suffixFirst = ".1" + c.suffix
 	if c.suffix == "" {
 		c.format = NoCompress
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
 
 	return c
 }
 
-func (p *compressor) Process(dir string, remains []os.DirEntry) error {
-	return p.b.Process(dir, remains)
+// WithNamer names the backups by n, the compression suffix is appended to the names.
+func (p *compressor) WithNamer(n Namer) *compressor {
+	p.setNamer(n)
+	return p
 }
 
-func (p *compressor) each(dir, base string) error {
-	var newName string
-	if p.format == NoCompress {
-		// dagrade to rename
-		newName = _defaultProcessor.incrTailNumber(base)
+func (p *compressor) Init(base string) {
+	p.b.base = base
+}
+
+func (p *compressor) setNamer(n Namer) {
+	p.b.namer = n
+}
+
+func (p *compressor) setTracer(t Tracer) {
+	p.tracer = t
+}
+
+func (p *compressor) setEmitter(emit func(Event)) {
+	p.emit = emit
+}
+
+func (p *compressor) setLogger(l Logger) {
+	p.b.setLogger(l)
+}
+
+func (p *compressor) setFS(fsys FS) {
+	p.b.fs = fsys
+}
+
+// WithCompressAfter keeps the most recent n backups uncompressed, only the older ones are compressed.
+func (p *compressor) WithCompressAfter(n int) *compressor {
+	if n < 0 {
+		n = 0
+	}
+	p.after = n
+	return p
+}
+
+// WithVerify decodes each compressed backup again and checks the checksum and the size before removing the original,
+// so a corruption during the compression never destroys the only copy. On failure the original is kept,
+// the rolling fails by ErrCorruptArchive, reported by the ErrorEvent.
+func (p *compressor) WithVerify() *compressor {
+	p.verify = true
+	return p
+}
+
+// WithInPlace compresses the backups under their names without renaming them, eg. app.log.1 to app.log.1.gz,
+// so it follows a processor renaming them, eg. DefaultProcessor in a ChainProcessor.
+// The compressed backups are skipped.
+func (p *compressor) WithInPlace() *compressor {
+	p.inPlace = true
+	return p
+}
+
+// WithLevel compresses at level, from gzip.BestSpeed(1) to gzip.BestCompression(9), or gzip.HuffmanOnly(-2),
+// DefaultCompressLevel by default. The lower levels suit the CPU-constrained hosts, the higher ones the storage-constrained.
+// The rolling fails by the invalid level.
+func (p *compressor) WithLevel(level int) *compressor {
+	p.level = level
+	return p
+}
+
+// WithDictionary presets dict to Zlib, eg. the recurring fields and messages of the logs, which compresses
+// the highly repetitive logs better. The same dictionary is required to read the backups, see Recompress.
+// Gzip has no preset dictionary, the rolling fails by it.
+func (p *compressor) WithDictionary(dict []byte) *compressor {
+	p.dict = string(dict)
+	return p
+}
+
+func (p *compressor) codec() codec {
+	return codec{format: p.format, level: p.level, dict: p.dict}
+}
+
+// WithWorkers compresses the files by n workers in parallel, Process returns after all of them are done.
+func (p *compressor) WithWorkers(n int) *compressor {
+	if n > 1 {
+		p.workers = newWorkerGroup(n)
+	} else {
+		p.workers = nil
+	}
+	return p
+}
+
+// WithRateLimit limits the bytes per second read by all the workers, bytesPerSec <= 0 means unlimited.
+func (p *compressor) WithRateLimit(bytesPerSec int64) *compressor {
+	if bytesPerSec > 0 {
+		p.limiter = newRateLimiter(bytesPerSec)
 	} else {
-		newName = p.incrTailNumber(base)
+		p.limiter = nil
 	}
+	return p
+}
+
+func (p *compressor) Process(dir string, remains []os.DirEntry) error {
+	return p.ProcessContext(context.Background(), dir, remains)
+}
 
-	if newName != base+p.suffixFirst || p.format == NoCompress {
-		debug("[Rename] %v --> %v", base, newName)
-		return renameFile(dir, base, newName)
+// ProcessContext is Process, the compressions are stopped once ctx is done, their partial files are removed.
+func (p *compressor) ProcessContext(ctx context.Context, dir string, remains []os.DirEntry) error {
+	err := p.b.process(ctx, dir, remains)
+	if p.workers != nil {
+		if werr := p.workers.Wait(); err == nil {
+			err = werr
+		}
 	}
+	return err
+}
 
-	debug("[Compress] %v --> %v", base, newName)
-	of, err := os.OpenFile(path.Join(dir, base), os.O_RDONLY, 0644)
+// goCompress compresses the file, then calls after if the compression succeeded.
+func (p *compressor) goCompress(ctx context.Context, dir, base, newName string, after func() error) error {
+	job := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, span := startSpan(ctx, p.tracer, SpanCompress)
+		span.SetAttribute("rollingf.src", path.Join(dir, base))
+		span.SetAttribute("rollingf.dst", path.Join(dir, newName))
+		span.SetAttribute("rollingf.format", string(p.format))
+		err := p.compress(ctx, dir, base, newName)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			if err := after(); err != nil {
+				return err
+			}
+		}
+		if p.emit != nil {
+			p.emit(CompressionDone{Name: path.Join(dir, newName), Format: p.format})
+		}
+		return nil
+	}
+
+	if p.workers == nil {
+		return job()
+	}
+
+	src := path.Join(dir, base)
+	done := make(chan struct{})
+	p.mu.Lock()
+	if p.compLocks == nil {
+		p.compLocks = make(map[string]chan struct{})
+	}
+	p.compLocks[src] = done
+	p.mu.Unlock()
+	p.workers.Go(func() error {
+		defer func() {
+			p.mu.Lock()
+			delete(p.compLocks, src)
+			p.mu.Unlock()
+			close(done)
+		}()
+		return job()
+	})
+	return nil
+}
+
+// rename renames base to newName after the worker compressing newName is done, since the compression removes its source,
+// eg. app.log.1 is compressed to app.log.2.gz before app.log is renamed to app.log.1.
+func (p *compressor) rename(dir, base, newName string) error {
+	p.mu.Lock()
+	done := p.compLocks[path.Join(dir, newName)]
+	p.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	p.b.debug("[Rename] %v --> %v", base, newName)
+	return renameFile(p.b.fs, dir, base, newName)
+}
+
+func (p *compressor) each(ctx context.Context, dir string, idx int, e os.DirEntry) error {
+	if p.inPlace {
+		return p.eachInPlace(ctx, dir, idx, e)
+	}
+	if p.b.namer != nil {
+		return p.eachByNamer(ctx, dir, idx, e)
+	}
+
+	base := e.Name()
+	if p.format == NoCompress || compressFormat(base) != NoCompress {
+		// dagrade to rename, the compressed backups keep their formats, eg. the ones left by the previous Compressor
+		newName := nextBackupName(p.b.base, base, NoCompress)
+		return p.rename(dir, base, newName)
+	}
+
+	newName := nextBackupName(p.b.base, base, NoCompress)
+	if !p.shouldCompress(parseBackupName(p.b.base, newName).index) {
+		return p.rename(dir, base, newName)
+	}
+	return p.goCompress(ctx, dir, base, newName+p.suffix, nil)
+}
+
+func (p *compressor) eachByNamer(ctx context.Context, dir string, idx int, e os.DirEntry) error {
+	base := e.Name()
+	newName, err := p.b.nameByNamer(idx, e)
 	if err != nil {
 		return err
 	}
-	defer of.Close()
 
-	nf, err := os.OpenFile(path.Join(dir, newName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	format := compressFormat(base)
+	compressed := p.format == NoCompress || format != NoCompress
+	if compressed || !p.shouldCompress(idx+1) {
+		newName += cfSuffix[format]
+		if newName == base {
+			return nil
+		}
+		return p.rename(dir, base, newName)
+	}
+
+	info, err := e.Info()
 	if err != nil {
 		return err
 	}
-	defer nf.Close()
+	return p.goCompress(ctx, dir, base, newName+p.suffix, func() error {
+		// keep the roll time, the namer relies on it
+		if c, ok := fsOrDefault(p.b.fs).(chtimeser); ok {
+			return c.Chtimes(path.Join(dir, newName+p.suffix), info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
+}
 
-	w := getCompressWriter(p.format, nf)
-	defer w.Close()
+func (p *compressor) eachInPlace(ctx context.Context, dir string, idx int, e os.DirEntry) error {
+	base := e.Name()
+	if p.format == NoCompress || compressFormat(base) != NoCompress || !p.shouldCompress(idx+1) {
+		return nil
+	}
 
-	if _, err := io.Copy(w, of); err != nil {
-		if err := removeFile(dir, newName); err != nil {
-			return err
-		}
+	info, err := e.Info()
+	if err != nil {
 		return err
 	}
-
-	return removeFile(dir, base)
+	return p.goCompress(ctx, dir, base, base+p.suffix, func() error {
+		// keep the roll time, the namer and the filters rely on it
+		if c, ok := fsOrDefault(p.b.fs).(chtimeser); ok {
+			return c.Chtimes(path.Join(dir, base+p.suffix), info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
 }
 
-func (p *compressor) incrTailNumber(base string) string {
-	if len(base) == 0 {
-		return base
+func (p *compressor) backupNames(base string) []string {
+	name := p.b.sampleName(base)
+	if p.format == NoCompress {
+		return []string{name}
+	}
+	if p.after > 0 {
+		// the recent backups are kept uncompressed
+		return []string{name, name + p.suffix}
 	}
+	return []string{name + p.suffix}
+}
+
+// shouldCompress reports whether the index-th backup shall be compressed.
+func (p *compressor) shouldCompress(index int) bool {
+	return index > p.after
+}
 
-	groups := strings.Split(base, ".")
+// compressTmpSuffix is appended to the name of the file being compressed, the partial file left by a crash
+// is never matched and is removed by the next start.
+const compressTmpSuffix = ".tmp"
 
-	var last string
-	var penultimate string
-	if len(base) > p.suffixLen {
-		last = base[len(base)-p.suffixLen:]
-		if last != p.suffix {
-			last = ""
-		} else {
-			if len(groups) >= 3 {
-				penultimate = groups[len(groups)-2]
+// compress compresses base to a temporary file, then renames it to newName, so newName is always complete.
+func (p *compressor) compress(ctx context.Context, dir, base, newName string) error {
+	p.b.debug("[Compress] %v --> %v", base, newName)
+	transcodeFn := func() error {
+		return transcode(ctx, p.b.fs, p.limiter, dir, base, newName, codec{}, p.codec(), p.verify)
+	}
+	var err error
+	if p.lowPriority {
+		err = runLowPriority(transcodeFn)
+	} else {
+		err = transcodeFn()
+	}
+	if err != nil {
+		return err
+	}
+	if p.xattrs {
+		if err := copyXattrs(p.b.fs, dir, base, newName); err != nil {
+			// the original is kept with its attributes
+			if rerr := removeFile(p.b.fs, dir, newName); rerr != nil {
+				p.b.warn("[Compress] err: %v", rerr)
 			}
+			return err
 		}
 	}
+	return removeFile(p.b.fs, dir, base)
+}
 
-	tail := 1
-	var pre string
-	if IsNumeric(penultimate) {
-		tail, _ = strconv.Atoi(penultimate)
-		tail++
-		pre = strings.Join(groups[:len(groups)-2], ".")
-	} else {
-		pre = base
+// ErrCorruptArchive is returned if a compressed backup does not decode to the original, see Compressor.WithVerify.
+var ErrCorruptArchive = errors.New("rollingf: the compressed backup does not match the original")
+
+// transcode writes the content of src compressed by from to a temporary file compressed by to,
+// then renames it to dst, so dst is always complete. The temporary file is decoded again first if verify. src is left.
+func transcode(ctx context.Context, fsys FS, limiter *rateLimiter, dir, src, dst string, from, to codec, verify bool) error {
+	fsys = fsOrDefault(fsys)
+	of, err := fsys.OpenFile(path.Join(dir, src), os.O_RDONLY, 0644)
+	if err != nil {
+		return err
 	}
-	return pre + "." + strconv.Itoa(tail) + p.suffix
+	defer of.Close()
+
+	tmpName := dst + compressTmpSuffix
+	nf, err := fsys.OpenFile(path.Join(dir, tmpName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w, err := to.writer(nf)
+	if err != nil {
+		nf.Close()
+		removeFile(fsys, dir, tmpName)
+		return err
+	}
+	var r io.Reader = &ctxReader{ctx: ctx, r: of}
+	if limiter != nil {
+		r = limiter.Reader(ctx, r)
+	}
+	var n int64
+	rc, err := from.reader(r)
+	if err == nil {
+		n, err = copyPooled(w, rc)
+		rc.Close()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := nf.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && verify {
+		err = verifyArchive(fsys, path.Join(dir, tmpName), to, n)
+	}
+	if err == nil {
+		err = renameFile(fsys, dir, tmpName, dst)
+	}
+	if err != nil {
+		if err := removeFile(fsys, dir, tmpName); err != nil {
+			return err
+		}
+		return err
+	}
+	return nil
+}
+
+// verifyArchive decodes the file compressed by c to the end, which checks the checksum, and compares the size with size.
+func verifyArchive(fsys FS, name string, c codec, size int64) error {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rc, err := c.reader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptArchive, name, err)
+	}
+	defer rc.Close()
+	n, err := copyPooled(io.Discard, rc)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptArchive, name, err)
+	}
+	if n != size {
+		return fmt.Errorf("%w: %s: %d bytes, want %d", ErrCorruptArchive, name, n, size)
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// backupIndex returns the tail number of the backup name, the compression suffix is ignored.
+//
+// eg.
+//
+//	"abc.log" returns 0, "abc.log.2" and "abc.log.2.gz" return 2
+func backupIndex(name string) int {
+	return parseBackupName("", name).index
+}
+
+// trimCompressSuffix removes the compression suffix of the name if any.
+func trimCompressSuffix(name string) string {
+	return strings.TrimSuffix(name, cfSuffix[compressFormat(name)])
 }
 
-func renameFile(dir, oldName, newName string) error {
-	return os.Rename(path.Join(dir, oldName), path.Join(dir, newName))
+func renameFile(fsys FS, dir, oldName, newName string) error {
+	return fsOrDefault(fsys).Rename(path.Join(dir, oldName), path.Join(dir, newName))
 }
 
-func removeFile(dir, oldName string) error {
-	return os.Remove(path.Join(dir, oldName))
+func removeFile(fsys FS, dir, oldName string) error {
+	return fsOrDefault(fsys).Remove(path.Join(dir, oldName))
 }
@@ -0,0 +1,597 @@
+package rollingf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompressAfter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2", "app.log.3.gz"} {
+		if err := os.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return backupIndex(entries[i].Name()) < backupIndex(entries[j].Name())
+	})
+
+	if err := Compressor(Gzip).WithCompressAfter(2).Process(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"app.log.1", "app.log.2", "app.log.3.gz", "app.log.4.gz"} {
+		if _, err := os.Stat(path.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "app.log")); !os.IsNotExist(err) {
+		t.Fatal("app.log still exists")
+	}
+}
+
+func TestCompressAfterWorkers(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string][]byte{
+		"app.log":   []byte("app.log"),
+		"app.log.1": bytes.Repeat([]byte("app.log.1\n"), 4*SizeMB/10),
+		"app.log.2": bytes.Repeat([]byte("app.log.2\n"), 4*SizeMB/10),
+	}
+	for name, b := range contents {
+		if err := os.WriteFile(path.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// app.log is renamed to app.log.1 while the workers compress app.log.1
+	if err := Compressor(Gzip).WithCompressAfter(1).WithWorkers(2).Process(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, from := range map[string]string{"app.log.1": "app.log", "app.log.2.gz": "app.log.1", "app.log.3.gz": "app.log.2"} {
+		b, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".gz") {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, err = io.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(b, contents[from]) {
+			t.Fatal(name, "is not", from)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "app.log")); !os.IsNotExist(err) {
+		t.Fatal("app.log still exists")
+	}
+}
+
+// ioCountFS counts the bytes read and written through the files, except the appending writes of the Roll
+// and its sidecar files, eg. the journal of the renumbering.
+type ioCountFS struct {
+	FS
+
+	mu      sync.Mutex
+	read    int64
+	written int64
+}
+
+type ioCountFile struct {
+	File
+	fs *ioCountFS
+}
+
+func (f *ioCountFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || flag&os.O_APPEND != 0 || strings.HasPrefix(path.Base(name), ".") {
+		return file, err
+	}
+	return &ioCountFile{File: file, fs: f}, nil
+}
+
+func (f *ioCountFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.fs.mu.Lock()
+	f.fs.read += int64(n)
+	f.fs.mu.Unlock()
+	return n, err
+}
+
+func (f *ioCountFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.fs.mu.Lock()
+	f.fs.written += int64(n)
+	f.fs.mu.Unlock()
+	return n, err
+}
+
+func TestZeroCopyProcessors(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"DefaultProcessor": nil,
+		"NoCompress":       {Compress(NoCompress)},
+		"NopProcessor": {Naming(TimestampNamer("")), OptionFunc(func(r *Roll) {
+			r.WithProcessor(NopProcessor())
+		})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			mfs := NewMemFS()
+			mfs.setClock(clock)
+			cfs := &ioCountFS{FS: mfs}
+
+			opts = append([]Option{WithFS(cfs), OptionFunc(func(r *Roll) {
+				r.WithDefaultMatcher().WithDefaultProcessor()
+			})}, opts...)
+			r := NewC("/mem/app.log", opts...).WithFilter(MaxBackupsFilter(3))
+			if r == nil {
+				t.Fatal("nil roll")
+			}
+			defer r.Close()
+
+			events := make(chan RotateEvent, 1)
+			r.OnRotate(func(ev RotateEvent) { events <- ev })
+			for i := 0; i < 3; i++ {
+				r.Write([]byte("hello"))
+				if err := rollSync(t, r, events); err != nil {
+					t.Fatal(err)
+				}
+				clock.Add(time.Minute)
+			}
+
+			entries, _ := mfs.ReadDir("/mem")
+			if len(entries) != 4 {
+				t.Fatal(len(entries), "files")
+			}
+			cfs.mu.Lock()
+			defer cfs.mu.Unlock()
+			if cfs.read != 0 || cfs.written != 0 {
+				t.Fatalf("read %d bytes, written %d bytes", cfs.read, cfs.written)
+			}
+		})
+	}
+}
+
+func TestCompressCancel(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "app.log"), make([]byte, 64*SizeKB), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// takes 64s unless cancelled
+	err = Compressor(Gzip).WithRateLimit(SizeKB).ProcessContext(ctx, dir, entries)
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatal("not cancelled in time", d)
+	}
+
+	names, _ := os.ReadDir(dir)
+	if len(names) != 1 || names[0].Name() != "app.log" {
+		t.Fatal("partial files left", names)
+	}
+}
+
+func TestCompressVerify(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("hello\n"), 1000)
+	if err := os.WriteFile(path.Join(dir, "app.log"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ffs := newFaultFS()
+	ffs.flip = ".gz" + compressTmpSuffix
+	p := Compressor(Gzip).WithVerify()
+	p.setFS(ffs)
+	p.Init("app.log")
+	if err := p.Process(dir, entries); !errors.Is(err, ErrCorruptArchive) {
+		t.Fatal(err)
+	}
+	// the original is kept
+	names, _ := os.ReadDir(dir)
+	if len(names) != 1 || names[0].Name() != "app.log" {
+		t.Fatal("files", names)
+	}
+
+	ffs.flip = ""
+	if err := p.Process(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ = os.ReadDir(dir); len(names) != 1 || names[0].Name() != "app.log.1.gz" {
+		t.Fatal("files", names)
+	}
+}
+
+func TestCompressLevel(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("hello rollingf\n"), 1000)
+	if err := os.WriteFile(path.Join(dir, "app.log"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := Compressor(Gzip).WithLevel(10)
+	p.Init("app.log")
+	if err := p.Process(dir, entries); err == nil {
+		t.Fatal("want the error of the invalid level")
+	}
+	if names, _ := os.ReadDir(dir); len(names) != 1 || names[0].Name() != "app.log" {
+		t.Fatal("files", names)
+	}
+
+	p.WithLevel(gzip.BestCompression)
+	if err := p.Process(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path.Join(dir, "app.log.1.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || !bytes.Equal(got, content) {
+		t.Fatal("content", len(got), err)
+	}
+}
+
+// BenchmarkCompress compresses a backup of 1MB per op, the writers and the buffers are reused from the pools.
+func BenchmarkCompress(b *testing.B) {
+	dir := b.TempDir()
+	content := bytes.Repeat([]byte("2023-01-02 15:04:05 INFO hello rollingf\n"), 1<<20/40)
+	src := path.Join(dir, "app.log")
+	for _, level := range []int{gzip.BestSpeed, DefaultCompressLevel} {
+		b.Run(strconv.Itoa(level), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := os.WriteFile(src, content, 0644); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if err := transcode(context.Background(), osFS{}, nil, dir, "app.log", "app.log.1.gz", codec{}, codec{format: Gzip, level: level}, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressDictionary(t *testing.T) {
+	dict := []byte("level=info msg=\"request served\" method=GET status=200 path=/api/v1/")
+	line := []byte("level=info msg=\"request served\" method=GET status=200 path=/api/v1/users\n")
+	compress := func(p *compressor) (string, []byte) {
+		dir := t.TempDir()
+		if err := os.WriteFile(path.Join(dir, "app.log"), line, 0644); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Init("app.log")
+		if err := p.Process(dir, entries); err != nil {
+			return dir, nil
+		}
+		b, err := os.ReadFile(path.Join(dir, "app.log.1"+p.suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir, b
+	}
+
+	_, plain := compress(Compressor(Zlib))
+	_, withDict := compress(Compressor(Zlib, WithLevel(zlib.BestCompression), WithDictionary(dict)).WithVerify())
+	if len(withDict) == 0 || len(withDict) >= len(plain) {
+		t.Fatal("sizes", len(withDict), len(plain))
+	}
+	if _, err := (codec{format: Zlib}).reader(bytes.NewReader(withDict)); !errors.Is(err, zlib.ErrDictionary) {
+		t.Fatal("read without the dictionary", err)
+	}
+	rc, err := codec{format: Zlib, dict: string(dict)}.reader(bytes.NewReader(withDict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, line) {
+		t.Fatal("content", string(got), err)
+	}
+
+	// gzip has no dictionary, the original is kept
+	dir, b := compress(Compressor(Gzip, WithDictionary(dict)))
+	if b != nil {
+		t.Fatal("want the error of the dictionary")
+	}
+	if names, _ := os.ReadDir(dir); len(names) != 1 || names[0].Name() != "app.log" {
+		t.Fatal("files", names)
+	}
+}
+
+func TestCompressMixedFormats(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2.gz", "app.log.3.z", "app.log.4.gz"} {
+		if err := os.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// switched from Gzip to Zlib, the backups of both are kept within 3
+	r := NewC(path.Join(dir, "app.log"), Compress(Zlib)).WithFilter(MaxBackupsFilter(3))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"app.log", "app.log.1.z", "app.log.2.z", "app.log.3.gz"}
+	var names []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		entries, _ := os.ReadDir(dir)
+		names = names[:0]
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if reflect.DeepEqual(names, want) {
+			break
+		}
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("files %v, want %v", names, want)
+	}
+	if b, _ := os.ReadFile(path.Join(dir, "app.log.3.gz")); string(b) != "app.log.2.gz" {
+		t.Fatalf("app.log.3.gz: %q", b)
+	}
+}
+
+// slowReadFS holds the backups opened for reading for a while, and records the most of them opened at once.
+type slowReadFS struct {
+	FS
+
+	mu      sync.Mutex
+	reading int
+	most    int
+}
+
+type slowReadFile struct {
+	File
+	fs *slowReadFS
+}
+
+func (f *slowReadFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || flag != os.O_RDONLY || !strings.HasPrefix(path.Base(name), "app.log") {
+		return file, err
+	}
+	f.mu.Lock()
+	f.reading++
+	if f.reading > f.most {
+		f.most = f.reading
+	}
+	f.mu.Unlock()
+	return &slowReadFile{File: file, fs: f}, nil
+}
+
+func (f *slowReadFile) Close() error {
+	time.Sleep(50 * time.Millisecond)
+	f.fs.mu.Lock()
+	f.fs.reading--
+	f.fs.mu.Unlock()
+	return f.File.Close()
+}
+
+func TestCompressWorkers(t *testing.T) {
+	mfs := NewMemFS()
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2", "app.log.3", "app.log.4"} {
+		f, err := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(name))
+		f.Close()
+	}
+	sfs := &slowReadFS{FS: mfs}
+	r := NewC("/mem/app.log", WithFS(sfs), Compress(Gzip), WithCompressWorkers(3))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	// drained before the rolling is done
+	for i := 1; i <= 5; i++ {
+		name := "/mem/app.log." + strconv.Itoa(i) + ".gz"
+		if _, err := mfs.Stat(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sfs.mu.Lock()
+	defer sfs.mu.Unlock()
+	if sfs.most < 2 || sfs.most > 3 {
+		t.Fatal(sfs.most, "compressed at once")
+	}
+}
+
+func TestCompressRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app.log.1"} {
+		if err := os.WriteFile(path.Join(dir, name), make([]byte, 32*SizeKB), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewC(dir+"/app.log", Compress(Gzip), WithCompressWorkers(2), WithCompressRateLimit(128*SizeKB))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	start := time.Now()
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit is shared by the workers, 64KB takes 0.5s
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatal("not throttled", d)
+	}
+	for _, name := range []string{"app.log.1.gz", "app.log.2.gz"} {
+		if _, err := os.Stat(path.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// recordProcessor records its name and the files it sees, then fails by err.
+type recordProcessor struct {
+	name  string
+	calls *[]string
+	seen  []string
+	err   error
+}
+
+func (p *recordProcessor) Process(_ string, remains []os.DirEntry) error {
+	*p.calls = append(*p.calls, p.name)
+	p.seen = p.seen[:0]
+	for _, e := range remains {
+		p.seen = append(p.seen, e.Name())
+	}
+	return p.err
+}
+
+func TestChainProcessor(t *testing.T) {
+	var calls []string
+	failed := errors.New("upload failed")
+	rename := &recordProcessor{name: "rename", calls: &calls}
+	upload := &recordProcessor{name: "upload", calls: &calls}
+	checksum := &recordProcessor{name: "checksum", calls: &calls}
+	p := ChainProcessor(rename, upload, checksum)
+
+	if err := p.Process("/mem", nil); err != nil || !reflect.DeepEqual(calls, []string{"rename", "upload", "checksum"}) {
+		t.Fatal(calls, err)
+	}
+
+	// the error stops the chain
+	calls = nil
+	upload.err = failed
+	if err := p.Process("/mem", nil); err != failed || !reflect.DeepEqual(calls, []string{"rename", "upload"}) {
+		t.Fatal(calls, err)
+	}
+
+	// the processors after the first one see the names renamed by it
+	calls = nil
+	upload.err = nil
+	mfs := NewMemFS()
+	r := NewC("/mem/app.log", WithFS(mfs), OptionFunc(func(r *Roll) {
+		r.WithDefaultMatcher().WithProcessor(DefaultProcessor(), upload, checksum)
+	}))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	r.Write([]byte("hello"))
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, []string{"upload", "checksum"}) || !reflect.DeepEqual(upload.seen, []string{"app.log.1"}) {
+		t.Fatal(calls, upload.seen)
+	}
+}
+
+func TestChainBuiltinProcessors(t *testing.T) {
+	mfs := NewMemFS()
+	r := NewC("/mem/app.log", WithFS(mfs), OptionFunc(func(r *Roll) {
+		r.WithMatcher(AnyFormatMatcher()).WithProcessor(DefaultProcessor(), Compressor(Gzip))
+	}))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	for _, s := range []string{"a", "b", "c"} {
+		r.Write([]byte(s))
+		if err := rollSync(t, r, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// renamed by the DefaultProcessor only, then compressed in place
+	entries, err := mfs.ReadDir("/mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	if want := []string{"app.log", "app.log.1.gz", "app.log.2.gz", "app.log.3.gz"}; !reflect.DeepEqual(names, want) {
+		t.Fatal(names)
+	}
+	for name, want := range map[string]string{"app.log.1.gz": "c", "app.log.2.gz": "b", "app.log.3.gz": "a"} {
+		b, _ := mfs.ReadFile(path.Join("/mem", name))
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if got, err := io.ReadAll(zr); err != nil || string(got) != want {
+			t.Fatal(name, string(got), err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Publisher publishes the notifications of the rotated files, eg. a Kafka producer or a NATS connection
+// adapted by the caller. key is the checksum of the file, so the consumers deduplicate the retried notifications,
+// eg. as the Kafka message key or the Nats-Msg-Id header of JetStream.
+type Publisher interface {
+	Publish(ctx context.Context, key string, payload []byte) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(ctx context.Context, key string, payload []byte) error
+
+func (f PublisherFunc) Publish(ctx context.Context, key string, payload []byte) error {
+	return f(ctx, key, payload)
+}
+
+// RotatedFile is the notification published by Roll.PublishRotated, as JSON.
+type RotatedFile struct {
+	Cycle    uint64    `json:"cycle"`    // the ID of the check cycle rolled the file
+	Path     string    `json:"path"`     // the path of the backup
+	Size     int64     `json:"size"`     // the size on disk
+	Checksum string    `json:"checksum"` // the SHA-256 of the content on disk, hex encoded
+	Time     time.Time `json:"time"`     // when the rotation started
+}
+
+// Backoff retries a failed operation, waiting Initial first and twice as long each time up to Max.
+type Backoff struct {
+	Initial  time.Duration // 100ms if <= 0
+	Max      time.Duration // 10s if <= 0
+	Attempts int           // the calls in total, 5 if <= 0
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = 100 * time.Millisecond
+	}
+	if b.Max <= 0 {
+		b.Max = 10 * time.Second
+	}
+	if b.Attempts <= 0 {
+		b.Attempts = 5
+	}
+	return b
+}
+
+// do calls fn until it succeeds, the attempts run out or ctx is done, the last error is returned.
+func (b Backoff) do(ctx context.Context, fn func() error) error {
+	b = b.withDefaults()
+	wait := b.Initial
+	var err error
+	for i := 0; i < b.Attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(wait):
+			}
+			if wait *= 2; wait > b.Max {
+				wait = b.Max
+			}
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// PublishRotated publishes a RotatedFile of the newest backup after every successful rotation, in the rotating goroutine,
+// retried by b. The failure after the retries is emitted as an ErrorEvent. The retries are stopped by Close.
+func (r *Roll) PublishRotated(p Publisher, b Backoff) *Roll {
+	return r.OnRotateContext(func(ctx context.Context, ev RotateEvent) {
+		if ev.Err != nil {
+			return
+		}
+		if err := r.publishRotated(ctx, p, b, ev); err != nil {
+			r.warn("[publish] [cycle #%d] err: %v", ev.Cycle, err)
+			r.emit(ErrorEvent{Cycle: ev.Cycle, Err: err})
+		}
+	})
+}
+
+func (r *Roll) publishRotated(ctx context.Context, p Publisher, b Backoff, ev RotateEvent) error {
+	backups, err := r.Backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		// removed by the filters
+		return nil
+	}
+	newest := backups[0]
+	sum, err := r.checksum(newest.Path)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(RotatedFile{
+		Cycle:    ev.Cycle,
+		Path:     newest.Path,
+		Size:     newest.Size,
+		Checksum: sum,
+		Time:     ev.Time,
+	})
+	if err != nil {
+		return err
+	}
+	err = b.do(ctx, func() error {
+		return p.Publish(ctx, sum, payload)
+	})
+	if err != nil {
+		return fmt.Errorf("rollingf: publish %s: %w", newest.Path, err)
+	}
+	return nil
+}
+
+// checksum returns the hex encoded SHA-256 of the file.
+func (r *Roll) checksum(name string) (string, error) {
+	f, err := r.fs.OpenFile(name, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
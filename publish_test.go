@@ -0,0 +1,81 @@
+package rollingf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestPublishRotated(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r := NewC(fp).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	type message struct {
+		key     string
+		payload []byte
+	}
+	published := make(chan message, 1)
+	calls := 0
+	r.PublishRotated(PublisherFunc(func(_ context.Context, key string, payload []byte) error {
+		if calls++; calls < 3 {
+			return errors.New("broker down")
+		}
+		published <- message{key, payload}
+		return nil
+	}), Backoff{Initial: time.Millisecond})
+
+	r.Write([]byte("hello\n"))
+	if err := r.MarkRotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var m message
+	select {
+	case m = <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not published")
+	}
+	sum := sha256.Sum256([]byte("hello\n"))
+	var f RotatedFile
+	if err := json.Unmarshal(m.payload, &f); err != nil {
+		t.Fatal(err)
+	}
+	if m.key != hex.EncodeToString(sum[:]) || f.Checksum != m.key || f.Path != fp+".1" || f.Size != 6 || f.Cycle == 0 {
+		t.Errorf("published %s %+v", m.key, f)
+	}
+	if _, err := os.Stat(f.Path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	calls := 0
+	err := Backoff{Initial: time.Millisecond, Attempts: 3}.do(context.Background(), func() error {
+		calls++
+		return errors.New("failed")
+	})
+	if err == nil || calls != 3 {
+		t.Fatal(err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	Backoff{Initial: time.Hour}.do(ctx, func() error {
+		calls++
+		return errors.New("failed")
+	})
+	if calls != 1 {
+		t.Fatal("not stopped by ctx", calls)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Recompress converges the backups to format, eg. after switching the Compressor from Gzip to Zlib: the uncompressed
+// backups are compressed, the ones in the other formats are transcoded, NoCompress decompresses them all.
+// The level and the dictionary of the Compressor of the Roll apply to its format.
+// The backups rolled within the last minAge are untouched, so the compressor of the rolling deals them as usual.
+//
+// The backups are matched by the matcher of the Roll with or without the compression suffixes, the new backups
+// keep the modification times of the old ones and are verified like Compressor.WithVerify. It waits for the rolling in progress, until ctx is done,
+// and returns the paths of the backups rewritten.
+func (r *Roll) Recompress(ctx context.Context, format CompressFormat, minAge time.Duration) ([]string, error) {
+	if format != NoCompress && cfSuffix[format] == "" {
+		return nil, fmt.Errorf("rollingf: unknown compression format %q", format)
+	}
+	unlock, err := r.lockBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ctx, cancel := r.withRollContext(ctx)
+	defer cancel()
+
+	dir := path.Dir(r.filePath)
+	files, err := r.recompressCandidates(dir, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	now := r.now()
+	for _, e := range files {
+		info, err := e.Info()
+		if err != nil {
+			return done, err
+		}
+		if now.Sub(info.ModTime()) < minAge {
+			continue
+		}
+
+		name := e.Name()
+		newName := trimCompressSuffix(name) + cfSuffix[format]
+		r.debug("[recompress] %v --> %v", name, newName)
+		// the old backup is the only copy
+		err = transcode(ctx, r.fs, nil, dir, name, newName, r.recompressCodec(compressFormat(name)), r.recompressCodec(format), true)
+		if err == nil {
+			if c, ok := fsOrDefault(r.fs).(chtimeser); ok {
+				err = c.Chtimes(path.Join(dir, newName), info.ModTime(), info.ModTime())
+			}
+		}
+		if err == nil {
+			err = removeFile(r.fs, dir, name)
+		}
+		if err != nil {
+			r.emit(ErrorEvent{Err: err})
+			return done, err
+		}
+
+		done = append(done, path.Join(dir, newName))
+		if format != NoCompress {
+			r.emit(CompressionDone{Name: path.Join(dir, newName), Format: format})
+		}
+	}
+	return done, nil
+}
+
+// recompressCandidates returns the backups in dir not in format, matched by the matcher with or without the suffixes.
+func (r *Roll) recompressCandidates(dir string, format CompressFormat) ([]os.DirEntry, error) {
+	if r.matcher == nil {
+		return nil, nil
+	}
+	entries, err := r.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	shards, err := r.shardFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(r.filePath)
+	tmpBase := path.Base(r.tmpFilePath)
+	var files []os.DirEntry
+	for _, e := range append(entries, shards...) {
+		name := path.Base(e.Name())
+		if !e.Type().IsRegular() || name == base || name == tmpBase || compressFormat(name) == format ||
+			strings.HasSuffix(name, compressTmpSuffix) {
+			continue
+		}
+		stem := trimCompressSuffix(name)
+		if r.matcher.Match(name) || r.matcher.Match(stem) || r.matcher.Match(stem+cfSuffix[format]) {
+			files = append(files, e)
+		}
+	}
+	return files, nil
+}
+
+// recompressCodec returns the codec of format, with the settings of the Compressor of r if it compresses in format.
+func (r *Roll) recompressCodec(format CompressFormat) codec {
+	if c, ok := r.processor.(*compressor); ok && c.format == format {
+		return c.codec()
+	}
+	return codec{format: format, level: DefaultCompressLevel}
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// RecordFormat frames every record written, so each file is parsed on its own and the truncated tail is detected.
+type RecordFormat int
+
+const (
+	// RawRecords writes the records as they are, the default.
+	RawRecords RecordFormat = iota
+	// LengthPrefixed writes the length and the CRC-32C of the record in big endian before it, for the binary records.
+	LengthPrefixed
+	// JSONLines writes every record as one line of JSON: a JSON record is compacted, the others are quoted as a string.
+	JSONLines
+)
+
+var (
+	// ErrTruncatedRecord is returned by RecordReader for the partial record at the end, eg. the writer crashed.
+	ErrTruncatedRecord = errors.New("rollingf: truncated record")
+	// ErrCorruptRecord is returned by RecordReader for the record failed the check of its format.
+	ErrCorruptRecord = errors.New("rollingf: corrupt record")
+)
+
+const recordHeaderLen = 8
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// WithRecordFormat frames every record by f before it is written to the file, read them back by NewRecordReader.
+//
+// A record is never split by the rollings, every Write or every record of WriteBatch is a record.
+// The tees get the records unframed.
+func WithRecordFormat(f RecordFormat) Option {
+	return OptionFunc(func(r *Roll) {
+		r.recordFormat = f
+	})
+}
+
+// frame returns the record p framed by the format of the Roll.
+func (r *Roll) frame(p []byte) []byte {
+	switch r.recordFormat {
+	case LengthPrefixed:
+		b := make([]byte, recordHeaderLen+len(p))
+		binary.BigEndian.PutUint32(b, uint32(len(p)))
+		binary.BigEndian.PutUint32(b[4:], crc32.Checksum(p, crc32c))
+		copy(b[recordHeaderLen:], p)
+		return b
+	case JSONLines:
+		var buf bytes.Buffer
+		if trimmed := bytes.TrimSpace(p); json.Valid(trimmed) && len(trimmed) > 0 {
+			json.Compact(&buf, trimmed)
+		} else {
+			s, _ := json.Marshal(string(p))
+			buf.Write(s)
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+	return p
+}
+
+// RecordReader reads the records framed by WithRecordFormat.
+type RecordReader struct {
+	br     *bufio.Reader
+	format RecordFormat
+}
+
+// NewRecordReader reads the records in the format from r, eg. a rolled file.
+func NewRecordReader(r io.Reader, format RecordFormat) *RecordReader {
+	return &RecordReader{
+		br:     bufio.NewReader(r),
+		format: format,
+	}
+}
+
+// Next returns the next record, io.EOF after the last one. The partial record at the end returns ErrTruncatedRecord.
+//
+// A JSONLines record is returned as the JSON line without the newline.
+// The RawRecords have no boundaries, the rest of the file is returned as one record.
+func (rr *RecordReader) Next() ([]byte, error) {
+	switch rr.format {
+	case LengthPrefixed:
+		var header [recordHeaderLen]byte
+		if _, err := io.ReadFull(rr.br, header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, ErrTruncatedRecord
+			}
+			return nil, err
+		}
+		p := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(rr.br, p); err != nil {
+			if err == io.ErrUnexpectedEOF || err == io.EOF {
+				return nil, ErrTruncatedRecord
+			}
+			return nil, err
+		}
+		if crc32.Checksum(p, crc32c) != binary.BigEndian.Uint32(header[4:]) {
+			return nil, ErrCorruptRecord
+		}
+		return p, nil
+	case JSONLines:
+		line, err := rr.br.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) == 0 {
+				return nil, io.EOF
+			}
+			return nil, ErrTruncatedRecord
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = line[:len(line)-1]
+		if !json.Valid(line) {
+			return nil, ErrCorruptRecord
+		}
+		return line, nil
+	}
+
+	p, err := io.ReadAll(rr.br)
+	if err == nil && len(p) == 0 {
+		err = io.EOF
+	}
+	return p, err
+}
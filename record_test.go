@@ -0,0 +1,83 @@
+package rollingf
+
+import (
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func readRecords(t *testing.T, name string, format RecordFormat) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []string
+	rr := NewRecordReader(f, format)
+	for {
+		p, err := rr.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, string(p))
+	}
+}
+
+func TestRecordFormat(t *testing.T) {
+	t.Run("length prefixed", func(t *testing.T) {
+		fp := path.Join(t.TempDir(), "app.log")
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WithRecordFormat(LengthPrefixed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Write([]byte("a"))
+		r.WriteBatch([][]byte{[]byte("bc"), nil, []byte("d\n")})
+		r.MarkRotate()
+		r.Write([]byte("e"))
+		r.Close()
+
+		if records, err := readRecords(t, fp+".1", LengthPrefixed); err != nil || !reflect.DeepEqual(records, []string{"a", "bc", "", "d\n"}) {
+			t.Fatalf("%q %v", records, err)
+		}
+		if records, err := readRecords(t, fp, LengthPrefixed); err != nil || !reflect.DeepEqual(records, []string{"e"}) {
+			t.Fatalf("%q %v", records, err)
+		}
+
+		// the writer crashed in the middle of a record
+		f, _ := os.OpenFile(fp, os.O_APPEND|os.O_WRONLY, 0644)
+		f.Write(r.frame([]byte("fgh"))[:10])
+		f.Close()
+		if records, err := readRecords(t, fp, LengthPrefixed); err != ErrTruncatedRecord || len(records) != 1 {
+			t.Fatalf("%q %v", records, err)
+		}
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		fp := path.Join(t.TempDir(), "app.log")
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WithRecordFormat(JSONLines))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Write([]byte("{\n  \"level\": \"error\"\n}\n"))
+		r.Write([]byte("two\nlines"))
+		r.Close()
+
+		want := []string{`{"level":"error"}`, `"two\nlines"`}
+		if records, err := readRecords(t, fp, JSONLines); err != nil || !reflect.DeepEqual(records, want) {
+			t.Fatalf("%q %v", records, err)
+		}
+
+		f, _ := os.OpenFile(fp, os.O_APPEND|os.O_WRONLY, 0644)
+		f.Write([]byte(`{"lev`))
+		f.Close()
+		if records, err := readRecords(t, fp, JSONLines); err != ErrTruncatedRecord || len(records) != 2 {
+			t.Fatalf("%q %v", records, err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// recoverRolling finishes the rolling interrupted by a crash, before the file is opened for writing.
+//
+// The partial compressions are removed, their sources are still there. The renumbering of the backups is finished
+// by its journal. The temporary file left means the writes
+// were switched to it: it is renamed back if the file was already processed, or the rolling is run again.
+func (r *Roll) recoverRolling() error {
+	r.rotateCh <- struct{}{}
+	if r.shared != nil {
+		// another process may be rolling the file right now
+		if _, err := r.shared.lock(true); err != nil {
+			<-r.rotateCh
+			return err
+		}
+	}
+	release := func() {
+		if r.shared != nil {
+			r.shared.unlock()
+		}
+		<-r.rotateCh
+	}
+
+	dir := path.Dir(r.filePath)
+	if err := r.removePartials(dir); err != nil {
+		release()
+		return err
+	}
+	if rc, ok := r.processor.(recoverer); ok {
+		if err := rc.recover(dir); err != nil {
+			release()
+			return err
+		}
+	}
+
+	_, err := r.fs.Stat(r.tmpFilePath)
+	if os.IsNotExist(err) || r.renameReopen {
+		release()
+		return nil
+	}
+	if err != nil {
+		release()
+		return err
+	}
+
+	_, err = r.fs.Stat(r.filePath)
+	if os.IsNotExist(err) {
+		r.debug("[recoverRolling] rename back %s", r.tmpFilePath)
+		release()
+		return r.fs.Rename(r.tmpFilePath, r.filePath)
+	}
+	if err != nil {
+		release()
+		return err
+	}
+	r.debug("[recoverRolling] roll again, %s is left", r.tmpFilePath)
+	// rollOnce releases the locks
+	return r.rollOnce(r.ctx)
+}
+
+// removePartials removes the partial compressions and archives of the file's backups in dir.
+func (r *Roll) removePartials(dir string) error {
+	entries, err := r.fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		// Open reports the missing directory
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	shards, err := r.shardFiles(dir)
+	if err != nil {
+		return err
+	}
+	base := path.Base(r.filePath)
+	for _, e := range append(entries, shards...) {
+		name := e.Name()
+		if !strings.HasPrefix(path.Base(name), base) || !strings.HasSuffix(name, compressTmpSuffix) {
+			continue
+		}
+		if done := strings.TrimSuffix(name, compressTmpSuffix); compressFormat(done) == NoCompress && !isArchive(base, done) {
+			continue
+		}
+		r.debug("[recoverRolling] remove the partial compression %s", name)
+		if err := removeFile(r.fs, dir, name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package rollingf
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRecoverRolling(t *testing.T) {
+	files := func(t *testing.T, dir string, contents map[string]string) {
+		for name, s := range contents {
+			if err := os.WriteFile(path.Join(dir, name), []byte(s), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expect := func(t *testing.T, dir string, contents map[string]string) {
+		for name, want := range contents {
+			b, err := os.ReadFile(path.Join(dir, name))
+			if want == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("%s is left", name)
+				}
+				continue
+			}
+			if err != nil || string(b) != want {
+				t.Errorf("%s: %q, want %q, %v", name, b, want, err)
+			}
+		}
+	}
+
+	t.Run("processed", func(t *testing.T) {
+		dir := t.TempDir()
+		files(t, dir, map[string]string{"app.log.1": "a", "_app.log": "b"})
+		r, err := NewE(NewRollConf(path.Join(dir, "app.log"), DurOneDay, 0, 0, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Write([]byte("c"))
+		r.Close()
+		expect(t, dir, map[string]string{"app.log.1": "a", "app.log": "bc", "_app.log": ""})
+	})
+
+	t.Run("unprocessed", func(t *testing.T) {
+		dir := t.TempDir()
+		files(t, dir, map[string]string{"app.log.1": "z", "app.log": "a", "_app.log": "b"})
+		r, err := NewE(NewRollConf(path.Join(dir, "app.log"), DurOneDay, 0, 0, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		expect(t, dir, map[string]string{"app.log.2": "z", "app.log.1": "a", "app.log": "b", "_app.log": ""})
+	})
+
+	t.Run("compressing", func(t *testing.T) {
+		dir := t.TempDir()
+		files(t, dir, map[string]string{"app.log": "a", "_app.log": "b", "app.log.1.gz.tmp": "partial"})
+		r, err := NewE(NewRollConf(path.Join(dir, "app.log"), DurOneDay, 0, 0, 2), Compress(Gzip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		expect(t, dir, map[string]string{"app.log": "b", "_app.log": "", "app.log.1.gz.tmp": ""})
+
+		f, err := os.Open(path.Join(dir, "app.log.1.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := io.ReadAll(zr); string(b) != "a" {
+			t.Fatalf("%q", b)
+		}
+	})
+}
+
+func TestCloseCancel(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), Compress(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// takes 64s unless cancelled
+	r.WithProcessor(Compressor(Gzip).WithRateLimit(SizeKB))
+	rotated := make(chan error, 1)
+	r.OnRotateContext(func(ctx context.Context, ev RotateEvent) {
+		if ctx.Err() == nil {
+			t.Error("ctx not done")
+		}
+		rotated <- ev.Err
+	})
+
+	r.Write(make([]byte, 64*SizeKB))
+	if err = r.MarkRotate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("b"))
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	r.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatal("not cancelled in time", d)
+	}
+	if err := <-rotated; !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	// finished by the next start
+	r, err = NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), Compress(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if b, err := os.ReadFile(fp); err != nil || string(b) != "b" {
+		t.Fatalf("%q %v", b, err)
+	}
+	if _, err := os.Stat(fp + ".1.gz"); err != nil {
+		t.Fatal(err)
+	}
+}
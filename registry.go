@@ -0,0 +1,400 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Params are the parameters of a component in a Spec, eg. {"size": "100MB"}.
+type Params map[string]any
+
+// String returns the string parameter key, def if it is absent.
+func (p Params) String(key, def string) (string, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: want a string, got %v", key, v)
+	}
+	return s, nil
+}
+
+// Int returns the integer parameter key, def if it is absent.
+func (p Params) Int(key string, def int) (int, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: want an integer, got %v", key, v)
+}
+
+// Size returns the size parameter key in bytes, a number or a text parsed by ParseSize, def if it is absent.
+func (p Params) Size(key string, def int64) (int64, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	if s, ok := v.(string); ok {
+		return ParseSize(s)
+	}
+	n, err := p.Int(key, 0)
+	return int64(n), err
+}
+
+// Age returns the duration parameter key, a text parsed by ParseAge or the seconds, def if it is absent.
+func (p Params) Age(key string, def time.Duration) (time.Duration, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	if s, ok := v.(string); ok {
+		return ParseAge(s)
+	}
+	n, err := p.Int(key, 0)
+	return time.Duration(n) * time.Second, err
+}
+
+// The factories create the components from the Params of a Spec.
+type (
+	CheckerFactory   func(p Params) (Checker, error)
+	FilterFactory    func(p Params) (Filter, error)
+	ProcessorFactory func(p Params) (Processor, error)
+	MatcherFactory   func(p Params) (Matcher, error)
+)
+
+// factories are the registered factories by the kind and the name, guarded by factoriesMu.
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]map[string]any{
+		"checker":   {},
+		"filter":    {},
+		"processor": {},
+		"matcher":   {},
+	}
+)
+
+// register adds the factory f of kind by name, it panics if the name is taken, the same as database/sql.Register.
+func register(kind, name string, f any) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[kind][name]; ok {
+		panic(fmt.Sprintf("rollingf: %s %q registered twice", kind, name))
+	}
+	factories[kind][name] = f
+}
+
+func lookup(kind, name string) (any, error) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	f, ok := factories[kind][name]
+	if !ok {
+		return nil, fmt.Errorf("unknown %s %q", kind, name)
+	}
+	return f, nil
+}
+
+// RegisterChecker makes a checker available to the Specs by name, eg. from the init of a plugin package.
+// It panics if the name is registered twice.
+func RegisterChecker(name string, f CheckerFactory) {
+	register("checker", name, f)
+}
+
+// RegisterFilter makes a filter available to the Specs by name, it panics if the name is registered twice.
+func RegisterFilter(name string, f FilterFactory) {
+	register("filter", name, f)
+}
+
+// RegisterProcessor makes a processor available to the Specs by name, it panics if the name is registered twice.
+func RegisterProcessor(name string, f ProcessorFactory) {
+	register("processor", name, f)
+}
+
+// RegisterMatcher makes a matcher available to the Specs by name, it panics if the name is registered twice.
+func RegisterMatcher(name string, f MatcherFactory) {
+	register("matcher", name, f)
+}
+
+// Registered returns the sorted names of the registered components of kind, "checker", "filter", "processor" or "matcher".
+func Registered(kind string) []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories[kind]))
+	for name := range factories[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterChecker("interval", func(p Params) (Checker, error) {
+		d, err := p.Age("interval", 0)
+		return IntervalChecker(d), err
+	})
+	RegisterChecker("max_size", func(p Params) (Checker, error) {
+		n, err := p.Size("size", 0)
+		return MaxSizeChecker(n), err
+	})
+	RegisterChecker("daily", func(Params) (Checker, error) {
+		return RotateDaily(), nil
+	})
+	RegisterChecker("hourly", func(Params) (Checker, error) {
+		return RotateHourly(), nil
+	})
+	RegisterChecker("first_write_of_day", func(Params) (Checker, error) {
+		return FirstWriteOfDay(), nil
+	})
+	RegisterChecker("write_rate", func(p Params) (Checker, error) {
+		limit, err := p.Size("limit", 0)
+		if err != nil {
+			return nil, err
+		}
+		per, err := p.Age("per", time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		sustained, err := p.Int("sustained", 1)
+		return WriteRateChecker(limit, per, sustained), err
+	})
+
+	RegisterFilter("max_backups", func(p Params) (Filter, error) {
+		n, err := p.Int("count", 0)
+		return MaxBackupsFilter(n), err
+	})
+	RegisterFilter("max_age", func(p Params) (Filter, error) {
+		d, err := p.Age("age", 0)
+		return MaxAgeFilter(d), err
+	})
+
+	RegisterProcessor("rename", func(Params) (Processor, error) {
+		return DefaultProcessor(), nil
+	})
+	RegisterProcessor("gzip", func(p Params) (Processor, error) {
+		level, err := p.Int("level", DefaultCompressLevel)
+		return Compressor(Gzip, WithLevel(level)), err
+	})
+	RegisterProcessor("zlib", func(p Params) (Processor, error) {
+		level, err := p.Int("level", DefaultCompressLevel)
+		return Compressor(Zlib, WithLevel(level)), err
+	})
+	RegisterProcessor("nop", func(Params) (Processor, error) {
+		return NopProcessor(), nil
+	})
+
+	RegisterMatcher("default", func(Params) (Matcher, error) {
+		return DefaultMatcher(), nil
+	})
+	RegisterMatcher("compress", func(p Params) (Matcher, error) {
+		format, err := p.String("format", string(Gzip))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := cfSuffix[CompressFormat(format)]; !ok {
+			return nil, fmt.Errorf("format: unsupported %q", format)
+		}
+		return CompressMatcher(CompressFormat(format)), nil
+	})
+	RegisterMatcher("any_format", func(Params) (Matcher, error) {
+		return AnyFormatMatcher(), nil
+	})
+	RegisterMatcher("regex", func(p Params) (Matcher, error) {
+		pattern, err := p.String("pattern", "")
+		if err != nil {
+			return nil, err
+		}
+		if pattern == "" {
+			return nil, errors.New("pattern: missing")
+		}
+		if _, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+		return NewRegexMatcher(pattern), nil
+	})
+}
+
+// ComponentSpec names a registered component and its parameters.
+type ComponentSpec struct {
+	Type   string `json:"type"`
+	Params Params `json:"params,omitempty"`
+}
+
+// Spec describes a Roll declaratively by the names of the registered components, eg. decoded from a config file:
+//
+//	{
+//		"file_path": "/var/log/app.log",
+//		"checkers": [{"type": "max_size", "params": {"size": "100MB"}}, {"type": "daily"}],
+//		"filters": [{"type": "max_backups", "params": {"count": 7}}],
+//		"processors": [{"type": "gzip"}]
+//	}
+//
+// The matcher follows the first processor if it is not given, AnyFormatMatcher for a compressor and DefaultMatcher otherwise.
+// The processor is DefaultProcessor if none is given, multiple ones are chained by ChainProcessor.
+type Spec struct {
+	FilePath   string          `json:"file_path"`
+	Checkers   []ComponentSpec `json:"checkers"`
+	Filters    []ComponentSpec `json:"filters,omitempty"`
+	Matcher    *ComponentSpec  `json:"matcher,omitempty"`
+	Processors []ComponentSpec `json:"processors,omitempty"`
+}
+
+// SpecFromMap converts a generic map to a Spec, eg. a section of a YAML or TOML config decoded to map[string]any.
+func SpecFromMap(m map[string]any) (Spec, error) {
+	var s Spec
+	b, err := json.Marshal(m)
+	if err != nil {
+		return s, fmt.Errorf("rollingf: invalid spec: %w", err)
+	}
+	if err = json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("rollingf: invalid spec: %w", err)
+	}
+	return s, nil
+}
+
+// Build creates the components of s from the registry and a Roll with them, the opts follow them and apply before start.
+func (s Spec) Build(opts ...Option) (*Roll, error) {
+	p := Pipeline()
+	for i, c := range s.Checkers {
+		checker, err := newChecker(c)
+		if err != nil {
+			return nil, specError("checkers", i, err)
+		}
+		p.Or(checker)
+	}
+	for i, c := range s.Filters {
+		filter, err := newFilter(c)
+		if err != nil {
+			return nil, specError("filters", i, err)
+		}
+		p.Filter(filter)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("rollingf: invalid spec: %w", err)
+	}
+
+	var processors []Processor
+	for i, c := range s.Processors {
+		processor, err := newProcessor(c)
+		if err != nil {
+			return nil, specError("processors", i, err)
+		}
+		processors = append(processors, processor)
+	}
+	if len(processors) == 0 {
+		processors = append(processors, DefaultProcessor())
+	}
+
+	matcher, err := s.matcher(processors[0])
+	if err != nil {
+		return nil, err
+	}
+
+	components := OptionFunc(func(r *Roll) {
+		r.WithChecker(p.checkers...).WithFilter(p.filters...).WithMatcher(matcher).WithProcessor(processors...)
+	})
+	r, err := NewCE(s.FilePath, append([]Option{components}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newChecker(c ComponentSpec) (Checker, error) {
+	f, err := lookup("checker", c.Type)
+	if err != nil {
+		return nil, err
+	}
+	return f.(CheckerFactory)(c.Params)
+}
+
+func newFilter(c ComponentSpec) (Filter, error) {
+	f, err := lookup("filter", c.Type)
+	if err != nil {
+		return nil, err
+	}
+	return f.(FilterFactory)(c.Params)
+}
+
+func newProcessor(c ComponentSpec) (Processor, error) {
+	f, err := lookup("processor", c.Type)
+	if err != nil {
+		return nil, err
+	}
+	return f.(ProcessorFactory)(c.Params)
+}
+
+func newMatcher(c ComponentSpec) (Matcher, error) {
+	f, err := lookup("matcher", c.Type)
+	if err != nil {
+		return nil, err
+	}
+	return f.(MatcherFactory)(c.Params)
+}
+
+// BuildMatcher creates the matcher of s from the registry like Build, eg. to find the backups by Inspect.
+func (s Spec) BuildMatcher() (Matcher, error) {
+	var first Processor
+	if len(s.Processors) > 0 {
+		var err error
+		if first, err = newProcessor(s.Processors[0]); err != nil {
+			return nil, specError("processors", 0, err)
+		}
+	}
+	return s.matcher(first)
+}
+
+// matcher creates the matcher of s, which follows the first processor if it is not given.
+func (s Spec) matcher(first Processor) (Matcher, error) {
+	if s.Matcher != nil {
+		m, err := newMatcher(*s.Matcher)
+		if err != nil {
+			return nil, specError("matcher", -1, err)
+		}
+		return m, nil
+	}
+	if _, ok := first.(*compressor); ok {
+		return AnyFormatMatcher(), nil
+	}
+	return DefaultMatcher(), nil
+}
+
+func specError(field string, i int, err error) error {
+	if i < 0 {
+		return fmt.Errorf("rollingf: invalid spec: %s: %w", field, err)
+	}
+	return fmt.Errorf("rollingf: invalid spec: %s[%d]: %w", field, i, err)
+}
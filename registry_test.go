@@ -0,0 +1,159 @@
+package rollingf
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpecBuild(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	var s Spec
+	err := json.Unmarshal([]byte(`{
+		"file_path": "`+fp+`",
+		"checkers": [{"type": "max_size", "params": {"size": "1KB"}}, {"type": "interval", "params": {"interval": "1d"}}],
+		"filters": [{"type": "max_backups", "params": {"count": 1}}],
+		"processors": [{"type": "gzip"}]
+	}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if th, _ := r.Checkers()[0].Threshold(); th != SizeKB {
+		t.Errorf("max size %d", th)
+	}
+	if th, _ := r.Checkers()[1].Threshold(); th != int64(DurOneDay) {
+		t.Errorf("interval %d", th)
+	}
+	if _, ok := r.matcher.(*indexMatcher); !ok || !r.matcher.Match("app.log.1.gz") {
+		t.Errorf("matcher %T", r.matcher)
+	}
+	if _, ok := r.processor.(*compressor); !ok {
+		t.Errorf("processor %T", r.processor)
+	}
+}
+
+func TestSpecBuildOptions(t *testing.T) {
+	mfs := NewMemFS()
+	s := Spec{
+		FilePath: "/mem/app.log",
+		Checkers: []ComponentSpec{{Type: "max_size", Params: Params{"size": 4}}},
+	}
+	// the options taking effect on start
+	r, err := s.Build(WithFS(mfs), WithWriteTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	if _, err := r.Write([]byte("large")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := mfs.ReadFile("/mem/app.log.1"); err != nil || string(b) != "large" {
+		t.Fatalf("%q %v", b, err)
+	}
+}
+
+func TestSpecFromMap(t *testing.T) {
+	s, err := SpecFromMap(map[string]any{
+		"file_path": "/var/log/app.log",
+		"checkers":  []any{map[string]any{"type": "daily"}},
+		"matcher":   map[string]any{"type": "regex", "params": map[string]any{"pattern": `\.\d+$`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Spec{
+		FilePath: "/var/log/app.log",
+		Checkers: []ComponentSpec{{Type: "daily"}},
+		Matcher:  &ComponentSpec{Type: "regex", Params: Params{"pattern": `\.\d+$`}},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestSpecErrors(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	for _, c := range []struct {
+		spec Spec
+		err  string
+	}{
+		{Spec{FilePath: fp}, "no checker"},
+		{Spec{FilePath: fp, Checkers: []ComponentSpec{{Type: "nope"}}}, `checkers[0]: unknown checker "nope"`},
+		{Spec{FilePath: fp, Checkers: []ComponentSpec{{Type: "max_size", Params: Params{"size": "1XB"}}}}, "invalid size"},
+		{Spec{FilePath: fp, Checkers: []ComponentSpec{{Type: "daily"}}, Filters: []ComponentSpec{{Type: "max_backups", Params: Params{"count": "x"}}}},
+			"filters[0]: count: want an integer"},
+		{Spec{FilePath: fp, Checkers: []ComponentSpec{{Type: "daily"}}, Matcher: &ComponentSpec{Type: "regex", Params: Params{"pattern": "("}}},
+			"matcher: pattern"},
+	} {
+		r, err := c.spec.Build()
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%+v: %v", c.spec, err)
+		}
+		if r != nil {
+			r.Close()
+		}
+	}
+}
+
+func TestRegisterChecker(t *testing.T) {
+	RegisterChecker("test_never", func(Params) (Checker, error) {
+		return MaxSizeChecker(0), nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories["checker"], "test_never")
+		factoriesMu.Unlock()
+	}()
+
+	found := false
+	for _, name := range Registered("checker") {
+		found = found || name == "test_never"
+	}
+	if !found {
+		t.Error(Registered("checker"))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registered twice")
+		}
+	}()
+	RegisterChecker("test_never", nil)
+}
+
+func TestSpecBuildMatcher(t *testing.T) {
+	for _, c := range []struct {
+		spec Spec
+		want Matcher
+	}{
+		{Spec{}, DefaultMatcher()},
+		{Spec{Processors: []ComponentSpec{{Type: "zlib"}}}, AnyFormatMatcher()},
+		{Spec{Matcher: &ComponentSpec{Type: "compress", Params: Params{"format": "gzip"}}}, CompressMatcher(Gzip)},
+	} {
+		m, err := c.spec.BuildMatcher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, c.want) {
+			t.Errorf("%+v: %#v, want %#v", c.spec, m, c.want)
+		}
+	}
+	if _, err := (Spec{Processors: []ComponentSpec{{Type: "bogus"}}}).BuildMatcher(); err == nil {
+		t.Error("unknown processor")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// renumberJournalName is the journal of the renames in progress, it is never matched as it starts with a dot.
+const renumberJournalName = ".{base}.renumber"
+
+// renameStep renames From to To in the file's directory.
+type renameStep struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// recoverer is implemented by the processors which finish their work interrupted by a crash, see Roll.recoverRolling.
+type recoverer interface {
+	recover(dir string) error
+}
+
+func journalPath(dir, base string) string {
+	return path.Join(dir, strings.ReplaceAll(renumberJournalName, "{base}", base))
+}
+
+// renumber renames the files by the steps in order, the later steps must not overwrite the earlier ones.
+//
+// The steps are checked before any rename, then persisted to the journal. So an interrupted renumbering is
+// finished by replayJournal, instead of leaving the gaps or two files named alike.
+func renumber(fsys FS, l *logs, dir, base string, steps []renameStep) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	fsys = fsOrDefault(fsys)
+	if err := checkSteps(fsys, dir, steps); err != nil {
+		return err
+	}
+	jp := journalPath(dir, base)
+	if err := writeJournal(fsys, jp, steps); err != nil {
+		return err
+	}
+	if err := runSteps(fsys, l, dir, steps); err != nil {
+		return err
+	}
+	return fsys.Remove(jp)
+}
+
+// orderSteps orders the steps so no file is renamed to the source of a step not done yet.
+func orderSteps(steps []renameStep) ([]renameStep, error) {
+	pending := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		pending[s.From] = true
+	}
+
+	ordered := make([]renameStep, 0, len(steps))
+	for len(steps) > 0 {
+		rest := steps[:0]
+		for _, s := range steps {
+			if pending[s.To] {
+				rest = append(rest, s)
+				continue
+			}
+			ordered = append(ordered, s)
+			delete(pending, s.From)
+		}
+		if len(rest) == len(steps) {
+			return nil, fmt.Errorf("rollingf: the renames of %s are cyclic", rest[0].From)
+		}
+		steps = rest
+	}
+	return ordered, nil
+}
+
+// checkSteps ensures every source exists, and no rename overwrites a file not renamed before.
+func checkSteps(fsys FS, dir string, steps []renameStep) error {
+	moved := make(map[string]bool, len(steps))
+	targets := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		if targets[s.To] {
+			return fmt.Errorf("rollingf: more than one file renamed to %s", s.To)
+		}
+		targets[s.To] = true
+
+		if _, err := fsys.Stat(path.Join(dir, s.From)); err != nil {
+			return err
+		}
+		_, err := fsys.Stat(path.Join(dir, s.To))
+		if err == nil && !moved[s.To] {
+			return fmt.Errorf("rollingf: renaming %s overwrites %s", s.From, s.To)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		moved[s.From] = true
+	}
+	return nil
+}
+
+// runSteps renames the files by the steps not done yet, so it can be replayed.
+//
+// The source of a step done is gone, unless a later step renamed another file to it. So the last step whose source
+// is gone is the last step done, and the steps before it are done too.
+func runSteps(fsys FS, l *logs, dir string, steps []renameStep) error {
+	start := 0
+	for j := len(steps) - 1; j >= 0; j-- {
+		_, err := fsys.Stat(path.Join(dir, steps[j].From))
+		if os.IsNotExist(err) {
+			start = j + 1
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range steps[start:] {
+		l.debug("[Rename] %v --> %v", s.From, s.To)
+		if err := fsys.Rename(path.Join(dir, s.From), path.Join(dir, s.To)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJournal writes the journal to a temporary file then renames it, so the journal is never torn.
+func writeJournal(fsys FS, jp string, steps []renameStep) error {
+	b, err := json.Marshal(steps)
+	if err != nil {
+		return err
+	}
+	tmp := jp + ".tmp"
+	f, err := fsys.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, jp)
+}
+
+// replayJournal finishes the renumbering interrupted, if any.
+func replayJournal(fsys FS, l *logs, dir, base string) error {
+	fsys = fsOrDefault(fsys)
+	jp := journalPath(dir, base)
+	// the journal torn was never acted on
+	if err := fsys.Remove(jp + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := fsys.OpenFile(jp, os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var steps []renameStep
+	if err = json.Unmarshal(b, &steps); err != nil {
+		return fmt.Errorf("rollingf: bad journal %s: %w", jp, err)
+	}
+	l.debug("[replayJournal] %d steps", len(steps))
+	if err = runSteps(fsys, l, dir, steps); err != nil {
+		return err
+	}
+	return fsys.Remove(jp)
+}
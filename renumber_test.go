@@ -0,0 +1,78 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestRenumberInterrupted(t *testing.T) {
+	// the renames: the journal, app.log.2, app.log.1, app.log
+	for k := 0; k < 4; k++ {
+		dir := t.TempDir()
+		for name, s := range map[string]string{"app.log": "0", "app.log.1": "1", "app.log.2": "2"} {
+			if err := os.WriteFile(path.Join(dir, name), []byte(s), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		remains, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ffs := newFaultFS()
+		ffs.failNext("rename", k, nil)
+		ffs.failNext("rename", 1, syscall.EIO)
+		p := DefaultProcessor()
+		p.Init("app.log")
+		p.setFS(ffs)
+		if err = p.Process(dir, remains); err == nil {
+			t.Fatal(k, "not interrupted")
+		}
+
+		// restart
+		p = DefaultProcessor()
+		p.Init("app.log")
+		if err = p.recover(dir); err != nil {
+			t.Fatal(k, err)
+		}
+
+		want := map[string]string{"app.log.1": "0", "app.log.2": "1", "app.log.3": "2"}
+		if k == 0 {
+			// interrupted before the journal, nothing renamed
+			want = map[string]string{"app.log": "0", "app.log.1": "1", "app.log.2": "2"}
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != len(want) {
+			t.Fatal(k, len(entries), "files")
+		}
+		for name, s := range want {
+			if b, err := os.ReadFile(path.Join(dir, name)); err != nil || string(b) != s {
+				t.Errorf("%d: %s: %q, want %q, %v", k, name, b, s, err)
+			}
+		}
+	}
+}
+
+func TestRenumberOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2"} {
+		if err := os.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// app.log.2 is not renamed, eg. it is filtered but failed to be removed
+	steps := []renameStep{{From: "app.log.1", To: "app.log.2"}, {From: "app.log", To: "app.log.1"}}
+	if err := renumber(nil, &logs{}, dir, "app.log", steps); err == nil {
+		t.Fatal("overwrote app.log.2")
+	}
+	if b, _ := os.ReadFile(path.Join(dir, "app.log.1")); string(b) != "app.log.1" {
+		t.Fatal("renamed before the check")
+	}
+
+	steps = []renameStep{{From: "app.log.2", To: "app.log.3"}, {From: "app.log.1", To: "app.log.3"}}
+	if err := renumber(nil, &logs{}, dir, "app.log", steps); err == nil {
+		t.Fatal("renamed two files to app.log.3")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// repeatSuppressor collapses the identical consecutive records.
+type repeatSuppressor struct {
+	window time.Duration
+
+	mu     sync.Mutex // held while the records passed are written, so the summaries keep the order
+	last   []byte
+	count  int // the repeats of last suppressed
+	timer  *time.Timer
+	closed bool
+}
+
+// SuppressRepeats collapses the identical consecutive records into a "last message repeated N times" record,
+// eg. an error loop, the way syslog does. The summary is written by the next different record, after window,
+// before the rolling or Close, so it always follows the repeated record in the same file.
+//
+// The repeats are counted after the interceptors, the tees get all of them.
+func SuppressRepeats(window time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		if window <= 0 {
+			r.repeats = nil
+			return
+		}
+		r.repeats = &repeatSuppressor{window: window}
+	})
+}
+
+// collapse returns the records to write instead of bs, the summaries included, s.mu must be held.
+func (s *repeatSuppressor) collapse(r *Roll, bs [][]byte) [][]byte {
+	out := make([][]byte, 0, len(bs))
+	for _, b := range bs {
+		if s.last != nil && bytes.Equal(b, s.last) {
+			s.count++
+			if s.timer == nil && !s.closed {
+				s.timer = time.AfterFunc(s.window, r.flushRepeatsLater)
+			}
+			continue
+		}
+		if sum := s.summary(); sum != nil {
+			out = append(out, sum)
+		}
+		s.last = append(s.last[:0], b...)
+		out = append(out, b)
+	}
+	return out
+}
+
+// summary returns the record of the repeats suppressed and resets the count, nil if none, s.mu must be held.
+func (s *repeatSuppressor) summary() []byte {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.count == 0 {
+		return nil
+	}
+	sum := []byte(fmt.Sprintf("last message repeated %d times\n", s.count))
+	s.count = 0
+	return sum
+}
+
+// flushRepeatsLater writes the summary after the window of SuppressRepeats.
+func (r *Roll) flushRepeatsLater() {
+	if err := r.lockFile(); err != nil {
+		return
+	}
+	defer r.fWUnlock()
+	if err := r.flushRepeats(false); err != nil {
+		r.warn("[flushRepeats] err: %v", err)
+	}
+}
+
+// flushRepeats writes the summary of the repeats suppressed to the current file, the lock of the file must be held.
+// The record repeated is forgotten if rolling, so the new file starts with it again.
+func (r *Roll) flushRepeats(rolling bool) error {
+	if r.repeats == nil || r.f == nil {
+		return nil
+	}
+	r.repeats.mu.Lock()
+	defer r.repeats.mu.Unlock()
+	sum := r.repeats.summary()
+	if rolling {
+		r.repeats.last = nil
+	}
+	if sum == nil {
+		return nil
+	}
+	n, err := r.writeFile(r.frame(sum))
+	r.st.update(int64(n))
+	return err
+}
+
+// persist writes the intercepted records to the file, framed and with the repeats collapsed,
+// the lock of the file must be held.
+func (r *Roll) persist(bs ...[]byte) (int, error) {
+	if r.repeats != nil {
+		r.repeats.mu.Lock()
+		defer r.repeats.mu.Unlock()
+		bs = r.repeats.collapse(r, bs)
+	}
+	switch len(bs) {
+	case 0:
+		return 0, nil
+	case 1:
+		return r.writeFile(r.frame(bs[0]))
+	}
+	size := 0
+	for _, b := range bs {
+		size += len(b)
+	}
+	// the framing may grow the records, the capacity covers the plain ones
+	buf := make([]byte, 0, size)
+	for _, b := range bs {
+		buf = append(buf, r.frame(b)...)
+	}
+	return r.writeFile(buf)
+}
+
+// closeRepeats writes the summary left and stops the timer, the lock of the file must be held.
+func (r *Roll) closeRepeats() {
+	if r.repeats == nil {
+		return
+	}
+	if err := r.flushRepeats(false); err != nil {
+		r.warn("[Close] repeats err: %v", err)
+	}
+	r.repeats.mu.Lock()
+	r.repeats.closed = true
+	r.repeats.mu.Unlock()
+}
@@ -0,0 +1,38 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSuppressRepeats(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), SuppressRepeats(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		r.Write([]byte("err\n"))
+	}
+	r.WriteBatch([][]byte{[]byte("err\n"), []byte("ok\n"), []byte("ok\n")})
+	// the summary is written before the rolling
+	r.MarkRotate()
+	r.Write([]byte("ok\n"))
+	r.Write([]byte("ok\n"))
+	time.Sleep(200 * time.Millisecond)
+	r.Write([]byte("ok\n"))
+	r.Write([]byte("end\n"))
+	r.Write([]byte("end\n"))
+	r.Close()
+
+	for name, want := range map[string]string{
+		"app.log.1": "err\nlast message repeated 3 times\nok\nlast message repeated 1 times\n",
+		"app.log":   "ok\nlast message repeated 1 times\nlast message repeated 1 times\nend\nlast message repeated 1 times\n",
+	} {
+		if b, err := os.ReadFile(path.Join(path.Dir(fp), name)); err != nil || string(b) != want {
+			t.Errorf("%s: %q, want %q, %v", name, b, want, err)
+		}
+	}
+}
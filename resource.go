@@ -0,0 +1,85 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Resource describes where the files are written, the unknown fields are left empty.
+type Resource struct {
+	Hostname    string `json:"hostname,omitempty"`
+	BootID      string `json:"boot_id,omitempty"`
+	ContainerID string `json:"container_id,omitempty"`
+	PID         int    `json:"pid,omitempty"`
+}
+
+var (
+	resourceOnce sync.Once
+	resource     Resource
+
+	// the id is the last element of the cgroup paths of docker, containerd and kubepods, eg.
+	//	/docker/<id>, /system.slice/docker-<id>.scope, /kubepods/besteffort/pod<uid>/<id>,
+	//	/kubepods.slice/kubepods-pod<uid>.slice/cri-containerd-<id>.scope,
+	// or of the files docker mounts into the container, eg. /var/lib/docker/containers/<id>/hostname.
+	containerIDReg = regexp.MustCompile(`(?:/docker/(?:containers/)?|/docker-|/containerd/|/cri-containerd-|` +
+		`/kubepods[^\s]*/(?:docker-|cri-containerd-|crio-)?)([0-9a-f]{64})(?:\.scope)?(?:/|\s|$)`)
+)
+
+// DetectResource detects the host and container metadata once, the result is cached.
+func DetectResource() Resource {
+	resourceOnce.Do(func() {
+		resource.Hostname, _ = os.Hostname()
+		resource.PID = os.Getpid()
+		if b, err := os.ReadFile("/proc/sys/kernel/random/boot_id"); err == nil {
+			resource.BootID = strings.TrimSpace(string(b))
+		}
+		resource.ContainerID = detectContainerID()
+		debug("[DetectResource] %+v", resource)
+	})
+	return resource
+}
+
+// detectContainerID looks for the container id in the cgroup paths and the mounts of the process.
+func detectContainerID() string {
+	for _, file := range []string{"/proc/self/cgroup", "/proc/self/mountinfo"} {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			if id := parseContainerID(scan.Text()); id != "" {
+				f.Close()
+				return id
+			}
+		}
+		f.Close()
+	}
+	return ""
+}
+
+// parseContainerID returns the container id in a line of /proc/self/cgroup or /proc/self/mountinfo, empty if none.
+func parseContainerID(line string) string {
+	if m := containerIDReg.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package rollingf
+
+import "testing"
+
+func TestParseContainerID(t *testing.T) {
+	const id = "4f9c1a7e2b3d5c6e8f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e"
+	for _, c := range []struct {
+		line string
+		want string
+	}{
+		// docker
+		{"12:memory:/docker/" + id, id},
+		{"0::/system.slice/docker-" + id + ".scope", id},
+		{"612 601 0:150 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw,relatime - ext4 /dev/sda1 rw", id},
+		// containerd
+		{"0::/system.slice/containerd.service/default/containerd/" + id, id},
+		{"0::/system.slice/cri-containerd-" + id + ".scope", id},
+		// kubepods
+		{"11:cpu:/kubepods/besteffort/pod2b7a5c32-1f4e-4d29-9e2c-b3f1c9a1e0d7/" + id, id},
+		{"0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod2b7a5c32.slice/cri-containerd-" + id + ".scope", id},
+		{"0::/kubepods.slice/kubepods-pod2b7a5c32.slice/crio-" + id + ".scope", id},
+		// not of a container
+		{"0::/user.slice/user-1000.slice/session-" + id + ".scope", ""},
+		{"586 585 0:52 / /sys/fs/cgroup rw,nosuid - cgroup2 cgroup2 rw", ""},
+		{"700 601 253:0 /var/lib/app/" + id + " /data rw - ext4 /dev/mapper/data rw", ""},
+		{"12:memory:/docker/" + id + "0", ""},
+		{"12:memory:/docker/" + id[:63], ""},
+	} {
+		if got := parseContainerID(c.line); got != c.want {
+			t.Fatalf("%s: %q != %q", c.line, got, c.want)
+		}
+	}
+}
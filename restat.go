@@ -0,0 +1,56 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "time"
+
+// RefreshStat stats the opened file before the checks, at most once every interval, or before every check if interval <= 0,
+// so the checkers see the bytes appended by the other processes, eg. a MaxSizeChecker on a file shared with a shell script.
+//
+// The size only grows by the refresh, the writes still buffered are counted until they are flushed.
+// The truncations are left to WatchFile.
+func RefreshStat(interval time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		r.restat = &restatter{every: interval}
+	})
+}
+
+type restatter struct {
+	every time.Duration
+	last  time.Time // only the checking goroutine touches it
+}
+
+// refreshStat takes the size of the file on disk if it is larger than the size counted.
+// The caller holds the write lock.
+func (r *Roll) refreshStat() {
+	if r.restat == nil || r.f == nil {
+		return
+	}
+	now := r.now()
+	if r.restat.every > 0 && now.Sub(r.restat.last) < r.restat.every {
+		return
+	}
+	r.restat.last = now
+
+	info, err := r.f.Stat()
+	if err != nil {
+		r.warn("[refreshStat] err: %v", err)
+		return
+	}
+	if info.Size() > r.st.Size() {
+		r.debug("[refreshStat] size %d -> %d", r.st.Size(), info.Size())
+		r.st.refresh(info.Size())
+	}
+}
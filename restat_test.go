@@ -0,0 +1,32 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRefreshStat(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 10, 0, 2), RefreshStat(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// another process appends to the file
+	f, err := os.OpenFile(fp, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("0123456789"))
+	f.Close()
+
+	rolling, reason, err := r.checkChain(r.nextCycle())
+	if err != nil || !rolling {
+		t.Fatal(rolling, reason, err)
+	}
+	if r.st.Size() != 10 {
+		t.Errorf("size %d", r.st.Size())
+	}
+}
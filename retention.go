@@ -0,0 +1,36 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"time"
+)
+
+// WithRetentionInterval runs the filters over the backups every d in background, see Roll.Purge,
+// so the idle services still remove the old backups. Default the filters only run when rolling.
+func WithRetentionInterval(d time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		r.retention = d
+	})
+}
+
+// sweep purges the backups, every r.retention until Close.
+func (r *Roll) sweep() {
+	r.debug("[sweep]")
+	if err := r.Purge(context.Background()); err != nil && err != ErrClosed {
+		r.warn("[sweep] err: %v", err)
+	}
+}
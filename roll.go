@@ -15,14 +15,17 @@
 package rollingf
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
-	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var _ io.WriteCloser = (*Roll)(nil)
@@ -31,19 +34,75 @@ type Roll struct {
 	filePath    string
 	tmpFilePath string
 
-	checkers  []Checker
-	filters   []Filter
-	matcher   Matcher
-	processor Processor
-
-	f        *os.File
-	st       *Rstat
-	rwmu     *sync.RWMutex
-	rotateCh chan struct{}
-	checkCh  chan struct{}
+	checkers       []Checker
+	checkerHandles []*Handle // the handles of checkers, by index
+	filters        []Filter
+	filtersMu      sync.Mutex
+	filterHandles  []*Handle // the handles of filters, by index, guarded by filtersMu
+	matcher        Matcher
+	sorter         Sorter
+	processor      Processor
+	namer          Namer
+	interceptors   []WriteInterceptor
+	rotateHooks    []func(context.Context, RotateEvent)
+	removeHooks    []func(FilterResult)
+	errorsPolicy   ErrorsPolicy
+	stats          rollStats
+	adaptive       *adaptiveCheck
+	loc            *time.Location
+	jitter         time.Duration
+	clock          Clock
+	maxMatched     int
+	coordinator    Coordinator
+	symlink        string
+	state          *stateStore
+	async          *asyncWriter
+	timeout        *timeoutWriter
+	fallback       *fallbackWriter
+	tees           *teeWriters
+	mbuf           *mmapBuffer
+	mbufEvery      time.Duration
+	stdio          *stdioCapture
+	tails          *tailers
+	retention      time.Duration
+	idle           *idleWatcher
+	events         *eventBus
+	tracer         Tracer
+	marker         []byte
+	recordFormat   RecordFormat
+	shard          bool // ShardByDate
+	gzActive       bool // CompressActive
+	gzFlush        time.Duration
+	watchEvery     time.Duration // WatchFile
+	restat         *restatter
+	repeats        *repeatSuppressor
+	flock          bool
+	lockf          File // the lock file of WithFlock
+	shared         *sharedLock
+	renameReopen   bool
+	cycles         uint64 // atomic, the ID of the last check cycle
+
+	fs         FS
+	f          File
+	st         *Rstat
+	quiet      bool // the Roll receiving the debug output must not debug itself
+	rwmu       *sync.RWMutex
+	rotateCh   chan struct{}
+	checkCh    chan struct{}
+	manual     bool       // the checks run by CheckNow only, see ManualCheck
+	checkMu    sync.Mutex // one check at a time, see CheckNow
+	inflight   inflight   // the rollings not yet processed
+	pending    pending    // the rolling deferred while the last one is in progress
+	sched      *Scheduler
+	logger     Logger
+	checkState int32           // by sched
+	closed     chan struct{}   // closed by Close, once it holds rotateCh
+	ctx        context.Context // done by Close or the deadline of Shutdown, cancels the rolling
+	cancel     context.CancelFunc
+	stopping   int32 // atomic, set by Close until Reopen, the writes are refused
 }
 
-// NewC creates a customizable Roll
+// NewC creates a customizable Roll, it returns nil on error, see NewCE for the error.
 //
 // The following components need to be populated:
 //   - Checker
@@ -51,27 +110,50 @@ type Roll struct {
 //   - Filter
 //   - Processor
 func NewC(filePath string, opts ...Option) *Roll {
-	r := baseR(filePath)
-	if r == nil {
+	r, err := NewCE(filePath, opts...)
+	if err != nil {
+		debug("[NewRoll] %v", err)
 		return nil
 	}
+	return r
+}
 
-	return r.WithOptions(opts...)
+// NewCE is NewC returning the error, eg. the permission is denied or the directory is missing.
+func NewCE(filePath string, opts ...Option) (*Roll, error) {
+	r := baseR(filePath).WithOptions(opts...)
+	if err := r.start(); err != nil {
+		return nil, fmt.Errorf("rollingf: %w", err)
+	}
+	return r, nil
 }
 
-// New roll creates a Roll with default components
+// New roll creates a Roll with default components, it returns nil on error, see NewE for the error.
 func New(c RollConf, opts ...Option) *Roll {
-	r := baseR(c.FilePath)
-	if r == nil {
+	r, err := NewE(c, opts...)
+	if err != nil {
+		debug("[NewRoll] %v", err)
 		return nil
 	}
+	return r
+}
+
+// NewE is New returning the error, eg. the RollConf is invalid or the file cannot be opened.
+func NewE(c RollConf, opts ...Option) (*Roll, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	r := baseR(c.FilePath)
 
 	r = r.WithDefaultChecker(c.RollCheckerConf)
 	r = r.WithDefaultFilter(c.RollFilterConf)
 	r = r.WithDefaultMatcher()
 	r = r.WithDefaultProcessor()
 
-	return r.WithOptions(opts...)
+	r = r.WithOptions(opts...)
+	if err := r.start(); err != nil {
+		return nil, fmt.Errorf("rollingf: %w", err)
+	}
+	return r, nil
 }
 
 func baseR(filePath string) *Roll {
@@ -80,20 +162,93 @@ func baseR(filePath string) *Roll {
 		rwmu:     &sync.RWMutex{},
 		rotateCh: make(chan struct{}, 1),
 		checkCh:  make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		events:   &eventBus{},
 		st:       &Rstat{},
+		fs:       newFileSystem(path.Dir(filePath)),
 	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.setTmpFile("", defaultTmpName)
+	return r
+}
 
+// start opens the file and starts the background checking, after the options are applied.
+func (r *Roll) start() (err error) {
+	if err = r.ensureDir(); err != nil {
+		return err
+	}
+	if err = r.acquireFlock(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			r.releaseFlock()
+		}
+	}()
+	if err = r.openShared(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			r.closeShared()
+		}
+	}()
+	if err = r.recoverRolling(); err != nil {
+		return err
+	}
 	if err := r.Open(); err != nil {
-		debug("[NewRoll] %v", err)
-		return nil
+		return err
+	}
+	if err := r.linkFile(); err != nil {
+		r.closeFile()
+		return err
+	}
+	if err := r.loadState(); err != nil {
+		r.closeFile()
+		return err
+	}
+	if err := r.startBuffer(); err != nil {
+		r.closeFile()
+		return err
+	}
+	if r.async != nil {
+		go r.async.run(r)
+	}
+	if r.timeout != nil {
+		go r.timeout.run()
+	}
+	if r.retention > 0 {
+		r.every(r.retention, r.sweep)
+	}
+	if r.gzActive && r.gzFlush > 0 {
+		r.every(r.gzFlush, r.flushActive)
+	}
+	if r.watchEvery > 0 {
+		go r.watchFile()
+	}
+	if r.idle != nil {
+		r.idle.touch(r.now())
+		r.every(r.idleEvery(), r.watchIdle)
 	}
 
-	go r.checkAndRoll()
+	if r.sched == nil && !r.manual {
+		go r.checkAndRoll(r.closed)
+	}
+	return nil
+}
 
-	dir, base := path.Split(filePath)
-	r.tmpFilePath = dir + "_" + base
+const defaultTmpName = "_{base}"
 
-	return r
+// setTmpFile sets the temporary file to tmpDir/tmpName, "{base}" in tmpName is replaced by the file's base name.
+func (r *Roll) setTmpFile(tmpDir, tmpName string) {
+	dir, base := path.Split(r.filePath)
+	if tmpDir == "" {
+		tmpDir = dir
+	}
+	if tmpName == "" {
+		tmpName = defaultTmpName
+	}
+	r.tmpFilePath = path.Join(tmpDir, strings.ReplaceAll(tmpName, "{base}", base))
 }
 
 func (r *Roll) WithDefaultChecker(c RollCheckerConf) *Roll {
@@ -116,27 +271,221 @@ func (r *Roll) WithDefaultProcessor() *Roll {
 	return r
 }
 
+// Validate reports the first misconfiguration of the component chain with an actionable message,
+// eg. the matcher never matches the backups produced by the processor.
+func (r *Roll) Validate() error {
+	if len(r.checkers) == 0 {
+		return errors.New("rollingf: no checker, the file will never roll, see WithChecker")
+	}
+	if r.matcher == nil && r.processor != nil {
+		return errors.New("rollingf: no matcher, the processor never runs, see WithMatcher")
+	}
+	if r.matcher != nil && r.processor == nil {
+		return errors.New("rollingf: no processor, the writes stay in the temporary file after rolling, see WithProcessor")
+	}
+	if bn, ok := r.processor.(backupNamer); ok {
+		base := path.Base(r.filePath)
+		for _, name := range bn.backupNames(base) {
+			if !r.matcher.Match(name) {
+				return fmt.Errorf("rollingf: the matcher %T never matches the backup %s of the processor %T, "+
+					"the backups are never filtered, see Compress and Naming", r.matcher, name, r.processor)
+			}
+		}
+	}
+	if r.maxMatched < 0 {
+		return fmt.Errorf("rollingf: MaxMatchedFiles must not be negative, got %d", r.maxMatched)
+	}
+	return nil
+}
+
+// UpdateConf replaces the checkers and filters by the default ones of c while the writes continue,
+// eg. to change the retention of a long-running daemon without restarting.
+//
+// The customized checkers and filters are replaced too, the rolling in progress finishes with the old filters.
+// The file path cannot be changed, an empty FilePath means the current one.
+func (r *Roll) UpdateConf(c RollConf) error {
+	if c.FilePath != "" && path.Clean(c.FilePath) != path.Clean(r.filePath) {
+		return fmt.Errorf("rollingf: UpdateConf cannot change the file path %s to %s", r.filePath, c.FilePath)
+	}
+
+	checkers := DefaultChecker(c.RollCheckerConf)
+	for _, checker := range checkers {
+		r.setup(checker)
+	}
+	filters := DefaultFilter(c.RollFilterConf)
+	for _, filter := range filters {
+		r.initFilter(filter)
+	}
+
+	r.fOpLock()
+	defer r.fOpUnlock()
+	r.debug("[UpdateConf] %+v", c)
+	r.checkers = checkers
+	r.checkerHandles = checkerHandles(checkers)
+	r.filtersMu.Lock()
+	r.filters = filters
+	r.filterHandles = filterHandles(filters)
+	r.filtersMu.Unlock()
+	return nil
+}
+
 func (r *Roll) WithChecker(c ...Checker) *Roll {
+	for _, checker := range c {
+		r.setup(checker)
+	}
+
+	r.fOpLock()
+	defer r.fOpUnlock()
 	r.checkers = append(r.checkers, c...)
+	r.checkerHandles = append(r.checkerHandles, checkerHandles(c)...)
 	return r
 }
 
+// WithCheckerV2 appends the checkers, they run after the ones appended before in order.
+func (r *Roll) WithCheckerV2(c ...CheckerV2) *Roll {
+	checkers := make([]Checker, 0, len(c))
+	for _, checker := range c {
+		if a, ok := checker.(*v1Checker); ok {
+			checkers = append(checkers, a.c)
+		} else {
+			checkers = append(checkers, &v2Checker{c: checker})
+		}
+	}
+	return r.WithChecker(checkers...)
+}
+
 func (r *Roll) WithFilter(f ...Filter) *Roll {
+	for _, filter := range f {
+		r.initFilter(filter)
+	}
+
+	r.filtersMu.Lock()
+	defer r.filtersMu.Unlock()
 	r.filters = append(r.filters, f...)
+	r.filterHandles = append(r.filterHandles, filterHandles(f)...)
 	return r
 }
 
+// WithFilterV2 appends the filters, they run after the ones appended before in order.
+func (r *Roll) WithFilterV2(f ...FilterV2) *Roll {
+	filters := make([]Filter, 0, len(f))
+	for _, filter := range f {
+		if v1, ok := filter.(Filter); ok {
+			filters = append(filters, v1)
+		} else {
+			filters = append(filters, &v2Filter{FilterV2: filter})
+		}
+	}
+	return r.WithFilter(filters...)
+}
+
+func (r *Roll) initFilter(f Filter) {
+	if i, ok := f.(interface{ Init(base string) }); ok {
+		i.Init(path.Base(r.filePath))
+	}
+	r.setup(f)
+}
+
+// WithLocation computes the calendar boundaries in loc for all the checkers and filters, eg. time.UTC.
+func (r *Roll) WithLocation(loc *time.Location) *Roll {
+	r.loc = loc
+	r.setupAll()
+	return r
+}
+
+// setup applies the Roll's settings to the component.
+func (r *Roll) setup(component any) {
+	if ls, ok := component.(locationSetter); ok && r.loc != nil {
+		ls.setLocation(r.loc)
+	}
+	if js, ok := component.(jitterSetter); ok {
+		js.setJitter(r.jitter)
+	}
+	if ls, ok := component.(loggerSetter); ok && r.logger != nil {
+		ls.setLogger(r.logger)
+	}
+	if cs, ok := component.(clockSetter); ok && r.clock != nil {
+		cs.setClock(r.clock)
+	}
+	if fss, ok := component.(fsSetter); ok {
+		fss.setFS(r.fs)
+	}
+	if es, ok := component.(emitterSetter); ok {
+		es.setEmitter(r.emit)
+	}
+	if ts, ok := component.(tracerSetter); ok && r.tracer != nil {
+		ts.setTracer(r.tracer)
+	}
+	if w, ok := component.(wrapper); ok {
+		r.setup(w.unwrap())
+	}
+}
+
+// wrapper is implemented by the components wrapping another one, which is set up by the Roll too.
+type wrapper interface {
+	unwrap() any
+}
+
+// setupAll applies the Roll's settings to all the components.
+func (r *Roll) setupAll() {
+	r.setup(r.fs)
+	r.setup(r.processor)
+	for _, c := range r.checkers {
+		r.setup(c)
+	}
+	for _, f := range r.filters {
+		r.setup(f)
+	}
+}
+
 func (r *Roll) WithMatcher(m Matcher) *Roll {
 	m.Init(path.Base(r.filePath))
 	r.matcher = m
 	return r
 }
 
-func (r *Roll) WithProcessor(p Processor) *Roll {
+// WithSorter sets the order of the matched files, NumericSorter by default.
+func (r *Roll) WithSorter(s Sorter) *Roll {
+	s.Init(path.Base(r.filePath))
+	r.sorter = s
+	return r
+}
+
+// WithProcessor sets the processor, multiple processors are chained by ChainProcessor.
+func (r *Roll) WithProcessor(ps ...Processor) *Roll {
+	if len(ps) == 0 {
+		return r
+	}
+	p := ps[0]
+	if len(ps) > 1 {
+		p = ChainProcessor(ps...)
+	}
+	if c, ok := p.(*chainProcessor); ok {
+		c.rematch = func(dir string) ([]os.DirEntry, error) {
+			if r.matcher == nil {
+				return nil, nil
+			}
+			return r.matchFiles(dir)
+		}
+	}
+
+	r.setup(p)
+	if i, ok := p.(interface{ Init(base string) }); ok {
+		i.Init(path.Base(r.filePath))
+	}
+	if ns, ok := p.(namerSetter); ok && r.namer != nil {
+		ns.setNamer(r.namer)
+	}
 	r.processor = p
 	return r
 }
 
+// WithInterceptor appends interceptors that rewrite the payload before it is written, in order.
+func (r *Roll) WithInterceptor(i ...WriteInterceptor) *Roll {
+	r.interceptors = append(r.interceptors, i...)
+	return r
+}
+
 func (r *Roll) WithOptions(opts ...Option) *Roll {
 	for _, opt := range opts {
 		opt.apply(r)
@@ -151,21 +500,123 @@ func (r *Roll) WithOptions(opts ...Option) *Roll {
 //  3. Then the filtered files will be removed.
 //  4. Finally the remains will be rolled.
 func (r *Roll) Write(p []byte) (n int, err error) {
-	debug("[Write]")
+	if atomic.LoadInt32(&r.stopping) != 0 {
+		return 0, ErrClosed
+	}
+	if r.async != nil {
+		return r.writeAsync([][]byte{p})
+	}
+	return r.deliver([][]byte{p})
+}
+
+// deliver writes the records to the file, or the fallback sink if the file fails.
+func (r *Roll) deliver(records [][]byte) (int, error) {
+	if r.fallback != nil {
+		return r.fallback.write(r, records)
+	}
+	return r.writeRecords(records)
+}
+
+// writeRecords writes the records to the file in the timeout if any, the RotateMarker records roll the file.
+func (r *Roll) writeRecords(records [][]byte) (int, error) {
+	if r.marker != nil {
+		return r.writeMarked(records)
+	}
+	return r.writeUnmarked(records)
+}
+
+func (r *Roll) writeUnmarked(records [][]byte) (int, error) {
+	if r.timeout != nil {
+		return r.writeTimeout(records)
+	}
+	if len(records) == 1 {
+		return r.write(records[0])
+	}
+	return r.writeBatch(records)
+}
+
+func (r *Roll) write(p []byte) (n int, err error) {
+	r.debug("[Write] [cycle #%d]", r.nextCycle())
 	// r.Lock()
 	// defer r.Unlock()
 
-	r.fWLock()
+	if err := r.lockFile(); err != nil {
+		return 0, err
+	}
+	defer r.fWUnlock()
+
+	b := r.intercept(p)
+	re, err := r.persist(b)
+	r.tee(b)
+	if err != nil {
+		return 0, err
+	}
+
+	r.st.update(int64(re))
+	if r.shouldCheck() {
+		r.signalCheck()
+	}
+	return len(p), nil
+}
+
+// WriteBatch writes the records in one call, the lock is acquired and the stat is updated only once.
+//
+// The records are never split by a rolling, all of them are written to the same file.
+// It returns the total length of the records written.
+func (r *Roll) WriteBatch(records [][]byte) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if atomic.LoadInt32(&r.stopping) != 0 {
+		return 0, ErrClosed
+	}
+	if r.async != nil {
+		return r.writeAsync(records)
+	}
+	return r.deliver(records)
+}
+
+func (r *Roll) writeBatch(records [][]byte) (int, error) {
+	r.debug("[WriteBatch] [cycle #%d] %d", r.nextCycle(), len(records))
+
+	if err := r.lockFile(); err != nil {
+		return 0, err
+	}
 	defer r.fWUnlock()
 
-	re, err := r.f.Write(p)
+	var n, size int
+	bs := make([][]byte, len(records))
+	for i, p := range records {
+		bs[i] = r.intercept(p)
+		n += len(p)
+		size += len(bs[i])
+	}
+
+	re, err := r.persist(bs...)
+	if r.tees != nil {
+		buf := make([]byte, 0, size)
+		for _, b := range bs {
+			buf = append(buf, b...)
+		}
+		r.tee(buf)
+	}
 	if err != nil {
 		return 0, err
 	}
 
 	r.st.update(int64(re))
-	go r.checkOnce()
-	return re, nil
+	if r.shouldCheck() {
+		r.signalCheck()
+	}
+	return n, nil
+}
+
+// intercept rewrites p by the interceptors in order.
+func (r *Roll) intercept(p []byte) []byte {
+	for _, i := range r.interceptors {
+		p = i.Intercept(p)
+	}
+	return p
 }
 
 func (r *Roll) Open() error {
@@ -173,191 +624,603 @@ func (r *Roll) Open() error {
 	if err != nil {
 		return err
 	}
-	return r.st.reset(r.filePath)
+	return r.resetStat()
 }
 
-func (r *Roll) openFile(filePath string) error {
-	debug("[openFile] %v", filePath)
-
-	var err error
-	r.f, err = os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+// resetStat resets the stat to the file on disk.
+func (r *Roll) resetStat() error {
+	r.debug("[reset]")
+	info, err := r.fs.Stat(r.filePath)
 	if err != nil {
 		return err
 	}
+	r.st.reset(info)
+	return nil
+}
 
+func (r *Roll) openFile(filePath string) error {
+	f, err := r.createFile(filePath)
+	if err != nil {
+		return err
+	}
+	r.f = f
 	return nil
 }
 
+func (r *Roll) createFile(filePath string) (File, error) {
+	r.debug("[openFile] %v", filePath)
+	f, err := r.fs.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil || !r.gzActive {
+		return f, err
+	}
+	return newGzipFile(f), nil
+}
+
+// Close closes the file, the Roll can be revived by Reopen. The writes and the second Close return ErrClosed.
+//
+// The compressions in progress are cancelled, so are the ContextProcessor, ContextFilter
+// and the hooks by OnRotateContext, Close waits for the rest of the rolling. The rolling cancelled is finished by the next start.
 func (r *Roll) Close() error {
+	r.cancel()
+	_, err := r.close(context.Background())
+	return err
+}
+
+// withRollContext returns a ctx which is also done by Close or the deadline of Shutdown.
+func (r *Roll) withRollContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// close closes the file, the records queued by NonBlocking are written until ctx is done, the bytes left are returned.
+func (r *Roll) close(ctx context.Context) (pending int64, err error) {
+	if !atomic.CompareAndSwapInt32(&r.stopping, 0, 1) {
+		return 0, ErrClosed
+	}
+	if r.async != nil {
+		pending = r.async.closeContext(ctx)
+	}
+	if r.timeout != nil {
+		r.timeout.close()
+	}
 	r.fOpLock()
 	defer r.fOpUnlock()
 	r.rotateCh <- struct{}{}
-	debug("[Close]")
+	close(r.closed)
+	r.cancel()
+	defer r.releaseFlock()
+	defer r.closeShared()
+	r.debug("[Close]")
+	r.closeRepeats()
+	r.saveState()
+
+	if r.mbuf != nil {
+		// the buffer left is recovered by the next start
+		if err := r.flushBuffer(); err != nil {
+			r.warn("[Close] flush err: %v", err)
+		}
+		if err := r.mbuf.close(); err != nil {
+			r.warn("[Close] buffer err: %v", err)
+		}
+	}
+
+	r.tails.close()
+	r.events.close()
+	if r.stdio != nil {
+		r.stdio.restore()
+		r.stdio = nil
+	}
+	// opened again by Reopen
+	if err := closeDir(r.fs); err != nil {
+		r.warn("[Close] directory err: %v", err)
+	}
 
+	if r.f == nil {
+		// closed for idling
+		return pending, nil
+	}
 	if err := r.closeFile(); err != nil {
-		return err
+		return pending, err
 	}
 	r.f = nil
-	return nil
+	return pending, nil
 }
 
 func (r *Roll) closeFile() error {
-	debug("[closeFile]")
+	r.debug("[closeFile]")
 	return r.f.Close()
 }
 
-func (r *Roll) checkOnce() {
+// signalCheck wakes up the checking goroutine without blocking, the writes meanwhile are checked at once.
+func (r *Roll) signalCheck() {
+	if r.manual {
+		return
+	}
+	if r.sched != nil {
+		r.scheduleCheck()
+		return
+	}
 	select {
 	case r.checkCh <- struct{}{}:
-		r.checkAndRoll()
 	default:
 	}
 }
 
-func (r *Roll) checkAndRoll() {
-	for range r.checkCh {
-		rolling, err := r.checkChain()
-		if err != nil {
-			debug("[checkAndRoll] [check] err: %v", err)
+// checkAndRoll runs the checks signaled by the writes until closed is closed, one at a time.
+func (r *Roll) checkAndRoll(closed <-chan struct{}) {
+	for {
+		select {
+		case <-closed:
+			return
+		case <-r.checkCh:
 		}
+		r.checkOnce()
+	}
+}
 
-		if rolling {
-			if err = r.roll(); err != nil {
-				debug("[checkAndRoll] [check] err: %v", err)
-			}
+// checkOnce runs the checkers and rolls if any of them triggers.
+func (r *Roll) checkOnce() {
+	r.checkMu.Lock()
+	defer r.checkMu.Unlock()
+	if r.shared != nil {
+		r.followShared()
+	}
+	id := atomic.AddUint64(&r.cycles, 1)
+	rolling, reason, err := r.checkChain(id)
+	if err != nil {
+		r.warn("[checkAndRoll] [cycle #%d] [check] err: %v", id, err)
+	}
+	if r.adaptive != nil {
+		r.adaptive.checked(rolling)
+	}
+
+	if rolling {
+		if err = r.rollCycle(id, reason); err != nil {
+			r.warn("[checkAndRoll] [cycle #%d] err: %v", id, err)
 		}
 	}
 }
 
-func (r *Roll) roll() error {
+// CheckNow runs the checkers at once instead of after the writes, and rolls if any of them triggers.
+// It waits for the rollings in progress before the checks, and for the processing of its rolling and
+// the OnRotate hooks after, so the backups are final when it returns, eg. in the tests, see the rollingtest package.
+// It returns whether it rolled.
+func (r *Roll) CheckNow() (bool, error) {
+	r.inflight.wait()
+	r.checkMu.Lock()
+	if r.shared != nil {
+		r.followShared()
+	}
+	id := atomic.AddUint64(&r.cycles, 1)
+	rolling, reason, err := r.checkChain(id)
+	if err == nil && rolling {
+		err = r.rotate(id, reason, true)
+	}
+	r.checkMu.Unlock()
+	r.inflight.wait()
+	return rolling && err == nil, err
+}
+
+// inflight counts the rollings started and not yet processed.
+type inflight struct {
+	mu   sync.Mutex
+	n    int
+	cond *sync.Cond
+}
+
+func (f *inflight) add() {
+	f.mu.Lock()
+	f.n++
+	f.mu.Unlock()
+}
+
+func (f *inflight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 && f.cond != nil {
+		f.cond.Broadcast()
+	}
+}
+
+// wait blocks until no rolling is in flight.
+func (f *inflight) wait() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cond == nil {
+		f.cond = sync.NewCond(&f.mu)
+	}
+	for f.n > 0 {
+		f.cond.Wait()
+	}
+}
+
+// pending is the reason of the rolling deferred by rotate, the deferrals meanwhile make one rolling.
+type pending struct {
+	mu     sync.Mutex
+	ok     bool
+	reason string
+}
+
+func (p *pending) set(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.ok {
+		p.ok, p.reason = true, reason
+	}
+}
+
+func (p *pending) take() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reason, ok := p.reason, p.ok
+	p.ok, p.reason = false, ""
+	return reason, ok
+}
+
+// releaseRotate releases rotateCh, and rolls in background if a rolling was deferred meanwhile.
+func (r *Roll) releaseRotate() {
+	<-r.rotateCh
+	reason, ok := r.pending.take()
+	if !ok {
+		return
+	}
+	r.inflight.add()
+	go func() {
+		defer r.inflight.done()
+		r.checkMu.Lock()
+		defer r.checkMu.Unlock()
+		if err := r.roll(reason); err != nil {
+			r.warn("[releaseRotate] deferred rolling err: %v", err)
+		}
+	}()
+}
+
+// nextCycle returns the ID of the next check cycle, which checks the writes happening now.
+func (r *Roll) nextCycle() uint64 {
+	return atomic.LoadUint64(&r.cycles) + 1
+}
+
+// roll switches the writes to the temporary file and processes the files in background, reason tells why.
+func (r *Roll) roll(reason string) error {
+	return r.rollCycle(atomic.AddUint64(&r.cycles, 1), reason)
+}
+
+// rollCycle rolls in the check cycle id, which tags the debug output, the RotateEvent and the errors.
+func (r *Roll) rollCycle(id uint64, reason string) error {
+	return r.rotate(id, reason, false)
+}
+
+// rotate rolls in the check cycle id, it skips if the last rolling is in progress unless wait is true.
+func (r *Roll) rotate(id uint64, reason string, wait bool) (err error) {
 	r.fOpLock()
 	defer r.fOpUnlock()
 
+	if wait {
+		if err = r.wakeLocked(); err != nil {
+			return err
+		}
+	}
 	if r.f == nil {
 		return nil
 	}
-	if err := r.openNew(); err != nil {
+	if wait {
+		select {
+		case r.rotateCh <- struct{}{}:
+		case <-r.closed:
+			return ErrClosed
+		}
+	} else {
+		// the rolling in progress still renames the temporary file, this one rolls once it is done,
+		// as the checkers, eg. RotateDaily, do not trigger again for the same boundary
+		select {
+		case r.rotateCh <- struct{}{}:
+		default:
+			select {
+			case <-r.closed:
+			default:
+				r.debug("[rollCycle] [cycle #%d] defer, the last rolling is in progress", id)
+				r.pending.set(reason)
+			}
+			return nil
+		}
+	}
+	if r.shared != nil {
+		// another process may be rolling the file, or have rolled it
+		ok, err := r.shared.lock(wait)
+		if !ok {
+			<-r.rotateCh
+			r.debug("[rollCycle] [cycle #%d] skip, the file is being rolled by another process", id)
+			return err
+		}
+		if moved, err := r.reopenMoved(); moved || err != nil {
+			r.shared.unlock()
+			<-r.rotateCh
+			return err
+		}
+	}
+	ctx, span := startSpan(r.ctx, r.tracer, SpanRoll)
+	span.SetAttribute("rollingf.file", r.filePath)
+	span.SetAttribute("rollingf.cycle", id)
+	span.SetAttribute("rollingf.reason", reason)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	start := r.now()
+	if err = r.prepareRoll(); err != nil {
+		if r.shared != nil {
+			r.shared.unlock()
+		}
+		<-r.rotateCh
+		err = cycleError(id, err)
+		r.notifyRotate(ctx, id, start, reason, err)
 		return err
 	}
+	r.emit(RotationStarted{Cycle: id, Reason: reason, Time: start})
+	r.inflight.add()
 
-	go r.process()
+	if r.renameReopen {
+		// the processor moves the file itself, the writes wait for it
+		r.process(ctx, id, reason)
+		return nil
+	}
+	r.goProcess(func() {
+		r.process(ctx, id, reason)
+	})
 	return nil
 }
 
-func (r *Roll) checkChain() (bool, error) {
+// prepareRoll switches the writes to the temporary file, or only flushes the buffer for RenameReopen.
+func (r *Roll) prepareRoll() error {
+	// the summary of the repeats follows the repeated record in the file being rolled
+	if err := r.flushRepeats(true); err != nil {
+		return err
+	}
+	if r.renameReopen {
+		return r.flushBuffer()
+	}
+	return r.openNew()
+}
+
+// cycleError tags err with the check cycle id, the cause is kept for errors.Is.
+func cycleError(id uint64, err error) error {
+	return fmt.Errorf("rollingf: cycle #%d: %w", id, err)
+}
+
+// checkChain returns true and the reason if any checker triggers the rolling.
+func (r *Roll) checkChain(id uint64) (bool, string, error) {
 	r.fWLock()
 	defer r.fWUnlock()
-	for _, checker := range r.checkers {
-		rolling, err := checker.Check(r.filePath, r.st)
+	r.refreshStat()
+	for i, checker := range r.checkers {
+		if !r.checkerHandles[i].Enabled() {
+			continue
+		}
+		var rolling bool
+		var err error
+		if cc, ok := checker.(contextChecker); ok {
+			rolling, err = cc.checkContext(r.ctx, r.filePath, r.st)
+		} else {
+			rolling, err = checker.Check(r.filePath, r.st)
+		}
 		if err != nil {
-			return false, err
+			return false, "", err
 		}
 		if rolling {
-			debug("[%s] hint %d", checker.Name(), r.st.Size())
-			return true, nil
+			reason := checker.Name()
+			if e, ok := checker.(CheckExplainer); ok {
+				reason += ": " + e.Explain(r.filePath, r.st)
+			}
+			r.debug("[cycle #%d] [%s] hint %d", id, reason, r.st.Size())
+			return true, reason, nil
 		}
 	}
 
-	return false, nil
+	return false, "", nil
 }
 
-func (r *Roll) filterChain(files []os.DirEntry) ([]os.DirEntry, error) {
+// filterChain runs the filters over the files and returns the remains and the result of each filtered file,
+// nothing is dealt if dryRun, the later filters get the remains as if the filtered files were dealt.
+func (r *Roll) filterChain(ctx context.Context, files []os.DirEntry, dryRun bool) ([]os.DirEntry, []FilterResult, error) {
+	// UpdateConf may replace the filters meanwhile, the file lock is not taken as Close holds it waiting for the rolling
+	r.filtersMu.Lock()
+	filters, handles := r.filters, r.filterHandles
+	r.filtersMu.Unlock()
+
 	var remains = files
-	for _, f := range r.filters {
+	var results []FilterResult
+	for i, f := range filters {
+		if !handles[i].Enabled() {
+			continue
+		}
 		items, tmp, err := f.Filter(remains)
 		if err != nil {
-			return nil, err
+			return nil, results, err
 		}
 		if len(tmp) > 0 {
-			debugArray(tmp, func(idx int) string {
+			r.debugArray(tmp, func(idx int) string {
 				return tmp[idx].Name()
 			}, "[%s]", f.Name())
-			f.DealFiltered(path.Dir(r.filePath), tmp)
+			results = append(results, r.dealFiltered(ctx, f, tmp, dryRun)...)
 		}
 		remains = items
 	}
 
-	return remains, nil
+	if r.errorsPolicy == SkipOnError && !dryRun {
+		if err := retentionError(results); err != nil {
+			r.emit(ErrorEvent{Err: err})
+		}
+	}
+	return remains, results, nil
+}
+
+// dealFiltered deals the files filtered by f, per file if f is a FilterV2, and reports the results.
+func (r *Roll) dealFiltered(ctx context.Context, f Filter, filtered []os.DirEntry, dryRun bool) []FilterResult {
+	dir := path.Dir(r.filePath)
+	results := make([]FilterResult, len(filtered))
+	fv, _ := f.(FilterV2)
+	for i, e := range filtered {
+		results[i] = FilterResult{Name: path.Join(dir, e.Name()), Filter: f.Name()}
+		if fv != nil {
+			results[i].Reason = fv.Reason(e)
+		}
+	}
+	if dryRun {
+		return results
+	}
+
+	skip := r.errorsPolicy == SkipOnError
+	if fv != nil {
+		for i, e := range filtered {
+			results[i].Err = fv.DealFile(dir, e)
+			if results[i].Err != nil && !skip {
+				// the rest are left to the next rolling
+				results = results[:i+1]
+				break
+			}
+		}
+	} else if skip {
+		for i := range filtered {
+			results[i].Err = dealFilteredContext(ctx, f, dir, filtered[i:i+1])
+		}
+	} else if err := dealFilteredContext(ctx, f, dir, filtered); err != nil {
+		// which files are dealt is unknown
+		for i := range results {
+			results[i].Err = err
+		}
+		r.emit(ErrorEvent{Err: err})
+		r.notifyRemove(results)
+		return results
+	}
+
+	for _, res := range results {
+		if res.Err != nil {
+			if !skip {
+				r.emit(ErrorEvent{Err: res.Err})
+			}
+		} else {
+			r.emit(BackupRemoved{Name: res.Name, Reason: res.Filter, Detail: res.Reason})
+		}
+	}
+	r.notifyRemove(results)
+	return results
 }
 
+// openNew switches the writes to the temporary file, the current file is kept on any error.
 func (r *Roll) openNew() error {
-	err := r.st.reset(r.filePath)
+	// the buffered writes belong to the file being rolled
+	if err := r.flushBuffer(); err != nil {
+		return err
+	}
+
+	_, err := r.fs.Stat(r.filePath)
+	if os.IsNotExist(err) && r.f.Name() == r.tmpFilePath {
+		// the last rolling failed to rename the temporary file back, finish it first
+		r.debug("[openNew] finish the interrupted rolling")
+		err = r.fs.Rename(r.tmpFilePath, r.filePath)
+	} else if os.IsNotExist(err) {
+		if cfs, ok := r.fs.(*createFS); ok && cfs.dirs {
+			// removed with its directory, the rolling goes on with the file created again
+			r.warn("[openNew] the file is removed, create it again")
+			var f File
+			if f, err = r.fs.OpenFile(r.filePath, os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+				err = f.Close()
+			}
+		}
+	}
 	if err != nil {
 		return err
 	}
 
-	if err = r.closeFile(); err != nil {
-		debug("[closeFile] err: %v", err)
+	f, err := r.createFile(r.tmpFilePath)
+	if err != nil {
+		return err
+	}
+	// the stat follows the new file, not the file being rolled
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
 		return err
 	}
 
-	return r.openFile(r.tmpFilePath)
+	if err = r.closeFile(); err != nil {
+		r.warn("[closeFile] err: %v", err)
+	}
+	r.f = f
+	r.st.reset(info)
+	r.tails.rotated(r.fs, f.Name())
+	if err = r.redirectStdio(); err != nil {
+		r.warn("[openNew] err: %v", err)
+	}
+
+	if r.state != nil {
+		now := r.now()
+		r.state.rotated(now)
+		r.st.setBirth(now)
+	}
+	return nil
 }
 
-func (r *Roll) process() {
-	select {
-	case r.rotateCh <- struct{}{}:
-		r.rollOnce()
-	default:
+// process finishes the rolling started by rollCycle, which hands over rotateCh.
+func (r *Roll) process(ctx context.Context, id uint64, reason string) {
+	defer r.inflight.done()
+	r.debug("[process] [cycle #%d] %s", id, reason)
+	_, span := startSpan(ctx, r.tracer, SpanProcess)
+	span.SetAttribute("rollingf.cycle", id)
+	start := r.now()
+	err := r.rollOnce(ctx)
+	if err != nil {
+		err = cycleError(id, err)
+		r.warn("[process] err: %v", err)
 	}
+	endSpan(span, err)
+	r.saveState()
+	r.notifyRotate(ctx, id, start, reason, err)
 }
 
-func (r *Roll) rollOnce() error {
-	debug("[rollingOnce]")
+func (r *Roll) rollOnce(ctx context.Context) error {
+	r.debug("[rollingOnce]")
 	defer func() {
-		<-r.rotateCh
+		if r.shared != nil {
+			r.shared.unlock()
+		}
+		r.releaseRotate()
 	}()
 
-	dir := path.Dir(r.filePath)
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-
 	// match
 	if r.matcher == nil {
 		return nil
 	}
-	var files []fs.DirEntry
-	for _, e := range entries {
-		if e.Type().IsRegular() && r.matcher.Match(e.Name()) {
-			files = append(files, e)
+	if r.coordinator != nil {
+		if err := r.coordinator.Lock(); err != nil {
+			return err
 		}
+		defer r.coordinator.Unlock()
+	}
+	dir := path.Dir(r.filePath)
+	files, err := r.matchFiles(dir)
+	if err != nil {
+		return err
+	}
+	if r.maxMatched > 0 && len(files) > r.maxMatched {
+		return fmt.Errorf("rollingf: matched %d files in %s, more than %d, check the matcher", len(files), dir, r.maxMatched)
 	}
-
-	sort.Slice(files, func(i, j int) bool {
-		f1 := files[i].Name()
-		f2 := files[j].Name()
-		if len(f2) != len(f1) {
-			return len(f2) > len(f1)
-		}
-
-		idx1 := strings.LastIndexByte(f1, '.')
-		if idx1 == -1 {
-			idx1 = 0
-		}
-		idx2 := strings.LastIndexByte(f2, '.')
-		if idx2 == -1 {
-			idx2 = 0
-		}
-
-		n1, _ := strconv.Atoi(f1[idx1+1:])
-		n2, _ := strconv.Atoi(f2[idx2+1:])
-
-		return n1 < n2
-	})
-
-	debugArray(files, func(idx int) string {
-		return files[idx].Name()
-	}, "[sorted]")
 
 	// filter
-	remains, err := r.filterChain(files)
+	remains, _, err := r.filterChain(ctx, files, false)
 	if err != nil {
 		return err
 	}
 
-	debugArray(remains, func(idx int) string {
+	r.debugArray(remains, func(idx int) string {
 		return remains[idx].Name()
 	}, "[remain]")
 
@@ -365,12 +1228,75 @@ func (r *Roll) rollOnce() error {
 	if r.processor == nil {
 		return nil
 	}
-	debug("[processor]")
-	if err := r.processor.Process(dir, remains); err != nil {
+	r.debug("[processor]")
+	err = processContext(ctx, r.processor, dir, remains)
+	if r.renameReopen {
+		// the file is created again even if the processor failed after moving it
+		moved, rerr := r.reopenMoved()
+		if moved && r.state != nil {
+			now := r.now()
+			r.state.rotated(now)
+			r.st.setBirth(now)
+		}
+		if err == nil {
+			err = rerr
+		}
+		if err == nil {
+			err = r.tidyShards(dir)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.tidyShards(dir); err != nil {
 		return err
 	}
 
-	return os.Rename(r.tmpFilePath, r.filePath)
+	return r.fs.Rename(r.tmpFilePath, r.filePath)
+}
+
+// matchFiles returns the files matched by the matcher in dir, sorted from the newest to the oldest.
+func (r *Roll) matchFiles(dir string) ([]os.DirEntry, error) {
+	entries, err := r.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpBase string
+	if path.Dir(r.tmpFilePath) == path.Clean(dir) {
+		tmpBase = path.Base(r.tmpFilePath)
+	}
+
+	var files []fs.DirEntry
+	for _, e := range entries {
+		if e.Name() == tmpBase {
+			continue
+		}
+		if e.Type().IsRegular() && r.matcher.Match(e.Name()) {
+			files = append(files, e)
+		}
+	}
+	shards, err := r.shardFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range shards {
+		if e.Type().IsRegular() && r.matcher.Match(path.Base(e.Name())) {
+			files = append(files, e)
+		}
+	}
+
+	if r.sorter != nil {
+		r.sorter.Sort(files)
+	} else {
+		(&numericSorter{base: path.Base(r.filePath)}).Sort(files)
+	}
+
+	r.debugArray(files, func(idx int) string {
+		return files[idx].Name()
+	}, "[sorted]")
+	return files, nil
 }
 
 // lock for writing file, exlusive for close and open
@@ -398,3 +1324,29 @@ func (r *Roll) fOpUnlock() {
 		r.rwmu.Unlock()
 	}
 }
+
+func (r *Roll) debug(format string, args ...any) {
+	if r.quiet {
+		return
+	}
+	logAt(r.logger, 2, LevelDebug, r.filePath, format, args...)
+}
+
+// warn logs an error handled in background.
+func (r *Roll) warn(format string, args ...any) {
+	if r.quiet {
+		return
+	}
+	logAt(r.logger, 2, LevelWarn, r.filePath, format, args...)
+}
+
+func (r *Roll) debugArray(arr any, formator func(idx int) string, format string, args ...any) {
+	if r.quiet {
+		return
+	}
+	if r.logger == nil {
+		logDebugArray(2, arr, formator, format, args...)
+		return
+	}
+	logAt(r.logger, 2, LevelDebug, r.filePath, "%s%s", fmt.Sprintf(format, args...), entryNames(arr, formator))
+}
@@ -2,9 +2,15 @@ package rollingf
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"io"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -18,7 +24,7 @@ func TestNew(t *testing.T) {
 		},
 		RollFilterConf: RollFilterConf{
 			MaxBackups: 20,
-			MaxAge:     2 * time.Minute,
+			MaxAge:     Age(2 * time.Minute),
 		},
 	})
 	if r == nil {
@@ -43,11 +49,11 @@ func TestNewC(t *testing.T) {
 	}()
 
 	r.WithDefaultChecker(RollCheckerConf{
-		Interval: 1 * time.Minute,
+		Interval: Age(1 * time.Minute),
 		MaxSize:  100,
 	}).WithDefaultFilter(RollFilterConf{
 		MaxBackups: 2,
-		MaxAge:     2 * time.Minute,
+		MaxAge:     Age(2 * time.Minute),
 	}).WithDefaultMatcher().WithDefaultProcessor()
 
 	write(r)
@@ -65,11 +71,11 @@ func TestNewRollSimple(t *testing.T) {
 	}()
 
 	r.WithDefaultChecker(RollCheckerConf{
-		Interval: 1 * time.Minute,
+		Interval: Age(1 * time.Minute),
 		MaxSize:  100,
 	}).WithDefaultFilter(RollFilterConf{
 		MaxBackups: 2,
-		MaxAge:     2 * time.Minute,
+		MaxAge:     Age(2 * time.Minute),
 	}).WithDefaultMatcher().WithDefaultProcessor()
 
 	write(r)
@@ -209,3 +215,654 @@ func write(w io.Writer) {
 	w.Write([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX\n"))
 	w.Write([]byte("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\n"))
 }
+
+func TestWriteBatch(t *testing.T) {
+	fp := t.TempDir() + "/app.log"
+	r := NewC(fp).WithChecker(MaxSizeChecker(SizeMB)).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	n, err := r.WriteBatch([][]byte{[]byte("a\n"), []byte("bb\n"), nil, []byte("ccc\n")})
+	if err != nil || n != 9 {
+		t.Fatal(n, err)
+	}
+	if r.st.Size() != 9 {
+		t.Fatal(r.st.Size())
+	}
+
+	b, err := os.ReadFile(fp)
+	if err != nil || string(b) != "a\nbb\nccc\n" {
+		t.Fatal(string(b), err)
+	}
+}
+
+func TestRotateReason(t *testing.T) {
+	events := make(chan RotateEvent, 1)
+	r := NewC(t.TempDir() + "/app.log").
+		WithChecker(MaxSizeChecker(100)).
+		WithDefaultMatcher().
+		WithDefaultProcessor().
+		OnRotate(func(ev RotateEvent) {
+			select {
+			case events <- ev:
+			default:
+			}
+		})
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	write(r)
+	select {
+	case ev := <-events:
+		if !strings.HasPrefix(ev.Reason, "MaxSizeChecker: size=") || ev.Err != nil {
+			t.Fatal(ev.Reason, ev.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no rotation")
+	}
+
+	if st := r.Stats(); st.Rotations == 0 || !strings.HasPrefix(st.LastReason, "MaxSizeChecker") {
+		t.Fatal(st)
+	}
+}
+
+func TestStatsFailures(t *testing.T) {
+	var rs rollStats
+	failed := errors.New("rename failed")
+	rs.rotated(RotateEvent{Reason: "first"})
+	rs.rotated(RotateEvent{Reason: "second", Err: failed})
+
+	st := rs.snapshot()
+	if st.Rotations != 1 || st.Failures != 1 || st.LastError != failed || st.LastReason != "second" {
+		t.Fatalf("%+v", st)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir := t.TempDir()
+	link := dir + "/current.log"
+	if err := os.Mkdir(dir+"/logs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("stale.log", link); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewC(dir+"/logs/app.log", WithSymlink(link))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	target, err := os.Readlink(link)
+	if err != nil || target != "logs/app.log" {
+		t.Fatal(target, err)
+	}
+	r.Write([]byte("hello"))
+	if b, err := os.ReadFile(link); err != nil || string(b) != "hello" {
+		t.Fatal(string(b), err)
+	}
+
+	if err := os.WriteFile(dir+"/regular.log", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if NewC(dir+"/logs/app.log", WithSymlink(dir+"/regular.log")) != nil {
+		t.Fatal("replaced a regular file")
+	}
+}
+
+func TestNonBlocking(t *testing.T) {
+	for _, policy := range []DropPolicy{DropNewest, DropOldest} {
+		fp := t.TempDir() + "/app.log"
+		r := NewC(fp, NonBlocking(2, policy))
+		if r == nil {
+			t.Fatal("nil roll")
+		}
+
+		// the background writer is stuck, eg. by a slow disk
+		r.fOpLock()
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			if _, err := r.Write([]byte(strconv.Itoa(i) + "\n")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Write blocked")
+		}
+		r.fOpUnlock()
+		r.Close()
+
+		if _, err := r.Write([]byte("x")); err == nil {
+			t.Fatal("write after close")
+		}
+
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		dropped := r.Stats().Dropped
+		if dropped < 7 || int64(len(lines))+dropped != 10 {
+			t.Fatal(policy, lines, dropped)
+		}
+		if policy == DropNewest && lines[0] != "0" || policy == DropOldest && lines[len(lines)-1] != "9" {
+			t.Fatal(policy, lines)
+		}
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	r := NewC(t.TempDir()+"/app.log", WithWriteTimeout(50*time.Millisecond))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	// the file hangs
+	r.fOpLock()
+	start := time.Now()
+	if _, err := r.Write([]byte("hung\n")); err != ErrWriteTimeout {
+		t.Fatal(err)
+	}
+	if _, err := r.WriteBatch([][]byte{[]byte("a"), []byte("b")}); err != ErrWriteTimeout {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Write blocked")
+	}
+	r.fOpUnlock()
+
+	// the worker catches up
+	time.Sleep(10 * time.Millisecond)
+	if n, err := r.Write([]byte("ok\n")); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+}
+
+func TestTee(t *testing.T) {
+	var a, b bytes.Buffer
+	fp := t.TempDir() + "/app.log"
+	r := NewC(fp, WithTee(&a), WithTee(&b)).WithInterceptor(Redactor("***").Fixed("secret"))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	r.Write([]byte("a secret\n"))
+	r.WriteBatch([][]byte{[]byte("b\n"), []byte("c\n")})
+	if err := r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a ***\nb\nc\n"
+	if f, _ := os.ReadFile(fp); string(f) != want || a.String() != want || b.String() != want {
+		t.Fatal(string(f), a.String(), b.String())
+	}
+}
+
+func TestUpdateConf(t *testing.T) {
+	dir := t.TempDir()
+	r := New(NewRollConf(dir+"/app.log", 0, SizeMB, 0, 5))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 16)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.Write([]byte("0123456789\n"))
+			}
+		}()
+	}
+	if err := r.UpdateConf(RollConf{RollCheckerConf: RollCheckerConf{MaxSize: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	select {
+	case ev := <-events:
+		if !strings.Contains(ev.Reason, "limit=100") {
+			t.Fatal(ev.Reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new MaxSize does not roll")
+	}
+
+	if err := r.UpdateConf(NewRollConf(dir+"/other.log", 0, 100, 0, 5)); err == nil {
+		t.Fatal("changed the file path")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []RollConf{
+		NewRollConf("", time.Hour, 0, 0, 0),
+		NewRollConf("/tmp/any_app/", time.Hour, 0, 0, 0),
+		NewRollConf("app.log", 0, -1, 0, 0),
+		NewRollConf("app.log", 0, 0, 0, 0),
+		NewRollConf("app.log", time.Hour, 0, 0, -1),
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v: expect error", c)
+		}
+	}
+	if err := NewRollConf("app.log", time.Hour, 0, 0, 0).Validate(); err != nil {
+		t.Error(err)
+	}
+
+	dir := t.TempDir()
+	r := New(NewRollConf(dir+"/app.log", time.Hour, SizeMB, 0, 5), Compress(Gzip), CompressAfter(2))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the timestamped backups are never matched by the default matcher
+	r.WithProcessor(DefaultProcessor().WithNamer(TimestampNamer(""))).WithDefaultMatcher()
+	if err := r.Validate(); err == nil || !strings.Contains(err.Error(), "never matches") {
+		t.Fatal(err)
+	}
+
+	if _, err := Pipeline().MaxSize(SizeMB).Build(dir+"/p.log", OptionFunc(func(r *Roll) {
+		r.WithMatcher(CompressMatcher(Gzip))
+	})); err == nil {
+		t.Fatal("expect the pipeline invalid")
+	}
+}
+
+func TestNewE(t *testing.T) {
+	missing := t.TempDir() + "/missing/app.log"
+	if _, err := NewCE(missing); !os.IsNotExist(errors.Unwrap(err)) || !strings.Contains(err.Error(), missing) {
+		t.Fatal(err)
+	}
+	if _, err := NewE(NewRollConf(missing, time.Hour, 0, 0, 0)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	if _, err := NewE(NewRollConf(missing, 0, 0, 0, 0)); err == nil || !strings.Contains(err.Error(), "never roll") {
+		t.Fatal(err)
+	}
+	if r, err := NewE(NewRollConf(t.TempDir()+"/app.log", time.Hour, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	} else {
+		r.Close()
+	}
+}
+
+func TestRenameReopen(t *testing.T) {
+	dir := t.TempDir()
+	fp := dir + "/app.log"
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), RenameReopen())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Write([]byte("a"))
+	if err = r.roll("test"); err != nil {
+		t.Fatal(err)
+	}
+	// rolled before roll returns, without the temporary file
+	if r.f.Name() != fp {
+		t.Fatal("writing", r.f.Name())
+	}
+	if _, err := os.Stat(dir + "/_app.log"); !os.IsNotExist(err) {
+		t.Fatal("the temporary file is created", err)
+	}
+	r.Write([]byte("b"))
+	r.roll("test")
+	r.Write([]byte("c"))
+	r.Close()
+
+	for name, want := range map[string]string{
+		"app.log":   "c",
+		"app.log.1": "b",
+		"app.log.2": "a",
+	} {
+		b, err := os.ReadFile(dir + "/" + name)
+		if err != nil || string(b) != want {
+			t.Errorf("%s: %q, want %q, %v", name, b, want, err)
+		}
+	}
+}
+
+// benchRecords are the records of a batch in the benchmarks of WriteBatch.
+const benchRecords = 16
+
+func BenchmarkWrite(b *testing.B) {
+	r, err := NewE(NewRollConf(path.Join(b.TempDir(), "app.log"), DurOneDay, 0, 0, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	line := []byte("2024-06-01 00:00:00 INFO request served in 1ms\n")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line) * benchRecords))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for i := 0; i < benchRecords; i++ {
+				r.Write(line)
+			}
+		}
+	})
+}
+
+func BenchmarkWriteBatch(b *testing.B) {
+	r, err := NewE(NewRollConf(path.Join(b.TempDir(), "app.log"), DurOneDay, 0, 0, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	line := []byte("2024-06-01 00:00:00 INFO request served in 1ms\n")
+	batch := make([][]byte, benchRecords)
+	for i := range batch {
+		batch[i] = line
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line) * benchRecords))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.WriteBatch(batch)
+		}
+	})
+}
+
+// BenchmarkWriteChecked runs the checkers after every write, FirstWriteOfDay is not compared inline.
+func BenchmarkWriteChecked(b *testing.B) {
+	r := NewC(path.Join(b.TempDir(), "app.log")).WithChecker(FirstWriteOfDay()).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		b.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	line := []byte("2024-06-01 00:00:00 INFO request served in 1ms\n")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Write(line)
+		}
+	})
+}
+
+func TestWriteInlineCheck(t *testing.T) {
+	r, err := NewE(NewRollConf(path.Join(t.TempDir(), "app.log"), DurOneDay, 10, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	for i := 0; i < 9; i++ {
+		r.Write([]byte("a"))
+	}
+	if len(r.checkCh) != 0 || atomic.LoadUint64(&r.cycles) != 0 {
+		t.Fatal("checked below the limits")
+	}
+	r.Write([]byte("a"))
+	select {
+	case ev := <-events:
+		if !strings.HasPrefix(ev.Reason, "MaxSizeChecker") {
+			t.Error(ev.Reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not rolled")
+	}
+}
+
+// BenchmarkWriteLock compares the lock of the Roll with the Lock(false) unsafe mode, under the parallel writers.
+// The writes share the read side of the lock, only the rollings and the other file operations take the write side.
+// Both modes cost about the same per write, the time goes into the write syscall, so the writes keep the lock
+// rather than swapping the file by an atomic pointer with the reference counts.
+func BenchmarkWriteLock(b *testing.B) {
+	line := []byte("2024-06-01 00:00:00 INFO request served in 1ms\n")
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"locked", nil},
+		{"unlocked", []Option{Lock(false)}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			r, err := NewE(NewRollConf(path.Join(b.TempDir(), "app.log"), DurOneDay, 0, 0, 1), c.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(line)))
+			b.SetParallelism(4)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					r.Write(line)
+				}
+			})
+		})
+	}
+}
+
+// tempProcessor records the files it sees, and whether the temporary file exists while rolling.
+type tempProcessor struct {
+	tmp    string
+	seen   []string
+	exists bool
+}
+
+func (p *tempProcessor) Process(_ string, remains []os.DirEntry) error {
+	p.seen = p.seen[:0]
+	for _, e := range remains {
+		p.seen = append(p.seen, e.Name())
+	}
+	_, err := os.Stat(p.tmp)
+	p.exists = err == nil
+	return nil
+}
+
+type matchAll struct{}
+
+func (matchAll) Init(string)       {}
+func (matchAll) Match(string) bool { return true }
+
+func TestTempFile(t *testing.T) {
+	dir := t.TempDir()
+	tmpDir := t.TempDir()
+	for _, c := range []struct {
+		dir, name string
+		want      string
+	}{
+		{"", "", dir + "/_app.log"},
+		{"", ".{base}.tmp", dir + "/.app.log.tmp"},
+		{tmpDir, "{base}.rolling", tmpDir + "/app.log.rolling"},
+	} {
+		p := &tempProcessor{tmp: c.want}
+		r := NewC(dir+"/app.log", TempFile(c.dir, c.name), OptionFunc(func(r *Roll) {
+			// the temporary file is never matched
+			r.WithMatcher(matchAll{}).WithProcessor(p)
+		}))
+		if r == nil {
+			t.Fatal("nil roll")
+		}
+		if r.tmpFilePath != c.want {
+			t.Fatal(r.tmpFilePath, "!=", c.want)
+		}
+
+		events := make(chan RotateEvent, 1)
+		r.OnRotate(func(ev RotateEvent) { events <- ev })
+		r.Write([]byte("hello"))
+		if err := rollSync(t, r, events); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+
+		if !p.exists || len(p.seen) != 1 || p.seen[0] != "app.log" {
+			t.Fatal(c.want, p.exists, p.seen)
+		}
+		// renamed back after rolling
+		if _, err := os.Stat(c.want); !os.IsNotExist(err) {
+			t.Fatal(c.want, "is left")
+		}
+		os.Remove(dir + "/app.log")
+	}
+}
+
+// gateProcessor signals entered on each call, then waits until release is closed.
+type gateProcessor struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *gateProcessor) Process(string, []os.DirEntry) error {
+	p.entered <- struct{}{}
+	<-p.release
+	return nil
+}
+
+func TestRollDeferredInProgress(t *testing.T) {
+	mfs := NewMemFS()
+	p := &gateProcessor{entered: make(chan struct{}, 2), release: make(chan struct{})}
+	r := NewC("/mem/app.log", WithFS(mfs), OptionFunc(func(r *Roll) {
+		r.WithDefaultMatcher().WithProcessor(p)
+	}))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 2)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	r.Write([]byte("a"))
+	if err := r.roll("first"); err != nil {
+		t.Fatal(err)
+	}
+	<-p.entered
+
+	// the temporary file receives the writes, it is rolled once the first rolling is done
+	r.Write([]byte("b"))
+	if err := r.roll("second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.roll("third"); err != nil {
+		t.Fatal(err)
+	}
+	close(p.release)
+	for _, want := range []string{"first", "second"} {
+		select {
+		case ev := <-events:
+			if ev.Reason != want || ev.Err != nil {
+				t.Fatal(want, ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("not rolled", want)
+		}
+	}
+	r.inflight.wait()
+	select {
+	case ev := <-events:
+		t.Fatal("deferred twice", ev)
+	default:
+	}
+	if b, _ := mfs.ReadFile("/mem/app.log"); len(b) != 0 {
+		t.Fatalf("%q", b)
+	}
+}
+
+func TestRollDeferredCalendar(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 23, 0, 0, 0, time.UTC)}
+	mfs := NewMemFS()
+	mfs.setClock(clock)
+	p := &gateProcessor{entered: make(chan struct{}, 2), release: make(chan struct{})}
+	r := NewC("/mem/app.log", WithFS(mfs), ManualCheck(), OptionFunc(func(r *Roll) {
+		r.WithClock(clock).WithLocation(time.UTC).WithChecker(MaxSizeChecker(4), RotateDaily()).
+			WithDefaultMatcher().WithProcessor(p)
+	}))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	events := make(chan RotateEvent, 2)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	r.Write([]byte("large"))
+	r.checkOnce()
+	<-p.entered
+
+	// the day boundary is used up by the check while the rolling by size is in progress
+	clock.Add(2 * time.Hour)
+	r.checkOnce()
+	close(p.release)
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.Err != nil {
+				t.Fatal(i, ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the daily rolling is lost")
+		}
+	}
+	if rolled, err := r.CheckNow(); rolled || err != nil {
+		t.Fatal("rolled again", err)
+	}
+}
+
+// gateMatcher signals entered on the first match, then waits until release is closed.
+type gateMatcher struct {
+	Matcher
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (m *gateMatcher) Match(other string) bool {
+	m.once.Do(func() {
+		close(m.entered)
+		<-m.release
+	})
+	return m.Matcher.Match(other)
+}
+
+func TestCloseWhileRolling(t *testing.T) {
+	m := &gateMatcher{Matcher: DefaultMatcher(), entered: make(chan struct{}), release: make(chan struct{})}
+	r := NewC(t.TempDir()+"/app.log", OptionFunc(func(r *Roll) {
+		r.WithMatcher(m).WithFilter(MaxBackupsFilter(1)).WithDefaultProcessor()
+	}))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+
+	r.Write([]byte("a"))
+	if err := r.roll("test"); err != nil {
+		t.Fatal(err)
+	}
+	<-m.entered
+
+	// Close holds the file lock waiting for the rolling, the filters are run without it
+	closed := make(chan error, 1)
+	go func() { closed <- r.Close() }()
+	time.Sleep(50 * time.Millisecond)
+	close(m.release)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocks with the rolling")
+	}
+}
@@ -14,7 +14,12 @@
 
 package rollingf
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type RollConf struct {
 	FilePath string // file's location
@@ -23,16 +28,16 @@ type RollConf struct {
 }
 
 type RollCheckerConf struct {
-	// interval to roll file
-	Interval time.Duration
+	// interval to roll file, eg. "1d" in the configs
+	Interval Age
 
-	// the max bytes to roll file
-	MaxSize int64
+	// the max bytes to roll file, eg. "250MiB" in the configs
+	MaxSize Size
 }
 
 type RollFilterConf struct {
-	// the max day to keep old files, only triggered when call Write()
-	MaxAge time.Duration
+	// the max day to keep old files, only triggered when call Write(), Roll.Purge or by WithRetentionInterval, eg. "30d" in the configs
+	MaxAge Age
 
 	// the max number of old log files to retain
 	MaxBackups int
@@ -43,27 +48,48 @@ func NewRollConf(filePath string, interval time.Duration, maxSize int64, maxAge
 		FilePath: filePath,
 
 		RollCheckerConf: RollCheckerConf{
-			Interval: interval,
-			MaxSize:  maxSize,
+			Interval: Age(interval),
+			MaxSize:  Size(maxSize),
 		},
 
 		RollFilterConf: RollFilterConf{
-			MaxAge:     maxAge,
+			MaxAge:     Age(maxAge),
 			MaxBackups: maxBackups,
 		},
 	}
 }
 
+// Validate reports the first misconfiguration of c with an actionable message.
+func (c RollConf) Validate() error {
+	switch {
+	case c.FilePath == "":
+		return errors.New("rollingf: FilePath is empty")
+	case strings.HasSuffix(c.FilePath, "/"):
+		return fmt.Errorf("rollingf: FilePath %q is a directory, add the file name", c.FilePath)
+	case c.Interval < 0:
+		return fmt.Errorf("rollingf: Interval must not be negative, got %v, 0 disables it", time.Duration(c.Interval))
+	case c.MaxSize < 0:
+		return fmt.Errorf("rollingf: MaxSize must not be negative, got %d, 0 disables it", c.MaxSize)
+	case c.Interval == 0 && c.MaxSize == 0:
+		return errors.New("rollingf: neither Interval nor MaxSize is set, the file will never roll")
+	case c.MaxAge < 0:
+		return fmt.Errorf("rollingf: MaxAge must not be negative, got %v, 0 disables it", time.Duration(c.MaxAge))
+	case c.MaxBackups < 0:
+		return fmt.Errorf("rollingf: MaxBackups must not be negative, got %d", c.MaxBackups)
+	}
+	return nil
+}
+
 func DefaultChecker(c RollCheckerConf) []Checker {
 	return []Checker{
-		IntervalChecker(c.Interval),
-		MaxSizeChecker(c.MaxSize),
+		IntervalChecker(time.Duration(c.Interval)),
+		MaxSizeChecker(int64(c.MaxSize)),
 	}
 }
 
 func DefaultFilter(c RollFilterConf) []Filter {
 	return []Filter{
 		MaxBackupsFilter(c.MaxBackups),
-		MaxAgeFilter(c.MaxAge),
+		MaxAgeFilter(time.Duration(c.MaxAge)),
 	}
 }
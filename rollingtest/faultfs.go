@@ -0,0 +1,195 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingtest
+
+import (
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ignorantshr/rollingf"
+)
+
+// Op is a file operation of a FaultFS.
+type Op string
+
+const (
+	OpOpen    Op = "open"
+	OpRename  Op = "rename"
+	OpRemove  Op = "remove"
+	OpReadDir Op = "readdir"
+	OpStat    Op = "stat"
+	OpWrite   Op = "write" // the writes to the opened files
+	OpSync    Op = "sync"
+)
+
+// Fault fails the calls of Op.
+type Fault struct {
+	Op Op
+	// Match selects the calls by the base name of the path, a path.Match pattern, eg. "*.gz*". Empty matches all.
+	// The old path is matched for OpRename.
+	Match string
+	// Nth fails the nth matching call from the injection, counted from 1, 0 fails every matching call.
+	Nth int
+	// Err is the error returned, syscall.EIO if nil.
+	Err error
+}
+
+// CompressionFault fails the writes of the compressed backups of rollingf.Gzip and rollingf.Zlib,
+// which are written to the temporary files first.
+func CompressionFault(err error) Fault {
+	return Fault{Op: OpOpen, Match: "*.*z.tmp", Err: err}
+}
+
+var _ rollingf.FS = (*FaultFS)(nil)
+
+// FaultFS fails the file operations of a FS by the faults injected, the others pass through.
+type FaultFS struct {
+	fs rollingf.FS
+
+	mu     sync.Mutex
+	faults []*fault
+	calls  map[Op]int
+}
+
+type fault struct {
+	Fault
+	seen int
+}
+
+// NewFaultFS wraps fsys, eg. a rollingf.MemFS.
+func NewFaultFS(fsys rollingf.FS) *FaultFS {
+	return &FaultFS{fs: fsys, calls: map[Op]int{}}
+}
+
+// Inject adds the faults, the earlier ones take precedence.
+func (f *FaultFS) Inject(faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ft := range faults {
+		f.faults = append(f.faults, &fault{Fault: ft})
+	}
+}
+
+// Reset removes the faults.
+func (f *FaultFS) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+// Calls returns the number of the calls of op, failed or not.
+func (f *FaultFS) Calls(op Op) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// check counts the call of op on name, and returns the error of the fault it hits.
+func (f *FaultFS) check(op Op, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+	for _, ft := range f.faults {
+		if ft.Op != op {
+			continue
+		}
+		if ft.Match != "" {
+			if ok, _ := path.Match(ft.Match, path.Base(name)); !ok {
+				continue
+			}
+		}
+		ft.seen++
+		if ft.Nth != 0 && ft.seen != ft.Nth {
+			continue
+		}
+		if ft.Err == nil {
+			return syscall.EIO
+		}
+		return ft.Err
+	}
+	return nil
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm os.FileMode) (rollingf.File, error) {
+	if err := f.check(OpOpen, name); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	file, err := f.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if err := f.check(OpRename, oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return f.fs.Rename(oldpath, newpath)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.check(OpRemove, name); err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return f.fs.Remove(name)
+}
+
+func (f *FaultFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if err := f.check(OpReadDir, name); err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return f.fs.ReadDir(name)
+}
+
+func (f *FaultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.check(OpStat, name); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return f.fs.Stat(name)
+}
+
+// Chtimes passes through if the wrapped FS supports it, eg. for Roll.Recompress.
+func (f *FaultFS) Chtimes(name string, atime, mtime time.Time) error {
+	if c, ok := f.fs.(interface {
+		Chtimes(name string, atime, mtime time.Time) error
+	}); ok {
+		return c.Chtimes(name, atime, mtime)
+	}
+	return nil
+}
+
+// faultFile fails the writes and the syncs by the faults of its FaultFS.
+type faultFile struct {
+	rollingf.File
+	fs *FaultFS
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.fs.check(OpWrite, f.Name()); err != nil {
+		return 0, &os.PathError{Op: "write", Path: f.Name(), Err: err}
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.check(OpSync, f.Name()); err != nil {
+		return &os.PathError{Op: "sync", Path: f.Name(), Err: err}
+	}
+	return f.File.Sync()
+}
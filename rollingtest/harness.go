@@ -0,0 +1,156 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingtest
+
+import (
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ignorantshr/rollingf"
+)
+
+// Start is the time of the FakeClock of a Harness.
+var Start = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Harness drives a Roll on a MemFS by a FakeClock. Each step runs the checkers at once and waits
+// for the rolling it triggers, so the backups are final when it returns, see Roll.CheckNow.
+//
+//	h := rollingtest.New(t, "/logs/app.log")
+//	h.Roll.WithChecker(rollingf.IntervalChecker(time.Hour)).WithFilter(rollingf.MaxBackupsFilter(2)).
+//		WithDefaultMatcher().WithDefaultProcessor()
+//	h.Write("a\n")
+//	if evs := h.Advance(2 * time.Hour); len(evs) != 1 { ... }
+//	h.Files() // [app.log app.log.1]
+type Harness struct {
+	Clock *FakeClock
+	Mem   *rollingf.MemFS
+	FS    *FaultFS
+	Roll  *rollingf.Roll
+
+	t      testing.TB
+	dir    string
+	events chan rollingf.RotateEvent
+}
+
+// New creates a Roll of filePath by rollingf.NewCE with opts, on a MemFS through a FaultFS, at Start.
+// The writes do not check, the steps do, see rollingf.ManualCheck.
+// The components are added to Roll after. The Roll is closed by the cleanup of t.
+func New(t testing.TB, filePath string, opts ...rollingf.Option) *Harness {
+	t.Helper()
+	h := &Harness{
+		Clock:  NewFakeClock(Start),
+		Mem:    rollingf.NewMemFS(),
+		t:      t,
+		dir:    path.Dir(filePath),
+		events: make(chan rollingf.RotateEvent, 64),
+	}
+	h.Mem.SetClock(h.Clock)
+	h.FS = NewFaultFS(h.Mem)
+
+	r, err := rollingf.NewCE(filePath, append([]rollingf.Option{rollingf.WithFS(h.FS), rollingf.ManualCheck()}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Roll = r.WithClock(h.Clock)
+	h.Roll.OnRotate(func(ev rollingf.RotateEvent) {
+		select {
+		case h.events <- ev:
+		default:
+			t.Error("rollingtest: too many rotations in a step")
+		}
+	})
+	t.Cleanup(func() {
+		h.Roll.Close()
+	})
+	return h
+}
+
+// Write writes s and returns the rotations it triggered.
+func (h *Harness) Write(s string) []rollingf.RotateEvent {
+	h.t.Helper()
+	if _, err := h.Roll.Write([]byte(s)); err != nil {
+		h.t.Fatal(err)
+	}
+	return h.Check()
+}
+
+// Advance moves the clock by d and returns the rotations it triggered.
+func (h *Harness) Advance(d time.Duration) []rollingf.RotateEvent {
+	h.Clock.Add(d)
+	return h.Check()
+}
+
+// Check runs the checkers and returns the rotations since the last step, the failed ones included.
+func (h *Harness) Check() []rollingf.RotateEvent {
+	h.Roll.CheckNow()
+	var evs []rollingf.RotateEvent
+	for {
+		select {
+		case ev := <-h.events:
+			evs = append(evs, ev)
+		default:
+			return evs
+		}
+	}
+}
+
+// Create creates the file name in the directory of the Roll with content, modified at modTime,
+// eg. the backups left by an earlier run.
+func (h *Harness) Create(name, content string, modTime time.Time) {
+	h.t.Helper()
+	p := path.Join(h.dir, name)
+	f, err := h.Mem.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	_, err = f.Write([]byte(content))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = h.Mem.Chtimes(p, modTime, modTime)
+	}
+	if err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// Files returns the sorted names of the files in the directory of the Roll.
+func (h *Harness) Files() []string {
+	h.t.Helper()
+	entries, err := h.Mem.ReadDir(h.dir)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Content returns the content of the file name in the directory of the Roll.
+func (h *Harness) Content(name string) string {
+	h.t.Helper()
+	b, err := h.Mem.ReadFile(path.Join(h.dir, name))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,128 @@
+package rollingtest
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ignorantshr/rollingf"
+)
+
+func TestHarnessInterval(t *testing.T) {
+	h := New(t, "/logs/app.log")
+	h.Roll.WithChecker(rollingf.IntervalChecker(time.Hour)).WithFilter(rollingf.MaxBackupsFilter(2)).
+		WithDefaultMatcher().WithDefaultProcessor()
+
+	if evs := h.Write("a\n"); len(evs) != 0 {
+		t.Fatal("rotations", evs)
+	}
+	if evs := h.Advance(30 * time.Minute); len(evs) != 0 {
+		t.Fatal("rotations", evs)
+	}
+	for _, s := range []string{"b\n", "c\n", "d\n"} {
+		evs := h.Advance(time.Hour + time.Minute)
+		if len(evs) != 1 || evs[0].Err != nil {
+			t.Fatal("rotations", evs)
+		}
+		h.Write(s)
+	}
+	if got, want := h.Files(), []string{"app.log", "app.log.1", "app.log.2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %v, want %v", got, want)
+	}
+	if h.Content("app.log") != "d\n" || h.Content("app.log.1") != "c\n" || h.Content("app.log.2") != "b\n" {
+		t.Fatal("contents")
+	}
+}
+
+func TestHarnessMaxAge(t *testing.T) {
+	h := New(t, "/logs/app.log")
+	h.Create("app.log.1", "old\n", Start.Add(-48*time.Hour))
+	h.Create("app.log.2", "older\n", Start.Add(-72*time.Hour))
+	h.Roll.WithChecker(rollingf.MaxSizeChecker(4)).WithFilter(rollingf.MaxAgeFilter(60 * time.Hour)).
+		WithDefaultMatcher().WithDefaultProcessor()
+
+	if evs := h.Write("large\n"); len(evs) != 1 || evs[0].Err != nil {
+		t.Fatal("rotations", evs)
+	}
+	if got, want := h.Files(), []string{"app.log", "app.log.1", "app.log.2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %v, want %v", got, want)
+	}
+	if h.Content("app.log.1") != "large\n" || h.Content("app.log.2") != "old\n" {
+		t.Fatal("contents")
+	}
+}
+
+func TestHarnessFaults(t *testing.T) {
+	h := New(t, "/logs/app.log")
+	h.Roll.WithChecker(rollingf.MaxSizeChecker(4)).WithFilter(rollingf.MaxBackupsFilter(5)).
+		WithMatcher(rollingf.CompressMatcher(rollingf.Gzip)).WithProcessor(rollingf.Compressor(rollingf.Gzip))
+
+	h.FS.Inject(CompressionFault(syscall.ENOSPC))
+	evs := h.Write("first\n")
+	if len(evs) != 1 || !errors.Is(evs[0].Err, syscall.ENOSPC) {
+		t.Fatal("rotations", evs)
+	}
+	// the rolled file is kept for the next rolling
+	if got, want := h.Files(), []string{"_app.log", "app.log"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %v, want %v", got, want)
+	}
+
+	h.FS.Reset()
+	h.FS.Inject(Fault{Op: OpRename, Nth: 2})
+	renames := h.FS.Calls(OpRename)
+	if evs = h.Write("second\n"); len(evs) != 1 || !errors.Is(evs[0].Err, syscall.EIO) {
+		t.Fatal("rotations", evs)
+	}
+	if h.FS.Calls(OpRename) <= renames {
+		t.Fatal("renames", h.FS.Calls(OpRename))
+	}
+
+	h.FS.Reset()
+	if evs = h.Write("third\n"); len(evs) != 1 || evs[0].Err != nil {
+		t.Fatal("rotations", evs)
+	}
+	for _, name := range h.Files() {
+		if name != "app.log" && name[len(name)-3:] != ".gz" {
+			t.Fatal("not compressed", h.Files())
+		}
+	}
+}
+
+func TestHarnessManualCheck(t *testing.T) {
+	h := New(t, "/logs/app.log")
+	h.Roll.WithChecker(rollingf.MaxSizeChecker(4)).WithFilter(rollingf.MaxBackupsFilter(2)).
+		WithDefaultMatcher().WithDefaultProcessor()
+
+	// the writes do not roll in the background
+	if _, err := h.Roll.Write([]byte("large\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got, want := h.Files(), []string{"app.log"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %v, want %v", got, want)
+	}
+	if evs := h.Check(); len(evs) != 1 || evs[0].Err != nil {
+		t.Fatal("rotations", evs)
+	}
+
+	// one rotation per step
+	for i := 0; i < 20; i++ {
+		if evs := h.Write("large\n"); len(evs) != 1 || evs[0].Err != nil {
+			t.Fatal(i, "rotations", evs)
+		}
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	c := NewFakeClock(Start)
+	c.Add(time.Minute)
+	if c.Since(Start) != time.Minute {
+		t.Fatal(c.Now())
+	}
+	c.Set(Start)
+	if !c.Now().Equal(Start) {
+		t.Fatal(c.Now())
+	}
+}
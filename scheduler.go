@@ -0,0 +1,306 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler runs the background work of many Rolls by a few goroutines and one timer, instead of the goroutines
+// and the tickers of each Roll: the checks after the writes, the periodic tasks of WithRetentionInterval,
+// IdleTimeout and CompressActive, and the processing of the rollings, eg. the compressions. See WithScheduler.
+//
+// The files watched by WatchFile and the buffers of MmapBuffer keep their own goroutines.
+type Scheduler struct {
+	checks  *jobQueue
+	process *jobQueue
+
+	mu     sync.Mutex
+	tasks  taskHeap
+	wake   chan struct{}
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// NewScheduler runs the checks and the periodic tasks by workers goroutines, and at most processWorkers rollings
+// are processed at the same time, which bounds the concurrent compressions of all the Rolls. Both are at least 1.
+func NewScheduler(workers, processWorkers int) *Scheduler {
+	s := &Scheduler{
+		checks:  newJobQueue(workers),
+		process: newJobQueue(processWorkers),
+		wake:    make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.runTimer()
+	return s
+}
+
+// WithScheduler runs the background work of the Roll by s, shared with the other Rolls of the process.
+// s must be closed after the Rolls.
+func WithScheduler(s *Scheduler) Option {
+	return OptionFunc(func(r *Roll) {
+		r.sched = s
+	})
+}
+
+// Close stops the periodic tasks and waits for the queued checks and processings.
+// The Rolls still using s fall back to their own goroutines.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	close(s.closed)
+	s.mu.Unlock()
+
+	<-s.done
+	s.checks.close()
+	s.process.close()
+	return nil
+}
+
+// every runs fn every d until closed is closed, one run at a time. It returns false if s is closed.
+func (s *Scheduler) every(d time.Duration, closed <-chan struct{}, fn func()) bool {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return false
+	default:
+	}
+	heap.Push(&s.tasks, &task{every: d, next: time.Now().Add(d), closed: closed, fn: fn})
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// runTimer queues the tasks due by a single timer until Close.
+func (s *Scheduler) runTimer() {
+	defer close(s.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		for len(s.tasks) > 0 && !s.tasks[0].next.After(now) {
+			t := s.tasks[0]
+			select {
+			case <-t.closed:
+				heap.Pop(&s.tasks)
+				continue
+			default:
+			}
+			if atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+				s.checks.push(func() {
+					defer atomic.StoreInt32(&t.running, 0)
+					select {
+					case <-t.closed:
+					default:
+						t.fn()
+					}
+				})
+			}
+			t.next = now.Add(t.every)
+			heap.Fix(&s.tasks, 0)
+		}
+		wait := time.Hour
+		if len(s.tasks) > 0 {
+			wait = s.tasks[0].next.Sub(now)
+		}
+		s.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-s.closed:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// task is a periodic task of a Roll, fn is skipped while the previous run is in progress.
+type task struct {
+	every   time.Duration
+	next    time.Time
+	closed  <-chan struct{}
+	fn      func()
+	running int32
+}
+
+// taskHeap orders the tasks by the next run.
+type taskHeap []*task
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h taskHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap) Push(x any)        { *h = append(*h, x.(*task)) }
+func (h *taskHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
+
+// jobQueue runs the jobs in order by a fixed number of goroutines, started on demand.
+type jobQueue struct {
+	max int
+
+	mu      sync.Mutex
+	jobs    []func()
+	running int
+	closed  bool
+	idle    sync.Cond
+}
+
+func newJobQueue(n int) *jobQueue {
+	if n < 1 {
+		n = 1
+	}
+	q := &jobQueue{max: n}
+	q.idle.L = &q.mu
+	return q
+}
+
+// push queues job, it runs in a new goroutine once the queue is closed.
+func (q *jobQueue) push(job func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		go job()
+		return
+	}
+	q.jobs = append(q.jobs, job)
+	if q.running < q.max {
+		q.running++
+		go q.work()
+	}
+}
+
+// work runs the jobs until the queue is empty.
+func (q *jobQueue) work() {
+	q.mu.Lock()
+	for len(q.jobs) > 0 {
+		job := q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+		q.mu.Unlock()
+		job()
+		q.mu.Lock()
+	}
+	q.running--
+	q.idle.Broadcast()
+	q.mu.Unlock()
+}
+
+// close waits for the queued jobs, the later ones run in their own goroutines.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for q.running > 0 {
+		q.idle.Wait()
+	}
+}
+
+// The check states of a Roll run by a Scheduler.
+const (
+	checkIdle int32 = iota
+	checkQueued
+	checkRunning
+	checkRerun // the writes during the check are checked again
+)
+
+// scheduleCheck queues a check of r in the Scheduler, unless one is pending, a check in progress runs again.
+func (r *Roll) scheduleCheck() {
+	for {
+		switch atomic.LoadInt32(&r.checkState) {
+		case checkIdle:
+			if atomic.CompareAndSwapInt32(&r.checkState, checkIdle, checkQueued) {
+				r.sched.checks.push(r.scheduledCheck)
+				return
+			}
+		case checkRunning:
+			if atomic.CompareAndSwapInt32(&r.checkState, checkRunning, checkRerun) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// scheduledCheck runs the checks of r until no write arrives during one, or r is closed.
+func (r *Roll) scheduledCheck() {
+	atomic.StoreInt32(&r.checkState, checkRunning)
+	for {
+		select {
+		case <-r.closed:
+			atomic.StoreInt32(&r.checkState, checkIdle)
+			return
+		default:
+		}
+		r.checkOnce()
+		if atomic.CompareAndSwapInt32(&r.checkState, checkRunning, checkIdle) {
+			return
+		}
+		atomic.StoreInt32(&r.checkState, checkRunning)
+	}
+}
+
+// every runs fn every d until Close, by the Scheduler or a goroutine of its own.
+func (r *Roll) every(d time.Duration, fn func()) {
+	closed := r.closed
+	if r.sched != nil && r.sched.every(d, closed, fn) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case <-ticker.C:
+			}
+			fn()
+		}
+	}()
+}
+
+// goProcess processes a rolling by the Scheduler, or a goroutine of its own.
+func (r *Roll) goProcess(fn func()) {
+	if r.sched != nil {
+		r.sched.process.push(fn)
+		return
+	}
+	go fn()
+}
@@ -0,0 +1,122 @@
+package rollingf
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	dir := t.TempDir()
+	s := NewScheduler(2, 1)
+	defer s.Close()
+
+	const n = 20
+	before := runtime.NumGoroutine()
+	var rolls []*Roll
+	var rotations int32
+	events := make(chan RotateEvent, n)
+	for i := 0; i < n; i++ {
+		r, err := NewE(NewRollConf(path.Join(dir, fmt.Sprintf("app%d.log", i)), DurOneDay, 10, 0, 2),
+			WithScheduler(s), WithRetentionInterval(10*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		r.OnRotate(func(ev RotateEvent) {
+			atomic.AddInt32(&rotations, 1)
+			events <- ev
+		})
+		rolls = append(rolls, r)
+	}
+	// the timer of the Scheduler, no goroutine per Roll
+	if d := runtime.NumGoroutine() - before; d > 3 {
+		t.Fatal("goroutines", d)
+	}
+
+	for _, r := range rolls {
+		if _, err := r.Write([]byte("more than ten bytes\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case ev := <-events:
+			if ev.Err != nil {
+				t.Fatal(ev.Err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("rotations", atomic.LoadInt32(&rotations))
+		}
+	}
+
+	// the sweeps keep 2 backups of each
+	for i := 0; i < n; i++ {
+		for j := 2; j <= 4; j++ {
+			if err := os.WriteFile(path.Join(dir, fmt.Sprintf("app%d.log.%d", i, j)), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == n*3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("files", len(entries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// slowChecker never rolls, it fails the test if the checks overlap.
+type slowChecker struct {
+	running, overlapped, checks int32
+}
+
+func (c *slowChecker) Name() string {
+	return "slowChecker"
+}
+
+func (c *slowChecker) Check(string, *Rstat) (bool, error) {
+	if atomic.AddInt32(&c.running, 1) > 1 {
+		atomic.StoreInt32(&c.overlapped, 1)
+	}
+	atomic.AddInt32(&c.checks, 1)
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&c.running, -1)
+	return false, nil
+}
+
+func TestSchedulerCheckOnce(t *testing.T) {
+	s := NewScheduler(4, 1)
+	defer s.Close()
+
+	c := &slowChecker{}
+	r := NewC(t.TempDir()+"/app.log", WithScheduler(s)).WithChecker(c)
+	defer r.Close()
+
+	for i := 0; i < 100; i++ {
+		r.Write([]byte("a\n"))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&c.overlapped) != 0 {
+		t.Fatal("the checks of a Roll overlapped")
+	}
+	if n := atomic.LoadInt32(&c.checks); n == 0 || n == 100 {
+		t.Fatal("checks", n)
+	}
+	// the last write is checked
+	if atomic.LoadInt32(&r.checkState) != checkIdle {
+		t.Fatal("check state", r.checkState)
+	}
+}
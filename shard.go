@@ -0,0 +1,171 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"time"
+)
+
+// mkdirAller is implemented by the FS which can create the directories, the others are regarded as creating
+// them implicitly, eg. MemFS.
+type mkdirAller interface {
+	MkdirAll(name string, perm os.FileMode) error
+}
+
+var (
+	_ mkdirAller = osFS{}
+	_ mkdirAller = (*MemFS)(nil)
+	_ mkdirAller = (*indexFS)(nil)
+)
+
+func (osFS) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+// MkdirAll does nothing, the directories of the MemFS exist as long as the files in them.
+func (m *MemFS) MkdirAll(string, os.FileMode) error {
+	return nil
+}
+
+func (f *indexFS) MkdirAll(name string, perm os.FileMode) error {
+	// the new directory changes the modification time of dir, which drops the cache
+	return mkdirAll(f.FS, name, perm)
+}
+
+func mkdirAll(fsys FS, name string, perm os.FileMode) error {
+	if m, ok := fsOrDefault(fsys).(mkdirAller); ok {
+		return m.MkdirAll(name, perm)
+	}
+	return nil
+}
+
+const shardLayout = "2006/01/02"
+
+// ShardByDate moves the backups into the directories of their rolling dates, eg. dir/2024/06/01/app.log.1.gz,
+// so a directory never holds thousands of backups. The date is the modification time in the location of WithLocation.
+//
+// The matcher and the filters see the backups in the date directories too, named by the paths relative to dir,
+// the directories emptied by the filters are removed.
+func ShardByDate() Option {
+	return OptionFunc(func(r *Roll) {
+		r.shard = true
+	})
+}
+
+// shardEntry is a file in a date directory, named by the path relative to the directory of the Roll.
+type shardEntry struct {
+	os.DirEntry
+	name string
+}
+
+func (e *shardEntry) Name() string {
+	return e.name
+}
+
+// walkShards calls fn for the entries in the date directories of dir, named by the paths relative to dir.
+// The empty date directories are reported with a nil entry.
+func (r *Roll) walkShards(dir string, fn func(e os.DirEntry)) error {
+	var walk func(rel string, depth int) error
+	walk = func(rel string, depth int) error {
+		entries, err := r.fs.ReadDir(path.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		if depth == 3 {
+			if len(entries) == 0 {
+				fn(&shardEntry{name: rel})
+			}
+			for _, e := range entries {
+				fn(&shardEntry{DirEntry: e, name: path.Join(rel, e.Name())})
+			}
+			return nil
+		}
+
+		width := 2
+		if depth == 0 {
+			width = 4
+		}
+		for _, e := range entries {
+			if !e.IsDir() || len(e.Name()) != width || !isDigits(e.Name()) {
+				continue
+			}
+			if err := walk(path.Join(rel, e.Name()), depth+1); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk("", 0)
+}
+
+// shardFiles returns the regular files in the date directories of dir.
+func (r *Roll) shardFiles(dir string) ([]os.DirEntry, error) {
+	if !r.shard {
+		return nil, nil
+	}
+	var files []os.DirEntry
+	err := r.walkShards(dir, func(e os.DirEntry) {
+		if e.(*shardEntry).DirEntry != nil {
+			files = append(files, e)
+		}
+	})
+	return files, err
+}
+
+// tidyShards moves the backups left in dir into the date directories, and removes the empty date directories.
+func (r *Roll) tidyShards(dir string) error {
+	if !r.shard {
+		return nil
+	}
+	files, err := r.matchFiles(dir)
+	if err != nil {
+		return err
+	}
+	loc := r.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	base := path.Base(r.filePath)
+	for _, e := range files {
+		if _, ok := e.(*shardEntry); ok || e.Name() == base {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		day := info.ModTime().In(loc).Format(shardLayout)
+		if err := mkdirAll(r.fs, path.Join(dir, day), 0755); err != nil {
+			return err
+		}
+		r.debug("[shard] %s --> %s", e.Name(), day)
+		if err := renameFile(r.fs, dir, e.Name(), path.Join(day, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return r.walkShards(dir, func(e os.DirEntry) {
+		if e.(*shardEntry).DirEntry != nil {
+			return
+		}
+		// the parents are left, they are removed once empty by the next tidying
+		r.debug("[shard] remove %s", e.Name())
+		if err := r.fs.Remove(path.Join(dir, e.Name())); err != nil {
+			r.warn("[shard] remove %s err: %v", e.Name(), err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package rollingf
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestShardByDate(t *testing.T) {
+	mfs := NewMemFS()
+	c := &fakeClock{now: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)}
+	r := NewC("/mem/app.log", WithFS(mfs), ShardByDate()).
+		WithClock(c).
+		WithLocation(time.UTC).
+		WithDefaultMatcher().
+		WithDefaultProcessor().
+		WithFilter(MaxBackupsFilter(2))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 16)
+	r.OnRotate(func(ev RotateEvent) {
+		events <- ev
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := r.Write([]byte{'a' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := rollSync(t, r, events); err != nil {
+			t.Fatal(err)
+		}
+		c.Add(24 * time.Hour)
+	}
+
+	for name, content := range map[string]string{"2024/06/03/app.log.1": "c", "2024/06/02/app.log.2": "b"} {
+		if b, err := mfs.ReadFile("/mem/" + name); err != nil || string(b) != content {
+			t.Errorf("%s: %q, want %q, %v", name, b, content, err)
+		}
+	}
+	for _, name := range []string{"app.log.1", "2024/06/01/app.log.3", "2024/06/01/app.log.1"} {
+		if _, err := mfs.Stat("/mem/" + name); !os.IsNotExist(err) {
+			t.Errorf("%s is left: %v", name, err)
+		}
+	}
+
+	backups, err := r.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != "2024/06/03/app.log.1" || backups[1].Index != 2 {
+		t.Errorf("backups %+v", backups)
+	}
+}
+
+func TestShardByDatePurge(t *testing.T) {
+	dir := t.TempDir()
+	day := func(d int) time.Time {
+		return time.Date(2024, 6, d, 12, 0, 0, 0, time.Local)
+	}
+	os.MkdirAll(path.Join(dir, "2024/06/01"), 0755)
+	for name, mtime := range map[string]time.Time{
+		"app.log":              day(4),
+		"app.log.1":            day(3),
+		"app.log.2":            day(2),
+		"2024/06/01/app.log.3": day(1),
+	} {
+		p := path.Join(dir, name)
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime)
+	}
+
+	r := NewC(path.Join(dir, "app.log"), ShardByDate()).
+		WithDefaultMatcher().
+		WithFilter(MaxBackupsFilter(2))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	if err := r.Purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"app.log", "2024/06/03/app.log.1", "2024/06/02/app.log.2"} {
+		if _, err := os.Stat(path.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	// the day emptied by the filter is removed
+	if _, err := os.Stat(path.Join(dir, "2024/06/01")); !os.IsNotExist(err) {
+		t.Errorf("2024/06/01 is left: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+)
+
+// sharedLock serializes the rollings of the processes writing the same file, see SharedFile.
+type sharedLock struct {
+	sem chan struct{} // serializes the goroutines of this process, as flock(2) is held per open file
+	f   File
+	fd  uintptr
+}
+
+// SharedFile lets multiple processes, eg. the workers of a pre-fork server, write the same file and roll it cooperatively.
+//
+// The rollings take an exclusive advisory lock on the lock file ".{base}.lock" in the file's directory,
+// so only one process rolls the file at a time. The other processes find the file replaced by comparing
+// the inodes, and reopen the new file instead of rolling it again. The records written meanwhile go to
+// the backup, and the size checked is the size of the file written by all the processes.
+//
+// It can not be used with WithFlock. It is a no-op on the platforms without flock(2)
+// and the FS whose files have no fd, eg. MemFS.
+func SharedFile() Option {
+	return OptionFunc(func(r *Roll) {
+		r.shared = &sharedLock{sem: make(chan struct{}, 1)}
+	})
+}
+
+// openShared opens the lock file of SharedFile.
+func (r *Roll) openShared() error {
+	if r.shared == nil || r.shared.f != nil {
+		return nil
+	}
+	f, err := r.fs.OpenFile(r.lockPath(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	fd, ok := f.(fder)
+	if !ok {
+		f.Close()
+		r.shared = nil
+		return nil
+	}
+	r.shared.f, r.shared.fd = f, fd.Fd()
+	return nil
+}
+
+func (r *Roll) closeShared() {
+	if r.shared == nil || r.shared.f == nil {
+		return
+	}
+	r.shared.f.Close()
+	r.shared.f = nil
+}
+
+// lock takes the lock, it returns false if the lock is held and wait is false.
+func (l *sharedLock) lock(wait bool) (bool, error) {
+	if wait {
+		l.sem <- struct{}{}
+	} else {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			return false, nil
+		}
+	}
+
+	var err error
+	if wait {
+		err = lockFd(l.fd)
+	} else if err = tryLockFd(l.fd); err == ErrLocked {
+		<-l.sem
+		return false, nil
+	}
+	if err != nil {
+		<-l.sem
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *sharedLock) unlock() {
+	unlockFd(l.fd)
+	<-l.sem
+}
+
+// followShared reopens the file if another process rolled it, it skips if a rolling is in progress.
+func (r *Roll) followShared() {
+	r.fOpLock()
+	defer r.fOpUnlock()
+
+	ok, err := r.shared.lock(false)
+	if !ok {
+		if err != nil {
+			r.warn("[followShared] err: %v", err)
+		}
+		return
+	}
+	defer r.shared.unlock()
+
+	if _, err = r.reopenMoved(); err != nil {
+		r.warn("[followShared] err: %v", err)
+	}
+}
+
+// reopenMoved reopens the file if the file at the path is not the one opened, it returns true if reopened.
+// The caller holds the file lock, and the sharedLock if any.
+func (r *Roll) reopenMoved() (bool, error) {
+	if r.f == nil {
+		// closed for idling, the wake opens the file at the path
+		return false, nil
+	}
+	cur, err := r.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	info, err := r.fs.Stat(r.filePath)
+	if os.IsNotExist(err) {
+		// the process rolling the file died before renaming the temporary file back, see SharedFile
+		err = r.fs.Rename(r.tmpFilePath, r.filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	} else if err != nil {
+		return false, err
+	} else if sameFile(cur, info) {
+		r.st.refresh(cur.Size())
+		return false, nil
+	}
+
+	r.debug("[reopenMoved] the file is moved")
+	if err = r.flushBuffer(); err != nil {
+		return false, err
+	}
+	f, err := r.createFile(r.filePath)
+	if err != nil {
+		return false, err
+	}
+	if info, err = f.Stat(); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err = r.closeFile(); err != nil {
+		r.warn("[closeFile] err: %v", err)
+	}
+	r.f = f
+	r.st.reset(info)
+	r.tails.rotated(r.fs, f.Name())
+	if err = r.redirectStdio(); err != nil {
+		r.warn("[reopenMoved] err: %v", err)
+	}
+	return true, nil
+}
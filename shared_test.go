@@ -0,0 +1,58 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+func TestSharedFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no flock")
+	}
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	c := NewRollConf(fp, DurOneDay, 0, 0, 2)
+	// the Rolls lock the distinct open files, the same as the processes
+	r1, err := NewE(c, SharedFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1.Write([]byte("a\n"))
+	r2, err := NewE(c, SharedFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan RotateEvent, 1)
+	r1.OnRotate(func(ev RotateEvent) { events <- ev })
+	if err = rollSync(t, r1, events); err != nil {
+		t.Fatal(err)
+	}
+
+	// r2 finds the file rolled by r1, and reopens it instead of rolling it again
+	if err = r2.roll("test"); err != nil {
+		t.Fatal(err)
+	}
+	r2.Write([]byte("d\n"))
+	r1.Write([]byte("e\n"))
+	r1.Close()
+	r2.Close()
+
+	for name, want := range map[string]string{
+		"app.log":   "d\ne\n",
+		"app.log.1": "a\n",
+	} {
+		b, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: %q, want %q", name, b, want)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "app.log.2")); !os.IsNotExist(err) {
+		t.Error("rolled twice")
+	}
+}
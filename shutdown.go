@@ -0,0 +1,84 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ShutdownError reports the work abandoned at the deadline of Shutdown, the file is closed anyway.
+type ShutdownError struct {
+	Err     error // the error of the ctx of Shutdown, nil if the work failed before the deadline
+	Dropped int64 // the bytes queued by NonBlocking but not written
+	Rolling bool  // the rolling was cancelled or failed, the next start finishes it
+}
+
+func (e *ShutdownError) Error() string {
+	msg := fmt.Sprintf("rollingf: shutdown: dropped %d bytes, rolling left: %v", e.Dropped, e.Rolling)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown closes the file like Close, but bounded by ctx, eg. in the preStop hook of Kubernetes:
+// the writes are refused, the records queued by NonBlocking are written and the rolling in progress
+// is finished until ctx is done. The work left then is abandoned and reported by a *ShutdownError.
+func (r *Roll) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.cancel()
+		case <-done:
+		}
+	}()
+
+	// the records dropped are counted by the writer of the queue
+	dropped, err := r.close(ctx)
+	r.cancel()
+	if err != nil {
+		return err
+	}
+
+	se := &ShutdownError{Err: ctx.Err(), Dropped: dropped, Rolling: r.rollingLeft()}
+	if se.Dropped > 0 || se.Rolling {
+		return se
+	}
+	return nil
+}
+
+// CloseWithTimeout is Shutdown bounded by d.
+func (r *Roll) CloseWithTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return r.Shutdown(ctx)
+}
+
+// rollingLeft reports whether the writes were switched to the temporary file but the rolling is not finished.
+func (r *Roll) rollingLeft() bool {
+	if r.renameReopen {
+		return false
+	}
+	_, err := r.fs.Stat(r.tmpFilePath)
+	return err == nil
+}
@@ -0,0 +1,94 @@
+package rollingf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Run("drained", func(t *testing.T) {
+		fp := path.Join(t.TempDir(), "app.log")
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), NonBlocking(16, DropNewest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Write([]byte("a"))
+		r.Write([]byte("b"))
+
+		if err = r.CloseWithTimeout(5 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = r.Write([]byte("c")); err != os.ErrClosed {
+			t.Fatal("write after shutdown", err)
+		}
+		if b, _ := os.ReadFile(fp); string(b) != "ab" {
+			t.Fatalf("%q", b)
+		}
+	})
+
+	t.Run("rolling finished", func(t *testing.T) {
+		fp := path.Join(t.TempDir(), "app.log")
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), Compress(Gzip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Write([]byte("a"))
+		r.MarkRotate()
+		r.Write([]byte("b"))
+
+		if err = r.CloseWithTimeout(5 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := os.ReadFile(fp); string(b) != "b" {
+			t.Fatalf("%q", b)
+		}
+		if _, err = os.Stat(fp + ".1.gz"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("queue abandoned", func(t *testing.T) {
+		fp := path.Join(t.TempDir(), "app.log")
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), NonBlocking(16, DropNewest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the background writer is stuck, eg. by a slow disk
+		r.fOpLock()
+		r.Write([]byte("ab"))
+		r.Write([]byte("cd"))
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- r.CloseWithTimeout(50 * time.Millisecond)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		r.fOpUnlock()
+
+		var se *ShutdownError
+		if err = <-errc; !errors.As(err, &se) || se.Dropped == 0 || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rolling abandoned", func(t *testing.T) {
+		fp := path.Join(t.TempDir(), "app.log")
+		r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), Compress(Gzip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// takes 64s unless cancelled
+		r.WithProcessor(Compressor(Gzip).WithRateLimit(SizeKB))
+		r.Write(make([]byte, 64*SizeKB))
+		r.MarkRotate()
+
+		var se *ShutdownError
+		if err = r.CloseWithTimeout(50 * time.Millisecond); !errors.As(err, &se) || !se.Rolling || se.Dropped != 0 {
+			t.Fatal(err)
+		}
+	})
+}
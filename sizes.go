@@ -0,0 +1,65 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "os"
+
+// SizeStats is a snapshot of the bytes of a Roll, for the capacity planning.
+type SizeStats struct {
+	File       int64 // the bytes of the file on disk, it is the temporary file while Rolling
+	Rolling    bool  // whether the writes go to the temporary file, the rolling is in progress
+	Pending    int64 // the bytes accepted by Write but not in the file yet, queued by NonBlocking or buffered by MmapBuffer
+	Backups    int64 // the bytes of the backups on disk, compressed or not
+	Compressed int64 // the bytes of the compressed backups, included in Backups
+	Total      int64 // the bytes on disk, File plus Backups
+}
+
+// Sizes returns the bytes of the file, the pending writes and the backups matched by the matcher.
+func (r *Roll) Sizes() (SizeStats, error) {
+	var s SizeStats
+	r.fWLock()
+	var (
+		info os.FileInfo
+		err  error
+	)
+	if r.f != nil {
+		info, err = r.f.Stat()
+		s.Rolling = r.f.Name() == r.tmpFilePath
+	} else {
+		// closed for idling
+		info, err = r.fs.Stat(r.filePath)
+	}
+	r.fWUnlock()
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	if info != nil {
+		s.File = info.Size()
+	}
+	s.Pending = r.async.pendingBytes() + r.mbuf.buffered()
+
+	backups, err := r.Backups()
+	if err != nil {
+		return s, err
+	}
+	for _, b := range backups {
+		s.Backups += b.Size
+		if b.Compressed {
+			s.Compressed += b.Size
+		}
+	}
+	s.Total = s.File + s.Backups
+	return s, nil
+}
@@ -0,0 +1,62 @@
+package rollingf
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSizes(t *testing.T) {
+	mfs := NewMemFS()
+	for name, size := range map[string]int{"app.log": 10, "app.log.1": 20, "app.log.2.gz": 5} {
+		f, _ := mfs.OpenFile("/mem/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Write(make([]byte, size))
+		f.Close()
+	}
+	r := NewC("/mem/app.log", WithFS(mfs), Compress(Gzip), CompressAfter(1))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	r.Write([]byte("hello"))
+	s, err := r.Sizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SizeStats{File: 15, Backups: 25, Compressed: 5, Total: 40}
+	if s != want {
+		t.Fatalf("%+v, want %+v", s, want)
+	}
+}
+
+func TestStatFollowsNewFile(t *testing.T) {
+	mfs := NewMemFS()
+	r := NewC("/mem/app.log", WithFS(mfs)).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	r.Write([]byte("hello"))
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.st.Size(); n != 0 {
+		t.Fatalf("size of the new file: %d", n)
+	}
+	r.Write([]byte("world"))
+	if n := r.st.Size(); n != 5 {
+		t.Fatalf("size: %d", n)
+	}
+}
+
+func TestAsyncPending(t *testing.T) {
+	w := &asyncWriter{ch: make(chan [][]byte, 1), policy: DropOldest}
+	w.enqueue([][]byte{[]byte("hello")})
+	w.enqueue([][]byte{[]byte("hi"), []byte("!")})
+	if n := w.pendingBytes(); n != 3 {
+		t.Fatalf("pending: %d", n)
+	}
+}
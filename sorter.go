@@ -0,0 +1,141 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// Sorter orders the matched files from the newest to the oldest, the filters and the processors rely on the order,
+// eg. MaxBackupsFilter removes the files after the first ones.
+type Sorter interface {
+	// Init the sorter with the file's base name
+	Init(base string)
+
+	// Sort sorts the files in place, the file itself is always the first.
+	Sort(files []os.DirEntry)
+}
+
+var (
+	_ Sorter = (*numericSorter)(nil)
+	_ Sorter = (*timestampSorter)(nil)
+	_ Sorter = (*mtimeSorter)(nil)
+)
+
+type numericSorter struct {
+	base string
+}
+
+// NumericSorter sorts the files by the tail number, the compression suffix is ignored. It is the default.
+//
+// eg.
+// app.log app.log.1 app.log.2.gz app.log.10.gz ...
+func NumericSorter() *numericSorter {
+	return &numericSorter{}
+}
+
+func (s *numericSorter) Init(base string) {
+	s.base = base
+}
+
+func (s *numericSorter) Sort(files []os.DirEntry) {
+	sort.Slice(files, func(i, j int) bool {
+		f1 := files[i].Name()
+		f2 := files[j].Name()
+
+		n1, n2 := parseBackupName(s.base, f1).index, parseBackupName(s.base, f2).index
+		if n1 != n2 {
+			return n1 < n2
+		}
+		return len(f1) < len(f2) || (len(f1) == len(f2) && f1 < f2)
+	})
+}
+
+type timestampSorter struct {
+	parser timeParser
+	base   string
+}
+
+// TimestampSorter sorts the files by the rolling time embedded in the names produced by n,
+// eg. TimestampNamer and LumberjackNamer. The files without a timestamp are sorted by the ModTime.
+func TimestampSorter(n Namer) *timestampSorter {
+	s := &timestampSorter{}
+	s.parser, _ = n.(timeParser)
+	return s
+}
+
+func (s *timestampSorter) Init(base string) {
+	s.base = base
+}
+
+func (s *timestampSorter) Sort(files []os.DirEntry) {
+	sortByTime(s.base, files, func(e os.DirEntry) time.Time {
+		if s.parser != nil {
+			if t, ok := s.parser.parseTime(s.base, path.Base(e.Name())); ok {
+				return t
+			}
+		}
+		return modTime(e)
+	})
+}
+
+type mtimeSorter struct {
+	base string
+}
+
+// MtimeSorter sorts the files by the ModTime, for the custom naming schemes carrying no order.
+// The ModTime changes on copies and restores, prefer the other sorters.
+func MtimeSorter() *mtimeSorter {
+	return &mtimeSorter{}
+}
+
+func (s *mtimeSorter) Init(base string) {
+	s.base = base
+}
+
+func (s *mtimeSorter) Sort(files []os.DirEntry) {
+	sortByTime(s.base, files, modTime)
+}
+
+// modTime returns the ModTime of the file, zero if it is gone.
+func modTime(e os.DirEntry) time.Time {
+	info, err := e.Info()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// sortByTime sorts the files from the latest time to the earliest, the file base is the first.
+func sortByTime(base string, files []os.DirEntry, timeOf func(os.DirEntry) time.Time) {
+	times := make(map[string]time.Time, len(files))
+	for _, e := range files {
+		times[e.Name()] = timeOf(e)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		f1, f2 := files[i].Name(), files[j].Name()
+		if f1 == base || f2 == base {
+			return f1 == base && f2 != base
+		}
+		t1, t2 := times[f1], times[f2]
+		if !t1.Equal(t2) {
+			return t1.After(t2)
+		}
+		return f1 < f2
+	})
+}
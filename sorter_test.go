@@ -0,0 +1,69 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSorters(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	n := TimestampNamer("")
+	for name, c := range map[string]struct {
+		s     Sorter
+		files []string
+		want  []string
+	}{
+		"numeric": {
+			s:     NumericSorter(),
+			files: []string{"app.log.10.gz", "app.log.2", "app.log", "app.log.1.gz"},
+			want:  []string{"app.log", "app.log.1.gz", "app.log.2", "app.log.10.gz"},
+		},
+		"timestamp": {
+			s: TimestampSorter(n),
+			files: []string{
+				n.Name("app.log", 0, now.Add(-2*time.Hour)) + ".gz",
+				"app.log",
+				n.Name("app.log", 0, now.Add(-time.Hour)),
+				n.Name("app.log", 0, now.Add(-3*time.Hour)),
+			},
+			want: []string{
+				"app.log",
+				n.Name("app.log", 0, now.Add(-time.Hour)),
+				n.Name("app.log", 0, now.Add(-2*time.Hour)) + ".gz",
+				n.Name("app.log", 0, now.Add(-3*time.Hour)),
+			},
+		},
+		"mtime": {
+			s:     MtimeSorter(),
+			files: []string{"app.log.c", "app.log.a", "app.log", "app.log.b"},
+			want:  []string{"app.log", "app.log.b", "app.log.a", "app.log.c"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i, f := range c.files {
+				p := path.Join(dir, f)
+				if err := os.WriteFile(p, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				// the later in the list, the newer
+				mt := now.Add(-time.Duration(len(c.files)-i) * time.Minute)
+				os.Chtimes(p, mt, mt)
+			}
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c.s.Init("app.log")
+			c.s.Sort(files)
+			for i, e := range files {
+				if e.Name() != c.want[i] {
+					t.Fatalf("%d: %s, want %s", i, e.Name(), c.want[i])
+				}
+			}
+		})
+	}
+}
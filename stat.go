@@ -17,7 +17,6 @@ package rollingf
 import (
 	"fmt"
 	"io/fs"
-	"os"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -26,6 +25,17 @@ import (
 
 const tsFormat = "2006-01-02 15:04:05"
 
+// BirthSource tells where the birth time of the file comes from.
+type BirthSource string
+
+const (
+	BirthNone       BirthSource = ""            // unknown yet, the file has not been written
+	BirthPlatform   BirthSource = "birthtime"   // the birth time provided by the filesystem
+	BirthState      BirthSource = "state"       // the last rotation persisted by the StateFile option
+	BirthCtime      BirthSource = "ctime"       // the status change time when the file was opened
+	BirthFirstWrite BirthSource = "first-write" // the time of the first write
+)
+
 // Rstat wraps os.FileInfo with local stored information about the file.
 type Rstat struct {
 	info fs.FileInfo
@@ -33,12 +43,75 @@ type Rstat struct {
 	rSize         int64
 	modeTime      time.Time
 	birthTimespec *syscall.Timespec
+	birthSource   BirthSource
+	priorWrite    time.Time // the last write before the file was opened, see PriorWrite
 
 	mu      sync.RWMutex
 	checkm  sync.RWMutex
 	checked bool
+
+	rate  *rateTracker // guarded by mu, see TrackRate
+	clock Clock        // the Clock of the Roll, the system time if nil
+}
+
+// StatSnapshot is a read-only copy of the Rstat, taken for a check, see CheckerV2.
+type StatSnapshot struct {
+	Name        string      // the base name of the file
+	Size        int64       // the bytes of the file, including the writes not synced
+	ModTime     time.Time   // the time of the last write
+	Birth       time.Time   // the time the file was started, zero if unknown
+	BirthSource BirthSource // where Birth comes from
+	PriorWrite  time.Time   // the last write before the file was opened, see PriorWrite
+}
+
+// Snapshot copies the stat.
+func (r *Rstat) Snapshot() StatSnapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s := StatSnapshot{
+		Size:        atomic.LoadInt64(&r.rSize),
+		ModTime:     r.modeTime,
+		BirthSource: r.birthSource,
+		PriorWrite:  r.priorWrite,
+	}
+	if r.info != nil {
+		s.Name = r.info.Name()
+	}
+	if r.birthTimespec != nil {
+		s.Birth = time.Unix(r.birthTimespec.Unix())
+	}
+	return s
+}
+
+// statOf rebuilds a Rstat from the snapshot s, for the Checkers adapted by AdaptChecker.
+func statOf(s StatSnapshot) *Rstat {
+	st := &Rstat{
+		info:        snapshotInfo{s},
+		rSize:       s.Size,
+		modeTime:    s.ModTime,
+		birthSource: s.BirthSource,
+		priorWrite:  s.PriorWrite,
+	}
+	if !s.Birth.IsZero() {
+		ts := syscall.NsecToTimespec(s.Birth.UnixNano())
+		st.birthTimespec = &ts
+	}
+	return st
 }
 
+// snapshotInfo is the fs.FileInfo of a snapshot.
+type snapshotInfo struct {
+	s StatSnapshot
+}
+
+func (i snapshotInfo) Name() string       { return i.s.Name }
+func (i snapshotInfo) Size() int64        { return i.s.Size }
+func (i snapshotInfo) Mode() fs.FileMode  { return 0644 }
+func (i snapshotInfo) ModTime() time.Time { return i.s.ModTime }
+func (i snapshotInfo) IsDir() bool        { return false }
+func (i snapshotInfo) Sys() interface{}   { return nil }
+
 // FileInfo returns the underlying fs.FileInfo.
 func (r *Rstat) FileInfo() fs.FileInfo {
 	r.mu.RLock()
@@ -82,7 +155,7 @@ func (r *Rstat) IsDir() bool {
 	return r.info.IsDir()
 }
 
-// Birthtimespec returns the file's birth time.
+// Birthtimespec returns the file's birth time, see BirthSource for where it comes from.
 func (r *Rstat) Birthtimespec() (bool, syscall.Timespec) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -94,33 +167,94 @@ func (r *Rstat) Birthtimespec() (bool, syscall.Timespec) {
 	return true, *r.birthTimespec
 }
 
+// BirthSource returns where the birth time comes from.
+//
+// The persisted state is preferred, then the platform birth time, the ctime and the time of the first write.
+func (r *Rstat) BirthSource() BirthSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.birthSource
+}
+
 func (r *Rstat) String() string {
-	return fmt.Sprintf("%s, rsize: %d bytes, modeTime: %v, birthTimespec: %v",
-		r.info.Name(), r.rSize, r.modeTime.Format(tsFormat), time.Unix(r.birthTimespec.Sec, 0).Format(tsFormat))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	birth := "unknown"
+	if r.birthTimespec != nil {
+		birth = time.Unix(r.birthTimespec.Unix()).Format(tsFormat)
+	}
+	return fmt.Sprintf("%s, rsize: %d bytes, modeTime: %v, birthTimespec: %v(%s)",
+		r.info.Name(), r.rSize, r.modeTime.Format(tsFormat), birth, r.birthSource)
 }
 
-func (r *Rstat) reset(filePath string) error {
+func (r *Rstat) reset(info fs.FileInfo) {
 	r.Lock()
 	defer r.Unlock()
 
-	info, err := os.Stat(filePath)
-	if err != nil {
-		return err
-	}
-
 	r.info = info
 	r.rSize = info.Size()
 	r.modeTime = info.ModTime()
 
-	stat, ok := r.info.Sys().(*syscall.Stat_t)
-	if ok {
-		r.birthTimespec = &stat.Birthtimespec
+	r.birthTimespec, r.birthSource = nil, BirthNone
+	birth, ctime := statTimes(info)
+	switch {
+	case birth != nil && birth.Nano() > 0:
+		r.birthTimespec, r.birthSource = birth, BirthPlatform
+	case ctime != nil && ctime.Nano() > 0:
+		r.birthTimespec, r.birthSource = ctime, BirthCtime
 	}
 
+	r.priorWrite = time.Time{}
+	if info.Size() > 0 {
+		r.priorWrite = info.ModTime()
+	}
+
+	r.rate.clear(r.now())
 	r.SetChecked(false)
+}
 
-	debug("[reset]")
-	return nil
+// setPriorWrite restores the last write persisted by the RollState, if it is later than the file's mtime.
+func (r *Rstat) setPriorWrite(t time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	if t.After(r.priorWrite) {
+		r.priorWrite = t
+	}
+}
+
+// PriorWrite returns the time of the last write to the file before it was opened,
+// it is zero if the file was empty.
+func (r *Rstat) PriorWrite() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.priorWrite
+}
+
+// setBirth overrides the birth time by the persisted RollState, which records the rotations exactly.
+func (r *Rstat) setBirth(t time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	ts := syscall.NsecToTimespec(t.UnixNano())
+	r.birthTimespec, r.birthSource = &ts, BirthState
+}
+
+// setClock stamps the writes by c.
+func (r *Rstat) setClock(c Clock) {
+	r.Lock()
+	defer r.Unlock()
+	r.clock = c
+}
+
+// now is the time of the clock, the caller holds mu.
+func (r *Rstat) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
 }
 
 func (r *Rstat) update(size int64) {
@@ -128,10 +262,23 @@ func (r *Rstat) update(size int64) {
 	defer r.Unlock()
 
 	atomic.AddInt64(&r.rSize, size)
-	r.modeTime = time.Now()
+	r.modeTime = r.now()
+	r.rate.add(r.modeTime, size)
+	if r.birthTimespec == nil {
+		ts := syscall.NsecToTimespec(r.modeTime.UnixNano())
+		r.birthTimespec, r.birthSource = &ts, BirthFirstWrite
+	}
 	r.SetChecked(false)
 }
 
+// refresh takes the size of the file written by the other processes too, see SharedFile.
+func (r *Rstat) refresh(size int64) {
+	r.Lock()
+	defer r.Unlock()
+
+	atomic.StoreInt64(&r.rSize, size)
+}
+
 func (r *Rstat) SetChecked(checked bool) {
 	r.checkm.Lock()
 	defer r.checkm.Unlock()
@@ -164,3 +311,91 @@ func (r *Rstat) Unlock() {
 func (r *Rstat) RUnlock() {
 	r.mu.RUnlock()
 }
+
+// TrackRate starts counting the bytes written per bucket for the rate-based checkers, the recent buckets are kept.
+// A shorter tracking than the current one is ignored, the counts restart with the file after the rolling.
+func (r *Rstat) TrackRate(bucket time.Duration, buckets int) {
+	r.Lock()
+	defer r.Unlock()
+
+	if bucket <= 0 || buckets <= 0 {
+		return
+	}
+	if r.rate != nil && r.rate.bucket == bucket && len(r.rate.counts) >= buckets+1 {
+		return
+	}
+	r.rate = newRateTracker(bucket, buckets+1, r.now())
+}
+
+// Rates returns the bytes written in each of the last n complete buckets, the oldest first.
+// It returns false if the rate is not tracked for n buckets yet, see TrackRate.
+func (r *Rstat) Rates(n int) ([]int64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.rate == nil {
+		return nil, false
+	}
+	return r.rate.last(r.now(), n)
+}
+
+// rateTracker counts the bytes in the fixed-length buckets of the time, in a ring of the recent buckets.
+type rateTracker struct {
+	bucket time.Duration
+	counts []int64
+	epochs []int64 // the bucket number of the counts, the count is stale if it is not the expected one
+	since  int64   // the bucket the tracking started in
+}
+
+func newRateTracker(bucket time.Duration, size int, now time.Time) *rateTracker {
+	t := &rateTracker{
+		bucket: bucket,
+		counts: make([]int64, size),
+		epochs: make([]int64, size),
+	}
+	t.clear(now)
+	return t
+}
+
+func (t *rateTracker) epoch(at time.Time) int64 {
+	return at.UnixNano() / int64(t.bucket)
+}
+
+func (t *rateTracker) clear(now time.Time) {
+	if t == nil {
+		return
+	}
+	for i := range t.epochs {
+		t.epochs[i] = -1
+		t.counts[i] = 0
+	}
+	t.since = t.epoch(now)
+}
+
+func (t *rateTracker) add(at time.Time, n int64) {
+	if t == nil {
+		return
+	}
+	e := t.epoch(at)
+	i := int(e % int64(len(t.counts)))
+	if t.epochs[i] != e {
+		t.epochs[i], t.counts[i] = e, 0
+	}
+	t.counts[i] += n
+}
+
+func (t *rateTracker) last(now time.Time, n int) ([]int64, bool) {
+	cur := t.epoch(now)
+	// the first bucket tracked is partial
+	if n <= 0 || n >= len(t.counts) || cur-int64(n) <= t.since {
+		return nil, false
+	}
+	counts := make([]int64, n)
+	for k := 0; k < n; k++ {
+		e := cur - int64(n) + int64(k)
+		if i := int(e % int64(len(t.counts))); t.epochs[i] == e {
+			counts[k] = t.counts[i]
+		}
+	}
+	return counts, true
+}
@@ -0,0 +1,146 @@
+package rollingf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateTracker(t *testing.T) {
+	tr := newRateTracker(time.Second, 4, time.Now())
+	tr.since = 0
+
+	base := time.Unix(100, 0)
+	tr.add(base, 10)
+	tr.add(base.Add(time.Second), 20)
+	tr.add(base.Add(time.Second+time.Millisecond), 5)
+	tr.add(base.Add(3*time.Second), 40)
+
+	counts, ok := tr.last(base.Add(4*time.Second), 3)
+	if !ok {
+		t.Fatal("not tracked")
+	}
+	if want := []int64{25, 0, 40}; counts[0] != want[0] || counts[1] != want[1] || counts[2] != want[2] {
+		t.Fatal(counts)
+	}
+	if _, ok := tr.last(base.Add(4*time.Second), 4); ok {
+		t.Fatal("more than the ring")
+	}
+
+	// the ring reused
+	tr.add(base.Add(5*time.Second), 7)
+	counts, _ = tr.last(base.Add(6*time.Second), 3)
+	if counts[0] != 40 || counts[1] != 0 || counts[2] != 7 {
+		t.Fatal(counts)
+	}
+}
+
+func TestWriteRateChecker(t *testing.T) {
+	st := &Rstat{}
+	c := WriteRateChecker(100, 20*time.Millisecond, 2)
+
+	if rolling, _ := c.Check("", st); rolling {
+		t.Fatal("rolled before the rate tracked")
+	}
+	if _, ok := st.Rates(2); ok {
+		t.Fatal("partial buckets counted")
+	}
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	var rolling bool
+	for !rolling && time.Now().Before(deadline) {
+		st.update(50)
+		time.Sleep(time.Millisecond)
+		rolling, _ = c.Check("", st)
+	}
+	if !rolling {
+		t.Fatal("not rolled", c.Explain("", st))
+	}
+
+	st.rate.clear(time.Now())
+	time.Sleep(70 * time.Millisecond)
+	if rolling, _ := c.Check("", st); rolling {
+		t.Fatal("rolled on the idle file", c.Explain("", st))
+	}
+}
+
+type sizeCheckerV2 struct {
+	max  int64
+	ctxs chan context.Context
+}
+
+func (c *sizeCheckerV2) Name() string {
+	return "sizeCheckerV2"
+}
+
+func (c *sizeCheckerV2) CheckContext(ctx context.Context, _ string, st StatSnapshot) (bool, error) {
+	select {
+	case c.ctxs <- ctx:
+	default:
+	}
+	return st.Size >= c.max, nil
+}
+
+func TestCheckerV2(t *testing.T) {
+	c := &sizeCheckerV2{max: 100, ctxs: make(chan context.Context, 1)}
+	events := make(chan RotateEvent, 1)
+	r := NewC(t.TempDir() + "/app.log").
+		WithCheckerV2(c).
+		WithDefaultMatcher().
+		WithDefaultProcessor().
+		OnRotate(func(ev RotateEvent) {
+			select {
+			case events <- ev:
+			default:
+			}
+		})
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+
+	write(r)
+	select {
+	case ev := <-events:
+		if !strings.HasPrefix(ev.Reason, "sizeCheckerV2") || ev.Err != nil {
+			t.Fatal(ev.Reason, ev.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no rotation")
+	}
+
+	ctx := <-c.ctxs
+	if ctx.Err() != nil {
+		t.Fatal("ctx done before Close")
+	}
+	r.Close()
+	if ctx.Err() == nil {
+		t.Fatal("ctx not done by Close")
+	}
+}
+
+func TestAdaptChecker(t *testing.T) {
+	st := &Rstat{}
+	st.update(150)
+	st.setPriorWrite(time.Unix(100, 0))
+
+	snap := st.Snapshot()
+	if snap.Size != 150 || !snap.PriorWrite.Equal(time.Unix(100, 0)) {
+		t.Fatal(snap)
+	}
+
+	c := AdaptChecker(MaxSizeChecker(100))
+	if rolling, err := c.CheckContext(context.Background(), "", snap); !rolling || err != nil {
+		t.Fatal(rolling, err)
+	}
+	snap.Size = 50
+	if rolling, _ := c.CheckContext(context.Background(), "", snap); rolling {
+		t.Fatal("rolled under the max size")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.CheckContext(ctx, "", snap); err == nil {
+		t.Fatal("checked on the done ctx")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RollState is the rotation metadata persisted across the restarts, see StateFile.
+type RollState struct {
+	LastRotation time.Time `json:"last_rotation"` // when the file was started
+	Bytes        int64     `json:"bytes"`         // the bytes written to the file when the state was saved
+	Sequence     int64     `json:"sequence"`      // the number of the rotations
+	LastWrite    time.Time `json:"last_write"`    // the last write to the file, zero if it was never written
+	Resource     Resource  `json:"resource"`      // where the file and its backups were written, see DetectResource
+}
+
+const defaultStateName = ".{base}.state"
+
+type stateStore struct {
+	path string
+
+	mu sync.Mutex
+	s  RollState
+}
+
+// StateFile persists the RollState to the sidecar file at statePath, default is ".{base}.state" in the file's directory.
+//
+// The IntervalChecker resumes from the last rotation after a restart, instead of relying on the birth time
+// of the file which is unavailable on many filesystems.
+func StateFile(statePath string) Option {
+	return OptionFunc(func(r *Roll) {
+		if statePath == "" {
+			dir, base := path.Split(r.filePath)
+			statePath = path.Join(dir, strings.ReplaceAll(defaultStateName, "{base}", base))
+		}
+		r.state = &stateStore{path: statePath}
+	})
+}
+
+// State returns the rotation metadata, it is zero without the StateFile option.
+func (r *Roll) State() RollState {
+	if r.state == nil {
+		return RollState{}
+	}
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	return r.state.s
+}
+
+func (s *stateStore) load(fsys FS) error {
+	f, err := fsys.OpenFile(s.path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Unmarshal(b, &s.s)
+}
+
+// save writes the state to a temporary file then renames it, so a crash never leaves a torn state.
+func (s *stateStore) save(fsys FS, bytes int64, lastWrite time.Time) error {
+	s.mu.Lock()
+	s.s.Bytes = bytes
+	s.s.Resource = DetectResource()
+	if bytes > 0 {
+		s.s.LastWrite = lastWrite
+	}
+	b, err := json.Marshal(s.s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := fsys.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, s.path)
+}
+
+func (s *stateStore) rotated(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.LastRotation = t
+	s.s.Sequence++
+}
+
+func (s *stateStore) lastRotation() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.LastRotation
+}
+
+// loadState restores the state, the first run starts the file from its birth time or now.
+func (r *Roll) loadState() error {
+	if r.state == nil {
+		return nil
+	}
+
+	err := r.state.load(r.fs)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.IsNotExist(err) {
+		start := r.now()
+		if ok, birth := r.st.Birthtimespec(); ok && birth.Nano() > 0 {
+			start = time.Unix(birth.Unix())
+		}
+		r.state.mu.Lock()
+		r.state.s.LastRotation = start
+		r.state.mu.Unlock()
+	}
+	r.st.setBirth(r.state.lastRotation())
+	r.state.mu.Lock()
+	lastWrite := r.state.s.LastWrite
+	r.state.mu.Unlock()
+	r.st.setPriorWrite(lastWrite)
+	return r.saveState()
+}
+
+func (r *Roll) saveState() error {
+	if r.state == nil {
+		return nil
+	}
+	err := r.state.save(r.fs, r.st.Size(), r.st.ModTime())
+	if err != nil {
+		r.warn("[saveState] err: %v", err)
+	}
+	return err
+}
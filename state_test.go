@@ -0,0 +1,132 @@
+package rollingf
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStateFile(t *testing.T) {
+	mfs := NewMemFS()
+	last := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	b, _ := json.Marshal(RollState{LastRotation: last, Sequence: 7})
+	f, _ := mfs.OpenFile("/mem/.app.log.state", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Write(b)
+	f.Close()
+
+	// MemFS has no birth time, the interval resumes from the state
+	r := NewC("/mem/app.log", WithFS(mfs), StateFile("")).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	if ok, _ := IntervalChecker(time.Hour).Check(r.filePath, r.st); !ok {
+		t.Fatal("expect rolling by the persisted last rotation")
+	}
+	if st := r.State(); !st.LastRotation.Equal(last) || st.Sequence != 7 {
+		t.Fatal(st)
+	}
+
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+	r.Write([]byte("hello"))
+	if err := rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := IntervalChecker(time.Hour).Check(r.filePath, r.st); ok {
+		t.Fatal("expect the interval restarted by the rotation")
+	}
+	r.Write([]byte("world"))
+	r.Close()
+
+	var saved RollState
+	b, _ = mfs.ReadFile("/mem/.app.log.state")
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Sequence != 8 || saved.Bytes != int64(len("world")) || !saved.LastRotation.After(last) {
+		t.Fatal(saved)
+	}
+	// the origin of the backups
+	if saved.Resource != DetectResource() || saved.Resource.PID != os.Getpid() {
+		t.Fatal(saved.Resource)
+	}
+}
+
+func TestBirthSource(t *testing.T) {
+	r := NewC("/mem/app.log", WithFS(NewMemFS()))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	if ok, _ := r.st.Birthtimespec(); ok || r.st.BirthSource() != BirthNone {
+		t.Fatal(r.st.BirthSource())
+	}
+	r.Write([]byte("hello"))
+	if ok, _ := r.st.Birthtimespec(); !ok || r.st.BirthSource() != BirthFirstWrite {
+		t.Fatal(r.st.BirthSource())
+	}
+	r.Close()
+
+	r = NewC("/mem/app.log", WithFS(NewMemFS()), StateFile(""))
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	defer r.Close()
+	if ok, _ := r.st.Birthtimespec(); !ok || r.st.BirthSource() != BirthState {
+		t.Fatal(r.st.BirthSource())
+	}
+
+	r2 := NewC(t.TempDir() + "/app.log")
+	if r2 == nil {
+		t.Fatal("nil roll")
+	}
+	defer r2.Close()
+	if ok, _ := r2.st.Birthtimespec(); !ok || r2.st.BirthSource() == BirthNone {
+		t.Fatal("no birth time on disk")
+	}
+}
+
+func TestFirstWriteOfDay(t *testing.T) {
+	mfs := NewMemFS()
+	yesterday := time.Now().AddDate(0, 0, -1)
+	b, _ := json.Marshal(RollState{LastRotation: yesterday, LastWrite: yesterday})
+	f, _ := mfs.OpenFile("/mem/.app.log.state", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Write(b)
+	f.Close()
+
+	r := NewC("/mem/app.log", WithFS(mfs), StateFile("")).WithDefaultMatcher().WithDefaultProcessor()
+	if r == nil {
+		t.Fatal("nil roll")
+	}
+	if !r.st.PriorWrite().Equal(yesterday) {
+		t.Fatal(r.st.PriorWrite())
+	}
+
+	// the process slept across midnight, the first write of today rolls
+	c := FirstWriteOfDay()
+	r.Write([]byte("hello"))
+	if ok, _ := c.Check(r.filePath, r.st); !ok {
+		t.Fatal("expect rolling on the first write of the day")
+	}
+	r.Write([]byte("world"))
+	if ok, _ := c.Check(r.filePath, r.st); ok {
+		t.Fatal("unexpected rolling on the same day")
+	}
+	r.Close()
+
+	var saved RollState
+	b, _ = mfs.ReadFile("/mem/.app.log.state")
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !saved.LastWrite.After(yesterday) {
+		t.Fatal(saved)
+	}
+
+	// an empty file has no prior write
+	st := &Rstat{}
+	st.update(1)
+	if ok, _ := FirstWriteOfDay().Check("", st); ok {
+		t.Fatal("unexpected rolling of a new file")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the statistics of a Roll.
+type Stats struct {
+	Rotations    int64     // the number of the successful rotations, the failed ones are not counted
+	Failures     int64     // the number of the failed rotations
+	LastRotation time.Time // when the last rotation started
+	LastReason   string    // which checker triggered the last rotation and why
+	LastError    error     // the error of the last failed rotation
+	Dropped      int64     // the number of the records dropped by the NonBlocking mode
+	Fallbacks    int64     // the number of the records written to the sink of WithFallback
+}
+
+// recentRotations is the number of the rotations kept for DebugHandler.
+const recentRotations = 16
+
+type rollStats struct {
+	mu     sync.Mutex
+	s      Stats
+	recent []RotateEvent // the recent rotations, the oldest first
+
+	dropped   int64 // atomic, it is on the write path
+	fallbacks int64 // atomic
+}
+
+func (rs *rollStats) drop(n int64) {
+	atomic.AddInt64(&rs.dropped, n)
+}
+
+func (rs *rollStats) fallback(n int64) {
+	atomic.AddInt64(&rs.fallbacks, n)
+}
+
+func (rs *rollStats) rotated(ev RotateEvent) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.s.LastRotation = ev.Time
+	rs.s.LastReason = ev.Reason
+	if ev.Err != nil {
+		rs.s.Failures++
+		rs.s.LastError = ev.Err
+	} else {
+		rs.s.Rotations++
+	}
+
+	if len(rs.recent) == recentRotations {
+		rs.recent = append(rs.recent[:0], rs.recent[1:]...)
+	}
+	rs.recent = append(rs.recent, ev)
+}
+
+func (rs *rollStats) recentRotations() []RotateEvent {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]RotateEvent(nil), rs.recent...)
+}
+
+func (rs *rollStats) snapshot() Stats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	s := rs.s
+	s.Dropped = atomic.LoadInt64(&rs.dropped)
+	s.Fallbacks = atomic.LoadInt64(&rs.fallbacks)
+	return s
+}
+
+// Stats returns a snapshot of the statistics.
+func (r *Roll) Stats() Stats {
+	return r.stats.snapshot()
+}
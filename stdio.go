@@ -0,0 +1,101 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrStdioUnsupported is returned by CaptureStdio on the platforms or the FS which can not duplicate the fds.
+var ErrStdioUnsupported = errors.New("rollingf: capturing stdio is not supported")
+
+// fder is implemented by the files backed by a file descriptor, eg. *os.File.
+type fder interface {
+	Fd() uintptr
+}
+
+// stdioCapture keeps the standard fds pointed at the file.
+type stdioCapture struct {
+	fds   []int
+	saved []int // duplicates of the original fds, restored by Close
+}
+
+// CaptureStdio redirects os.Stdout and os.Stderr into the file by dup2, so the panics of the runtime
+// and the output of the child processes inheriting the fds are captured too.
+//
+// The fds follow the file across the rotations, and are restored by Close.
+// Only the writes of the Roll pass the interceptors and the tees, the captured output goes to the file directly.
+func (r *Roll) CaptureStdio() error {
+	r.fOpLock()
+	defer r.fOpUnlock()
+	if r.stdio != nil {
+		return nil
+	}
+	if err := r.wakeLocked(); err != nil {
+		return err
+	}
+	if r.f == nil {
+		return ErrClosed
+	}
+
+	c := &stdioCapture{}
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		fd := int(f.Fd())
+		saved, err := dupFd(fd)
+		if err != nil {
+			c.restore()
+			return fmt.Errorf("rollingf: dup %s: %w", f.Name(), err)
+		}
+		c.fds = append(c.fds, fd)
+		c.saved = append(c.saved, saved)
+	}
+
+	r.stdio = c
+	if err := r.redirectStdio(); err != nil {
+		r.stdio = nil
+		c.restore()
+		return err
+	}
+	return nil
+}
+
+// redirectStdio points the captured fds at the current file.
+func (r *Roll) redirectStdio() error {
+	if r.stdio == nil {
+		return nil
+	}
+	f, ok := r.f.(fder)
+	if !ok {
+		return ErrStdioUnsupported
+	}
+	r.debug("[redirectStdio] %v", r.stdio.fds)
+	for _, fd := range r.stdio.fds {
+		if err := redirectFd(int(f.Fd()), fd); err != nil {
+			return fmt.Errorf("rollingf: redirect fd %d: %w", fd, err)
+		}
+	}
+	return nil
+}
+
+// restore points the fds back at the original files.
+func (c *stdioCapture) restore() {
+	for i, saved := range c.saved {
+		redirectFd(saved, c.fds[i])
+		closeFd(saved)
+	}
+	c.fds, c.saved = nil, nil
+}
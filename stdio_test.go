@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package rollingf
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCaptureStdio(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := make(chan struct{}, 1)
+	r.OnRotate(func(RotateEvent) { rotated <- struct{}{} })
+
+	if err := r.CaptureStdio(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(os.Stdout, "stdout\n")
+	if err = r.roll("test"); err != nil {
+		r.Close()
+		t.Fatal(err)
+	}
+	<-rotated
+	fmt.Fprint(os.Stderr, "stderr\n")
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the debug output may be captured too
+	if b, _ := os.ReadFile(fp); !strings.Contains(string(b), "\nstderr\n") && !strings.HasPrefix(string(b), "stderr\n") {
+		t.Fatalf("file: %q", b)
+	}
+	if b, _ := os.ReadFile(fp + ".1"); !strings.HasPrefix(string(b), "stdout\n") {
+		t.Fatalf("backup: %q", b)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// symlinker is implemented by the FS which can point a symbolic link at a file.
+type symlinker interface {
+	// Symlink points link at target, replacing the existing link atomically.
+	Symlink(target, link string) error
+}
+
+var _ symlinker = osFS{}
+
+func (osFS) Symlink(target, link string) error {
+	if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("rollingf: %s exists and is not a symlink", link)
+	}
+
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// WithSymlink keeps a symbolic link at linkPath pointing at the file, eg. "current.log",
+// which gives tail -F and the log shippers a stable path.
+//
+// The link is relative if possible, so it survives the moves of the directory.
+// An existing regular file at linkPath is never replaced.
+func WithSymlink(linkPath string) Option {
+	return OptionFunc(func(r *Roll) {
+		r.symlink = linkPath
+	})
+}
+
+func (r *Roll) linkFile() error {
+	if r.symlink == "" {
+		return nil
+	}
+	s, ok := r.fs.(symlinker)
+	if !ok {
+		r.debug("[linkFile] %T does not support symlinks", r.fs)
+		return nil
+	}
+
+	target := r.filePath
+	if rel, err := filepath.Rel(path.Dir(r.symlink), r.filePath); err == nil {
+		target = rel
+	}
+	r.debug("[linkFile] %s -> %s", r.symlink, target)
+	return s.Symlink(target, r.symlink)
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TailPollInterval is how often Tail checks the end of the file for the new writes.
+var TailPollInterval = 200 * time.Millisecond
+
+const tailBufSize = 32 * 1024
+
+// tailers are the followers of the file, each rotation hands them the new file.
+type tailers struct {
+	mu     sync.Mutex
+	subs   map[*tailSub]struct{}
+	closed bool
+}
+
+// tailSub is a Tail following the file.
+type tailSub struct {
+	mu    sync.Mutex
+	next  []File // the new files opened by the rotations, to read after the current one
+	done  chan struct{}
+	close sync.Once
+}
+
+// Tail follows the logical stream of the file from its current end, across the rotations:
+// the rolled file is read to its end, then the new file from its start, so nothing is missed or repeated.
+//
+// The channel is closed when ctx is done, the Roll is closed, or reading fails. The chunks are not aligned to the records.
+func (r *Roll) Tail(ctx context.Context) (<-chan []byte, error) {
+	r.fOpLock()
+	defer r.fOpUnlock()
+	if err := r.wakeLocked(); err != nil {
+		return nil, err
+	}
+	if r.f == nil {
+		return nil, ErrClosed
+	}
+
+	f, err := r.fs.OpenFile(r.f.Name(), os.O_RDONLY, 0)
+	if os.IsNotExist(err) && r.f.Name() == r.tmpFilePath {
+		// the rolling has just renamed the temporary file back
+		f, err = r.fs.OpenFile(r.filePath, os.O_RDONLY, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = skipToEnd(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if r.tails == nil {
+		r.tails = &tailers{subs: make(map[*tailSub]struct{})}
+	}
+	sub := &tailSub{done: make(chan struct{})}
+	if !r.tails.add(sub) {
+		f.Close()
+		return nil, ErrClosed
+	}
+
+	ch := make(chan []byte)
+	go r.tail(ctx, sub, f, ch)
+	return ch, nil
+}
+
+// skipToEnd moves the offset of f to its end.
+func skipToEnd(f File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if s, ok := f.(io.Seeker); ok {
+		_, err = s.Seek(info.Size(), io.SeekStart)
+		return err
+	}
+	_, err = io.CopyN(io.Discard, f, info.Size())
+	return err
+}
+
+func (r *Roll) tail(ctx context.Context, sub *tailSub, cur File, ch chan<- []byte) {
+	defer close(ch)
+	defer func() {
+		r.tails.remove(sub)
+		cur.Close()
+		for _, f := range sub.next {
+			f.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(TailPollInterval)
+	defer ticker.Stop()
+	buf := make([]byte, tailBufSize)
+	for {
+		// the writes to cur are done once the next file shows up or the Roll is closed
+		stopped := sub.stopped()
+		next := sub.pop()
+		for {
+			n, err := cur.Read(buf)
+			if n > 0 {
+				select {
+				case ch <- append([]byte(nil), buf[:n]...):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.warn("[tail] err: %v", err)
+				return
+			}
+		}
+		if next != nil {
+			cur.Close()
+			cur = next
+			continue
+		}
+		if stopped {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.done:
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotated hands each Tail the new file, opened before it is renamed.
+func (t *tailers) rotated(fsys FS, name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for sub := range t.subs {
+		f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			debug("[tail] err: %v", err)
+			sub.stop()
+			continue
+		}
+		sub.push(f)
+	}
+}
+
+func (t *tailers) add(sub *tailSub) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.subs[sub] = struct{}{}
+	return true
+}
+
+func (t *tailers) remove(sub *tailSub) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.subs, sub)
+}
+
+// close stops the Tails after they read to the end.
+// reopen accepts the Tails again after close.
+func (t *tailers) reopen() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = false
+}
+
+func (t *tailers) close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for sub := range t.subs {
+		sub.stop()
+	}
+}
+
+func (s *tailSub) push(f File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = append(s.next, f)
+}
+
+func (s *tailSub) pop() File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.next) == 0 {
+		return nil
+	}
+	f := s.next[0]
+	s.next = s.next[1:]
+	return f
+}
+
+func (s *tailSub) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *tailSub) stop() {
+	s.close.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,60 @@
+package rollingf
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	defer func(d time.Duration) { TailPollInterval = d }(TailPollInterval)
+	TailPollInterval = time.Millisecond
+
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := make(chan struct{}, 1)
+	r.OnRotate(func(RotateEvent) { rotated <- struct{}{} })
+
+	r.Write([]byte("skipped\n"))
+	ch, err := r.Tail(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Write([]byte("a\n"))
+	r.roll("test")
+	r.Write([]byte("b\n"))
+	<-rotated
+	r.Write([]byte("c\n"))
+	r.Close()
+
+	var got []byte
+	for p := range ch {
+		got = append(got, p...)
+	}
+	if string(got) != "a\nb\nc\n" {
+		t.Fatalf("%q", got)
+	}
+}
+
+func TestTailCancel(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.Tail(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range ch {
+	}
+}
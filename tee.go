@@ -0,0 +1,82 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"io"
+	"sync"
+)
+
+// syncer is implemented by the writers which can flush to the stable storage, eg. *os.File.
+type syncer interface {
+	Sync() error
+}
+
+// WithTee writes every record to ws too, eg. os.Stdout in the containers or a network socket,
+// after the interceptors. Only the file is rolled, the errors of ws are ignored.
+//
+// Unlike io.MultiWriter, the Roll keeps its Close and Sync: Sync syncs ws too, Close leaves ws open.
+func WithTee(ws ...io.Writer) Option {
+	return OptionFunc(func(r *Roll) {
+		if r.tees == nil {
+			r.tees = &teeWriters{}
+		}
+		r.tees.ws = append(r.tees.ws, ws...)
+	})
+}
+
+type teeWriters struct {
+	mu sync.Mutex // the concurrent writes to the file are fine, but not to ws
+	ws []io.Writer
+}
+
+func (r *Roll) tee(p []byte) {
+	if r.tees == nil {
+		return
+	}
+	r.tees.mu.Lock()
+	defer r.tees.mu.Unlock()
+	for _, w := range r.tees.ws {
+		if _, err := w.Write(p); err != nil {
+			r.warn("[tee] %T err: %v", w, err)
+		}
+	}
+}
+
+// Sync commits the buffered writes and the file to the stable storage, the tee writers are synced too.
+func (r *Roll) Sync() error {
+	r.fWLock()
+	defer r.fWUnlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.flushBuffer()
+	if serr := r.f.Sync(); err == nil {
+		err = serr
+	}
+	if r.tees != nil {
+		r.tees.mu.Lock()
+		defer r.tees.mu.Unlock()
+		for _, w := range r.tees.ws {
+			if s, ok := w.(syncer); ok {
+				if serr := s.Sync(); serr != nil {
+					r.warn("[tee] %T sync err: %v", w, serr)
+				}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ io.WriteCloser = (*throttle)(nil)
+
+type throttle struct {
+	w           io.Writer
+	bytesPerSec int64
+	burst       int64
+	fraction    float64
+	clock       Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	acc    float64 // the fraction accumulated by Sample, a write is kept every time it reaches 1
+
+	discarded        int64 // atomic, the bytes shed
+	discardedRecords int64 // atomic, the writes shed
+}
+
+// Throttle sheds the writes to w over bytesPerSec, eg. the log storms of an incident, before they hit the disk
+// and churn the rollings. The writes are shed as a whole, a burst of one second is allowed by default, see WithBurst.
+//
+// The shed writes are reported as written, so the loggers never fail or retry them, they are counted by Discarded.
+// bytesPerSec <= 0 means unlimited, eg. for sampling only, see Sample.
+//
+// eg.
+//
+//	log.SetOutput(rollingf.Throttle(rf, 10*rollingf.SizeMB).WithSample(0.5))
+func Throttle(w io.Writer, bytesPerSec int64) *throttle {
+	return &throttle{
+		w:           w,
+		bytesPerSec: bytesPerSec,
+		burst:       bytesPerSec,
+		tokens:      float64(bytesPerSec),
+		fraction:    1,
+		clock:       systemClock{},
+	}
+}
+
+// Sample keeps the fraction of the writes to w and sheds the rest evenly, eg. 0.1 keeps 1 of every 10 writes.
+func Sample(w io.Writer, fraction float64) *throttle {
+	return Throttle(w, 0).WithSample(fraction)
+}
+
+// WithBurst allows n bytes written at once above the rate.
+func (t *throttle) WithBurst(n int64) *throttle {
+	if n < t.bytesPerSec {
+		n = t.bytesPerSec
+	}
+	t.burst, t.tokens = n, float64(n)
+	return t
+}
+
+// WithSample keeps the fraction of the writes passed the rate, fraction >= 1 keeps all of them.
+func (t *throttle) WithSample(fraction float64) *throttle {
+	if fraction > 1 {
+		fraction = 1
+	}
+	if fraction < 0 {
+		fraction = 0
+	}
+	t.fraction = fraction
+	return t
+}
+
+func (t *throttle) setClock(c Clock) {
+	t.clock = c
+}
+
+func (t *throttle) Write(p []byte) (int, error) {
+	if !t.allow(int64(len(p))) {
+		atomic.AddInt64(&t.discarded, int64(len(p)))
+		atomic.AddInt64(&t.discardedRecords, 1)
+		return len(p), nil
+	}
+	return t.w.Write(p)
+}
+
+// allow reports whether the write of n bytes is kept.
+func (t *throttle) allow(n int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bytesPerSec > 0 {
+		now := t.clock.Now()
+		if !t.last.IsZero() {
+			t.tokens += now.Sub(t.last).Seconds() * float64(t.bytesPerSec)
+			if t.tokens > float64(t.burst) {
+				t.tokens = float64(t.burst)
+			}
+		}
+		t.last = now
+		// a write larger than the burst passes once the bucket is full
+		if t.tokens < float64(n) && t.tokens < float64(t.burst) {
+			return false
+		}
+	}
+
+	if t.fraction < 1 {
+		t.acc += t.fraction
+		if t.acc < 1 {
+			return false
+		}
+		t.acc--
+	}
+
+	if t.bytesPerSec > 0 {
+		t.tokens -= float64(n)
+	}
+	return true
+}
+
+// Discarded returns the bytes and the number of the writes shed.
+func (t *throttle) Discarded() (bytes, writes int64) {
+	return atomic.LoadInt64(&t.discarded), atomic.LoadInt64(&t.discardedRecords)
+}
+
+// Close closes w if it is an io.Closer, eg. the Roll.
+func (t *throttle) Close() error {
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
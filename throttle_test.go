@@ -0,0 +1,56 @@
+package rollingf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	var buf bytes.Buffer
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	th := Throttle(&buf, 10)
+	th.setClock(clock)
+
+	for i := 0; i < 4; i++ {
+		if n, err := th.Write([]byte("abc")); n != 3 || err != nil {
+			t.Fatal(n, err)
+		}
+	}
+	// the burst of 10 bytes passes 3 writes
+	if buf.String() != "abcabcabc" {
+		t.Fatalf("%q", buf.String())
+	}
+	if b, w := th.Discarded(); b != 3 || w != 1 {
+		t.Fatal(b, w)
+	}
+
+	clock.Add(500 * time.Millisecond)
+	th.Write([]byte("defg"))
+	th.Write([]byte("hij"))
+	if buf.String() != "abcabcabcdefg" {
+		t.Fatalf("%q", buf.String())
+	}
+
+	// larger than the burst, passes once the bucket is full
+	clock.Add(time.Hour)
+	th.Write(bytes.Repeat([]byte("x"), 20))
+	th.Write([]byte("y"))
+	if b, w := th.Discarded(); buf.Len() != 33 || b != 7 || w != 3 {
+		t.Fatal(buf.Len(), b, w)
+	}
+}
+
+func TestSample(t *testing.T) {
+	var buf bytes.Buffer
+	s := Sample(&buf, 0.25)
+	for i := 0; i < 8; i++ {
+		s.Write([]byte{'0' + byte(i)})
+	}
+	if buf.String() != "37" {
+		t.Fatalf("%q", buf.String())
+	}
+	if b, w := s.Discarded(); b != 6 || w != 6 {
+		t.Fatal(b, w)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWriteTimeout is returned by Write when the file does not respond in the timeout of WithWriteTimeout.
+var ErrWriteTimeout = errors.New("rollingf: write timeout")
+
+type writeJob struct {
+	fn   func() (int, error)
+	done chan writeResult
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+// timeoutWriter runs the writes in a worker, so the callers can give up a hung write.
+type timeoutWriter struct {
+	timeout time.Duration
+	jobs    chan writeJob
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// WithWriteTimeout makes Write and WriteBatch return ErrWriteTimeout if the file does not respond in d,
+// eg. on a hung NFS or fuse filesystem. os.File has no deadlines, the writes are run by an internal worker,
+// the timed out one may still land in the file later.
+func WithWriteTimeout(d time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		if d <= 0 {
+			r.timeout = nil
+			return
+		}
+		r.timeout = &timeoutWriter{
+			timeout: d,
+			jobs:    make(chan writeJob),
+		}
+	})
+}
+
+func (w *timeoutWriter) run() {
+	for job := range w.jobs {
+		n, err := job.fn()
+		job.done <- writeResult{n, err}
+	}
+}
+
+// do runs fn in the worker and waits for it at most the timeout.
+func (w *timeoutWriter) do(fn func() (int, error)) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+
+	// buffered, the worker never blocks on the callers gave up
+	job := writeJob{fn: fn, done: make(chan writeResult, 1)}
+	select {
+	case w.jobs <- job:
+	case <-timer.C:
+		return 0, ErrWriteTimeout
+	}
+	select {
+	case res := <-job.done:
+		return res.n, res.err
+	case <-timer.C:
+		return 0, ErrWriteTimeout
+	}
+}
+
+func (w *timeoutWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.jobs)
+	}
+}
+
+func (r *Roll) writeTimeout(records [][]byte) (int, error) {
+	// the worker may still use the buffers after the caller gave up
+	cp := make([][]byte, len(records))
+	for i, p := range records {
+		cp[i] = append([]byte(nil), p...)
+	}
+	return r.timeout.do(func() (int, error) {
+		if len(cp) == 1 {
+			return r.write(cp[0])
+		}
+		return r.writeBatch(cp)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "context"
+
+// Tracer starts the spans around the rotation and the compression, eg. an adapter of an OpenTelemetry trace.Tracer,
+// see README for one. The module stays free of the tracing dependencies.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// The names of the spans.
+const (
+	SpanRoll     = "rollingf.roll"     // switching the writes to the new file
+	SpanProcess  = "rollingf.process"  // matching, filtering and processing the backups, a child of SpanRoll
+	SpanCompress = "rollingf.compress" // compressing a backup
+)
+
+// WithTracer traces the rotations and the compressions by t, so the slow ones show up in the traces of the application.
+func WithTracer(t Tracer) Option {
+	return OptionFunc(func(r *Roll) {
+		r.tracer = t
+		r.setup(r.processor)
+	})
+}
+
+// tracerSetter is implemented by the components tracing their work, eg. the compressor.
+type tracerSetter interface {
+	setTracer(t Tracer)
+}
+
+// startSpan starts a span by t, it is a no-op without t.
+func startSpan(ctx context.Context, t Tracer, name string) (context.Context, Span) {
+	if t == nil {
+		return ctx, nopSpan{}
+	}
+	return t.Start(ctx, name)
+}
+
+// endSpan records err if any and ends the span.
+func endSpan(s Span, err error) {
+	if err != nil {
+		s.RecordError(err)
+	}
+	s.End()
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, interface{}) {}
+func (nopSpan) RecordError(error)                {}
+func (nopSpan) End()                             {}
@@ -0,0 +1,103 @@
+package rollingf
+
+import (
+	"context"
+	"path"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type recordTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type spanKey struct{}
+
+func (t *recordTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &recordedSpan{name: name, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.name
+	}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), &recordSpan{t: t, s: s}
+}
+
+func (t *recordTracer) ended() []recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans []recordedSpan
+	for _, s := range t.spans {
+		if s.ended {
+			spans = append(spans, *s)
+		}
+	}
+	return spans
+}
+
+type recordSpan struct {
+	t *recordTracer
+	s *recordedSpan
+}
+
+func (s *recordSpan) SetAttribute(key string, value interface{}) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.s.attrs[key] = value
+}
+
+func (s *recordSpan) RecordError(err error) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.s.err = err
+}
+
+func (s *recordSpan) End() {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.s.ended = true
+}
+
+func TestTracer(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	tracer := &recordTracer{}
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), Compress(Gzip), WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{}, 1)
+	r.OnRotate(func(RotateEvent) { done <- struct{}{} })
+
+	r.Write([]byte("hello"))
+	if err = r.roll("test"); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	r.Close()
+
+	spans := tracer.ended()
+	if len(spans) != 3 {
+		t.Fatalf("%+v", spans)
+	}
+	// in the start order
+	roll, process, compress := spans[0], spans[1], spans[2]
+	if roll.name != SpanRoll || roll.attrs["rollingf.reason"] != "test" || roll.err != nil {
+		t.Errorf("%+v", roll)
+	}
+	if compress.name != SpanCompress || compress.attrs["rollingf.dst"] != fp+".1.gz" {
+		t.Errorf("%+v", compress)
+	}
+	if process.name != SpanProcess || process.parent != SpanRoll {
+		t.Errorf("%+v", process)
+	}
+}
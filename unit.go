@@ -1,6 +1,12 @@
 package rollingf
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
 
 const (
 	DurOneDay  = 24 * time.Hour
@@ -10,4 +16,141 @@ const (
 const (
 	SizeKB = 1024
 	SizeMB = 1024 * 1024
+	SizeGB = 1024 * 1024 * 1024
+	SizeTB = 1024 * 1024 * 1024 * 1024
 )
+
+// sizeUnits are the units of ParseSize, the SI forms are binary too, same as SizeKB.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   SizeKB,
+	"kb":  SizeKB,
+	"kib": SizeKB,
+	"m":   SizeMB,
+	"mb":  SizeMB,
+	"mib": SizeMB,
+	"g":   SizeGB,
+	"gb":  SizeGB,
+	"gib": SizeGB,
+	"t":   SizeTB,
+	"tb":  SizeTB,
+	"tib": SizeTB,
+}
+
+// ParseSize parses a human-friendly size to bytes, eg. "250MiB", "1.5GB", "512k" and "1024".
+//
+// The units are case-insensitive and binary, "1KB" is 1024 bytes.
+func ParseSize(s string) (int64, error) {
+	str := strings.TrimSpace(s)
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(str)
+	}
+
+	num, unit := str[:i], strings.ToLower(strings.TrimSpace(str[i:]))
+	mul, ok := sizeUnits[unit]
+	if !ok || num == "" {
+		return 0, fmt.Errorf("rollingf: invalid size %q", s)
+	}
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		return n * mul, nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("rollingf: invalid size %q", s)
+	}
+	return int64(f * float64(mul)), nil
+}
+
+// ParseAge parses a duration like time.ParseDuration, with the units "d"(day) and "w"(week) in addition,
+// eg. "30d", "1w2d" and "36h".
+func ParseAge(s string) (time.Duration, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return 0, fmt.Errorf("rollingf: invalid age %q", s)
+	}
+
+	var d time.Duration
+	for str != "" {
+		i := strings.IndexFunc(str, func(r rune) bool {
+			return !unicode.IsDigit(r) && r != '.'
+		})
+		if i <= 0 {
+			return parseDuration(s, d, str)
+		}
+		j := strings.IndexFunc(str[i:], func(r rune) bool {
+			return unicode.IsDigit(r) || r == '.'
+		})
+		if j < 0 {
+			j = len(str) - i
+		}
+
+		num, unit, rest := str[:i], str[i:i+j], str[i+j:]
+		var mul time.Duration
+		switch unit {
+		case "d":
+			mul = DurOneDay
+		case "w":
+			mul = DurOneWeek
+		default:
+			part, err := time.ParseDuration(num + unit)
+			if err != nil {
+				return 0, fmt.Errorf("rollingf: invalid age %q", s)
+			}
+			d += part
+			str = rest
+			continue
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, fmt.Errorf("rollingf: invalid age %q", s)
+		}
+		d += time.Duration(f * float64(mul))
+		str = rest
+	}
+	return d, nil
+}
+
+// parseDuration parses the rest of s by time.ParseDuration, eg. "0" and "-1h".
+func parseDuration(s string, d time.Duration, rest string) (time.Duration, error) {
+	part, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, fmt.Errorf("rollingf: invalid age %q", s)
+	}
+	return d + part, nil
+}
+
+// Size is a number of bytes, which is unmarshaled from a human-friendly text by ParseSize, eg. in the configs.
+type Size int64
+
+func (s *Size) UnmarshalText(text []byte) error {
+	n, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+	return nil
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(s), 10)), nil
+}
+
+// Age is a duration, which is unmarshaled from a human-friendly text by ParseAge, eg. in the configs.
+type Age time.Duration
+
+func (a *Age) UnmarshalText(text []byte) error {
+	d, err := ParseAge(string(text))
+	if err != nil {
+		return err
+	}
+	*a = Age(d)
+	return nil
+}
+
+func (a Age) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(a).String()), nil
+}
@@ -0,0 +1,58 @@
+package rollingf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"1024":   1024,
+		"250MiB": 250 * SizeMB,
+		"250mb":  250 * SizeMB,
+		"1.5GB":  3 * SizeGB / 2,
+		" 512k ": 512 * SizeKB,
+		"2 TiB":  2 * SizeTB,
+	} {
+		if got, err := ParseSize(s); err != nil || got != want {
+			t.Errorf("%q: %d %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "MB", "1.2.3MB", "10XB", "-1"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("%q: expect error", s)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"30d":    30 * DurOneDay,
+		"1w2d":   DurOneWeek + 2*DurOneDay,
+		"1d12h":  DurOneDay + 12*time.Hour,
+		"36h30m": 36*time.Hour + 30*time.Minute,
+		"0":      0,
+		"0.5d":   12 * time.Hour,
+	} {
+		if got, err := ParseAge(s); err != nil || got != want {
+			t.Errorf("%q: %v %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "d", "1x", "1d2"} {
+		if _, err := ParseAge(s); err == nil {
+			t.Errorf("%q: expect error", s)
+		}
+	}
+}
+
+func TestRollConfText(t *testing.T) {
+	var c RollConf
+	err := json.Unmarshal([]byte(`{"FilePath":"app.log","Interval":"1d","MaxSize":"250MiB","MaxAge":"30d","MaxBackups":5}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Interval != Age(DurOneDay) || c.MaxSize != 250*SizeMB || c.MaxAge != Age(30*DurOneDay) || c.MaxBackups != 5 {
+		t.Fatal(c)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"sync"
 )
 
 // type Compare interface {
@@ -33,22 +34,90 @@ func SetDebug(enabled bool) {
 	debugEnabled = enabled
 }
 
+var (
+	debugMu     sync.RWMutex
+	debugRoll   *Roll
+	debugLogger *log.Logger
+)
+
+// SetDebugOutput routes the debug output to filePath instead of the standard logger,
+// the file is rolled by a small fixed policy: 10MB per file and 3 backups at most.
+//
+// An empty filePath routes the debug output back to the standard logger.
+func SetDebugOutput(filePath string) error {
+	var r *Roll
+	if filePath != "" {
+		var err error
+		// quiet before the goroutines of the Roll start
+		r, err = NewCE(filePath, OptionFunc(func(r *Roll) {
+			r.quiet = true
+			r.WithChecker(MaxSizeChecker(10 * SizeMB)).
+				WithFilter(MaxBackupsFilter(3)).
+				WithDefaultMatcher().
+				WithDefaultProcessor()
+		}))
+		if err != nil {
+			return fmt.Errorf("rollingf: debug output: %w", err)
+		}
+	}
+
+	debugMu.Lock()
+	old := debugRoll
+	debugRoll = r
+	if r != nil {
+		debugLogger = log.New(r, "", log.LstdFlags)
+	} else {
+		debugLogger = nil
+	}
+	debugMu.Unlock()
+
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+func debugOutput(s string) {
+	debugMu.RLock()
+	defer debugMu.RUnlock()
+
+	if debugLogger != nil {
+		debugLogger.Output(3, s)
+		return
+	}
+	log.Output(3, s)
+}
+
 func debug(format string, args ...any) {
+	logDebug(2, format, args...)
+}
+
+// logDebug logs the debug message with the location of the caller at calldepth.
+func logDebug(calldepth int, format string, args ...any) {
 	if !debugEnabled {
 		return
 	}
-	_, f, l, _ := runtime.Caller(1)
-	log.Printf(fmt.Sprintf("%s:%d [rollingf] ", f, l)+format+"\n", args...)
+	_, f, l, _ := runtime.Caller(calldepth)
+	debugOutput(fmt.Sprintf(fmt.Sprintf("%s:%d [rollingf] ", f, l)+format, args...))
 }
 
 func debugArray(arr any, formator func(idx int) string, format string, args ...any) {
+	logDebugArray(2, arr, formator, format, args...)
+}
+
+func logDebugArray(calldepth int, arr any, formator func(idx int) string, format string, args ...any) {
 	if !debugEnabled {
 		return
 	}
-	_, f, l, _ := runtime.Caller(1)
-	pre := fmt.Sprintf("%s:%d [rollingf] ", f, l) + fmt.Sprintf(format, args...)
+	_, f, l, _ := runtime.Caller(calldepth)
+	debugOutput(fmt.Sprintf("%s:%d [rollingf] ", f, l) + fmt.Sprintf(format, args...) + entryNames(arr, formator))
+}
+
+// entryNames formats the entries of arr by formator, each preceded by a space.
+func entryNames(arr any, formator func(idx int) string) string {
+	var s string
 	for i := range arr.([]os.DirEntry) {
-		pre += fmt.Sprintf(" %s", formator(i))
+		s += fmt.Sprintf(" %s", formator(i))
 	}
-	log.Println(pre)
+	return s
 }
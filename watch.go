@@ -0,0 +1,129 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"time"
+)
+
+// WatchFile checks the file every interval, and at once on the changes of the directory where supported (inotify on Linux),
+// for the interference of the other processes: the file removed or replaced is opened again at the path,
+// the file truncated has its size reset, so the checkers see the file on disk. Each is reported by a FileTampered event.
+//
+// The file is not checked during the rollings, which move it themselves.
+func WatchFile(interval time.Duration) Option {
+	return OptionFunc(func(r *Roll) {
+		r.watchEvery = interval
+	})
+}
+
+// watchFile rechecks the file every r.watchEvery or on the notifications of the directory, until Close.
+func (r *Roll) watchFile() {
+	closed := r.closed
+	notified, stop, err := watchDir(path.Dir(r.filePath), path.Base(r.filePath))
+	if err != nil {
+		r.warn("[watchFile] %v, poll only", err)
+	}
+	defer stop()
+
+	var tick <-chan time.Time
+	if r.watchEvery > 0 {
+		ticker := time.NewTicker(r.watchEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case <-tick:
+		case <-notified:
+		}
+
+		kind, err := r.recheckFile()
+		if err != nil {
+			r.warn("[watchFile] err: %v", err)
+			r.emit(ErrorEvent{Err: err})
+			continue
+		}
+		if kind != "" {
+			r.debug("[watchFile] the file is %s", kind)
+			r.emit(FileTampered{Name: r.filePath, Kind: kind})
+		}
+	}
+}
+
+// recheckFile compares the file opened with the one at the path, and recovers from the interference.
+// It returns how the file was changed, empty if it is intact.
+func (r *Roll) recheckFile() (string, error) {
+	r.fOpLock()
+	defer r.fOpUnlock()
+	// a rolling in progress moves the file itself
+	select {
+	case r.rotateCh <- struct{}{}:
+	default:
+		return "", nil
+	}
+	defer r.releaseRotate()
+	if r.f == nil || r.f.Name() != r.filePath {
+		// closed for idling, or the last rolling failed to rename the temporary file back
+		return "", nil
+	}
+
+	cur, err := r.f.Stat()
+	if err != nil {
+		return "", err
+	}
+	info, err := r.fs.Stat(r.filePath)
+	var kind string
+	switch {
+	case os.IsNotExist(err):
+		kind = "removed"
+	case err != nil:
+		return "", err
+	case !sameFile(cur, info):
+		kind = "replaced"
+	case info.Size() < r.st.Size():
+		r.st.reset(info)
+		return "truncated", nil
+	default:
+		return "", nil
+	}
+
+	// the writes since are lost with the file
+	if err = r.flushBuffer(); err != nil {
+		return "", err
+	}
+	f, err := r.createFile(r.filePath)
+	if err != nil {
+		return "", err
+	}
+	if info, err = f.Stat(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err = r.closeFile(); err != nil {
+		r.warn("[closeFile] err: %v", err)
+	}
+	r.f = f
+	r.st.reset(info)
+	r.tails.rotated(r.fs, f.Name())
+	if err = r.redirectStdio(); err != nil {
+		r.warn("[recheckFile] err: %v", err)
+	}
+	return kind, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"bytes"
+	"syscall"
+	"unsafe"
+)
+
+// watchDir notifies the removals, the renames and the creations of name in dir by inotify.
+// The writes are not notified, the truncations are left to the polling.
+func watchDir(dir, name string) (<-chan struct{}, func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	wd, err := syscall.InotifyAddWatch(fd, dir,
+		syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_MOVED_TO|syscall.IN_CREATE|syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, func() {}, err
+	}
+
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || n <= 0 {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				if ev.Mask&syscall.IN_IGNORED != 0 {
+					// the watch is removed by stop or with the directory
+					return
+				}
+				nameb := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+				if ev.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 ||
+					string(bytes.TrimRight(nameb, "\x00")) == name {
+					select {
+					case ch <- struct{}{}:
+					default:
+					}
+				}
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+			}
+		}
+	}()
+
+	stop := func() {
+		// removing the watch queues IN_IGNORED, which wakes up the blocking read
+		if _, err := syscall.InotifyRmWatch(fd, uint32(wd)); err == nil {
+			<-done
+		}
+		syscall.Close(fd)
+	}
+	return ch, stop, nil
+}
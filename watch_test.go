@@ -0,0 +1,65 @@
+package rollingf
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWatchFileRemoved(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WatchFile(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := r.Events()
+
+	r.Write([]byte("a\n"))
+	if err = os.Remove(fp); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev != (FileTampered{Name: fp, Kind: "removed"}) {
+			t.Fatalf("%+v", ev)
+		}
+	case <-time.After(time.Second):
+		// no inotify, check at once
+		if kind, err := r.recheckFile(); err != nil || kind != "removed" {
+			t.Fatal(kind, err)
+		}
+	}
+
+	r.Write([]byte("b\n"))
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(fp); string(b) != "b\n" {
+		t.Fatalf("%q", b)
+	}
+}
+
+func TestWatchFileTruncated(t *testing.T) {
+	fp := path.Join(t.TempDir(), "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), WatchFile(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("hello\n"))
+	if err = os.Truncate(fp, 0); err != nil {
+		t.Fatal(err)
+	}
+	if kind, err := r.recheckFile(); err != nil || kind != "truncated" {
+		t.Fatal(kind, err)
+	}
+	if r.st.Size() != 0 {
+		t.Errorf("size %d", r.st.Size())
+	}
+	if kind, err := r.recheckFile(); err != nil || kind != "" {
+		t.Fatal(kind, err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// workerGroup runs the jobs with limited concurrency and keeps the first error.
+type workerGroup struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func newWorkerGroup(n int) *workerGroup {
+	if n < 1 {
+		n = 1
+	}
+	return &workerGroup{
+		sem: make(chan struct{}, n),
+	}
+}
+
+// Go runs the job once a worker is free.
+func (g *workerGroup) Go(job func() error) {
+	g.wg.Add(1)
+	g.sem <- struct{}{}
+	go func() {
+		defer func() {
+			<-g.sem
+			g.wg.Done()
+		}()
+
+		if err := job(); err != nil {
+			g.mu.Lock()
+			if g.err == nil {
+				g.err = err
+			}
+			g.mu.Unlock()
+		}
+	}()
+}
+
+// Wait waits for all the jobs, returns and clears the first error.
+func (g *workerGroup) Wait() error {
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err := g.err
+	g.err = nil
+	return err
+}
+
+// rateLimiter limits the bytes per second shared by all the readers it wraps.
+type rateLimiter struct {
+	bytesPerSec int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{
+		bytesPerSec: bytesPerSec,
+	}
+}
+
+// wait blocks until n bytes are allowed to pass or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSec))
+	d := l.next.Sub(now)
+	l.mu.Unlock()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader wraps r, reading from it is limited by l, the reads fail once ctx is done.
+func (l *rateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	chunk := 32 * SizeKB
+	if l.bytesPerSec < int64(chunk) {
+		chunk = int(l.bytesPerSec)
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l, chunk: chunk}
+}
+
+type limitedReader struct {
+	ctx   context.Context
+	r     io.Reader
+	l     *rateLimiter
+	chunk int
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > lr.chunk {
+		p = p[:lr.chunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.wait(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// ctxReader fails the reads once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
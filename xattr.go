@@ -0,0 +1,62 @@
+// Copyright 2023 ignorantshr.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollingf
+
+import "path"
+
+// xattrCopier is implemented by the FS which can copy the extended attributes between the files.
+type xattrCopier interface {
+	// CopyXattrs copies the extended attributes of src to dst, including the security labels, eg. security.selinux.
+	CopyXattrs(src, dst string) error
+}
+
+var (
+	_ xattrCopier = osFS{}
+	_ xattrCopier = (*indexFS)(nil)
+	_ xattrCopier = (*createFS)(nil)
+)
+
+// PreserveXattrs copies the extended attributes and the security labels of the backups to their compressed files,
+// since some shippers and auditd rules key off them. The renamed backups keep them anyway.
+// It must follow the Compress option. It is a no-op on the platforms other than Linux and the FS without them, eg. MemFS.
+func PreserveXattrs() Option {
+	return OptionFunc(func(r *Roll) {
+		if c, ok := r.processor.(*compressor); ok {
+			c.WithXattrs()
+		}
+	})
+}
+
+// WithXattrs copies the extended attributes of each backup to its compressed file, the compression fails if they cannot be copied.
+func (p *compressor) WithXattrs() *compressor {
+	p.xattrs = true
+	return p
+}
+
+// copyXattrs copies the extended attributes of src to dst in dir, if fsys supports them.
+func copyXattrs(fsys FS, dir, src, dst string) error {
+	if c, ok := fsOrDefault(fsys).(xattrCopier); ok {
+		return c.CopyXattrs(path.Join(dir, src), path.Join(dir, dst))
+	}
+	return nil
+}
+
+func (f *indexFS) CopyXattrs(src, dst string) error {
+	return copyXattrs(f.FS, "", src, dst)
+}
+
+func (f *createFS) CopyXattrs(src, dst string) error {
+	return copyXattrs(f.FS, "", src, dst)
+}
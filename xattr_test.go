@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package rollingf
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestPreserveXattrs(t *testing.T) {
+	dir := t.TempDir()
+	fp := path.Join(dir, "app.log")
+	r, err := NewE(NewRollConf(fp, DurOneDay, 0, 0, 2), Compress(Gzip), PreserveXattrs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = syscall.Setxattr(fp, "user.shipper", []byte("fluentd"), 0); err != nil {
+		t.Skip("no xattrs:", err)
+	}
+	events := make(chan RotateEvent, 1)
+	r.OnRotate(func(ev RotateEvent) { events <- ev })
+
+	r.Write([]byte("a\n"))
+	if err = rollSync(t, r, events); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(fp + ".1"); !os.IsNotExist(err) {
+		t.Error("not compressed", err)
+	}
+	value, err := getXattr(fp+".1.gz", "user.shipper")
+	if err != nil || string(value) != "fluentd" {
+		t.Fatalf("%q %v", value, err)
+	}
+}